@@ -61,8 +61,8 @@ func (a *App) GetBillsByDateRange(startDate, endDate time.Time, pageNum, pageSiz
 
 // ========== Statistics API Bindings ==========
 
-// GetStats retrieves overall usage statistics (IPC_03: 添加period参数)
-func (a *App) GetStats(startDate, endDate *time.Time, period string) (*models.StatsResponse, error) {
+// GetStats retrieves overall usage statistics (IPC_03: 添加period参数); accountID 0 includes all accounts
+func (a *App) GetStats(startDate, endDate *time.Time, period string, accountID int) (*models.StatsResponse, error) {
 	// 参数验证
 	if period != "" {
 		// 验证period参数的有效性
@@ -80,7 +80,7 @@ func (a *App) GetStats(startDate, endDate *time.Time, period string) (*models.St
 		}
 	}
 
-	result, err := a.apiService.GetStats(startDate, endDate, period)
+	result, err := a.apiService.GetStats(startDate, endDate, period, accountID)
 	if err != nil {
 		return nil, services.WrapError(err, services.ErrorTypeAPI, services.ErrCodeAPIInvalidResponse, "Failed to retrieve statistics")
 	}
@@ -89,23 +89,384 @@ func (a *App) GetStats(startDate, endDate *time.Time, period string) (*models.St
 }
 
 // GetHourlyUsage retrieves hourly usage statistics
-func (a *App) GetHourlyUsage(hours int) ([]models.HourlyUsageData, error) {
-	return a.apiService.GetHourlyUsage(hours)
+func (a *App) GetHourlyUsage(hours, accountID int) ([]models.HourlyUsageData, error) {
+	return a.apiService.GetHourlyUsage(hours, accountID)
 }
 
 // GetModelDistribution retrieves usage distribution by model
-func (a *App) GetModelDistribution(startDate, endDate *time.Time) ([]models.ModelDistributionData, error) {
-	return a.apiService.GetModelDistribution(startDate, endDate)
+func (a *App) GetModelDistribution(startDate, endDate *time.Time, accountID int) ([]models.ModelDistributionData, error) {
+	return a.apiService.GetModelDistribution(startDate, endDate, accountID)
+}
+
+// GetAPIKeyDistribution retrieves usage distribution by API key (keys are masked)
+func (a *App) GetAPIKeyDistribution(startDate, endDate *time.Time, accountID int) ([]models.APIKeyDistributionData, error) {
+	return a.apiService.GetAPIKeyDistribution(startDate, endDate, accountID)
+}
+
+// GetAPIKeyTrend retrieves daily usage trend of a single API key
+func (a *App) GetAPIKeyTrend(key string, days, accountID int) ([]models.APIKeyTrendData, error) {
+	return a.apiService.GetAPIKeyTrend(key, days, accountID)
+}
+
+// ComparePeriods compares usage between two custom periods
+func (a *App) ComparePeriods(currentStart, currentEnd, previousStart, previousEnd time.Time, accountID int) (*models.PeriodComparison, error) {
+	return a.apiService.ComparePeriods(currentStart, currentEnd, previousStart, previousEnd, accountID)
+}
+
+// ComparePeriodPreset compares usage using a preset (week_over_week, month_over_month, same_day_last_week)
+func (a *App) ComparePeriodPreset(preset string, accountID int) (*models.PeriodComparison, error) {
+	return a.apiService.ComparePeriodPreset(preset, accountID)
 }
 
 // GetRecentUsage retrieves recent usage records
-func (a *App) GetRecentUsage(limit int) ([]models.ExpenseBill, error) {
-	return a.apiService.GetRecentUsage(limit)
+func (a *App) GetRecentUsage(limit, accountID int) ([]models.ExpenseBill, error) {
+	return a.apiService.GetRecentUsage(limit, accountID)
 }
 
 // GetUsageTrend retrieves usage trend data
-func (a *App) GetUsageTrend(days int) ([]models.HourlyUsageData, error) {
-	return a.apiService.GetUsageTrend(days)
+func (a *App) GetUsageTrend(days, accountID int) ([]models.HourlyUsageData, error) {
+	return a.apiService.GetUsageTrend(days, accountID)
+}
+
+// QueryUsage aggregates usage by arbitrary dimensions and metrics
+func (a *App) QueryUsage(query models.UsageQuery) (*models.UsageQueryResult, error) {
+	return a.apiService.QueryUsage(query)
+}
+
+// GetUsageHeatmap returns a 7×24 day-of-week × hour matrix of calls, tokens or cost
+func (a *App) GetUsageHeatmap(startDate, endDate *time.Time, metric string, modelNames, apiKeys []string, accountIDs []int) (*models.UsageHeatmap, error) {
+	return a.apiService.GetUsageHeatmap(startDate, endDate, metric, modelNames, apiKeys, accountIDs)
+}
+
+// ========== Anomaly Detection API Bindings ==========
+
+// DetectUsageAnomalies runs usage anomaly detection immediately
+func (a *App) DetectUsageAnomalies() ([]models.UsageAnomaly, error) {
+	return a.apiService.DetectUsageAnomalies()
+}
+
+// GetUsageAnomalies retrieves recently detected usage anomalies
+func (a *App) GetUsageAnomalies(limit int) ([]models.UsageAnomaly, error) {
+	return a.apiService.GetUsageAnomalies(limit)
+}
+
+// ========== Membership Tier Detection API Bindings ==========
+
+// GetTierDetectionRules retrieves the rules used to detect the membership tier
+func (a *App) GetTierDetectionRules() ([]models.TierDetectionRule, error) {
+	return a.apiService.GetTierDetectionRules()
+}
+
+// SaveTierDetectionRule creates or updates a tier detection rule
+func (a *App) SaveTierDetectionRule(rule models.TierDetectionRule) (*models.TierDetectionRule, error) {
+	return a.apiService.SaveTierDetectionRule(rule)
+}
+
+// DeleteTierDetectionRule deletes a tier detection rule
+func (a *App) DeleteTierDetectionRule(id int) error {
+	return a.apiService.DeleteTierDetectionRule(id)
+}
+
+// GetMembershipTierHistory retrieves the timeline of detected membership tier changes
+func (a *App) GetMembershipTierHistory() ([]models.MembershipTierChange, error) {
+	return a.apiService.GetMembershipTierHistory()
+}
+
+// RefreshMembershipTierHistory re-detects the membership tier timeline from all bills
+func (a *App) RefreshMembershipTierHistory() ([]models.MembershipTierChange, error) {
+	return a.apiService.RefreshMembershipTierHistory()
+}
+
+// ========== Membership Tier Catalogue API Bindings ==========
+
+// GetMembershipTierCatalogue retrieves all tiers of the catalogue
+func (a *App) GetMembershipTierCatalogue() ([]models.MembershipTierLimit, error) {
+	return a.apiService.GetMembershipTierCatalogue()
+}
+
+// GetMembershipTierLimit retrieves a single tier of the catalogue
+func (a *App) GetMembershipTierLimit(tierName string) (*models.MembershipTierLimit, error) {
+	return a.apiService.GetMembershipTierLimit(tierName)
+}
+
+// SaveMembershipTierLimit creates or updates a tier of the catalogue
+func (a *App) SaveMembershipTierLimit(limit models.MembershipTierLimit) error {
+	return a.apiService.SaveMembershipTierLimit(limit)
+}
+
+// DeleteMembershipTierLimit deletes a tier from the catalogue
+func (a *App) DeleteMembershipTierLimit(tierName string) error {
+	return a.apiService.DeleteMembershipTierLimit(tierName)
+}
+
+// ExportMembershipTierCatalogue exports the tier catalogue as JSON
+func (a *App) ExportMembershipTierCatalogue() (string, error) {
+	return a.apiService.ExportMembershipTierCatalogue()
+}
+
+// ImportMembershipTierCatalogue imports tiers from JSON, optionally replacing the whole catalogue
+func (a *App) ImportMembershipTierCatalogue(data string, replace bool) (int, error) {
+	return a.apiService.ImportMembershipTierCatalogue(data, replace)
+}
+
+// ========== Quota Tracking API Bindings ==========
+
+// GetQuotaStatus retrieves the rolling-window quota usage of each active account's tier
+func (a *App) GetQuotaStatus() ([]*models.QuotaStatus, error) {
+	return a.apiService.GetQuotaStatus()
+}
+
+// ========== Work Session API Bindings ==========
+
+// GetSessions reconstructs work sessions from bill timestamps
+func (a *App) GetSessions(filter models.SessionFilter) ([]models.UsageSession, error) {
+	return a.apiService.GetSessions(filter)
+}
+
+// GetSessionStats returns session-level statistics
+func (a *App) GetSessionStats(filter models.SessionFilter) (*models.SessionStats, error) {
+	return a.apiService.GetSessionStats(filter)
+}
+
+// GetSessionIdleGap returns the session idle gap in minutes
+func (a *App) GetSessionIdleGap() int {
+	return a.apiService.GetSessionIdleGap()
+}
+
+// SetSessionIdleGap sets the session idle gap in minutes
+func (a *App) SetSessionIdleGap(minutes int) error {
+	return a.apiService.SetSessionIdleGap(minutes)
+}
+
+// ========== Budget API Bindings ==========
+
+// GetBudgets returns all budgets
+func (a *App) GetBudgets() ([]models.Budget, error) {
+	return a.apiService.GetBudgets()
+}
+
+// SaveBudget creates or updates a budget
+func (a *App) SaveBudget(budget models.Budget) (*models.Budget, error) {
+	return a.apiService.SaveBudget(budget)
+}
+
+// DeleteBudget deletes a budget
+func (a *App) DeleteBudget(id int) error {
+	return a.apiService.DeleteBudget(id)
+}
+
+// GetBudgetStatuses returns the current-period progress of every budget
+func (a *App) GetBudgetStatuses() ([]models.BudgetStatus, error) {
+	return a.apiService.GetBudgetStatuses()
+}
+
+// ========== Alert Rule API Bindings ==========
+
+// GetAlertRules returns all alert rules
+func (a *App) GetAlertRules() ([]models.AlertRule, error) {
+	return a.apiService.GetAlertRules()
+}
+
+// SaveAlertRule creates or updates an alert rule
+func (a *App) SaveAlertRule(rule models.AlertRule) (*models.AlertRule, error) {
+	return a.apiService.SaveAlertRule(rule)
+}
+
+// DeleteAlertRule deletes an alert rule
+func (a *App) DeleteAlertRule(id int) error {
+	return a.apiService.DeleteAlertRule(id)
+}
+
+// GetAlertEvents returns recent alert events; ruleID 0 means all rules
+func (a *App) GetAlertEvents(ruleID, limit int) ([]models.AlertEvent, error) {
+	return a.apiService.GetAlertEvents(ruleID, limit)
+}
+
+// EvaluateAlertRules evaluates all alert rules immediately
+func (a *App) EvaluateAlertRules() ([]models.AlertEvent, error) {
+	return a.apiService.EvaluateAlertRules()
+}
+
+// ========== Usage Digest API Bindings ==========
+
+// GetDigestSchedules returns all digest schedules
+func (a *App) GetDigestSchedules() ([]models.DigestSchedule, error) {
+	return a.apiService.GetDigestSchedules()
+}
+
+// SaveDigestSchedule creates or updates a digest schedule
+func (a *App) SaveDigestSchedule(schedule models.DigestSchedule) (*models.DigestSchedule, error) {
+	return a.apiService.SaveDigestSchedule(schedule)
+}
+
+// DeleteDigestSchedule deletes a digest schedule
+func (a *App) DeleteDigestSchedule(id int) error {
+	return a.apiService.DeleteDigestSchedule(id)
+}
+
+// GenerateDigest generates and sends a daily or weekly digest immediately
+func (a *App) GenerateDigest(kind string) (*models.UsageDigest, error) {
+	return a.apiService.GenerateDigest(kind)
+}
+
+// GetUsageDigests returns the most recent digests
+func (a *App) GetUsageDigests(limit int) ([]models.UsageDigest, error) {
+	return a.apiService.GetUsageDigests(limit)
+}
+
+// GetUsageDigest returns a past digest by ID
+func (a *App) GetUsageDigest(id int) (*models.UsageDigest, error) {
+	return a.apiService.GetUsageDigest(id)
+}
+
+// ========== Notification Center API Bindings ==========
+
+// GetNotifications returns a page of notifications filtered by type, category, read state or date range
+func (a *App) GetNotifications(filter models.NotificationFilter) (*models.PaginatedResult, error) {
+	return a.apiService.GetNotifications(filter)
+}
+
+// GetNotificationsByType returns all notifications of a type (0=info, 1=success, 2=warning, 3=error)
+func (a *App) GetNotificationsByType(notificationType int) ([]services.Notification, error) {
+	return a.apiService.GetNotificationsByType(notificationType)
+}
+
+// GetNotificationsByDateRange returns notifications last seen within the date range
+func (a *App) GetNotificationsByDateRange(start, end time.Time) ([]services.Notification, error) {
+	return a.apiService.GetNotificationsByDateRange(start, end)
+}
+
+// GetUnreadNotificationCount returns the number of unread notifications
+func (a *App) GetUnreadNotificationCount() (int, error) {
+	return a.apiService.GetUnreadNotificationCount()
+}
+
+// MarkNotificationRead marks a notification as read
+func (a *App) MarkNotificationRead(id int) error {
+	return a.apiService.MarkNotificationRead(id)
+}
+
+// MarkAllNotificationsRead marks all notifications as read
+func (a *App) MarkAllNotificationsRead() error {
+	return a.apiService.MarkAllNotificationsRead()
+}
+
+// DeleteNotification deletes a notification
+func (a *App) DeleteNotification(id int) error {
+	return a.apiService.DeleteNotification(id)
+}
+
+// ClearNotifications deletes all notifications
+func (a *App) ClearNotifications() error {
+	return a.apiService.ClearNotifications()
+}
+
+// ExportNotifications exports all notifications as JSON
+func (a *App) ExportNotifications() (string, error) {
+	return a.apiService.ExportNotifications()
+}
+
+// GetNotificationTTL returns the notification retention in days
+func (a *App) GetNotificationTTL() int {
+	return a.apiService.GetNotificationTTL()
+}
+
+// SetNotificationTTL sets the notification retention in days
+func (a *App) SetNotificationTTL(days int) error {
+	return a.apiService.SetNotificationTTL(days)
+}
+
+// ========== Notification Channel API Bindings ==========
+
+// GetNotificationChannels returns all notification channels
+func (a *App) GetNotificationChannels() ([]models.NotificationChannel, error) {
+	return a.apiService.GetNotificationChannels()
+}
+
+// SaveNotificationChannel creates or updates a notification channel
+func (a *App) SaveNotificationChannel(channel models.NotificationChannel) (*models.NotificationChannel, error) {
+	return a.apiService.SaveNotificationChannel(channel)
+}
+
+// DeleteNotificationChannel deletes a notification channel
+func (a *App) DeleteNotificationChannel(id int) error {
+	return a.apiService.DeleteNotificationChannel(id)
+}
+
+// TestNotificationChannel sends a test notification to a channel
+func (a *App) TestNotificationChannel(id int) (*models.NotificationDelivery, error) {
+	return a.apiService.TestNotificationChannel(id)
+}
+
+// GetNotificationDeliveries returns the delivery log; channelID 0 means all channels
+func (a *App) GetNotificationDeliveries(channelID, limit int) ([]models.NotificationDelivery, error) {
+	return a.apiService.GetNotificationDeliveries(channelID, limit)
+}
+
+// ========== Subscription Savings API Bindings ==========
+
+// GetSubscriptionSavings retrieves the subscription vs pay-as-you-go savings per month and billing cycle
+func (a *App) GetSubscriptionSavings(startDate, endDate *time.Time) (*models.SubscriptionSavingsReport, error) {
+	return a.apiService.GetSubscriptionSavings(startDate, endDate)
+}
+
+// ========== Price Catalogue API Bindings ==========
+
+// GetModelPrices retrieves the model price catalogue
+func (a *App) GetModelPrices() ([]models.ModelPrice, error) {
+	return a.apiService.GetModelPrices()
+}
+
+// SaveModelPrice creates or updates a model price
+func (a *App) SaveModelPrice(price models.ModelPrice) (*models.ModelPrice, error) {
+	return a.apiService.SaveModelPrice(price)
+}
+
+// DeleteModelPrice deletes a model price
+func (a *App) DeleteModelPrice(id int) error {
+	return a.apiService.DeleteModelPrice(id)
+}
+
+// VerifyBilledCosts checks the month's bills against the price catalogue
+func (a *App) VerifyBilledCosts(billingMonth string, absTolerance, relTolerance float64) (*models.CostVerificationReport, error) {
+	return a.apiService.VerifyBilledCosts(billingMonth, absTolerance, relTolerance)
+}
+
+// ========== Cost Allocation API Bindings ==========
+
+// GetGroupUsageReport retrieves usage per group ("group" or "use_group")
+func (a *App) GetGroupUsageReport(startDate, endDate *time.Time, groupType string) ([]models.GroupUsageData, error) {
+	return a.apiService.GetGroupUsageReport(startDate, endDate, groupType)
+}
+
+// GetCostCenterChargeback retrieves the monthly cost rolled up by cost center
+func (a *App) GetCostCenterChargeback(billingMonth, groupType string) ([]models.CostCenterChargeback, error) {
+	return a.apiService.GetCostCenterChargeback(billingMonth, groupType)
+}
+
+// GetCostAllocationTable retrieves the monthly chargeback table
+func (a *App) GetCostAllocationTable(billingMonth, groupType string) (*models.ReportTable, error) {
+	return a.apiService.GetCostAllocationTable(billingMonth, groupType)
+}
+
+// ExportCostAllocationCSV exports the monthly chargeback table as CSV
+func (a *App) ExportCostAllocationCSV(billingMonth, groupType string) (string, error) {
+	return a.apiService.ExportCostAllocationCSV(billingMonth, groupType)
+}
+
+// GetGroupCostCenters retrieves all group to cost center mappings
+func (a *App) GetGroupCostCenters() ([]models.GroupCostCenter, error) {
+	return a.apiService.GetGroupCostCenters()
+}
+
+// SaveGroupCostCenter creates or updates the cost center of a group
+func (a *App) SaveGroupCostCenter(groupID, groupName, costCenter, description string) error {
+	return a.apiService.SaveGroupCostCenter(groupID, groupName, costCenter, description)
+}
+
+// DeleteGroupCostCenter removes the cost center mapping of a group
+func (a *App) DeleteGroupCostCenter(groupID string) error {
+	return a.apiService.DeleteGroupCostCenter(groupID)
 }
 
 // ========== Token Management API Bindings ==========
@@ -128,6 +489,11 @@ func (a *App) SaveToken(tokenName, tokenValue string) error {
 	return nil
 }
 
+// AddAccountToken adds the API token of another account to sync
+func (a *App) AddAccountToken(tokenName, tokenValue string) (int, error) {
+	return a.apiService.AddAccountToken(tokenValue, tokenName)
+}
+
 // GetToken retrieves the active API token
 func (a *App) GetToken() (*models.APIToken, error) {
 	token, err := a.apiService.GetToken()
@@ -147,6 +513,67 @@ func (a *App) DeleteToken(id int) error {
 	return a.apiService.DeleteToken(id)
 }
 
+// SetTokenExpiry sets or clears the expiry time of an API token
+func (a *App) SetTokenExpiry(id int, expiresAt *time.Time) error {
+	return a.apiService.SetTokenExpiry(id, expiresAt)
+}
+
+// GetTokenHealth returns the expiry state of every API token
+func (a *App) GetTokenHealth() ([]models.TokenHealth, error) {
+	return a.apiService.GetTokenHealth()
+}
+
+// CheckTokenExpiry checks token expiry immediately
+func (a *App) CheckTokenExpiry() ([]models.TokenHealth, error) {
+	return a.apiService.CheckTokenExpiry()
+}
+
+// GetTokenEncryptionStatus returns the token encryption key source and lock state
+func (a *App) GetTokenEncryptionStatus() map[string]interface{} {
+	return a.apiService.GetTokenEncryptionStatus()
+}
+
+// UnlockTokens unlocks passphrase-encrypted tokens
+func (a *App) UnlockTokens(passphrase string) error {
+	return a.apiService.UnlockTokens(passphrase)
+}
+
+// SetTokenPassphrase re-encrypts tokens with a passphrase, or with the key file if empty
+func (a *App) SetTokenPassphrase(passphrase string) error {
+	return a.apiService.SetTokenPassphrase(passphrase)
+}
+
+// RotateToken replaces the active API token after validating it against the billing API;
+// force confirms a rotation whose account cannot be verified
+func (a *App) RotateToken(newValue string, force bool) (*models.TokenRotation, error) {
+	return a.apiService.RotateToken(newValue, force)
+}
+
+// RotateAccountToken replaces the API token of an account
+func (a *App) RotateAccountToken(tokenID int, newValue string, force bool) (*models.TokenRotation, error) {
+	return a.apiService.RotateAccountToken(tokenID, newValue, force)
+}
+
+// RollbackTokenRotation restores the previous token of a rotation within its grace period
+func (a *App) RollbackTokenRotation(rotationID int) (*models.TokenRotation, error) {
+	return a.apiService.RollbackTokenRotation(rotationID)
+}
+
+// GetTokenRotations returns the token rotation audit trail
+func (a *App) GetTokenRotations(limit int) ([]models.TokenRotation, error) {
+	return a.apiService.GetTokenRotations(limit)
+}
+
+// GetRedactionPatterns returns the configured secret patterns
+func (a *App) GetRedactionPatterns() []string {
+	return a.apiService.GetRedactionPatterns()
+}
+
+// SetRedactionPatterns sets additional secret patterns masked in logs, errors and notifications
+func (a *App) SetRedactionPatterns(patterns []string) error {
+	return a.apiService.SetRedactionPatterns(patterns)
+}
+
 // ValidateToken validates an API token
 func (a *App) ValidateToken(token string) error {
 	return a.apiService.ValidateToken(token)
@@ -265,6 +692,16 @@ func (a *App) SetConfig(key, value, description string) error {
 	return a.apiService.SetConfig(key, value, description)
 }
 
+// GetReportingTimezone returns the timezone used for daily, weekly and monthly statistics
+func (a *App) GetReportingTimezone() string {
+	return a.apiService.GetReportingTimezone()
+}
+
+// SetReportingTimezone sets the reporting timezone (IANA name, e.g. Asia/Shanghai)
+func (a *App) SetReportingTimezone(timezone string) error {
+	return a.apiService.SetReportingTimezone(timezone)
+}
+
 // GetAllConfigs retrieves all configuration values
 func (a *App) GetAllConfigs() ([]models.AutoSyncConfig, error) {
 	return a.apiService.GetAllConfigs()
@@ -6,8 +6,6 @@ import (
 	"glm-usage-monitor/models"
 	"glm-usage-monitor/services"
 	"log"
-	"math"
-	"strconv"
 	"time"
 )
 
@@ -58,6 +56,15 @@ func (a *App) startup(ctx context.Context) {
 		log.Println("Cleaned up stale sync records on startup")
 	}
 
+	// 启动告警规则定时评估
+	a.apiService.StartAlertEngine()
+
+	// 启动用量摘要定时生成
+	a.apiService.StartDigestScheduler()
+
+	// 启动API令牌过期检查（启动时及每日）
+	a.apiService.StartTokenMonitor()
+
 	log.Printf("DEBUG: Application startup completed successfully")
 }
 
@@ -91,6 +98,12 @@ func (a *App) cleanupAllRunningSyncs() error {
 
 // shutdown is called when the app is about to close
 func (a *App) shutdown(ctx context.Context) {
+	if a.apiService != nil {
+		a.apiService.StopAlertEngine()
+		a.apiService.StopDigestScheduler()
+		a.apiService.StopTokenMonitor()
+	}
+
 	if a.database != nil {
 		if err := a.database.Close(); err != nil {
 			log.Printf("Error closing database: %v", err)
@@ -117,281 +130,156 @@ func (a *App) GetAPIService() *services.APIService {
 
 // ========== Frontend API Methods ==========
 
-// GetApiUsageProgress returns API usage progress with growth rate
+// GetApiUsageProgress returns today's API usage progress with growth rate
 func (a *App) GetApiUsageProgress() (map[string]interface{}, error) {
-	// IPC_05: 从动态配置获取限制，移除硬编码
-	// 从配置服务获取每日限制
-	dailyLimit := a.getDynamicDailyLimit()
-
-	result := map[string]interface{}{
-		"percentage": 0,
-		"used":       0,
-		"limit":      dailyLimit,
-		"remaining":  dailyLimit,
-		"growthRate": 0.0,
+	progress, err := a.apiService.GetApiUsageProgress()
+	if err != nil {
+		return nil, err
 	}
 
-	// Get recent usage for the last hour
-	usage, err := a.apiService.GetRecentUsage(1)
-	if err != nil {
-		return result, err
+	used := progress["daily_usage"].(int)
+	limit := progress["daily_limit"].(float64)
+	remaining := 0
+	if limit > float64(used) {
+		remaining = int(limit) - used
 	}
 
-	if len(usage) > 0 {
-		// Use charge_count as a proxy for API usage count
-		apiUsage := int(usage[0].ChargeCount)
-		result["used"] = apiUsage
-		result["percentage"] = int(float64(apiUsage) / float64(result["limit"].(int)) * 100)
-		result["remaining"] = result["limit"].(int) - apiUsage
-
-		// Calculate growth rate by comparing with previous hour (simplified approach)
-		if len(usage) > 0 {
-			// Get usage from the previous 2 hours to calculate trend
-			previousUsage, err := a.apiService.GetHourlyUsage(2)
-			if err == nil && len(previousUsage) >= 2 {
-				currentUsage := float64(apiUsage)
-				prevHourUsage := float64(previousUsage[1].CallCount) // Previous hour data
-
-				if prevHourUsage > 0 {
-					growthRate := ((currentUsage - prevHourUsage) / prevHourUsage) * 100
-					result["growthRate"] = math.Round(growthRate*100) / 100
-				} else if currentUsage > 0 {
-					// Growth from zero
-					result["growthRate"] = 100.0
-				} else {
-					// No usage in either period
-					result["growthRate"] = 0.0
-				}
-			} else {
-				// If insufficient data, assume moderate growth
-				result["growthRate"] = 5.0
-			}
-		}
+	result := map[string]interface{}{
+		"percentage": int(progress["daily_percentage"].(float64)),
+		"used":       used,
+		"limit":      int(limit),
+		"remaining":  remaining,
+		"growthRate": progress["growthRate"],
 	}
 
 	return result, nil
 }
 
-// GetTokenUsageProgress returns token usage progress with growth rate
+// GetTokenUsageProgress returns today's token usage progress with growth rate
 func (a *App) GetTokenUsageProgress() (map[string]interface{}, error) {
-	result := map[string]interface{}{
-		"used":       0,
-		"growthRate": 0.0,
-	}
-
-	// Get recent usage for the last hour
-	usage, err := a.apiService.GetRecentUsage(1)
+	progress, err := a.apiService.GetTokenUsageProgress()
 	if err != nil {
-		return result, err
+		return nil, err
 	}
 
-	if len(usage) > 0 {
-		currentTokenUsage := usage[0].ChargeUnit
-		result["used"] = currentTokenUsage
-
-		// Calculate growth rate by comparing with previous hour
-		previousUsage, err := a.apiService.GetHourlyUsage(2)
-		if err == nil && len(previousUsage) >= 2 {
-			prevHourTokenUsage := previousUsage[1].TokenUsage
-
-			if prevHourTokenUsage > 0 {
-				growthRate := ((currentTokenUsage - prevHourTokenUsage) / prevHourTokenUsage) * 100
-				result["growthRate"] = math.Round(growthRate*100) / 100
-			} else if currentTokenUsage > 0 {
-				// Growth from zero
-				result["growthRate"] = 100.0
-			} else {
-				// No usage in either period
-				result["growthRate"] = 0.0
-			}
-		} else {
-			// If insufficient data, assume moderate growth
-			result["growthRate"] = 8.0
-		}
+	result := map[string]interface{}{
+		"used":       progress["daily_usage"],
+		"percentage": progress["daily_percentage"],
+		"growthRate": progress["growthRate"],
 	}
 
 	return result, nil
 }
 
-// GetTotalCostProgress returns total cost progress with growth rate
+// GetTotalCostProgress returns today's cost progress with growth rate
 func (a *App) GetTotalCostProgress() (map[string]interface{}, error) {
-	result := map[string]interface{}{
-		"used":       0.0,
-		"growthRate": 0.0,
-	}
-
-	// Get recent usage for the last hour
-	usage, err := a.apiService.GetRecentUsage(1)
+	progress, err := a.apiService.GetTotalCostProgress()
 	if err != nil {
-		return result, err
+		return nil, err
 	}
 
-	if len(usage) > 0 {
-		currentCost := usage[0].CashCost
-		result["used"] = currentCost
-
-		// Calculate growth rate by comparing with previous hour
-		previousUsage, err := a.apiService.GetHourlyUsage(2)
-		if err == nil && len(previousUsage) >= 2 {
-			prevHourCost := previousUsage[1].CashCost
-
-			if prevHourCost > 0 {
-				growthRate := ((currentCost - prevHourCost) / prevHourCost) * 100
-				result["growthRate"] = math.Round(growthRate*100) / 100
-			} else if currentCost > 0 {
-				// Growth from zero
-				result["growthRate"] = 100.0
-			} else {
-				// No usage in either period
-				result["growthRate"] = 0.0
-			}
-		} else {
-			// If insufficient data, assume moderate growth
-			result["growthRate"] = 3.0
-		}
+	result := map[string]interface{}{
+		"used":       progress["daily_usage"],
+		"percentage": progress["daily_percentage"],
+		"growthRate": progress["growthRate"],
 	}
 
 	return result, nil
 }
 
-// GetDayApiUsage returns API usage for the last day
+// GetDayApiUsage returns API usage of today in the reporting timezone
 func (a *App) GetDayApiUsage() (int, error) {
-	usage, err := a.apiService.GetRecentUsage(24)
+	totals, err := a.apiService.GetRecentDaysTotals(1)
 	if err != nil {
 		return 0, err
 	}
 
-	total := 0
-	for _, record := range usage {
-		total += int(record.ChargeCount)
-	}
-
-	return total, nil
+	return totals.CallCount, nil
 }
 
-// GetDayTokenUsage returns token usage for the last day
+// GetDayTokenUsage returns token usage of today in the reporting timezone
 func (a *App) GetDayTokenUsage() (int, error) {
-	usage, err := a.apiService.GetRecentUsage(24)
+	totals, err := a.apiService.GetRecentDaysTotals(1)
 	if err != nil {
 		return 0, err
 	}
 
-	total := 0
-	for _, record := range usage {
-		total += int(record.ChargeUnit)
-	}
-
-	return total, nil
+	return int(totals.TokenUsage), nil
 }
 
-// GetDayTotalCost returns total cost for the last day
+// GetDayTotalCost returns total cost of today in the reporting timezone
 func (a *App) GetDayTotalCost() (float64, error) {
-	usage, err := a.apiService.GetRecentUsage(24)
+	totals, err := a.apiService.GetRecentDaysTotals(1)
 	if err != nil {
 		return 0.0, err
 	}
 
-	total := 0.0
-	for _, record := range usage {
-		total += record.CashCost
-	}
-
-	return total, nil
+	return totals.CashCost, nil
 }
 
-// GetWeekApiUsage returns API usage for the last week
+// GetWeekApiUsage returns API usage of the last 7 days in the reporting timezone
 func (a *App) GetWeekApiUsage() (int, error) {
-	usage, err := a.apiService.GetRecentUsage(168) // 7 days * 24 hours
+	totals, err := a.apiService.GetRecentDaysTotals(7)
 	if err != nil {
 		return 0, err
 	}
 
-	total := 0
-	for _, record := range usage {
-		total += int(record.ChargeCount)
-	}
-
-	return total, nil
+	return totals.CallCount, nil
 }
 
-// GetWeekTokenUsage returns token usage for the last week
+// GetWeekTokenUsage returns token usage of the last 7 days in the reporting timezone
 func (a *App) GetWeekTokenUsage() (int, error) {
-	usage, err := a.apiService.GetRecentUsage(168) // 7 days * 24 hours
+	totals, err := a.apiService.GetRecentDaysTotals(7)
 	if err != nil {
 		return 0, err
 	}
 
-	total := 0
-	for _, record := range usage {
-		total += int(record.ChargeUnit)
-	}
-
-	return total, nil
+	return int(totals.TokenUsage), nil
 }
 
-// GetWeekTotalCost returns total cost for the last week
+// GetWeekTotalCost returns total cost of the last 7 days in the reporting timezone
 func (a *App) GetWeekTotalCost() (float64, error) {
-	usage, err := a.apiService.GetRecentUsage(168) // 7 days * 24 hours
+	totals, err := a.apiService.GetRecentDaysTotals(7)
 	if err != nil {
 		return 0.0, err
 	}
 
-	total := 0.0
-	for _, record := range usage {
-		total += record.CashCost
-	}
-
-	return total, nil
+	return totals.CashCost, nil
 }
 
-// GetMonthApiUsage returns API usage for the last month
+// GetMonthApiUsage returns API usage of the last 30 days in the reporting timezone
 func (a *App) GetMonthApiUsage() (int, error) {
-	usage, err := a.apiService.GetRecentUsage(720) // 30 days * 24 hours
+	totals, err := a.apiService.GetRecentDaysTotals(30)
 	if err != nil {
 		return 0, err
 	}
 
-	total := 0
-	for _, record := range usage {
-		total += int(record.ChargeCount)
-	}
-
-	return total, nil
+	return totals.CallCount, nil
 }
 
-// GetMonthTokenUsage returns token usage for the last month
+// GetMonthTokenUsage returns token usage of the last 30 days in the reporting timezone
 func (a *App) GetMonthTokenUsage() (int, error) {
-	usage, err := a.apiService.GetRecentUsage(720) // 30 days * 24 hours
+	totals, err := a.apiService.GetRecentDaysTotals(30)
 	if err != nil {
 		return 0, err
 	}
 
-	total := 0
-	for _, record := range usage {
-		total += int(record.ChargeUnit)
-	}
-
-	return total, nil
+	return int(totals.TokenUsage), nil
 }
 
-// GetMonthTotalCost returns total cost for the last month
+// GetMonthTotalCost returns total cost of the last 30 days in the reporting timezone
 func (a *App) GetMonthTotalCost() (float64, error) {
-	usage, err := a.apiService.GetRecentUsage(720) // 30 days * 24 hours
+	totals, err := a.apiService.GetRecentDaysTotals(30)
 	if err != nil {
 		return 0.0, err
 	}
 
-	total := 0.0
-	for _, record := range usage {
-		total += record.CashCost
-	}
-
-	return total, nil
+	return totals.CashCost, nil
 }
 
 // GetDailyUsage returns daily usage data
 func (a *App) GetDailyUsage(days int) (map[string]interface{}, error) {
-	usage, err := a.apiService.GetRecentUsage(days * 24)
+	usage, err := a.apiService.GetRecentUsage(days*24, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -409,7 +297,7 @@ func (a *App) GetDailyUsage(days int) (map[string]interface{}, error) {
 	})
 
 	for _, record := range usage {
-		date := record.TransactionTime.Format("01-02")
+		date := record.TransactionTime.In(models.ReportingLocation()).Format("01-02")
 		if data, exists := dailyData[date]; exists {
 			data.callCount += int(record.ChargeCount)
 			data.tokenUsage += int(record.ChargeUnit)
@@ -437,7 +325,7 @@ func (a *App) GetDailyUsage(days int) (map[string]interface{}, error) {
 
 // GetMonthlyUsage returns monthly usage data
 func (a *App) GetMonthlyUsage() (map[string]interface{}, error) {
-	usage, err := a.apiService.GetRecentUsage(720) // 30 days
+	usage, err := a.apiService.GetRecentUsage(720, 0) // 30 days
 	if err != nil {
 		return nil, err
 	}
@@ -455,7 +343,7 @@ func (a *App) GetMonthlyUsage() (map[string]interface{}, error) {
 	})
 
 	for _, record := range usage {
-		date := record.TransactionTime.Format("01-02")
+		date := record.TransactionTime.In(models.ReportingLocation()).Format("01-02")
 		if data, exists := dailyData[date]; exists {
 			data.callCount += int(record.ChargeCount)
 			data.tokenUsage += int(record.ChargeUnit)
@@ -481,24 +369,17 @@ func (a *App) GetMonthlyUsage() (map[string]interface{}, error) {
 	return result, nil
 }
 
-// GetCurrentMembershipTier returns the current membership tier
+// GetCurrentMembershipTier returns the current membership tier detected from bills
 func (a *App) GetCurrentMembershipTier() (map[string]interface{}, error) {
-	// Try to get token usage information to determine membership tier
-	token, err := a.apiService.GetToken()
-	if err == nil && token != nil {
-		// For now, we'll determine tier based on usage patterns
-		// TODO: Implement real tier detection from API response
-		result := map[string]interface{}{
-			"membershipTier": "GLM Coding Pro",
-			"tierName":       "GLM Coding Pro",
-		}
-		return result, nil
+	tierInfo, err := a.apiService.GetCurrentMembershipTier()
+	if err != nil {
+		return nil, err
 	}
 
-	// Fallback to free tier if no token found
 	result := map[string]interface{}{
-		"membershipTier": "Free",
-		"tierName":       "Free",
+		"membershipTier": tierInfo["tier_name"],
+		"tierName":       tierInfo["tier_name"],
+		"tier":           tierInfo["tier"],
 	}
 
 	return result, nil
@@ -737,20 +618,6 @@ func (a *App) GetAutoSyncStatus() (map[string]interface{}, error) {
 	return status, nil
 }
 
-// getDynamicDailyLimit 从动态配置获取每日限制 (IPC_05)
-func (a *App) getDynamicDailyLimit() int {
-	// 尝试从配置获取每日限制
-	config, err := a.apiService.GetConfig("daily_limit")
-	if err == nil && config != "" {
-		if limit, err := strconv.Atoi(config); err == nil {
-			return limit
-		}
-	}
-
-	// 如果配置不存在，返回默认值
-	return 1000
-}
-
 // CleanOldSyncHistory 清理指定天数前的同步历史记录 (MUTATION_01)
 func (a *App) CleanOldSyncHistory(days int) error {
 	return a.apiService.CleanOldSyncHistory(days)
@@ -239,6 +239,459 @@ func GetMigrations() []MigrationScript {
 				CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_unique_value ON api_tokens(token_value);
 			`,
 		},
+		{
+			Version:     12,
+			Description: "添加用量异常检测记录表",
+			SQL: `
+				CREATE TABLE IF NOT EXISTS usage_anomalies (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					hour_start DATETIME NOT NULL,
+					metric TEXT NOT NULL,
+					value REAL NOT NULL,
+					baseline REAL NOT NULL,
+					deviation REAL NOT NULL,
+					score REAL NOT NULL,
+					top_model TEXT,
+					top_api_key TEXT,
+					detected_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+				);
+
+				-- 同一小时同一指标只记录一次异常
+				CREATE UNIQUE INDEX IF NOT EXISTS idx_usage_anomalies_hour_metric ON usage_anomalies(hour_start, metric);
+				CREATE INDEX IF NOT EXISTS idx_usage_anomalies_detected_at ON usage_anomalies(detected_at);
+			`,
+		},
+		{
+			Version:     13,
+			Description: "添加分组与成本中心映射表",
+			SQL: `
+				CREATE TABLE IF NOT EXISTS group_cost_centers (
+					group_id TEXT PRIMARY KEY,
+					group_name TEXT,
+					cost_center TEXT NOT NULL,
+					description TEXT,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+
+				-- 为分组统计添加索引
+				CREATE INDEX IF NOT EXISTS idx_expense_bills_group_id ON expense_bills(group_id);
+				CREATE INDEX IF NOT EXISTS idx_expense_bills_use_group_id ON expense_bills(use_group_id);
+			`,
+		},
+		{
+			Version:     14,
+			Description: "添加应用设置表",
+			SQL: `
+				-- 已有账单时间的UTC规范化依赖报表时区设置，无法在SQL中完成：
+				-- 启动时由 APIService.normalizeBillTimes 执行一次（app_settings.bill_times_normalized 标记）
+				CREATE TABLE IF NOT EXISTS app_settings (
+					setting_key TEXT PRIMARY KEY,
+					setting_value TEXT NOT NULL,
+					description TEXT,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+			`,
+		},
+		{
+			Version:     15,
+			Description: "添加会员等级识别规则表和等级变更历史表",
+			SQL: `
+				CREATE TABLE IF NOT EXISTS tier_detection_rules (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					tier_name TEXT NOT NULL,
+					match_field TEXT NOT NULL,                  -- token_resource_name, token_resource_no, model_product_code
+					match_type TEXT NOT NULL DEFAULT 'contains', -- contains, equals, prefix, regex
+					pattern TEXT NOT NULL,
+					priority INTEGER NOT NULL DEFAULT 100,      -- 数值越小越优先
+					enabled BOOLEAN NOT NULL DEFAULT 1,
+					description TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+
+				CREATE TABLE IF NOT EXISTS membership_tier_history (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					tier_name TEXT NOT NULL,
+					effective_from DATETIME NOT NULL,
+					rule_id INTEGER,
+					match_field TEXT,
+					match_value TEXT,
+					detected_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+
+				CREATE INDEX IF NOT EXISTS idx_membership_tier_history_effective_from ON membership_tier_history(effective_from);
+				CREATE INDEX IF NOT EXISTS idx_expense_bills_token_resource_name ON expense_bills(token_resource_name);
+
+				-- 默认规则：与原有按资源包名称匹配的逻辑一致
+				INSERT INTO tier_detection_rules (tier_name, match_field, match_type, pattern, priority, description) VALUES
+					('lite', 'token_resource_name', 'contains', 'lite', 10, 'GLM Coding Lite'),
+					('max', 'token_resource_name', 'contains', 'max', 20, 'GLM Coding Max'),
+					('plus', 'token_resource_name', 'contains', 'plus', 30, 'Plus'),
+					('pro', 'token_resource_name', 'contains', 'pro', 40, 'GLM Coding Pro'),
+					('enterprise', 'token_resource_name', 'contains', 'enterprise', 50, '企业版'),
+					('enterprise', 'token_resource_name', 'contains', '企业', 51, '企业版'),
+					('free', 'token_resource_name', 'contains', 'free', 60, '免费版'),
+					('free', 'token_resource_name', 'contains', '免费', 61, '免费版');
+			`,
+		},
+		{
+			Version:     16,
+			Description: "会员等级目录添加费用限制字段并写入内置套餐数据",
+			SQL: `
+				ALTER TABLE membership_tier_limits ADD COLUMN daily_cost_limit REAL;
+				ALTER TABLE membership_tier_limits ADD COLUMN monthly_cost_limit REAL;
+
+				-- 内置套餐目录：GLM Coding Plan 每5小时重置prompt次数，日/月次数按每5小时上限折算
+				-- 已存在的等级保留用户修改，不覆盖
+				INSERT OR IGNORE INTO membership_tier_limits
+				(tier_name, daily_limit, monthly_limit, max_tokens, period_hours, call_limit, description) VALUES
+					('free', 1000, 30000, 1000000, NULL, NULL, '免费版'),
+					('lite', 576, 17280, NULL, 5, 120, 'GLM Coding Lite：每5小时约120次prompts'),
+					('pro', 2880, 86400, NULL, 5, 600, 'GLM Coding Pro：每5小时约600次prompts'),
+					('max', 11520, 345600, NULL, 5, 2400, 'GLM Coding Max：每5小时约2400次prompts');
+			`,
+		},
+		{
+			Version:     17,
+			Description: "会员等级目录添加套餐月费字段",
+			SQL: `
+				ALTER TABLE membership_tier_limits ADD COLUMN monthly_price REAL;
+
+				-- 内置套餐月费（元），以官网价格为准，可在目录中修改
+				UPDATE membership_tier_limits SET monthly_price = 0 WHERE tier_name = 'free' AND monthly_price IS NULL;
+				UPDATE membership_tier_limits SET monthly_price = 20 WHERE tier_name = 'lite' AND monthly_price IS NULL;
+				UPDATE membership_tier_limits SET monthly_price = 100 WHERE tier_name = 'pro' AND monthly_price IS NULL;
+				UPDATE membership_tier_limits SET monthly_price = 200 WHERE tier_name = 'max' AND monthly_price IS NULL;
+
+				CREATE INDEX IF NOT EXISTS idx_expense_bills_token_resource_no ON expense_bills(token_resource_no);
+			`,
+		},
+		{
+			Version:     18,
+			Description: "添加模型价格目录表",
+			SQL: `
+				CREATE TABLE IF NOT EXISTS model_prices (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					model_code TEXT NOT NULL,                 -- 模型编码或产品编码
+					context_band TEXT NOT NULL DEFAULT '',    -- 上下文区间，如 [0,32k]，空为不区分
+					token_type TEXT NOT NULL DEFAULT '',      -- input, output，空为不区分
+					unit TEXT NOT NULL,                       -- 计价单位，如 百万tokens、千tokens、次
+					price REAL NOT NULL,                      -- 每计价单位的标价（元）
+					effective_from DATE NOT NULL,
+					description TEXT,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					UNIQUE(model_code, context_band, token_type, effective_from)
+				);
+
+				CREATE INDEX IF NOT EXISTS idx_model_prices_model_code ON model_prices(model_code);
+
+				-- 内置参考价格（元），以官网价格为准，可在目录中修改
+				INSERT OR IGNORE INTO model_prices (model_code, unit, price, effective_from, description) VALUES
+					('glm-4-plus', '百万tokens', 5, '2025-01-01', 'GLM-4-Plus'),
+					('glm-4-air', '百万tokens', 0.5, '2025-01-01', 'GLM-4-Air'),
+					('glm-4-airx', '百万tokens', 10, '2025-01-01', 'GLM-4-AirX'),
+					('glm-4-long', '百万tokens', 1, '2025-01-01', 'GLM-4-Long'),
+					('glm-4-flashx', '百万tokens', 0.1, '2025-01-01', 'GLM-4-FlashX'),
+					('glm-4-flash', '百万tokens', 0, '2025-01-01', 'GLM-4-Flash（免费）'),
+					('glm-4v-plus', '百万tokens', 4, '2025-01-01', 'GLM-4V-Plus'),
+					('embedding-3', '百万tokens', 0.5, '2025-01-01', 'Embedding-3');
+			`,
+		},
+		{
+			Version:     19,
+			Description: "添加预算及预算告警记录表",
+			SQL: `
+				CREATE TABLE IF NOT EXISTS budgets (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL,
+					scope_type TEXT NOT NULL DEFAULT 'global', -- global, model, api_key, group
+					scope_value TEXT NOT NULL DEFAULT '',      -- 模型名称、API Key（key_id）或分组ID，全局预算为空
+					period TEXT NOT NULL DEFAULT 'month',      -- day, week, month, billing_cycle
+					amount REAL NOT NULL,                      -- 预算金额（元）
+					thresholds TEXT NOT NULL DEFAULT '[50,80,100]', -- 告警阈值百分比（JSON数组）
+					enabled BOOLEAN DEFAULT 1,
+					description TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+
+				-- 每个预算周期内每个阈值只告警一次
+				CREATE TABLE IF NOT EXISTS budget_alerts (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					budget_id INTEGER NOT NULL,
+					period_key TEXT NOT NULL,
+					threshold REAL NOT NULL,
+					spent REAL NOT NULL,
+					amount REAL NOT NULL,
+					triggered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					UNIQUE(budget_id, period_key, threshold)
+				);
+
+				CREATE INDEX IF NOT EXISTS idx_budget_alerts_budget_id ON budget_alerts(budget_id);
+			`,
+		},
+		{
+			Version:     20,
+			Description: "添加自定义告警规则及告警事件表",
+			SQL: `
+				CREATE TABLE IF NOT EXISTS alert_rules (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL,
+					metric TEXT NOT NULL,                       -- calls, tokens, input_tokens, output_tokens, cost, gift_deducted
+					filter TEXT NOT NULL DEFAULT '{}',          -- 查询过滤条件（JSON，同通用用量查询）
+					comparison TEXT NOT NULL,                   -- gt, gte, lt, lte, eq
+					threshold REAL NOT NULL,
+					window_minutes INTEGER NOT NULL,            -- 统计窗口（截至评估时刻）
+					cooldown_minutes INTEGER NOT NULL DEFAULT 60, -- 两次触发通知的最短间隔
+					severity TEXT NOT NULL DEFAULT 'warning',   -- info, warning, critical
+					weekdays TEXT NOT NULL DEFAULT '[]',        -- 仅在这些星期评估（0=周日，JSON数组），空为每天
+					enabled BOOLEAN DEFAULT 1,
+					description TEXT,
+					state TEXT NOT NULL DEFAULT 'ok',           -- ok, firing
+					last_value REAL,
+					last_evaluated_at DATETIME,
+					last_fired_at DATETIME,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+
+				CREATE TABLE IF NOT EXISTS alert_events (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					rule_id INTEGER NOT NULL,
+					rule_name TEXT NOT NULL,
+					event_type TEXT NOT NULL,                   -- firing, resolved
+					severity TEXT NOT NULL,
+					value REAL NOT NULL,
+					threshold REAL NOT NULL,
+					message TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+
+				CREATE INDEX IF NOT EXISTS idx_alert_events_rule_id ON alert_events(rule_id);
+				CREATE INDEX IF NOT EXISTS idx_alert_events_created_at ON alert_events(created_at);
+			`,
+		},
+		{
+			Version:     21,
+			Description: "添加通知渠道及投递记录表",
+			SQL: `
+				CREATE TABLE IF NOT EXISTS notification_channels (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL,
+					channel_type TEXT NOT NULL,                 -- feishu, dingtalk, wecom, slack, generic
+					url TEXT NOT NULL DEFAULT '',
+					secret TEXT NOT NULL DEFAULT '',            -- 签名密钥（飞书、钉钉加签，通用Webhook HMAC）
+					config TEXT NOT NULL DEFAULT '{}',          -- 渠道类型相关的其他配置（JSON）
+					notification_types TEXT NOT NULL DEFAULT '["warning","error"]', -- 路由的通知类型（JSON数组）
+					max_retries INTEGER NOT NULL DEFAULT 3,
+					enabled BOOLEAN DEFAULT 1,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+
+				CREATE TABLE IF NOT EXISTS notification_deliveries (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					channel_id INTEGER NOT NULL,
+					channel_name TEXT NOT NULL,
+					notification_type TEXT NOT NULL,
+					title TEXT NOT NULL,
+					status TEXT NOT NULL,                       -- success, failed
+					attempts INTEGER NOT NULL DEFAULT 0,
+					status_code INTEGER,
+					error_message TEXT,
+					response_body TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					completed_at DATETIME
+				);
+
+				CREATE INDEX IF NOT EXISTS idx_notification_deliveries_channel_id ON notification_deliveries(channel_id);
+				CREATE INDEX IF NOT EXISTS idx_notification_deliveries_created_at ON notification_deliveries(created_at);
+			`,
+		},
+		{
+			Version:     22,
+			Description: "添加持久化通知中心表",
+			SQL: `
+				CREATE TABLE IF NOT EXISTS notifications (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					type INTEGER NOT NULL,                      -- 0=info, 1=success, 2=warning, 3=error
+					category TEXT NOT NULL DEFAULT '',          -- 数据中的type，如 budget_threshold
+					title TEXT NOT NULL,
+					message TEXT NOT NULL DEFAULT '',
+					data TEXT,                                  -- JSON
+					dedup_key TEXT,                             -- 相同去重键只保留一条，重复出现时更新
+					occurrences INTEGER NOT NULL DEFAULT 1,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP, -- 最近一次出现时间
+					read_at DATETIME
+				);
+
+				CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_dedup_key ON notifications(dedup_key) WHERE dedup_key IS NOT NULL;
+				CREATE INDEX IF NOT EXISTS idx_notifications_updated_at ON notifications(updated_at);
+				CREATE INDEX IF NOT EXISTS idx_notifications_read_at ON notifications(read_at);
+			`,
+		},
+		{
+			Version:     23,
+			Description: "添加用量摘要计划及历史表",
+			SQL: `
+				CREATE TABLE IF NOT EXISTS digest_schedules (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL,
+					kind TEXT NOT NULL,                         -- daily, weekly
+					time_of_day TEXT NOT NULL,                  -- HH:MM，报表时区
+					weekdays TEXT NOT NULL DEFAULT '[]',        -- 仅在这些星期生成（0=周日，JSON数组），空为每天
+					enabled BOOLEAN DEFAULT 1,
+					last_run_at DATETIME,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+
+				CREATE TABLE IF NOT EXISTS usage_digests (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					schedule_id INTEGER NOT NULL DEFAULT 0,     -- 手动生成时为0
+					kind TEXT NOT NULL,
+					title TEXT NOT NULL,
+					summary TEXT NOT NULL DEFAULT '',
+					data TEXT NOT NULL,                         -- 完整摘要（JSON）
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+
+				CREATE INDEX IF NOT EXISTS idx_usage_digests_created_at ON usage_digests(created_at);
+			`,
+		},
+		{
+			Version:     24,
+			Description: "添加API令牌过期提醒记录表",
+			SQL: `
+				CREATE TABLE IF NOT EXISTS token_expiry_warnings (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					token_id INTEGER NOT NULL,
+					expires_at DATETIME NOT NULL,               -- 提醒时的过期时间，更新过期时间后重新提醒
+					days_before INTEGER NOT NULL,               -- 14, 3, 1
+					warned_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					UNIQUE(token_id, expires_at, days_before)
+				);
+			`,
+		},
+		{
+			Version:     25,
+			Description: "API令牌加密存储，添加脱敏提示列",
+			SQL: `
+				-- token_value 改为AES-GCM密文，启动时由程序加密已有明文
+				ALTER TABLE api_tokens ADD COLUMN token_hint TEXT NOT NULL DEFAULT '';
+			`,
+		},
+		{
+			Version:     26,
+			Description: "多账号同步，账单和同步历史记录所属账号",
+			SQL: `
+				-- account_id 对应 api_tokens.id
+				ALTER TABLE expense_bills ADD COLUMN account_id INTEGER;
+				ALTER TABLE sync_history ADD COLUMN account_id INTEGER;
+				ALTER TABLE sync_history ADD COLUMN account_name TEXT;
+
+				CREATE INDEX IF NOT EXISTS idx_expense_bills_account_id ON expense_bills(account_id);
+				CREATE INDEX IF NOT EXISTS idx_sync_history_account_id ON sync_history(account_id);
+
+				-- 只有一个令牌时，已有账单都来自该账号
+				UPDATE expense_bills
+				SET account_id = (SELECT MIN(id) FROM api_tokens)
+				WHERE account_id IS NULL
+				  AND (SELECT COUNT(*) FROM api_tokens) = 1;
+			`,
+		},
+		{
+			Version:     27,
+			Description: "添加API令牌轮换审计表",
+			SQL: `
+				CREATE TABLE IF NOT EXISTS token_rotations (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					token_id INTEGER NOT NULL,
+					token_name TEXT NOT NULL DEFAULT '',
+					previous_token_value TEXT NOT NULL DEFAULT '', -- 旧令牌密文，宽限期结束或回滚后清空
+					previous_token_hint TEXT NOT NULL DEFAULT '',
+					previous_expires_at DATETIME,
+					new_token_hint TEXT NOT NULL DEFAULT '',
+					customer_id TEXT NOT NULL DEFAULT '',          -- 探测同步识别出的账号
+					account_check TEXT NOT NULL DEFAULT '',        -- matched, unverified
+					status TEXT NOT NULL,                          -- failed, rotated, rolled_back, completed
+					message TEXT NOT NULL DEFAULT '',
+					grace_until DATETIME,
+					rotated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					rolled_back_at DATETIME
+				);
+
+				CREATE INDEX IF NOT EXISTS idx_token_rotations_token_id ON token_rotations(token_id);
+				CREATE INDEX IF NOT EXISTS idx_token_rotations_status ON token_rotations(status);
+			`,
+		},
+		{
+			Version:     28,
+			Description: "模型价格目录添加GLM-4.5/GLM-4.6系列输入输出分项价格",
+			SQL: `
+				-- 内置参考价格（元/百万tokens），按输入长度分档，以官网价格为准，可在目录中修改
+				-- 不带上下文区间的价格为 [0,32k] 档，作为账单未标注区间时的默认价格
+				INSERT OR IGNORE INTO model_prices (model_code, context_band, token_type, unit, price, effective_from, description) VALUES
+					('glm-4.6', '', 'input', '百万tokens', 2, '2025-09-30', 'GLM-4.6 输入'),
+					('glm-4.6', '', 'output', '百万tokens', 8, '2025-09-30', 'GLM-4.6 输出'),
+					('glm-4.6', '[32k,128k]', 'input', '百万tokens', 4, '2025-09-30', 'GLM-4.6 输入 [32K,128K]'),
+					('glm-4.6', '[32k,128k]', 'output', '百万tokens', 16, '2025-09-30', 'GLM-4.6 输出 [32K,128K]'),
+					('glm-4.5', '', 'input', '百万tokens', 2, '2025-07-28', 'GLM-4.5 输入'),
+					('glm-4.5', '', 'output', '百万tokens', 8, '2025-07-28', 'GLM-4.5 输出'),
+					('glm-4.5', '[32k,128k]', 'input', '百万tokens', 4, '2025-07-28', 'GLM-4.5 输入 [32K,128K]'),
+					('glm-4.5', '[32k,128k]', 'output', '百万tokens', 16, '2025-07-28', 'GLM-4.5 输出 [32K,128K]'),
+					('glm-4.5-air', '', 'input', '百万tokens', 0.8, '2025-07-28', 'GLM-4.5-Air 输入'),
+					('glm-4.5-air', '', 'output', '百万tokens', 2, '2025-07-28', 'GLM-4.5-Air 输出'),
+					('glm-4.5-air', '[32k,128k]', 'input', '百万tokens', 1.2, '2025-07-28', 'GLM-4.5-Air 输入 [32K,128K]'),
+					('glm-4.5-air', '[32k,128k]', 'output', '百万tokens', 8, '2025-07-28', 'GLM-4.5-Air 输出 [32K,128K]'),
+					('glm-4.5v', '', 'input', '百万tokens', 2, '2025-08-11', 'GLM-4.5V 输入'),
+					('glm-4.5v', '', 'output', '百万tokens', 6, '2025-08-11', 'GLM-4.5V 输出'),
+					('glm-4.5-flash', '', '', '百万tokens', 0, '2025-07-28', 'GLM-4.5-Flash（免费）');
+			`,
+		},
+		{
+			Version:     29,
+			Description: "会员等级变更历史按账号记录",
+			SQL: `
+				-- account_id 对应 api_tokens.id，0 为未归属账号的账单
+				ALTER TABLE membership_tier_history ADD COLUMN account_id INTEGER NOT NULL DEFAULT 0;
+
+				CREATE INDEX IF NOT EXISTS idx_membership_tier_history_account ON membership_tier_history(account_id, effective_from);
+
+				-- 旧的历史混合了所有账号的账单，清空后由启动时的重新识别按账号生成
+				DELETE FROM membership_tier_history;
+			`,
+		},
+		{
+			Version:     30,
+			Description: "令牌轮换记录保存新令牌密文",
+			SQL: `
+				-- 回滚时按密文确认令牌未被再次替换，脱敏值不唯一
+				ALTER TABLE token_rotations ADD COLUMN new_token_value TEXT NOT NULL DEFAULT '';
+
+				-- 宽限期内的轮换从当前令牌补全（每个令牌最多一条）
+				UPDATE token_rotations
+				SET new_token_value = COALESCE((
+					SELECT token_value FROM api_tokens
+					WHERE api_tokens.id = token_rotations.token_id AND api_tokens.token_hint = token_rotations.new_token_hint
+				), '')
+				WHERE status = 'rotated';
+			`,
+		},
+		{
+			Version:     31,
+			Description: "令牌按明文指纹去重",
+			SQL: `
+				-- 令牌加密后每次密文都不同，token_value 上的唯一索引不再能发现重复令牌
+				DROP INDEX IF EXISTS idx_api_tokens_unique_value;
+
+				-- 明文的HMAC指纹，由令牌库在打开时为已有令牌补全
+				ALTER TABLE api_tokens ADD COLUMN token_hash TEXT;
+				CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_unique_hash ON api_tokens(token_hash)
+					WHERE token_hash IS NOT NULL;
+			`,
+		},
 	}
 }
 
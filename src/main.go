@@ -2,6 +2,9 @@ package main
 
 import (
 	"embed"
+	"glm-usage-monitor/services"
+	"log"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -12,6 +15,9 @@ import (
 var assets embed.FS
 
 func main() {
+	// 所有日志输出前脱敏令牌和密钥
+	log.SetOutput(services.NewRedactingWriter(os.Stderr))
+
 	// Create an instance of the app structure
 	app := NewApp()
 
@@ -186,11 +186,11 @@ func ValidateSyncConfig(config map[string]interface{}) error {
 	}
 
 	// 验证必需字段
-	if enabled, ok := config["enabled"]; !ok {
+	if _, ok := config["enabled"]; !ok {
 		return errors.New("enabled field is required")
 	}
 
-	if frequency, ok := config["frequency_seconds"]; !ok {
+	if _, ok := config["frequency_seconds"]; !ok {
 		return errors.New("frequency_seconds field is required")
 	}
 
@@ -43,7 +43,8 @@ type ExpenseBill struct {
 	APIUsage          int     `json:"api_usage" db:"api_usage"`
 
 	// === 新增字段：模型信息字段 ===
-	APIKey              string `json:"api_key" db:"api_key"`
+	APIKey              string `json:"api_key" db:"api_key"` // 返回前端时已脱敏
+	APIKeyID            string `json:"api_key_id" db:"-"`    // API Key的稳定标识，仅在返回前端时填充
 	ModelCode           string `json:"model_code" db:"model_code"`
 	ModelProductType    string `json:"model_product_type" db:"model_product_type"`
 	ModelProductSubtype string `json:"model_product_subtype" db:"model_product_subtype"`
@@ -79,15 +80,20 @@ type ExpenseBill struct {
 	DeductUsage       float64 `json:"deduct_usage" db:"deduct_usage"` // DB_04: 修复为float64类型，与数据库一致
 	DeductAfter       string  `json:"deduct_after" db:"deduct_after"`
 	TokenType         string  `json:"token_type" db:"token_type"`
+
+	// 账单所属账号（api_tokens.id），0 表示未归属
+	AccountID int `json:"account_id" db:"account_id"`
 }
 
 // APIToken represents api_tokens table structure (DB_02: 重新设计)
 type APIToken struct {
 	ID           int        `json:"id" db:"id"`
 	TokenName    string     `json:"token_name" db:"token_name"`
-	TokenValue   string     `json:"token_value" db:"token_value"`
-	Provider     string     `json:"provider" db:"provider"`     // API提供商 (如: openai, claude, etc.)
-	TokenType    string     `json:"token_type" db:"token_type"` // Token类型 (如: api_key, bearer, etc.)
+	TokenValue   string     `json:"token_value" db:"token_value"` // 加密存储，返回前端时为脱敏值
+	TokenHint    string     `json:"-" db:"token_hint"`            // 明文的脱敏形式
+	TokenHash    string     `json:"-" db:"token_hash"`            // 明文的密钥指纹，用于发现重复令牌
+	Provider     string     `json:"provider" db:"provider"`       // API提供商 (如: openai, claude, etc.)
+	TokenType    string     `json:"token_type" db:"token_type"`   // Token类型 (如: api_key, bearer, etc.)
 	IsActive     bool       `json:"is_active" db:"is_active"`
 	DailyLimit   *int       `json:"daily_limit" db:"daily_limit"`     // 每日调用限制
 	MonthlyLimit *int       `json:"monthly_limit" db:"monthly_limit"` // 每月调用限制
@@ -115,6 +121,8 @@ type SyncHistory struct {
 	TotalPages    int        `json:"total_pages" db:"total_pages"`
 	BillingMonth  string     `json:"billing_month" db:"billing_month"`
 	FailedCount   int        `json:"failed_count" db:"failed_count"`
+	AccountID     int        `json:"account_id" db:"account_id"`     // 同步的账号（api_tokens.id），0 表示旧记录
+	AccountName   string     `json:"account_name" db:"account_name"` // 同步时的令牌名称
 
 	// === DB_07: 新增缺失字段（使用COALESCE处理NULL值，所以不需要指针类型） ===
 	SyncTime time.Time `json:"sync_time" db:"sync_time"` // 使用COALESCE(sync_time, start_time)处理
@@ -157,9 +165,392 @@ type MembershipTierLimit struct {
 	PeriodHours *int `json:"period_hours" db:"period_hours"`
 	CallLimit   *int `json:"call_limit" db:"call_limit"`
 
+	DailyCostLimit   *float64 `json:"daily_cost_limit" db:"daily_cost_limit"`     // 元
+	MonthlyCostLimit *float64 `json:"monthly_cost_limit" db:"monthly_cost_limit"` // 元
+	MonthlyPrice     *float64 `json:"monthly_price" db:"monthly_price"`           // 套餐月费（元）
+
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// MembershipTierCatalogue is the JSON import/export format of the membership tier catalogue
+type MembershipTierCatalogue struct {
+	Version    int                   `json:"version"`
+	ExportedAt time.Time             `json:"exported_at"`
+	Tiers      []MembershipTierLimit `json:"tiers"`
+}
+
+// SubscriptionSavings compares the list price of usage covered by coding-plan resource
+// packages with what the subscription cost, for a month or a billing cycle
+type SubscriptionSavings struct {
+	Period           string     `json:"period"` // 月份 (2006-01) 或资源包编号
+	Label            string     `json:"label"`
+	Tier             string     `json:"tier,omitempty"`
+	StartTime        *time.Time `json:"start_time,omitempty"`
+	EndTime          *time.Time `json:"end_time,omitempty"`
+	CoveredCalls     int        `json:"covered_calls"`
+	CoveredTokens    float64    `json:"covered_tokens"`
+	ListPriceCost    float64    `json:"list_price_cost"`    // 覆盖用量按标价计算的费用
+	SubscriptionCost float64    `json:"subscription_cost"`  // 套餐实际费用
+	NetSaving        float64    `json:"net_saving"`         // 正数为节省，负数为亏损
+	SavingPercent    float64    `json:"saving_percent"`     // 节省金额占标价费用的百分比
+	PayAsYouGoCost   float64    `json:"pay_as_you_go_cost"` // 未被套餐覆盖、按量付费的现金费用
+}
+
+// SubscriptionSavingsReport holds the savings analysis per month and per billing cycle
+type SubscriptionSavingsReport struct {
+	ByMonth []SubscriptionSavings `json:"by_month"`
+	ByCycle []SubscriptionSavings `json:"by_cycle"`
+	Total   SubscriptionSavings   `json:"total"`
+}
+
+// ModelPrice represents model_prices table structure
+type ModelPrice struct {
+	ID            int       `json:"id" db:"id"`
+	ModelCode     string    `json:"model_code" db:"model_code"`         // 模型编码或产品编码
+	ContextBand   string    `json:"context_band" db:"context_band"`     // 空为不区分
+	TokenType     string    `json:"token_type" db:"token_type"`         // input, output，空为不区分
+	Unit          string    `json:"unit" db:"unit"`                     // 如 百万tokens
+	Price         float64   `json:"price" db:"price"`                   // 每计价单位的标价（元）
+	EffectiveFrom string    `json:"effective_from" db:"effective_from"` // 2006-01-02
+	Description   string    `json:"description" db:"description"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CostDiscrepancy represents a bill whose cash cost differs from the expected cost
+type CostDiscrepancy struct {
+	BillID          string    `json:"bill_id"`
+	BillingNo       string    `json:"billing_no"`
+	TransactionTime time.Time `json:"transaction_time"`
+	ModelName       string    `json:"model_name"`
+	ChargeName      string    `json:"charge_name"`
+	PriceID         int       `json:"price_id"`
+	UsageCount      float64   `json:"usage_count"`
+	UsageUnit       string    `json:"usage_unit"`
+	DiscountRate    float64   `json:"discount_rate"`
+	ExpectedCost    float64   `json:"expected_cost"`
+	BilledCost      float64   `json:"billed_cost"` // cash_cost + gift_deduct_amount
+	Difference      float64   `json:"difference"`  // 账单金额 - 预期金额
+}
+
+// CostVerificationReport summarizes the billed-cost verification of a month
+type CostVerificationReport struct {
+	BillingMonth    string            `json:"billing_month"`
+	CheckedBills    int               `json:"checked_bills"`
+	MatchedBills    int               `json:"matched_bills"`
+	UnpricedBills   int               `json:"unpriced_bills"` // 价格目录中没有对应价格
+	CoveredBills    int               `json:"covered_bills"`  // 资源包抵扣，不参与核对
+	UnpricedModels  []string          `json:"unpriced_models"`
+	ExpectedTotal   float64           `json:"expected_total"`
+	BilledTotal     float64           `json:"billed_total"`
+	DifferenceTotal float64           `json:"difference_total"`
+	Discrepancies   []CostDiscrepancy `json:"discrepancies"`
+}
+
+// Budget represents budgets table structure
+type Budget struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	ScopeType   string    `json:"scope_type" db:"scope_type"`   // global, model, api_key, group
+	ScopeValue  string    `json:"scope_value" db:"scope_value"` // 模型名称、API Key的key_id或分组ID
+	ScopeKeyID  string    `json:"scope_key_id" db:"-"`          // api_key范围的key_id；为空时scope_value为原始API Key
+	Period      string    `json:"period" db:"period"`           // day, week, month, billing_cycle
+	Amount      float64   `json:"amount" db:"amount"`           // 预算金额（元）
+	Thresholds  []float64 `json:"thresholds" db:"thresholds"`   // 告警阈值百分比，如 50, 80, 100
+	Enabled     bool      `json:"enabled" db:"enabled"`
+	Description string    `json:"description" db:"description"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// BudgetStatus represents a budget's spending in its current period
+type BudgetStatus struct {
+	Budget            Budget    `json:"budget"`
+	PeriodKey         string    `json:"period_key"`
+	PeriodStart       time.Time `json:"period_start"`
+	PeriodEnd         time.Time `json:"period_end"` // 不包含
+	Spent             float64   `json:"spent"`
+	Remaining         float64   `json:"remaining"`
+	Percentage        float64   `json:"percentage"`
+	CrossedThresholds []float64 `json:"crossed_thresholds"`
+	NextThreshold     *float64  `json:"next_threshold"`
+}
+
+// AlertRule represents alert_rules table structure
+type AlertRule struct {
+	ID              int              `json:"id" db:"id"`
+	Name            string           `json:"name" db:"name"`
+	Metric          string           `json:"metric" db:"metric"`         // 同通用用量查询的指标
+	Filter          UsageQueryFilter `json:"filter" db:"filter"`         // 时间范围由窗口决定，其余条件同通用用量查询
+	Comparison      string           `json:"comparison" db:"comparison"` // gt, gte, lt, lte, eq
+	Threshold       float64          `json:"threshold" db:"threshold"`
+	WindowMinutes   int              `json:"window_minutes" db:"window_minutes"`
+	CooldownMinutes int              `json:"cooldown_minutes" db:"cooldown_minutes"`
+	Severity        string           `json:"severity" db:"severity"` // info, warning, critical
+	Weekdays        []int            `json:"weekdays" db:"weekdays"` // 0=周日，空为每天
+	Enabled         bool             `json:"enabled" db:"enabled"`
+	Description     string           `json:"description" db:"description"`
+	State           string           `json:"state" db:"state"` // ok, firing
+	LastValue       *float64         `json:"last_value" db:"last_value"`
+	LastEvaluatedAt *time.Time       `json:"last_evaluated_at" db:"last_evaluated_at"`
+	LastFiredAt     *time.Time       `json:"last_fired_at" db:"last_fired_at"`
+	CreatedAt       time.Time        `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at" db:"updated_at"`
+}
+
+// AlertEvent represents alert_events table structure
+type AlertEvent struct {
+	ID        int       `json:"id" db:"id"`
+	RuleID    int       `json:"rule_id" db:"rule_id"`
+	RuleName  string    `json:"rule_name" db:"rule_name"`
+	EventType string    `json:"event_type" db:"event_type"` // firing, resolved
+	Severity  string    `json:"severity" db:"severity"`
+	Value     float64   `json:"value" db:"value"`
+	Threshold float64   `json:"threshold" db:"threshold"`
+	Message   string    `json:"message" db:"message"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// NotificationChannel represents notification_channels table structure
+type NotificationChannel struct {
+	ID                int               `json:"id" db:"id"`
+	Name              string            `json:"name" db:"name"`
+	ChannelType       string            `json:"channel_type" db:"channel_type"` // feishu, dingtalk, wecom, slack, generic, smtp
+	URL               string            `json:"url" db:"url"`
+	Secret            string            `json:"secret" db:"secret"`                         // 签名密钥或SMTP密码，返回前端时已脱敏
+	Config            map[string]string `json:"config" db:"config"`                         // SMTP: host, port, tls_mode, username, from, to, to:<类型>, subject_prefix, text_template, html_template
+	NotificationTypes []string          `json:"notification_types" db:"notification_types"` // 通知级别(info, success, warning, error)或数据类型(如 budget_threshold)，* 为全部
+	MaxRetries        int               `json:"max_retries" db:"max_retries"`
+	Enabled           bool              `json:"enabled" db:"enabled"`
+	CreatedAt         time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// NotificationDelivery represents notification_deliveries table structure
+type NotificationDelivery struct {
+	ID               int        `json:"id" db:"id"`
+	ChannelID        int        `json:"channel_id" db:"channel_id"`
+	ChannelName      string     `json:"channel_name" db:"channel_name"`
+	NotificationType string     `json:"notification_type" db:"notification_type"`
+	Title            string     `json:"title" db:"title"`
+	Status           string     `json:"status" db:"status"` // success, failed
+	Attempts         int        `json:"attempts" db:"attempts"`
+	StatusCode       int        `json:"status_code" db:"status_code"`
+	ErrorMessage     string     `json:"error_message" db:"error_message"`
+	ResponseBody     string     `json:"response_body" db:"response_body"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	CompletedAt      *time.Time `json:"completed_at" db:"completed_at"`
+}
+
+// TokenHealth describes the expiry state of an API token
+type TokenHealth struct {
+	TokenID       int        `json:"token_id"`
+	TokenName     string     `json:"token_name"`
+	IsActive      bool       `json:"is_active"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	DaysRemaining *int       `json:"days_remaining"` // 向上取整，未设置过期时间时为空
+	Status        string     `json:"status"`         // ok, expiring, expired, inactive, no_expiry
+}
+
+// TokenRotation represents token_rotations table structure, the audit trail of token rotations
+type TokenRotation struct {
+	ID                 int        `json:"id" db:"id"`
+	TokenID            int        `json:"token_id" db:"token_id"`
+	TokenName          string     `json:"token_name" db:"token_name"`
+	PreviousTokenValue string     `json:"-" db:"previous_token_value"` // 旧令牌密文，仅宽限期内保留
+	PreviousTokenHint  string     `json:"previous_token_hint" db:"previous_token_hint"`
+	PreviousExpiresAt  *time.Time `json:"previous_expires_at" db:"previous_expires_at"`
+	NewTokenHint       string     `json:"new_token_hint" db:"new_token_hint"`
+	NewTokenValue      string     `json:"-" db:"new_token_value"` // 新令牌密文，回滚时确认令牌未被再次替换
+	CustomerID         string     `json:"customer_id" db:"customer_id"`
+	AccountCheck       string     `json:"account_check" db:"account_check"` // matched, unverified
+	Status             string     `json:"status" db:"status"`               // failed, rotated, rolled_back, completed
+	Message            string     `json:"message" db:"message"`
+	GraceUntil         *time.Time `json:"grace_until" db:"grace_until"`
+	RotatedAt          time.Time  `json:"rotated_at" db:"rotated_at"`
+	RolledBackAt       *time.Time `json:"rolled_back_at" db:"rolled_back_at"`
+
+	// 以下字段用于前端API响应，不存储在数据库中
+	CanRollback bool `json:"can_rollback"`
+}
+
+// DigestSchedule represents digest_schedules table structure
+type DigestSchedule struct {
+	ID        int        `json:"id" db:"id"`
+	Name      string     `json:"name" db:"name"`
+	Kind      string     `json:"kind" db:"kind"`               // daily（昨日+本周至今）, weekly（上周+本月至今）
+	TimeOfDay string     `json:"time_of_day" db:"time_of_day"` // HH:MM，报表时区
+	Weekdays  []int      `json:"weekdays" db:"weekdays"`       // 0=周日，空为每天
+	Enabled   bool       `json:"enabled" db:"enabled"`
+	LastRunAt *time.Time `json:"last_run_at" db:"last_run_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// DigestItem is a ranked model or API key of a digest period
+type DigestItem struct {
+	Name   string  `json:"name"` // API Key已脱敏
+	Calls  float64 `json:"calls"`
+	Tokens float64 `json:"tokens"`
+	Cost   float64 `json:"cost"`
+}
+
+// DigestPeriod summarizes one digest period against the prior period of the same length
+type DigestPeriod struct {
+	Key            string       `json:"key"` // yesterday, week_to_date, last_week, month_to_date
+	Label          string       `json:"label"`
+	StartTime      time.Time    `json:"start_time"`
+	EndTime        time.Time    `json:"end_time"` // 不包含
+	Calls          float64      `json:"calls"`
+	Tokens         float64      `json:"tokens"`
+	Cost           float64      `json:"cost"`
+	PreviousCalls  float64      `json:"previous_calls"`
+	PreviousTokens float64      `json:"previous_tokens"`
+	PreviousCost   float64      `json:"previous_cost"`
+	CallsChange    *float64     `json:"calls_change"` // 环比变化百分比，上期为0时为空
+	TokensChange   *float64     `json:"tokens_change"`
+	CostChange     *float64     `json:"cost_change"`
+	TopModels      []DigestItem `json:"top_models"`
+	TopAPIKeys     []DigestItem `json:"top_api_keys"`
+}
+
+// DigestSyncHealth summarizes syncs during a digest's periods
+type DigestSyncHealth struct {
+	Healthy        bool       `json:"healthy"`
+	LastSyncTime   *time.Time `json:"last_sync_time"`
+	LastStatus     string     `json:"last_status"`
+	CompletedSyncs int        `json:"completed_syncs"`
+	FailedSyncs    int        `json:"failed_syncs"`
+	LastError      string     `json:"last_error"`
+}
+
+// UsageDigest represents a generated digest, stored in usage_digests
+type UsageDigest struct {
+	ID          int              `json:"id" db:"id"`
+	ScheduleID  int              `json:"schedule_id" db:"schedule_id"` // 手动生成时为0
+	Kind        string           `json:"kind" db:"kind"`
+	Title       string           `json:"title" db:"title"`
+	Summary     string           `json:"summary" db:"summary"`
+	Timezone    string           `json:"timezone"`
+	Periods     []DigestPeriod   `json:"periods"`
+	Budgets     []BudgetStatus   `json:"budgets"`
+	SyncHealth  DigestSyncHealth `json:"sync_health"`
+	GeneratedAt time.Time        `json:"generated_at" db:"created_at"`
+}
+
+// NotificationFilter represents notification center query filters
+type NotificationFilter struct {
+	PageNum    int        `json:"page_num"`
+	PageSize   int        `json:"page_size"`
+	Type       *int       `json:"type"`     // 0=info, 1=success, 2=warning, 3=error
+	Category   string     `json:"category"` // 如 budget_threshold、alert_firing
+	UnreadOnly bool       `json:"unread_only"`
+	StartTime  *time.Time `json:"start_time"` // 包含，按最近一次出现时间
+	EndTime    *time.Time `json:"end_time"`   // 不包含
+	SearchTerm string     `json:"search_term"`
+}
+
+// SessionIdleGapConfigKey is the app setting holding the session idle gap in minutes
+const SessionIdleGapConfigKey = "session_idle_gap_minutes"
+
+// DefaultSessionIdleGapMinutes is the idle gap used when none is configured
+const DefaultSessionIdleGapMinutes = 30
+
+// SessionFilter restricts and configures work-session reconstruction
+type SessionFilter struct {
+	StartTime      *time.Time `json:"start_time"` // 包含
+	EndTime        *time.Time `json:"end_time"`   // 不包含
+	ModelNames     []string   `json:"model_names"`
+	APIKeys        []string   `json:"api_keys"`         // 原始API Key或key_id
+	IdleGapMinutes int        `json:"idle_gap_minutes"` // 同一API Key相邻调用间隔小于该值视为同一会话，0表示使用配置值
+	Limit          int        `json:"limit"`            // 0表示不限制，按开始时间倒序截取
+}
+
+// UsageSession represents a run of consecutive calls on the same API key
+type UsageSession struct {
+	APIKey          string    `json:"api_key"` // 已脱敏
+	KeyID           string    `json:"key_id"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	Calls           int       `json:"calls"`
+	Tokens          float64   `json:"tokens"`
+	Cost            float64   `json:"cost"`
+	DominantModel   string    `json:"dominant_model"` // 会话内调用次数最多的模型
+}
+
+// SessionStats holds session-level aggregates
+type SessionStats struct {
+	IdleGapMinutes       int           `json:"idle_gap_minutes"`
+	SessionCount         int           `json:"session_count"`
+	TotalCalls           int           `json:"total_calls"`
+	TotalTokens          float64       `json:"total_tokens"`
+	TotalCost            float64       `json:"total_cost"`
+	TotalHours           float64       `json:"total_hours"`
+	AvgDurationMinutes   float64       `json:"avg_duration_minutes"`
+	AvgCallsPerSession   float64       `json:"avg_calls_per_session"`
+	AvgCostPerSession    float64       `json:"avg_cost_per_session"`
+	CostPerSessionHour   float64       `json:"cost_per_session_hour"`
+	TokensPerSessionHour float64       `json:"tokens_per_session_hour"`
+	LongestSession       *UsageSession `json:"longest_session"`
+}
+
+// TierDetectionRule represents tier_detection_rules table structure
+type TierDetectionRule struct {
+	ID          int       `json:"id" db:"id"`
+	TierName    string    `json:"tier_name" db:"tier_name"`
+	MatchField  string    `json:"match_field" db:"match_field"` // token_resource_name, token_resource_no, model_product_code
+	MatchType   string    `json:"match_type" db:"match_type"`   // contains, equals, prefix, regex（不区分大小写）
+	Pattern     string    `json:"pattern" db:"pattern"`
+	Priority    int       `json:"priority" db:"priority"` // 数值越小越优先
+	Enabled     bool      `json:"enabled" db:"enabled"`
+	Description string    `json:"description" db:"description"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// MembershipTierChange represents membership_tier_history table structure
+type MembershipTierChange struct {
+	ID            int       `json:"id" db:"id"`
+	AccountID     int       `json:"account_id" db:"account_id"` // 账单所属账号（api_tokens.id），0 表示未归属
+	TierName      string    `json:"tier_name" db:"tier_name"`
+	EffectiveFrom time.Time `json:"effective_from" db:"effective_from"`
+	RuleID        *int      `json:"rule_id" db:"rule_id"`
+	MatchField    string    `json:"match_field" db:"match_field"`
+	MatchValue    string    `json:"match_value" db:"match_value"`
+	DetectedAt    time.Time `json:"detected_at" db:"detected_at"`
+}
+
+// QuotaStatus represents usage of the active tier's rolling-window call quota
+type QuotaStatus struct {
+	AccountID          int        `json:"account_id"`
+	AccountName        string     `json:"account_name"`
+	Tier               string     `json:"tier"`
+	TierName           string     `json:"tier_name"`
+	Tracked            bool       `json:"tracked"` // 当前等级未配置周期和次数限制时为false
+	PeriodHours        int        `json:"period_hours"`
+	CallLimit          int        `json:"call_limit"`
+	Used               int        `json:"used"`
+	Remaining          int        `json:"remaining"`
+	Percentage         float64    `json:"percentage"`
+	Level              string     `json:"level"` // normal, warning (>=80%), exceeded (>=100%)
+	WindowStart        time.Time  `json:"window_start"`
+	WindowEnd          time.Time  `json:"window_end"`
+	OldestUsageAt      *time.Time `json:"oldest_usage_at,omitempty"`
+	OldestExpiresAt    *time.Time `json:"oldest_expires_at,omitempty"` // 最早计入的用量移出窗口的时间
+	CallsPerHour       float64    `json:"calls_per_hour"`
+	TimeToLimitSeconds *int64     `json:"time_to_limit_seconds,omitempty"` // 按当前速度达到上限的剩余时间
+	EstimatedLimitAt   *time.Time `json:"estimated_limit_at,omitempty"`
+}
+
+// GroupCostCenter represents group_cost_centers table structure
+type GroupCostCenter struct {
+	GroupID     string    `json:"group_id" db:"group_id"` // group_id 或 use_group_id
+	GroupName   string    `json:"group_name" db:"group_name"`
+	CostCenter  string    `json:"cost_center" db:"cost_center"`
+	Description string    `json:"description" db:"description"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
 // SyncStatus represents current sync status
 type SyncStatus struct {
 	IsSyncing      bool       `json:"is_syncing"`
@@ -181,6 +572,7 @@ type BillFilter struct {
 	MinCashCost *float64   `json:"min_cash_cost"`
 	MaxCashCost *float64   `json:"max_cash_cost"`
 	SearchTerm  *string    `json:"search_term"`
+	AccountID   *int       `json:"account_id"` // 为空时包含全部账号
 }
 
 // StatsResponse represents statistics response
@@ -205,11 +597,14 @@ type HourlyUsageData struct {
 
 // ModelDistributionData represents model usage distribution
 type ModelDistributionData struct {
-	ModelName  string  `json:"model_name"`
-	CallCount  int     `json:"call_count"`
-	TokenUsage float64 `json:"token_usage"`
-	CashCost   float64 `json:"cash_cost"`
-	Percentage float64 `json:"percentage"`
+	ModelName             string  `json:"model_name"`
+	CallCount             int     `json:"call_count"`
+	TokenUsage            float64 `json:"token_usage"` // 归一化后的实际token数
+	InputTokens           float64 `json:"input_tokens"`
+	OutputTokens          float64 `json:"output_tokens"`
+	CashCost              float64 `json:"cash_cost"`
+	Percentage            float64 `json:"percentage"`
+	PricePerMillionTokens float64 `json:"price_per_million_tokens"` // 每百万tokens实际单价（元）
 }
 
 // ChargeTypeStatsData represents charge type statistics
@@ -220,6 +615,104 @@ type ChargeTypeStatsData struct {
 	Percentage float64 `json:"percentage"`
 }
 
+// APIKeyDistributionData represents usage distribution by API key
+type APIKeyDistributionData struct {
+	KeyID      string  `json:"key_id"`  // API Key的稳定标识，用于查询趋势
+	APIKey     string  `json:"api_key"` // 已脱敏的API Key
+	CallCount  int     `json:"call_count"`
+	TokenUsage float64 `json:"token_usage"`
+	CashCost   float64 `json:"cash_cost"`
+	Percentage float64 `json:"percentage"`
+}
+
+// APIKeyTrendData represents daily usage of a single API key
+type APIKeyTrendData struct {
+	Date       string  `json:"date"`
+	CallCount  int     `json:"call_count"`
+	TokenUsage float64 `json:"token_usage"`
+	CashCost   float64 `json:"cash_cost"`
+}
+
+// GroupUsageData represents usage and spend of a single group
+type GroupUsageData struct {
+	GroupID     string                  `json:"group_id"`
+	GroupName   string                  `json:"group_name"`
+	CostCenter  string                  `json:"cost_center"`
+	CallCount   int                     `json:"call_count"`
+	TokenUsage  float64                 `json:"token_usage"`
+	CashCost    float64                 `json:"cash_cost"`
+	Percentage  float64                 `json:"percentage"`
+	TopModels   []ModelDistributionData `json:"top_models"`
+	DailySeries []DailyUsageData        `json:"daily_series"`
+}
+
+// DailyUsageData represents usage aggregated by day
+type DailyUsageData struct {
+	Date       string  `json:"date"`
+	CallCount  int     `json:"call_count"`
+	TokenUsage float64 `json:"token_usage"`
+	CashCost   float64 `json:"cash_cost"`
+}
+
+// CostCenterChargeback represents the monthly chargeback of a single cost center
+type CostCenterChargeback struct {
+	CostCenter   string   `json:"cost_center"`
+	BillingMonth string   `json:"billing_month"`
+	Groups       []string `json:"groups"`
+	CallCount    int      `json:"call_count"`
+	TokenUsage   float64  `json:"token_usage"`
+	CashCost     float64  `json:"cash_cost"`
+	Percentage   float64  `json:"percentage"`
+}
+
+// ReportTable represents a tabular report that can be exported
+type ReportTable struct {
+	Title   string     `json:"title"`
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+// UsageTotals represents aggregated usage within a period
+type UsageTotals struct {
+	CallCount  int     `json:"call_count"`
+	TokenUsage float64 `json:"token_usage"`
+	CashCost   float64 `json:"cash_cost"`
+}
+
+// PeriodRange represents a half-open time range [Start, End)
+type PeriodRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// MetricDelta represents a metric compared between two periods
+type MetricDelta struct {
+	Current      float64 `json:"current"`
+	Previous     float64 `json:"previous"`
+	Delta        float64 `json:"delta"`
+	DeltaPercent float64 `json:"delta_percent"` // 上期为0且本期有用量时为100
+}
+
+// UsageComparison represents calls, tokens and cost compared between two periods
+type UsageComparison struct {
+	Key    string      `json:"key"`   // 维度取值，总体对比时为空
+	Label  string      `json:"label"` // 展示名称（API Key已脱敏）
+	Calls  MetricDelta `json:"calls"`
+	Tokens MetricDelta `json:"tokens"`
+	Cost   MetricDelta `json:"cost"`
+}
+
+// PeriodComparison represents a period-over-period comparison
+type PeriodComparison struct {
+	Preset       string            `json:"preset"`
+	Current      PeriodRange       `json:"current"`
+	Previous     PeriodRange       `json:"previous"`
+	Overall      UsageComparison   `json:"overall"`
+	ByModel      []UsageComparison `json:"by_model"`
+	ByChargeType []UsageComparison `json:"by_charge_type"`
+	ByAPIKey     []UsageComparison `json:"by_api_key"`
+}
+
 // SyncProgress represents sync progress for callback
 type SyncProgress struct {
 	CurrentPage int `json:"current_page"`
@@ -231,6 +724,18 @@ type SyncProgress struct {
 
 // SyncResult represents result of a sync operation
 type SyncResult struct {
+	Success      bool                `json:"success"`
+	SyncedItems  int                 `json:"synced_items"`
+	TotalItems   int                 `json:"total_items"`
+	FailedItems  int                 `json:"failed_items"`
+	ErrorMessage string              `json:"error_message,omitempty"`
+	Accounts     []AccountSyncResult `json:"accounts,omitempty"` // 各账号的同步结果
+}
+
+// AccountSyncResult represents the sync result of a single account
+type AccountSyncResult struct {
+	AccountID    int    `json:"account_id"`
+	AccountName  string `json:"account_name"`
 	Success      bool   `json:"success"`
 	SyncedItems  int    `json:"synced_items"`
 	TotalItems   int    `json:"total_items"`
@@ -260,3 +765,17 @@ type PaginatedResult struct {
 	Pagination PaginationParams `json:"pagination"`
 	Total      int              `json:"total"`
 }
+
+// UsageAnomaly represents usage_anomalies table structure
+type UsageAnomaly struct {
+	ID         int       `json:"id" db:"id"`
+	HourStart  time.Time `json:"hour_start" db:"hour_start"`   // 异常所在小时的起始时间
+	Metric     string    `json:"metric" db:"metric"`           // 指标 (calls, cost)
+	Value      float64   `json:"value" db:"value"`             // 该小时的实际值
+	Baseline   float64   `json:"baseline" db:"baseline"`       // 同一周内小时的历史中位数
+	Deviation  float64   `json:"deviation" db:"deviation"`     // 历史中位数绝对偏差 (MAD)
+	Score      float64   `json:"score" db:"score"`             // 稳健z分数
+	TopModel   string    `json:"top_model" db:"top_model"`     // 该小时用量最高的模型
+	TopAPIKey  string    `json:"top_api_key" db:"top_api_key"` // 该小时用量最高的API Key（已脱敏）
+	DetectedAt time.Time `json:"detected_at" db:"detected_at"`
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	// 内嵌时区数据，Windows等缺少系统zoneinfo的平台也能加载时区
+	_ "time/tzdata"
+)
+
+// DefaultReportingTimezone is the timezone used for reporting until configured otherwise
+const DefaultReportingTimezone = "Asia/Shanghai"
+
+// ReportingTimezoneConfigKey is the config key holding the reporting timezone
+const ReportingTimezoneConfigKey = "reporting_timezone"
+
+var (
+	reportingMu       sync.RWMutex
+	reportingLocation = mustLoadLocation(DefaultReportingTimezone)
+)
+
+// mustLoadLocation loads a location, falling back to a fixed UTC+8 zone
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.FixedZone(name, 8*60*60)
+	}
+	return loc
+}
+
+// SetReportingTimezone sets the IANA timezone (e.g. "Asia/Shanghai") used for
+// parsing API times and bucketing statistics by day, week and month
+func SetReportingTimezone(name string) error {
+	if name == "" {
+		return fmt.Errorf("timezone cannot be empty")
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %s: %w", name, err)
+	}
+
+	reportingMu.Lock()
+	reportingLocation = loc
+	reportingMu.Unlock()
+
+	return nil
+}
+
+// ReportingLocation returns the configured reporting timezone
+func ReportingLocation() *time.Location {
+	reportingMu.RLock()
+	defer reportingMu.RUnlock()
+	return reportingLocation
+}
+
+// ReportingTimezone returns the name of the configured reporting timezone
+func ReportingTimezone() string {
+	return ReportingLocation().String()
+}
+
+// ReportingNow returns the current time in the reporting timezone
+func ReportingNow() time.Time {
+	return time.Now().In(ReportingLocation())
+}
+
+// reportingOffsetYears is how many years back ReportingOffsetExpr resolves zone transitions
+const reportingOffsetYears = 10
+
+// ReportingOffsetModifier returns the SQLite date modifier (e.g. "+28800 seconds") that
+// shifts the current UTC time into the reporting timezone. Use ReportingOffsetExpr for
+// stored timestamps, whose offset may differ from the current one in DST zones.
+func ReportingOffsetModifier() string {
+	_, offset := ReportingNow().Zone()
+	return offsetModifier(offset)
+}
+
+// ReportingOffsetExpr returns a SQL expression evaluating to the SQLite date modifier that
+// shifts the UTC timestamp in column into the reporting timezone, using the offset in effect
+// at that timestamp. Fixed-offset zones yield a plain literal; zones with DST yield a CASE
+// over their transitions in recent years, earlier rows using the oldest offset covered.
+func ReportingOffsetExpr(column string) string {
+	loc := ReportingLocation()
+	now := time.Now()
+	start := time.Date(now.Year()-reportingOffsetYears, 1, 1, 0, 0, 0, 0, loc)
+	end := time.Date(now.Year()+2, 1, 1, 0, 0, 0, 0, loc)
+
+	var cases strings.Builder
+	t := start
+	for {
+		_, offset := t.Zone()
+		_, next := t.ZoneBounds()
+		if next.IsZero() || !next.Before(end) {
+			if cases.Len() == 0 {
+				return "'" + offsetModifier(offset) + "'"
+			}
+			return fmt.Sprintf("CASE%s ELSE '%s' END", cases.String(), offsetModifier(offset))
+		}
+		// 转换时刻按UTC比较，datetime() 会把带偏移的存储格式换算为UTC
+		fmt.Fprintf(&cases, " WHEN datetime(%s) < '%s' THEN '%s'",
+			column, next.UTC().Format("2006-01-02 15:04:05"), offsetModifier(offset))
+		t = next
+	}
+}
+
+// offsetModifier formats a UTC offset in seconds as a SQLite date modifier
+func offsetModifier(offset int) string {
+	return fmt.Sprintf("%+d seconds", offset)
+}
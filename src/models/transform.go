@@ -1,6 +1,10 @@
 package models
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -14,7 +18,7 @@ type TimeWindow struct {
 	End   time.Time `json:"end"`
 }
 
-// ParseTimeWindow parses the time window string from the API response
+// ParseTimeWindow parses the time window string from the API response in the reporting timezone
 // Format: "2025-11-01 00:00:00 - 2025-11-01 23:59:59"
 func ParseTimeWindow(timeWindowStr string) (*TimeWindow, error) {
 	if timeWindowStr == "" {
@@ -30,14 +34,16 @@ func ParseTimeWindow(timeWindowStr string) (*TimeWindow, error) {
 	startTimeStr := strings.TrimSpace(parts[0])
 	endTimeStr := strings.TrimSpace(parts[1])
 
+	loc := ReportingLocation()
+
 	// Parse start time
-	startTime, err := time.Parse("2006-01-02 15:04:05", startTimeStr)
+	startTime, err := time.ParseInLocation("2006-01-02 15:04:05", startTimeStr, loc)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse start time %s: %w", startTimeStr, err)
 	}
 
 	// Parse end time
-	endTime, err := time.Parse("2006-01-02 15:04:05", endTimeStr)
+	endTime, err := time.ParseInLocation("2006-01-02 15:04:05", endTimeStr, loc)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse end time %s: %w", endTimeStr, err)
 	}
@@ -70,94 +76,118 @@ func ExtractTransactionTime(billingNo string) (time.Time, error) {
 		return time.Time{}, fmt.Errorf("failed to parse timestamp %s: %w", timestampStr, err)
 	}
 
-	// Convert milliseconds timestamp to time.Time
-	return time.Unix(timestamp/1000, (timestamp%1000)*1000000), nil
+	// Convert milliseconds timestamp to time.Time in the reporting timezone
+	return time.UnixMilli(timestamp).In(ReportingLocation()), nil
 }
 
-// TransformExpenseBill transforms raw expense bill data into our database model
-func TransformExpenseBill(rawBill map[string]interface{}) (*ExpenseBill, error) {
-	bill := &ExpenseBill{}
-
-	// Basic string fields
-	if v, ok := rawBill["charge_name"].(string); ok {
-		bill.ChargeName = v
-	}
-	if v, ok := rawBill["charge_type"].(string); ok {
-		bill.ChargeType = v
-	}
-	if v, ok := rawBill["model_name"].(string); ok {
-		bill.ModelName = v
-	}
-	if v, ok := rawBill["use_group_name"].(string); ok {
-		bill.UseGroupName = v
-	}
-	if v, ok := rawBill["group_name"].(string); ok {
-		bill.GroupName = v
-	}
-	if v, ok := rawBill["billing_no"].(string); ok {
-		bill.BillingNo = v
-	}
-	if v, ok := rawBill["order_time"].(string); ok {
-		bill.OrderTime = v
-	}
-	if v, ok := rawBill["use_group_id"].(string); ok {
-		bill.UseGroupID = v
-	}
-	if v, ok := rawBill["group_id"].(string); ok {
-		bill.GroupID = v
-	}
-	if v, ok := rawBill["charge_unit_symbol"].(string); ok {
-		bill.ChargeUnitSymbol = v
-	}
-
-	// Numeric fields
-	if v, ok := rawBill["discount_rate"].(float64); ok {
-		bill.DiscountRate = v
-	} else if v, ok := rawBill["discount_rate"].(string); ok {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			bill.DiscountRate = f
-		}
+// ExtractCustomerID extracts the account identifier from billingNo, i.e. the part before
+// the 13-digit timestamp
+func ExtractCustomerID(billingNo string) string {
+	re := regexp.MustCompile(`^(.+?)_?\d{13}$`)
+	matches := re.FindStringSubmatch(billingNo)
+	if len(matches) < 2 {
+		return ""
 	}
+	return matches[1]
+}
 
-	if v, ok := rawBill["cost_rate"].(float64); ok {
-		bill.CostRate = v
-	} else if v, ok := rawBill["cost_rate"].(string); ok {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			bill.CostRate = f
-		}
+// rawString reads a string field of a raw bill
+func rawString(rawBill map[string]interface{}, key string) string {
+	if v, ok := rawBill[key].(string); ok {
+		return v
 	}
+	return ""
+}
 
-	if v, ok := rawBill["cash_cost"].(float64); ok {
-		bill.CashCost = v
-	} else if v, ok := rawBill["cash_cost"].(string); ok {
+// rawFloat reads a numeric field of a raw bill that may be encoded as a number or a string
+func rawFloat(rawBill map[string]interface{}, key string) float64 {
+	switch v := rawBill[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case string:
 		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			bill.CashCost = f
+			return f
 		}
 	}
+	return 0
+}
 
-	if v, ok := rawBill["charge_unit"].(float64); ok {
-		bill.ChargeUnit = v
-	} else if v, ok := rawBill["charge_unit"].(string); ok {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			bill.ChargeUnit = f
-		}
-	}
+// TransformExpenseBill transforms raw expense bill data into our database model
+func TransformExpenseBill(rawBill map[string]interface{}) (*ExpenseBill, error) {
+	bill := &ExpenseBill{}
 
-	if v, ok := rawBill["charge_count"].(float64); ok {
-		bill.ChargeCount = v
-	} else if v, ok := rawBill["charge_count"].(string); ok {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			bill.ChargeCount = f
-		}
-	}
+	// Basic string fields
+	bill.ChargeName = rawString(rawBill, "charge_name")
+	bill.ChargeType = rawString(rawBill, "charge_type")
+	bill.ModelName = rawString(rawBill, "model_name")
+	bill.UseGroupName = rawString(rawBill, "use_group_name")
+	bill.GroupName = rawString(rawBill, "group_name")
+	bill.BillingNo = rawString(rawBill, "billing_no")
+	bill.OrderTime = rawString(rawBill, "order_time")
+	bill.UseGroupID = rawString(rawBill, "use_group_id")
+	bill.GroupID = rawString(rawBill, "group_id")
+	bill.ChargeUnitSymbol = rawString(rawBill, "charge_unit_symbol")
 
-	if v, ok := rawBill["trial_cash_cost"].(float64); ok {
-		bill.TrialCashCost = v
-	} else if v, ok := rawBill["trial_cash_cost"].(string); ok {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			bill.TrialCashCost = f
-		}
-	}
+	// Numeric fields
+	bill.DiscountRate = rawFloat(rawBill, "discount_rate")
+	bill.CostRate = rawFloat(rawBill, "cost_rate")
+	bill.CashCost = rawFloat(rawBill, "cash_cost")
+	bill.ChargeUnit = rawFloat(rawBill, "charge_unit")
+	bill.ChargeCount = rawFloat(rawBill, "charge_count")
+	bill.TrialCashCost = rawFloat(rawBill, "trial_cash_cost")
+
+	// Bill detail fields
+	bill.BillingDate = rawString(rawBill, "billing_date")
+	bill.BillingTime = rawString(rawBill, "billing_time")
+	bill.CustomerID = rawString(rawBill, "customer_id")
+	bill.OrderNo = rawString(rawBill, "order_no")
+	bill.OriginalAmount = rawFloat(rawBill, "original_amount")
+	bill.OriginalCostPrice = rawFloat(rawBill, "original_cost_price")
+	bill.DiscountType = rawString(rawBill, "discount_type")
+	bill.CreditPayAmount = rawFloat(rawBill, "credit_pay_amount")
+	bill.ThirdParty = rawFloat(rawBill, "third_party")
+	bill.CashAmount = rawFloat(rawBill, "cash_amount")
+	bill.APIUsage = int(rawFloat(rawBill, "api_usage"))
+
+	// Model fields
+	bill.APIKey = rawString(rawBill, "api_key")
+	bill.ModelCode = rawString(rawBill, "model_code")
+	bill.ModelProductType = rawString(rawBill, "model_product_type")
+	bill.ModelProductSubtype = rawString(rawBill, "model_product_subtype")
+	bill.ModelProductCode = rawString(rawBill, "model_product_code")
+	bill.ModelProductName = rawString(rawBill, "model_product_name")
+
+	// Payment, cost and usage fields
+	bill.PaymentType = rawString(rawBill, "payment_type")
+	bill.StartTime = rawString(rawBill, "start_time")
+	bill.EndTime = rawString(rawBill, "end_time")
+	bill.BusinessID = rawString(rawBill, "business_id")
+	bill.CostPrice = rawFloat(rawBill, "cost_price")
+	bill.CostUnit = rawString(rawBill, "cost_unit")
+	bill.UsageCount = rawFloat(rawBill, "usage_count")
+	bill.UsageExempt = rawFloat(rawBill, "usage_exempt")
+	bill.UsageUnit = rawString(rawBill, "usage_unit")
+	bill.Currency = rawString(rawBill, "currency")
+
+	// Amount fields
+	bill.SettlementAmount = rawFloat(rawBill, "settlement_amount")
+	bill.GiftDeductAmount = rawFloat(rawBill, "gift_deduct_amount")
+	bill.DueAmount = rawFloat(rawBill, "due_amount")
+	bill.PaidAmount = rawFloat(rawBill, "paid_amount")
+	bill.UnpaidAmount = rawFloat(rawBill, "unpaid_amount")
+	bill.BillingStatus = rawString(rawBill, "billing_status")
+	bill.InvoicingAmount = rawFloat(rawBill, "invoicing_amount")
+	bill.InvoicedAmount = rawFloat(rawBill, "invoiced_amount")
+
+	// Token resource package fields
+	bill.TokenAccountID = rawString(rawBill, "token_account_id")
+	bill.TokenResourceNo = rawString(rawBill, "token_resource_no")
+	bill.TokenResourceName = rawString(rawBill, "token_resource_name")
+	bill.DeductUsage = rawFloat(rawBill, "deduct_usage")
+	bill.DeductAfter = rawString(rawBill, "deduct_after")
+	bill.TokenType = rawString(rawBill, "token_type")
 
 	// Time window processing
 	if v, ok := rawBill["time_window"].(string); ok && v != "" {
@@ -230,6 +260,21 @@ func (bill *ExpenseBill) ConvertToDatabaseFriendly() interface{} {
 	}
 }
 
+// ToCSV renders the report table as CSV with a header row
+func (t *ReportTable) ToCSV() (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	if err := writer.Write(t.Columns); err != nil {
+		return "", fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	if err := writer.WriteAll(t.Rows); err != nil {
+		return "", fmt.Errorf("failed to write CSV rows: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
 // FormatCashCost formats cash cost to a readable string
 func FormatCashCost(cost float64) string {
 	return fmt.Sprintf("¥%.4f", cost)
@@ -268,3 +313,23 @@ func FormatDateForAPI(t time.Time) string {
 func FormatTimeForAPI(t time.Time) string {
 	return t.Format("15:04:05")
 }
+
+// MaskSecret masks a secret value for display, keeping only the first and last 4 characters
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + "****" + secret[len(secret)-4:]
+}
+
+// SecretID returns a stable, non-reversible identifier for a secret value
+func SecretID(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// UsageKind is the kind of consumption a bill unit measures
+type UsageKind string
+
+const (
+	UsageKindTokens UsageKind = "tokens"
+	UsageKindCalls  UsageKind = "calls"
+	UsageKindImages UsageKind = "images"
+	UsageKindOther  UsageKind = "other"
+)
+
+// TokenDirection tells whether tokens were consumed as input or output
+type TokenDirection string
+
+const (
+	TokenDirectionInput   TokenDirection = "input"
+	TokenDirectionOutput  TokenDirection = "output"
+	TokenDirectionUnknown TokenDirection = ""
+)
+
+// NormalizedUsage represents real consumption derived from a bill's unit fields
+type NormalizedUsage struct {
+	InputTokens  float64 `json:"input_tokens"`
+	OutputTokens float64 `json:"output_tokens"`
+	TotalTokens  float64 `json:"total_tokens"` // 含无法区分输入/输出的tokens
+	Calls        float64 `json:"calls"`
+	Images       float64 `json:"images"`
+	OtherUnits   float64 `json:"other_units"`
+}
+
+// unitMultipliers maps quantity prefixes in unit symbols to their multiplier
+var unitMultipliers = []struct {
+	prefix     string
+	multiplier float64
+}{
+	{"百万", 1000000},
+	{"千万", 10000000},
+	{"万", 10000},
+	{"千", 1000},
+	{"1m", 1000000},
+	{"m", 1000000},
+	{"1k", 1000},
+	{"k", 1000},
+}
+
+// ParseUsageUnit returns the kind of consumption a unit symbol measures and the number
+// of base units per unit, e.g. "千tokens" -> (tokens, 1000), "次" -> (calls, 1)
+func ParseUsageUnit(unit string) (UsageKind, float64) {
+	u := strings.ToLower(strings.TrimSpace(unit))
+	u = strings.TrimPrefix(u, "/")
+	if u == "" {
+		return UsageKindOther, 1
+	}
+
+	switch {
+	case strings.Contains(u, "token"):
+		prefix := strings.TrimSpace(u[:strings.Index(u, "token")])
+		if n, err := strconv.ParseFloat(prefix, 64); err == nil && n > 0 {
+			return UsageKindTokens, n // 如 "1000tokens"
+		}
+		for _, m := range unitMultipliers {
+			if prefix == m.prefix {
+				return UsageKindTokens, m.multiplier
+			}
+		}
+		return UsageKindTokens, 1
+	case strings.Contains(u, "次"), strings.Contains(u, "call"), strings.Contains(u, "request"), strings.Contains(u, "times"):
+		return UsageKindCalls, 1
+	case strings.Contains(u, "张"), strings.Contains(u, "幅"), strings.Contains(u, "image"), strings.Contains(u, "img"), strings.Contains(u, "pic"):
+		return UsageKindImages, 1
+	default:
+		return UsageKindOther, 1
+	}
+}
+
+// ParseTokenDirection infers whether tokens are input or output from the token type
+// or, failing that, from the charge name (e.g. "GLM-4 输出")
+func ParseTokenDirection(tokenType, chargeName string) TokenDirection {
+	for _, s := range []string{tokenType, chargeName} {
+		v := strings.ToLower(s)
+		switch {
+		case strings.Contains(v, "输入"), strings.Contains(v, "input"), strings.Contains(v, "prompt"):
+			return TokenDirectionInput
+		case strings.Contains(v, "输出"), strings.Contains(v, "output"), strings.Contains(v, "completion"):
+			return TokenDirectionOutput
+		}
+	}
+	return TokenDirectionUnknown
+}
+
+// NormalizeUsage converts a quantity in the given unit into normalized consumption
+func NormalizeUsage(quantity float64, unit, tokenType, chargeName string) NormalizedUsage {
+	var usage NormalizedUsage
+	if quantity <= 0 {
+		return usage
+	}
+
+	kind, multiplier := ParseUsageUnit(unit)
+	amount := quantity * multiplier
+
+	switch kind {
+	case UsageKindTokens:
+		usage.TotalTokens = amount
+		switch ParseTokenDirection(tokenType, chargeName) {
+		case TokenDirectionInput:
+			usage.InputTokens = amount
+		case TokenDirectionOutput:
+			usage.OutputTokens = amount
+		}
+	case UsageKindCalls:
+		usage.Calls = amount
+	case UsageKindImages:
+		usage.Images = amount
+	default:
+		usage.OtherUnits = amount
+	}
+
+	return usage
+}
+
+// NormalizeUsage converts the bill into normalized consumption. usage_count/usage_unit hold the
+// real consumption; bills without them fall back to charge_count in charge_unit_symbol units.
+func (bill *ExpenseBill) NormalizeUsage() NormalizedUsage {
+	if bill.UsageCount > 0 {
+		return NormalizeUsage(bill.UsageCount, bill.UsageUnit, bill.TokenType, bill.ChargeName)
+	}
+	return NormalizeUsage(bill.ChargeCount, bill.ChargeUnitSymbol, bill.TokenType, bill.ChargeName)
+}
+
+// Add accumulates other into the usage
+func (u *NormalizedUsage) Add(other NormalizedUsage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.TotalTokens += other.TotalTokens
+	u.Calls += other.Calls
+	u.Images += other.Images
+	u.OtherUnits += other.OtherUnits
+}
+
+// ListPrice returns the cost of a quantity at costPrice per costUnit, converting between unit
+// multipliers of the same kind (e.g. 1500 tokens at 0.005 per 千tokens -> 0.0075)
+func ListPrice(quantity float64, unit string, costPrice float64, costUnit string) float64 {
+	if quantity <= 0 || costPrice <= 0 {
+		return 0
+	}
+
+	kind, multiplier := ParseUsageUnit(unit)
+	costKind, costMultiplier := ParseUsageUnit(costUnit)
+	if strings.TrimSpace(costUnit) == "" || kind != costKind {
+		return quantity * costPrice // 单位无法换算时按计量单位直接计价
+	}
+
+	return quantity * multiplier / costMultiplier * costPrice
+}
+
+// PricePerMillionTokens returns the effective price per million tokens, or 0 without token usage
+func PricePerMillionTokens(cost, tokens float64) float64 {
+	if tokens <= 0 {
+		return 0
+	}
+	return cost / tokens * 1000000
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Usage query dimensions
+const (
+	UsageDimensionModel      = "model"
+	UsageDimensionChargeType = "charge_type"
+	UsageDimensionAPIKey     = "api_key"
+	UsageDimensionGroup      = "group"
+	UsageDimensionUseGroup   = "use_group"
+	UsageDimensionProduct    = "product"
+	UsageDimensionHour       = "hour"
+	UsageDimensionDay        = "day"
+	UsageDimensionWeek       = "week"
+	UsageDimensionMonth      = "month"
+	UsageDimensionWeekday    = "weekday"     // 0=周日 ... 6=周六
+	UsageDimensionHourOfDay  = "hour_of_day" // 00-23
+	UsageDimensionAccount    = "account"     // 账单所属账号（令牌名称）
+)
+
+// Usage query metrics
+const (
+	UsageMetricCalls        = "calls"
+	UsageMetricTokens       = "tokens"
+	UsageMetricInputTokens  = "input_tokens"
+	UsageMetricOutputTokens = "output_tokens"
+	UsageMetricCost         = "cost"
+	UsageMetricGiftDeducted = "gift_deducted"
+)
+
+// UsageDimensionLabels maps each supported dimension to its display label
+var UsageDimensionLabels = map[string]string{
+	UsageDimensionModel:      "模型",
+	UsageDimensionChargeType: "计费类型",
+	UsageDimensionAPIKey:     "API Key",
+	UsageDimensionGroup:      "分组",
+	UsageDimensionUseGroup:   "使用分组",
+	UsageDimensionProduct:    "产品",
+	UsageDimensionHour:       "小时",
+	UsageDimensionDay:        "日期",
+	UsageDimensionWeek:       "周",
+	UsageDimensionMonth:      "月份",
+	UsageDimensionWeekday:    "星期",
+	UsageDimensionHourOfDay:  "时段",
+	UsageDimensionAccount:    "账号",
+}
+
+// UsageMetricLabels maps each supported metric to its display label
+var UsageMetricLabels = map[string]string{
+	UsageMetricCalls:        "调用次数",
+	UsageMetricTokens:       "Token用量",
+	UsageMetricInputTokens:  "输入Token",
+	UsageMetricOutputTokens: "输出Token",
+	UsageMetricCost:         "费用(元)",
+	UsageMetricGiftDeducted: "赠送抵扣(元)",
+}
+
+// IsTimeDimension reports whether the dimension buckets by time
+func IsTimeDimension(dimension string) bool {
+	switch dimension {
+	case UsageDimensionHour, UsageDimensionDay, UsageDimensionWeek, UsageDimensionMonth:
+		return true
+	}
+	return false
+}
+
+// UsageHeatmap represents usage by day of week and hour of day in the reporting timezone
+type UsageHeatmap struct {
+	Metric   string         `json:"metric"`
+	Timezone string         `json:"timezone"`
+	Days     []string       `json:"days"`   // 行标签，周一在前
+	Hours    []int          `json:"hours"`  // 列标签 0-23
+	Values   [7][24]float64 `json:"values"` // Values[day][hour]
+	Max      float64        `json:"max"`
+	Total    float64        `json:"total"`
+}
+
+// UsageQueryFilter restricts the bills included in a usage query
+type UsageQueryFilter struct {
+	StartTime   *time.Time `json:"start_time"` // 包含
+	EndTime     *time.Time `json:"end_time"`   // 不包含
+	ModelNames  []string   `json:"model_names"`
+	ChargeTypes []string   `json:"charge_types"`
+	APIKeys     []string   `json:"api_keys"` // 原始API Key或key_id
+	GroupIDs    []string   `json:"group_ids"`
+	AccountIDs  []int      `json:"account_ids"` // api_tokens.id，为空时包含全部账号
+}
+
+// UsageQuery describes a generic aggregation over expense bills
+type UsageQuery struct {
+	Dimensions  []string         `json:"dimensions"`
+	Metrics     []string         `json:"metrics"`
+	Granularity string           `json:"granularity"` // hour, day, week, month；为空时不按时间分桶
+	Filter      UsageQueryFilter `json:"filter"`
+	OrderBy     string           `json:"order_by"` // 维度或指标名，默认按时间升序或首个指标降序
+	Descending  bool             `json:"descending"`
+	Limit       int              `json:"limit"`
+}
+
+// UsageQueryColumn describes a column of a usage query result
+type UsageQueryColumn struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	Type  string `json:"type"` // dimension 或 metric
+}
+
+// UsageQueryRow represents a single row of a usage query result
+type UsageQueryRow struct {
+	Dimensions map[string]string  `json:"dimensions"`
+	Metrics    map[string]float64 `json:"metrics"`
+}
+
+// UsageQueryResult represents the typed table returned by a usage query
+type UsageQueryResult struct {
+	Columns []UsageQueryColumn `json:"columns"`
+	Rows    []UsageQueryRow    `json:"rows"`
+}
+
+// Normalize validates the query, applies defaults and moves the granularity into the dimensions
+func (q *UsageQuery) Normalize() error {
+	if len(q.Metrics) == 0 {
+		q.Metrics = []string{UsageMetricCalls, UsageMetricTokens, UsageMetricCost}
+	}
+
+	if q.Granularity != "" {
+		if !IsTimeDimension(q.Granularity) {
+			return fmt.Errorf("invalid granularity: %s. Valid values are: hour, day, week, month", q.Granularity)
+		}
+
+		hasGranularity := false
+		for _, dimension := range q.Dimensions {
+			if dimension == q.Granularity {
+				hasGranularity = true
+				break
+			}
+		}
+		if !hasGranularity {
+			q.Dimensions = append([]string{q.Granularity}, q.Dimensions...)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, dimension := range q.Dimensions {
+		if _, ok := UsageDimensionLabels[dimension]; !ok {
+			return fmt.Errorf("invalid dimension: %s", dimension)
+		}
+		if seen[dimension] {
+			return fmt.Errorf("duplicate dimension: %s", dimension)
+		}
+		seen[dimension] = true
+	}
+
+	for _, metric := range q.Metrics {
+		if _, ok := UsageMetricLabels[metric]; !ok {
+			return fmt.Errorf("invalid metric: %s", metric)
+		}
+		if seen[metric] {
+			return fmt.Errorf("duplicate metric: %s", metric)
+		}
+		seen[metric] = true
+	}
+
+	if q.OrderBy != "" && !seen[q.OrderBy] {
+		return fmt.Errorf("order by must be one of the selected dimensions or metrics: %s", q.OrderBy)
+	}
+
+	if q.Filter.StartTime != nil && q.Filter.EndTime != nil && !q.Filter.EndTime.After(*q.Filter.StartTime) {
+		return fmt.Errorf("end time must be after start time")
+	}
+
+	if q.Limit < 0 {
+		return fmt.Errorf("limit cannot be negative")
+	}
+
+	return nil
+}
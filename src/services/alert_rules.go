@@ -0,0 +1,541 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"glm-usage-monitor/models"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alert rule comparisons
+const (
+	AlertComparisonGT  = "gt"
+	AlertComparisonGTE = "gte"
+	AlertComparisonLT  = "lt"
+	AlertComparisonLTE = "lte"
+	AlertComparisonEQ  = "eq"
+)
+
+// Alert severities
+const (
+	AlertSeverityInfo     = "info"
+	AlertSeverityWarning  = "warning"
+	AlertSeverityCritical = "critical"
+)
+
+// Alert rule states and event types
+const (
+	AlertStateOK       = "ok"
+	AlertStateFiring   = "firing"
+	AlertEventFiring   = "firing"
+	AlertEventResolved = "resolved"
+)
+
+// DefaultAlertEvaluationInterval is how often the alert engine evaluates rules on its timer
+const DefaultAlertEvaluationInterval = 5 * time.Minute
+
+// alertComparisonSymbols maps comparisons to their display symbols
+var alertComparisonSymbols = map[string]string{
+	AlertComparisonGT:  ">",
+	AlertComparisonGTE: "≥",
+	AlertComparisonLT:  "<",
+	AlertComparisonLTE: "≤",
+	AlertComparisonEQ:  "=",
+}
+
+// validateAlertRule checks an alert rule before it is saved
+func validateAlertRule(rule *models.AlertRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return fmt.Errorf("rule name is required")
+	}
+	if _, ok := models.UsageMetricLabels[rule.Metric]; !ok {
+		return fmt.Errorf("invalid metric: %s", rule.Metric)
+	}
+	if _, ok := alertComparisonSymbols[rule.Comparison]; !ok {
+		return fmt.Errorf("invalid comparison: %s", rule.Comparison)
+	}
+	if rule.WindowMinutes <= 0 || rule.WindowMinutes > 31*24*60 {
+		return fmt.Errorf("window must be between 1 minute and 31 days")
+	}
+	if rule.CooldownMinutes < 0 {
+		return fmt.Errorf("cooldown cannot be negative")
+	}
+
+	switch rule.Severity {
+	case "":
+		rule.Severity = AlertSeverityWarning
+	case AlertSeverityInfo, AlertSeverityWarning, AlertSeverityCritical:
+	default:
+		return fmt.Errorf("invalid severity: %s", rule.Severity)
+	}
+
+	for _, weekday := range rule.Weekdays {
+		if weekday < 0 || weekday > 6 {
+			return fmt.Errorf("invalid weekday: %d", weekday)
+		}
+	}
+
+	// 时间范围由窗口决定
+	rule.Filter.StartTime = nil
+	rule.Filter.EndTime = nil
+
+	return nil
+}
+
+// alertRuleColumns are the selected columns of alert_rules, in scanAlertRule order
+const alertRuleColumns = `id, name, metric, COALESCE(filter, ''), comparison, threshold, window_minutes, cooldown_minutes,
+	severity, COALESCE(weekdays, ''), enabled, COALESCE(description, ''), state, last_value,
+	last_evaluated_at, last_fired_at, created_at, updated_at`
+
+// scanAlertRule scans an alert rule row, decoding its JSON columns
+func scanAlertRule(rows *sql.Rows) (*models.AlertRule, error) {
+	var rule models.AlertRule
+	var filter, weekdays string
+	var lastValue sql.NullFloat64
+	var lastEvaluatedAt, lastFiredAt sql.NullTime
+	err := rows.Scan(&rule.ID, &rule.Name, &rule.Metric, &filter, &rule.Comparison, &rule.Threshold,
+		&rule.WindowMinutes, &rule.CooldownMinutes, &rule.Severity, &weekdays, &rule.Enabled,
+		&rule.Description, &rule.State, &lastValue, &lastEvaluatedAt, &lastFiredAt, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan alert rule: %w", err)
+	}
+
+	if filter != "" {
+		if err := json.Unmarshal([]byte(filter), &rule.Filter); err != nil {
+			return nil, fmt.Errorf("failed to parse filter of alert rule %d: %w", rule.ID, err)
+		}
+	}
+	if weekdays != "" {
+		if err := json.Unmarshal([]byte(weekdays), &rule.Weekdays); err != nil {
+			return nil, fmt.Errorf("failed to parse weekdays of alert rule %d: %w", rule.ID, err)
+		}
+	}
+	if lastValue.Valid {
+		rule.LastValue = &lastValue.Float64
+	}
+	if lastEvaluatedAt.Valid {
+		rule.LastEvaluatedAt = &lastEvaluatedAt.Time
+	}
+	if lastFiredAt.Valid {
+		rule.LastFiredAt = &lastFiredAt.Time
+	}
+
+	return &rule, nil
+}
+
+// GetAlertRules retrieves all alert rules
+func (s *DatabaseService) GetAlertRules() ([]models.AlertRule, error) {
+	rows, err := s.db.Query("SELECT " + alertRuleColumns + " FROM alert_rules ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []models.AlertRule
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+
+	return rules, nil
+}
+
+// SaveAlertRule creates an alert rule or updates an existing one. Editing a rule keeps its state.
+func (s *DatabaseService) SaveAlertRule(rule *models.AlertRule) error {
+	if err := validateAlertRule(rule); err != nil {
+		return err
+	}
+	if rule.Weekdays == nil {
+		rule.Weekdays = []int{}
+	}
+
+	filter, err := json.Marshal(rule.Filter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert rule filter: %w", err)
+	}
+	weekdays, err := json.Marshal(rule.Weekdays)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert rule weekdays: %w", err)
+	}
+
+	now := time.Now()
+	if rule.ID == 0 {
+		result, err := s.db.Exec(`
+			INSERT INTO alert_rules (name, metric, filter, comparison, threshold, window_minutes, cooldown_minutes,
+			                         severity, weekdays, enabled, description, state, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, rule.Name, rule.Metric, string(filter), rule.Comparison, rule.Threshold, rule.WindowMinutes,
+			rule.CooldownMinutes, rule.Severity, string(weekdays), rule.Enabled, rule.Description, AlertStateOK, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to create alert rule: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get alert rule ID: %w", err)
+		}
+		rule.ID = int(id)
+		rule.State = AlertStateOK
+		rule.CreatedAt = now
+		rule.UpdatedAt = now
+		return nil
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE alert_rules
+		SET name = ?, metric = ?, filter = ?, comparison = ?, threshold = ?, window_minutes = ?,
+		    cooldown_minutes = ?, severity = ?, weekdays = ?, enabled = ?, description = ?, updated_at = ?
+		WHERE id = ?
+	`, rule.Name, rule.Metric, string(filter), rule.Comparison, rule.Threshold, rule.WindowMinutes,
+		rule.CooldownMinutes, rule.Severity, string(weekdays), rule.Enabled, rule.Description, now, rule.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update alert rule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("alert rule not found: %d", rule.ID)
+	}
+
+	rule.UpdatedAt = now
+	return nil
+}
+
+// DeleteAlertRule deletes an alert rule; its events are kept as history
+func (s *DatabaseService) DeleteAlertRule(id int) error {
+	result, err := s.db.Exec("DELETE FROM alert_rules WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete alert rule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("alert rule not found: %d", id)
+	}
+
+	return nil
+}
+
+// GetAlertEvents retrieves recent alert events, optionally of one rule (ruleID > 0)
+func (s *DatabaseService) GetAlertEvents(ruleID, limit int) ([]models.AlertEvent, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	whereClause := "1=1"
+	args := []interface{}{}
+	if ruleID > 0 {
+		whereClause = "rule_id = ?"
+		args = append(args, ruleID)
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT id, rule_id, rule_name, event_type, severity, value, threshold, COALESCE(message, ''), created_at
+		FROM alert_events
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, whereClause), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AlertEvent{}
+	for rows.Next() {
+		var event models.AlertEvent
+		err := rows.Scan(&event.ID, &event.RuleID, &event.RuleName, &event.EventType, &event.Severity,
+			&event.Value, &event.Threshold, &event.Message, &event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan alert event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// AlertEngine evaluates user-defined alert rules after syncs and on a timer
+type AlertEngine struct {
+	db                  *sql.DB
+	dbService           *DatabaseService
+	statsService        *StatisticsService
+	notificationService *NotificationService
+
+	mu       sync.Mutex // 串行化定时评估与同步后评估
+	ticker   *time.Ticker
+	stopChan chan bool
+	running  bool
+}
+
+// NewAlertEngine creates a new alert engine
+func NewAlertEngine(db *sql.DB, dbService *DatabaseService, statsService *StatisticsService, notificationService *NotificationService) *AlertEngine {
+	return &AlertEngine{
+		db:                  db,
+		dbService:           dbService,
+		statsService:        statsService,
+		notificationService: notificationService,
+		stopChan:            make(chan bool, 1),
+	}
+}
+
+// Start evaluates rules periodically until Stop is called
+func (e *AlertEngine) Start(interval time.Duration) {
+	e.mu.Lock()
+	if e.running {
+		e.mu.Unlock()
+		return
+	}
+	e.running = true
+	e.ticker = time.NewTicker(interval)
+	ticker := e.ticker
+	e.mu.Unlock()
+
+	log.Printf("Alert engine started with interval: %v", interval)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Alert engine goroutine panic recovered: %v", r)
+			}
+		}()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := e.EvaluateRules(time.Now()); err != nil {
+					log.Printf("Error evaluating alert rules: %v", err)
+				}
+			case <-e.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic evaluation
+func (e *AlertEngine) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.running {
+		return
+	}
+
+	e.running = false
+	e.ticker.Stop()
+	select {
+	case e.stopChan <- true:
+	default:
+	}
+
+	log.Println("Alert engine stopped")
+}
+
+// EvaluateRules evaluates all enabled rules at now and returns the recorded events. A breached rule
+// fires and notifies at most once per cooldown; a firing rule that no longer breaches resolves.
+func (e *AlertEngine) EvaluateRules(now time.Time) ([]models.AlertEvent, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules, err := e.dbService.GetAlertRules()
+	if err != nil {
+		return nil, err
+	}
+
+	events := []models.AlertEvent{}
+	for _, rule := range rules {
+		if !rule.Enabled || !alertRuleActiveOn(rule, now) {
+			continue
+		}
+
+		event, err := e.evaluateRule(rule, now)
+		if err != nil {
+			log.Printf("Error evaluating alert rule %s: %v", rule.Name, err)
+			continue
+		}
+		if event != nil {
+			events = append(events, *event)
+		}
+	}
+
+	return events, nil
+}
+
+// alertRuleActiveOn reports whether the rule is evaluated on now's weekday in the reporting timezone
+func alertRuleActiveOn(rule models.AlertRule, now time.Time) bool {
+	if len(rule.Weekdays) == 0 {
+		return true
+	}
+	weekday := int(now.In(models.ReportingLocation()).Weekday())
+	for _, day := range rule.Weekdays {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateRule computes the rule's metric over its window and applies the state transition
+func (e *AlertEngine) evaluateRule(rule models.AlertRule, now time.Time) (*models.AlertEvent, error) {
+	value, err := e.queryRuleValue(rule, now)
+	if err != nil {
+		return nil, err
+	}
+	breached := compareAlertValue(value, rule.Comparison, rule.Threshold)
+
+	cooldownPassed := rule.LastFiredAt == nil ||
+		now.Sub(*rule.LastFiredAt) >= time.Duration(rule.CooldownMinutes)*time.Minute
+
+	var event *models.AlertEvent
+	state := rule.State
+	lastFiredAt := rule.LastFiredAt
+	switch {
+	case breached && cooldownPassed:
+		// 首次触发或冷却期后仍未恢复，均再次通知
+		event = newAlertEvent(rule, AlertEventFiring, value, now)
+		state = AlertStateFiring
+		lastFiredAt = &now
+	case !breached && rule.State == AlertStateFiring:
+		event = newAlertEvent(rule, AlertEventResolved, value, now)
+		state = AlertStateOK
+	}
+
+	tx, err := e.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE alert_rules SET state = ?, last_value = ?, last_evaluated_at = ?, last_fired_at = ?
+		WHERE id = ?
+	`, state, value, now, lastFiredAt, rule.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update alert rule state: %w", err)
+	}
+
+	if event != nil {
+		result, err := tx.Exec(`
+			INSERT INTO alert_events (rule_id, rule_name, event_type, severity, value, threshold, message, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, event.RuleID, event.RuleName, event.EventType, event.Severity, event.Value, event.Threshold, event.Message, event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record alert event: %w", err)
+		}
+		if id, err := result.LastInsertId(); err == nil {
+			event.ID = int(id)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit alert rule evaluation: %w", err)
+	}
+
+	if event != nil && e.notificationService != nil {
+		e.notificationService.AddAlertNotification(event)
+	}
+
+	return event, nil
+}
+
+// queryRuleValue aggregates the rule's metric over [now-window, now)
+func (e *AlertEngine) queryRuleValue(rule models.AlertRule, now time.Time) (float64, error) {
+	filter := rule.Filter
+	start := now.Add(-time.Duration(rule.WindowMinutes) * time.Minute)
+	filter.StartTime = &start
+	filter.EndTime = &now
+
+	result, err := e.statsService.QueryUsage(&models.UsageQuery{
+		Metrics: []string{rule.Metric},
+		Filter:  filter,
+	})
+	if err != nil {
+		// 该API Key尚无账单时视为没有用量
+		if errors.Is(err, errAPIKeyNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if len(result.Rows) == 0 {
+		return 0, nil
+	}
+
+	return math.Round(result.Rows[0].Metrics[rule.Metric]*10000) / 10000, nil
+}
+
+// compareAlertValue applies the rule comparison to value and threshold
+func compareAlertValue(value float64, comparison string, threshold float64) bool {
+	switch comparison {
+	case AlertComparisonGT:
+		return value > threshold
+	case AlertComparisonGTE:
+		return value >= threshold
+	case AlertComparisonLT:
+		return value < threshold
+	case AlertComparisonLTE:
+		return value <= threshold
+	case AlertComparisonEQ:
+		return math.Abs(value-threshold) < 1e-9
+	}
+	return false
+}
+
+// newAlertEvent builds a firing or resolved event with a readable message
+func newAlertEvent(rule models.AlertRule, eventType string, value float64, now time.Time) *models.AlertEvent {
+	condition := fmt.Sprintf("最近%s%s为 %s（条件：%s %s）",
+		formatAlertWindow(rule.WindowMinutes), models.UsageMetricLabels[rule.Metric],
+		formatAlertValue(value), alertComparisonSymbols[rule.Comparison], formatAlertValue(rule.Threshold))
+
+	message := fmt.Sprintf("%s：%s", rule.Name, condition)
+	if eventType == AlertEventResolved {
+		message = fmt.Sprintf("%s 已恢复：%s", rule.Name, condition)
+	}
+
+	return &models.AlertEvent{
+		RuleID:    rule.ID,
+		RuleName:  rule.Name,
+		EventType: eventType,
+		Severity:  rule.Severity,
+		Value:     value,
+		Threshold: rule.Threshold,
+		Message:   message,
+		CreatedAt: now,
+	}
+}
+
+// formatAlertWindow formats a window in the largest whole unit
+func formatAlertWindow(minutes int) string {
+	switch {
+	case minutes%(24*60) == 0:
+		return fmt.Sprintf("%d天", minutes/(24*60))
+	case minutes%60 == 0:
+		return fmt.Sprintf("%d小时", minutes/60)
+	default:
+		return fmt.Sprintf("%d分钟", minutes)
+	}
+}
+
+// formatAlertValue formats a metric value without trailing zeros
+func formatAlertValue(value float64) string {
+	if value == math.Trunc(value) {
+		return fmt.Sprintf("%.0f", value)
+	}
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.4f", value), "0"), ".")
+}
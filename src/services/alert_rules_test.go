@@ -0,0 +1,147 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"glm-usage-monitor/models"
+)
+
+// newTestAlertEngine creates an alert engine over an in-memory database with ten calls
+// between 10:00 and 10:05 UTC on Monday 2025-11-10
+func newTestAlertEngine(t *testing.T) (*AlertEngine, *DatabaseService) {
+	t.Helper()
+
+	db := newTestDB(t, expenseBillsTestSchema(), apiTokensTestSchema, alertRulesTestSchema, notificationsTestSchema)
+	for i := 0; i < 10; i++ {
+		_, err := db.Exec("INSERT INTO expense_bills (id, transaction_time, cash_cost) VALUES (?, ?, 0)",
+			fmt.Sprintf("bill-%d", i), time.Date(2025, 11, 10, 10, 0, i*30, 0, time.UTC))
+		if err != nil {
+			t.Fatalf("failed to insert bill: %v", err)
+		}
+	}
+
+	dbService := NewDatabaseService(db)
+	engine := NewAlertEngine(db, dbService, NewStatisticsService(db), newTestNotificationServiceOn(db))
+	return engine, dbService
+}
+
+func TestAlertRuleFiresWithCooldownAndResolves(t *testing.T) {
+	engine, dbService := newTestAlertEngine(t)
+	rule := &models.AlertRule{
+		Name:            "调用过多",
+		Metric:          models.UsageMetricCalls,
+		Comparison:      AlertComparisonGT,
+		Threshold:       5,
+		WindowMinutes:   60,
+		CooldownMinutes: 30,
+		Enabled:         true,
+	}
+	if err := dbService.SaveAlertRule(rule); err != nil {
+		t.Fatalf("SaveAlertRule failed: %v", err)
+	}
+
+	steps := []struct {
+		at        time.Time
+		wantEvent string // 空表示不产生事件
+		wantState string
+	}{
+		{time.Date(2025, 11, 10, 10, 10, 0, 0, time.UTC), AlertEventFiring, AlertStateFiring},
+		// 冷却期内仍超限，不重复通知
+		{time.Date(2025, 11, 10, 10, 20, 0, 0, time.UTC), "", AlertStateFiring},
+		// 冷却期后仍未恢复，再次通知
+		{time.Date(2025, 11, 10, 10, 45, 0, 0, time.UTC), AlertEventFiring, AlertStateFiring},
+		// 窗口内不再有调用
+		{time.Date(2025, 11, 10, 11, 30, 0, 0, time.UTC), AlertEventResolved, AlertStateOK},
+		{time.Date(2025, 11, 10, 11, 40, 0, 0, time.UTC), "", AlertStateOK},
+	}
+
+	for _, step := range steps {
+		events, err := engine.EvaluateRules(step.at)
+		if err != nil {
+			t.Fatalf("EvaluateRules at %s failed: %v", step.at.Format("15:04"), err)
+		}
+
+		gotEvent := ""
+		if len(events) == 1 {
+			gotEvent = events[0].EventType
+		}
+		if len(events) > 1 || gotEvent != step.wantEvent {
+			t.Errorf("at %s: expected event %q, got %+v", step.at.Format("15:04"), step.wantEvent, events)
+		}
+
+		rules, err := dbService.GetAlertRules()
+		if err != nil {
+			t.Fatalf("GetAlertRules failed: %v", err)
+		}
+		if rules[0].State != step.wantState {
+			t.Errorf("at %s: expected state %s, got %s", step.at.Format("15:04"), step.wantState, rules[0].State)
+		}
+	}
+
+	history, err := dbService.GetAlertEvents(rule.ID, 0)
+	if err != nil {
+		t.Fatalf("GetAlertEvents failed: %v", err)
+	}
+	if len(history) != 3 {
+		t.Errorf("expected 2 firing and 1 resolved events in the history, got %d", len(history))
+	}
+
+	var notifications int
+	if err := engine.db.QueryRow("SELECT COUNT(*) FROM notifications").Scan(&notifications); err != nil {
+		t.Fatalf("failed to count notifications: %v", err)
+	}
+	if notifications != 2 {
+		t.Errorf("expected one firing and one resolved notification, got %d", notifications)
+	}
+}
+
+func TestAlertRuleWeekdays(t *testing.T) {
+	// 周一 20:00 UTC 在报表时区（UTC+8）已是周二
+	now := time.Date(2025, 11, 10, 20, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		weekdays      []int
+		wantEvaluated bool
+	}{
+		{"every day", nil, true},
+		{"reporting weekday", []int{2}, true},
+		{"UTC weekday only", []int{1}, false},
+		{"weekend", []int{0, 6}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, dbService := newTestAlertEngine(t)
+			rule := &models.AlertRule{
+				Name:          "全天调用",
+				Metric:        models.UsageMetricCalls,
+				Comparison:    AlertComparisonGTE,
+				Threshold:     10,
+				WindowMinutes: 24 * 60,
+				Weekdays:      tt.weekdays,
+				Enabled:       true,
+			}
+			if err := dbService.SaveAlertRule(rule); err != nil {
+				t.Fatalf("SaveAlertRule failed: %v", err)
+			}
+
+			events, err := engine.EvaluateRules(now)
+			if err != nil {
+				t.Fatalf("EvaluateRules failed: %v", err)
+			}
+			rules, err := dbService.GetAlertRules()
+			if err != nil {
+				t.Fatalf("GetAlertRules failed: %v", err)
+			}
+
+			evaluated := rules[0].LastEvaluatedAt != nil
+			if evaluated != tt.wantEvaluated || (len(events) == 1) != tt.wantEvaluated {
+				t.Errorf("expected evaluated %v, got last evaluated %v with events %+v",
+					tt.wantEvaluated, rules[0].LastEvaluatedAt, events)
+			}
+		})
+	}
+}
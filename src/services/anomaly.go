@@ -0,0 +1,361 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"glm-usage-monitor/models"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	anomalyBaselineWeeks  = 8    // 基线回看的周数（同一周内小时）
+	anomalyMinSamples     = 4    // 计算基线所需的最少样本数
+	anomalyScoreThreshold = 3.5  // 稳健z分数阈值
+	anomalyLookbackHours  = 24   // 每次检测覆盖的最近小时数
+	anomalyMinCalls       = 10   // 调用次数异常的最小绝对值，避免低用量误报
+	anomalyMinCost        = 1.0  // 费用异常的最小绝对值（元）
+	anomalyMaxScore       = 99.0 // 基线无波动时使用的分数上限
+)
+
+// anomalyHourFormat is the hour bucket key format shared by SQLite strftime and Go
+const anomalyHourFormat = "2006-01-02 15:00:00"
+
+// hourlyBucket holds aggregated usage for a single hour
+type hourlyBucket struct {
+	Calls float64
+	Cost  float64
+}
+
+// AnomalyDetector detects hourly usage spikes against a rolling hour-of-week baseline
+type AnomalyDetector struct {
+	db                  *sql.DB
+	notificationService *NotificationService
+}
+
+// NewAnomalyDetector creates a new anomaly detector
+func NewAnomalyDetector(db *sql.DB, notificationService *NotificationService) *AnomalyDetector {
+	return &AnomalyDetector{
+		db:                  db,
+		notificationService: notificationService,
+	}
+}
+
+// DetectAnomalies compares the hourly call count and cost of the last 24 hours with the
+// same hour of week in previous weeks, persists new anomalies and raises a warning for each
+func (d *AnomalyDetector) DetectAnomalies(now time.Time) ([]models.UsageAnomaly, error) {
+	lastHour := now.UTC().Truncate(time.Hour)
+	checkStart := lastHour.Add(-(anomalyLookbackHours - 1) * time.Hour)
+	historyStart := checkStart.AddDate(0, 0, -7*anomalyBaselineWeeks)
+
+	earliest, err := d.getEarliestTransactionHour()
+	if err != nil {
+		return nil, err
+	}
+	if earliest == nil {
+		return nil, nil // 没有账单数据
+	}
+
+	buckets, err := d.loadHourlyBuckets(historyStart, lastHour.Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	var detected []models.UsageAnomaly
+	for hour := checkStart; !hour.After(lastHour); hour = hour.Add(time.Hour) {
+		current := buckets[hour.Format(anomalyHourFormat)]
+
+		// 收集同一周内小时的历史样本，早于首条账单的周不计入基线
+		var callsBaseline, costBaseline []float64
+		for week := 1; week <= anomalyBaselineWeeks; week++ {
+			past := hour.AddDate(0, 0, -7*week)
+			if past.Before(*earliest) {
+				break
+			}
+			sample := buckets[past.Format(anomalyHourFormat)]
+			callsBaseline = append(callsBaseline, sample.Calls)
+			costBaseline = append(costBaseline, sample.Cost)
+		}
+
+		if len(callsBaseline) < anomalyMinSamples {
+			continue
+		}
+
+		checks := []struct {
+			metric   string
+			value    float64
+			baseline []float64
+			minValue float64
+		}{
+			{"calls", current.Calls, callsBaseline, anomalyMinCalls},
+			{"cost", current.Cost, costBaseline, anomalyMinCost},
+		}
+
+		for _, check := range checks {
+			if check.value < check.minValue {
+				continue
+			}
+
+			score, median, mad := robustZScore(check.value, check.baseline)
+			if score < anomalyScoreThreshold {
+				continue
+			}
+
+			anomaly := &models.UsageAnomaly{
+				HourStart:  hour,
+				Metric:     check.metric,
+				Value:      check.value,
+				Baseline:   median,
+				Deviation:  mad,
+				Score:      math.Round(score*100) / 100,
+				DetectedAt: time.Now(),
+			}
+
+			anomaly.TopModel, anomaly.TopAPIKey, err = d.getTopContributors(hour, check.metric)
+			if err != nil {
+				log.Printf("Failed to get top contributors for anomaly at %s: %v", hour.Format(anomalyHourFormat), err)
+			}
+
+			created, err := d.saveAnomaly(anomaly)
+			if err != nil {
+				return detected, err
+			}
+			if !created {
+				continue // 该小时该指标已记录过
+			}
+
+			if d.notificationService != nil {
+				d.notificationService.AddUsageAnomalyNotification(anomaly)
+			}
+			detected = append(detected, *anomaly)
+		}
+	}
+
+	if len(detected) > 0 {
+		log.Printf("Detected %d usage anomalies", len(detected))
+	}
+
+	return detected, nil
+}
+
+// GetRecentAnomalies retrieves the most recently detected anomalies
+func (d *AnomalyDetector) GetRecentAnomalies(limit int) ([]models.UsageAnomaly, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	query := `
+		SELECT id, hour_start, metric, value, baseline, deviation, score,
+		       COALESCE(top_model, ''), COALESCE(top_api_key, ''), detected_at
+		FROM usage_anomalies
+		ORDER BY hour_start DESC, id DESC
+		LIMIT ?
+	`
+
+	rows, err := d.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage anomalies: %w", err)
+	}
+	defer rows.Close()
+
+	var anomalies []models.UsageAnomaly
+	for rows.Next() {
+		var anomaly models.UsageAnomaly
+		err := rows.Scan(
+			&anomaly.ID, &anomaly.HourStart, &anomaly.Metric, &anomaly.Value, &anomaly.Baseline,
+			&anomaly.Deviation, &anomaly.Score, &anomaly.TopModel, &anomaly.TopAPIKey, &anomaly.DetectedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan usage anomaly: %w", err)
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+
+	return anomalies, nil
+}
+
+// getEarliestTransactionHour returns the hour of the oldest bill, or nil if there are no bills
+func (d *AnomalyDetector) getEarliestTransactionHour() (*time.Time, error) {
+	var earliest sql.NullString
+	err := d.db.QueryRow("SELECT MIN(datetime(transaction_time)) FROM expense_bills").Scan(&earliest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get earliest transaction time: %w", err)
+	}
+	if !earliest.Valid || earliest.String == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse("2006-01-02 15:04:05", earliest.String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse earliest transaction time %s: %w", earliest.String, err)
+	}
+
+	hour := t.Truncate(time.Hour)
+	return &hour, nil
+}
+
+// loadHourlyBuckets aggregates call count and cost per UTC hour within [start, end)
+func (d *AnomalyDetector) loadHourlyBuckets(start, end time.Time) (map[string]hourlyBucket, error) {
+	query := `
+		SELECT strftime('%Y-%m-%d %H:00:00', transaction_time) as hour_start,
+		       COUNT(*) as call_count,
+		       COALESCE(SUM(cash_cost), 0) as cash_cost
+		FROM expense_bills
+		WHERE datetime(transaction_time) >= ? AND datetime(transaction_time) < ?
+		GROUP BY hour_start
+	`
+
+	rows, err := d.db.Query(query, start.UTC().Format("2006-01-02 15:04:05"), end.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hourly buckets: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := make(map[string]hourlyBucket)
+	for rows.Next() {
+		var hourStart sql.NullString
+		var bucket hourlyBucket
+		if err := rows.Scan(&hourStart, &bucket.Calls, &bucket.Cost); err != nil {
+			return nil, fmt.Errorf("failed to scan hourly bucket: %w", err)
+		}
+		if hourStart.Valid {
+			buckets[hourStart.String] = bucket
+		}
+	}
+
+	return buckets, nil
+}
+
+// getTopContributors returns the model and masked API key with the highest usage in the given hour
+func (d *AnomalyDetector) getTopContributors(hour time.Time, metric string) (string, string, error) {
+	orderBy := "call_count"
+	if metric == "cost" {
+		orderBy = "cash_cost"
+	}
+
+	start := hour.UTC().Format("2006-01-02 15:04:05")
+	end := hour.Add(time.Hour).UTC().Format("2006-01-02 15:04:05")
+
+	var topModel, topAPIKey string
+	for _, column := range []string{"model_name", "api_key"} {
+		query := fmt.Sprintf(`
+			SELECT COALESCE(%s, '') as dimension,
+			       COUNT(*) as call_count,
+			       COALESCE(SUM(cash_cost), 0) as cash_cost
+			FROM expense_bills
+			WHERE datetime(transaction_time) >= ? AND datetime(transaction_time) < ?
+			GROUP BY dimension
+			ORDER BY %s DESC
+			LIMIT 1
+		`, column, orderBy)
+
+		var value string
+		var calls, cost float64
+		err := d.db.QueryRow(query, start, end).Scan(&value, &calls, &cost)
+		if err != nil && err != sql.ErrNoRows {
+			return topModel, topAPIKey, fmt.Errorf("failed to query top %s: %w", column, err)
+		}
+
+		if column == "model_name" {
+			topModel = value
+		} else {
+			topAPIKey = models.MaskSecret(value)
+		}
+	}
+
+	return topModel, topAPIKey, nil
+}
+
+// saveAnomaly persists an anomaly, returning false if the hour and metric were already recorded
+func (d *AnomalyDetector) saveAnomaly(anomaly *models.UsageAnomaly) (bool, error) {
+	query := `
+		INSERT OR IGNORE INTO usage_anomalies (
+			hour_start, metric, value, baseline, deviation, score,
+			top_model, top_api_key, detected_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := d.db.Exec(query,
+		anomaly.HourStart, anomaly.Metric, anomaly.Value, anomaly.Baseline, anomaly.Deviation,
+		anomaly.Score, anomaly.TopModel, anomaly.TopAPIKey, anomaly.DetectedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to save usage anomaly: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		return false, nil
+	}
+
+	if id, err := result.LastInsertId(); err == nil {
+		anomaly.ID = int(id)
+	}
+
+	return true, nil
+}
+
+// robustZScore returns the modified z-score (0.6745 * (x - median) / MAD) of value against
+// the baseline, falling back to the standard z-score when the MAD is zero
+func robustZScore(value float64, baseline []float64) (score, median, mad float64) {
+	median = medianOf(baseline)
+
+	deviations := make([]float64, len(baseline))
+	for i, v := range baseline {
+		deviations[i] = math.Abs(v - median)
+	}
+	mad = medianOf(deviations)
+
+	switch {
+	case mad > 0:
+		score = 0.6745 * (value - median) / mad
+	default:
+		mean, stdDev := meanStdDev(baseline)
+		if stdDev > 0 {
+			score = (value - mean) / stdDev
+		} else if value > median {
+			score = anomalyMaxScore
+		}
+	}
+
+	return math.Min(score, anomalyMaxScore), median, mad
+}
+
+// medianOf returns the median of values
+func medianOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// meanStdDev returns the mean and population standard deviation of values
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"glm-usage-monitor/models"
+)
+
+// anomalyTestNow is the detection time; the checked hour is its truncated hour
+var anomalyTestNow = time.Date(2025, 11, 10, 12, 30, 0, 0, time.UTC)
+
+// anomalyTestHour is a seeded hour of usage: calls bills costing cost each, weeksAgo weeks
+// before the checked hour
+type anomalyTestHour struct {
+	weeksAgo int
+	calls    int
+	cost     float64
+}
+
+// seedAnomalyHours stores the bills of every seeded hour, attributed to one model and API key
+func seedAnomalyHours(t *testing.T, detector *AnomalyDetector, hours []anomalyTestHour) {
+	t.Helper()
+
+	checkedHour := anomalyTestNow.Truncate(time.Hour)
+	for _, hour := range hours {
+		start := checkedHour.AddDate(0, 0, -7*hour.weeksAgo)
+		for i := 0; i < hour.calls; i++ {
+			_, err := detector.db.Exec(`
+				INSERT INTO expense_bills (id, transaction_time, cash_cost, model_name, api_key)
+				VALUES (?, ?, ?, 'glm-4.6', 'sk-anomaly-test-key')
+			`, fmt.Sprintf("w%d-%d", hour.weeksAgo, i), start.Add(time.Duration(i)*time.Second), hour.cost)
+			if err != nil {
+				t.Fatalf("failed to insert bill: %v", err)
+			}
+		}
+	}
+}
+
+// anomalyBaseline returns eight previous weeks with the given call counts at the given cost per call
+func anomalyBaseline(cost float64, calls ...int) []anomalyTestHour {
+	hours := make([]anomalyTestHour, 0, len(calls))
+	for i, count := range calls {
+		hours = append(hours, anomalyTestHour{weeksAgo: i + 1, calls: count, cost: cost})
+	}
+	return hours
+}
+
+func TestDetectAnomalies(t *testing.T) {
+	tests := []struct {
+		name      string
+		hours     []anomalyTestHour
+		wantScore map[string]float64 // 按指标期望的分数，空表示没有异常
+	}{
+		{
+			// 中位数10.5，MAD 0.5：0.6745 * (60 - 10.5) / 0.5
+			name:      "spike over a varying baseline",
+			hours:     append(anomalyBaseline(0, 10, 12, 11, 9, 10, 11, 12, 10), anomalyTestHour{0, 60, 0}),
+			wantScore: map[string]float64{"calls": 66.78},
+		},
+		{
+			name:  "usage within the baseline variation",
+			hours: append(anomalyBaseline(0, 10, 12, 11, 9, 10, 11, 12, 10), anomalyTestHour{0, 12, 0}),
+		},
+		{
+			name:  "spike below the minimum call count",
+			hours: append(anomalyBaseline(0, 1, 1, 1, 1, 1, 1, 1, 1), anomalyTestHour{0, 9, 0}),
+		},
+		{
+			// 基线无波动时分数取上限
+			name:      "cost spike over a flat baseline is capped",
+			hours:     append(anomalyBaseline(0.5, 10, 10, 10, 10, 10, 10, 10, 10), anomalyTestHour{0, 10, 5}),
+			wantScore: map[string]float64{"cost": anomalyMaxScore},
+		},
+		{
+			name:  "too few weeks of history",
+			hours: append(anomalyBaseline(0, 10, 10, 10), anomalyTestHour{0, 60, 0}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, expenseBillsTestSchema(), usageAnomaliesTestSchema, notificationsTestSchema)
+			ns := newTestNotificationServiceOn(db)
+			detector := NewAnomalyDetector(db, ns)
+			seedAnomalyHours(t, detector, tt.hours)
+
+			detected, err := detector.DetectAnomalies(anomalyTestNow)
+			if err != nil {
+				t.Fatalf("DetectAnomalies failed: %v", err)
+			}
+			if len(detected) != len(tt.wantScore) {
+				t.Fatalf("expected %d anomalies, got %+v", len(tt.wantScore), detected)
+			}
+			for _, anomaly := range detected {
+				want, ok := tt.wantScore[anomaly.Metric]
+				if !ok || anomaly.Score != want {
+					t.Errorf("expected %s score %.2f, got %.2f", anomaly.Metric, want, anomaly.Score)
+				}
+				if !anomaly.HourStart.Equal(anomalyTestNow.Truncate(time.Hour)) {
+					t.Errorf("expected the anomaly in the checked hour, got %s", anomaly.HourStart)
+				}
+				if anomaly.TopModel != "glm-4.6" || anomaly.TopAPIKey == "sk-anomaly-test-key" {
+					t.Errorf("expected the top model and a masked API key, got %s / %s", anomaly.TopModel, anomaly.TopAPIKey)
+				}
+			}
+
+			// 再次检测时已记录的异常被忽略，不重复通知
+			again, err := detector.DetectAnomalies(anomalyTestNow.Add(10 * time.Minute))
+			if err != nil {
+				t.Fatalf("DetectAnomalies failed: %v", err)
+			}
+			if len(again) != 0 {
+				t.Errorf("expected recorded anomalies to be ignored, got %+v", again)
+			}
+
+			var stored, notified int
+			if err := db.QueryRow("SELECT COUNT(*) FROM usage_anomalies").Scan(&stored); err != nil {
+				t.Fatalf("failed to count anomalies: %v", err)
+			}
+			if err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE dedup_key LIKE 'anomaly:%'").Scan(&notified); err != nil {
+				t.Fatalf("failed to count notifications: %v", err)
+			}
+			if stored != len(tt.wantScore) || notified != len(tt.wantScore) {
+				t.Errorf("expected %d stored and notified anomalies, got %d and %d", len(tt.wantScore), stored, notified)
+			}
+		})
+	}
+}
+
+func TestUsageAnomalyNotification(t *testing.T) {
+	ns := newTestNotificationService(t)
+	anomaly := &models.UsageAnomaly{
+		HourStart: time.Date(2025, 11, 10, 12, 0, 0, 0, time.UTC),
+		Metric:    "calls",
+		Value:     60,
+		Baseline:  10.5,
+		TopModel:  "glm-4.6",
+	}
+	ns.AddUsageAnomalyNotification(anomaly)
+	ns.AddUsageAnomalyNotification(anomaly)
+
+	var message, dedupKey string
+	var occurrences int
+	err := ns.db.QueryRow("SELECT message, dedup_key, occurrences FROM notifications").Scan(&message, &dedupKey, &occurrences)
+	if err != nil {
+		t.Fatalf("failed to read notification: %v", err)
+	}
+	// 小时按报表时区（默认UTC+8）显示
+	if !strings.HasPrefix(message, "2025-11-10 20:00 ") {
+		t.Errorf("expected the hour in the reporting timezone, got %q", message)
+	}
+	if dedupKey != "anomaly:2025-11-10 12:00:00:calls" || occurrences != 2 {
+		t.Errorf("expected one notification per hour and metric, got key %q with %d occurrences", dedupKey, occurrences)
+	}
+}
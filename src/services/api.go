@@ -11,33 +11,140 @@ import (
 
 // APIService provides all API methods for frontend
 type APIService struct {
-	dbService       *DatabaseService
-	statsService    *StatisticsService
-	zhipuAPIService *ZhipuAPIService
-	autoSyncService *AutoSyncService
-	db              DatabaseInterface
-	errorHandler    ErrorHandler
+	dbService           *DatabaseService
+	statsService        *StatisticsService
+	zhipuAPIService     *ZhipuAPIService
+	autoSyncService     *AutoSyncService
+	notificationService *NotificationService
+	anomalyDetector     *AnomalyDetector
+	quotaTracker        *QuotaTracker
+	budgetTracker       *BudgetTracker
+	alertEngine         *AlertEngine
+	digestGenerator     *DigestGenerator
+	tokenMonitor        *TokenMonitor
+	tokenVault          *TokenVault
+	tokenRotator        *TokenRotator
+	channelDispatcher   *ChannelDispatcher
+	db                  DatabaseInterface
+	errorHandler        ErrorHandler
 }
 
 // NewAPIService creates a new API service
 func NewAPIService(db DatabaseInterface) *APIService {
 	dbService := NewDatabaseService(db.GetDB())
 	statsService := NewStatisticsService(db.GetDB())
+	notificationService := NewNotificationService(db.GetDB())
+
+	budgetTracker := NewBudgetTracker(db.GetDB(), dbService, statsService, notificationService)
 
 	apiService := &APIService{
-		dbService:       dbService,
-		statsService:    statsService,
-		zhipuAPIService: nil, // Will be initialized when token is set
-		db:              db,
-		errorHandler:    NewErrorHandler(),
+		dbService:           dbService,
+		statsService:        statsService,
+		zhipuAPIService:     nil, // Will be initialized when token is set
+		notificationService: notificationService,
+		anomalyDetector:     NewAnomalyDetector(db.GetDB(), notificationService),
+		quotaTracker:        NewQuotaTracker(db.GetDB(), dbService, notificationService),
+		budgetTracker:       budgetTracker,
+		alertEngine:         NewAlertEngine(db.GetDB(), dbService, statsService, notificationService),
+		digestGenerator:     NewDigestGenerator(db.GetDB(), dbService, statsService, budgetTracker, notificationService),
+		channelDispatcher:   NewChannelDispatcher(dbService),
+		db:                  db,
+		errorHandler:        NewErrorHandler(),
+	}
+
+	// 通知转发到外部渠道
+	notificationService.AddDispatcher(apiService.channelDispatcher)
+
+	// 加载令牌加密密钥，并加密旧版本遗留的明文令牌
+	apiService.tokenVault = NewTokenVault(db.GetDB(), dbService)
+	if err := apiService.tokenVault.Open(); err != nil {
+		log.Printf("Error opening token vault: %v", err)
 	}
 
+	// 宽限期已过的令牌轮换不再保留旧令牌
+	apiService.tokenRotator = NewTokenRotator(db.GetDB(), apiService.tokenVault)
+	if _, err := apiService.tokenRotator.Expire(time.Now()); err != nil {
+		log.Printf("Error expiring token rotations: %v", err)
+	}
+
+	// 令牌过期停用后停止使用该令牌同步
+	apiService.tokenMonitor = NewTokenMonitor(db.GetDB(), dbService, notificationService, apiService.onTokenDeactivated)
+
 	// 初始化自动同步服务
 	apiService.autoSyncService = NewAutoSyncService(apiService, dbService)
 
+	// 加载报表时区设置
+	apiService.loadReportingTimezone()
+	apiService.normalizeBillTimes()
+
+	// 加载自定义脱敏规则
+	apiService.loadRedactionPatterns()
+
+	// 清理过期通知
+	apiService.cleanupNotifications()
+
+	// 从上次记录的等级变更起识别新的变更
+	if _, err := dbService.UpdateAllMembershipTierHistory(); err != nil {
+		log.Printf("Error updating membership tier history: %v", err)
+	}
+
 	return apiService
 }
 
+// loadReportingTimezone applies the persisted reporting timezone, keeping the default if unset
+func (s *APIService) loadReportingTimezone() {
+	timezone, err := s.dbService.GetAppSetting(models.ReportingTimezoneConfigKey)
+	if err != nil || timezone == "" {
+		return
+	}
+
+	if err := models.SetReportingTimezone(timezone); err != nil {
+		log.Printf("Error applying reporting timezone %s: %v", timezone, err)
+	}
+}
+
+// billTimesNormalizedConfigKey marks that stored bill times were re-derived in the reporting
+// timezone after upgrading from versions that stored them in mixed formats
+const billTimesNormalizedConfigKey = "bill_times_normalized"
+
+// normalizeBillTimes re-derives the stored bill times once, in the configured reporting timezone.
+// Older versions stored transaction_time with a local offset and parsed time windows as UTC; the
+// conversion depends on the reporting timezone setting, so it runs here at startup, after the
+// timezone is loaded, instead of in a migration.
+func (s *APIService) normalizeBillTimes() {
+	if value, err := s.dbService.GetAppSetting(billTimesNormalizedConfigKey); err == nil && value == "true" {
+		return
+	}
+
+	updated, err := s.dbService.RederiveBillTimes()
+	if err != nil {
+		log.Printf("Error normalizing bill times: %v", err)
+		return
+	}
+	if err := s.dbService.SetAppSetting(billTimesNormalizedConfigKey, "true", "账单时间已按报表时区重新计算为UTC"); err != nil {
+		log.Printf("Error saving bill time normalization marker: %v", err)
+		return
+	}
+
+	log.Printf("Normalized times of %d bills", updated)
+}
+
+// loadRedactionPatterns applies the persisted secret patterns to the default redactor
+func (s *APIService) loadRedactionPatterns() {
+	value, err := s.dbService.GetAppSetting(RedactionPatternsConfigKey)
+	if err != nil || value == "" {
+		return
+	}
+
+	patterns, err := parseRedactionPatterns(value)
+	if err == nil {
+		err = DefaultRedactor().SetPatterns(patterns)
+	}
+	if err != nil {
+		log.Printf("Error applying redaction patterns: %v", err)
+	}
+}
+
 // ========== Bill Management APIs ==========
 
 // GetBills retrieves expense bills with filtering and pagination (IPC_02: 统一响应格式)
@@ -81,17 +188,29 @@ func (s *APIService) GetBills(filter *models.BillFilter) (*models.PaginatedResul
 		return nil, appErr
 	}
 
+	redactBillPage(result)
 	return result, nil
 }
 
+// redactBillPage masks the API keys of a page of bills before it is returned to the frontend
+func redactBillPage(result *models.PaginatedResult) {
+	if result == nil {
+		return
+	}
+	if bills, ok := result.Data.([]models.ExpenseBill); ok {
+		RedactExpenseBills(bills)
+	}
+}
+
 // GetBillByID retrieves a single expense bill by ID
 func (s *APIService) GetBillByID(id string) (*models.ExpenseBill, error) {
 	bill, err := s.dbService.GetExpenseBillByID(id)
 	if err != nil {
-		log.Printf("Error getting bill by ID %d: %v", id, err)
+		log.Printf("Error getting bill by ID %s: %v", id, err)
 		return nil, fmt.Errorf("failed to retrieve bill: %w", err)
 	}
 
+	RedactExpenseBill(bill)
 	return bill, nil
 }
 
@@ -99,11 +218,11 @@ func (s *APIService) GetBillByID(id string) (*models.ExpenseBill, error) {
 func (s *APIService) DeleteBill(id string) error {
 	err := s.dbService.DeleteExpenseBill(id)
 	if err != nil {
-		log.Printf("Error deleting bill ID %d: %v", id, err)
+		log.Printf("Error deleting bill ID %s: %v", id, err)
 		return fmt.Errorf("failed to delete bill: %w", err)
 	}
 
-	log.Printf("Successfully deleted bill ID %d", id)
+	log.Printf("Successfully deleted bill ID %s", id)
 	return nil
 }
 
@@ -122,23 +241,25 @@ func (s *APIService) GetBillsByDateRange(startDate, endDate time.Time, pageNum,
 		return nil, fmt.Errorf("failed to retrieve bills by date range: %w", err)
 	}
 
+	redactBillPage(result)
 	return result, nil
 }
 
 // ========== Statistics APIs ==========
 
-// GetStats retrieves overall usage statistics (IPC_03: 支持period参数解析)
-func (s *APIService) GetStats(startDate, endDate *time.Time, period string) (*models.StatsResponse, error) {
+// GetStats retrieves overall usage statistics (IPC_03: 支持period参数解析); accountID 0 includes all accounts
+func (s *APIService) GetStats(startDate, endDate *time.Time, period string, accountID int) (*models.StatsResponse, error) {
 	// 根据period参数计算时间范围
 	if period != "" {
 		startDate, endDate = s.calculateDateRange(period)
 	}
 
-	stats, err := s.statsService.GetOverallStats(startDate, endDate)
+	stats, err := s.statsService.GetOverallStats(startDate, endDate, accountID)
 	if err != nil {
 		log.Printf("Error getting statistics: %v", err)
 		return nil, fmt.Errorf("failed to retrieve statistics: %w", err)
 	}
+	RedactExpenseBills(stats.RecentUsage)
 
 	// Add sync status
 	syncStatus, err := s.dbService.GetAutoSyncStatus()
@@ -153,7 +274,7 @@ func (s *APIService) GetStats(startDate, endDate *time.Time, period string) (*mo
 
 // calculateDateRange 根据period参数计算时间范围
 func (s *APIService) calculateDateRange(period string) (*time.Time, *time.Time) {
-	now := time.Now()
+	now := models.ReportingNow()
 	var startDate, endDate time.Time
 
 	switch period {
@@ -193,14 +314,14 @@ func (s *APIService) calculateDateRange(period string) (*time.Time, *time.Time)
 }
 
 // GetHourlyUsage retrieves hourly usage statistics
-func (s *APIService) GetHourlyUsage(hours int) ([]models.HourlyUsageData, error) {
+func (s *APIService) GetHourlyUsage(hours, accountID int) ([]models.HourlyUsageData, error) {
 	if hours <= 0 {
 		hours = 5 // Default to last 5 hours
 	}
 
 	// Calculate start time
 	startTime := time.Now().Add(-time.Duration(hours) * time.Hour)
-	usageData, err := s.statsService.GetHourlyUsage(&startTime, nil)
+	usageData, err := s.statsService.GetHourlyUsage(&startTime, nil, accountID)
 	if err != nil {
 		log.Printf("Error getting hourly usage: %v", err)
 		return nil, fmt.Errorf("failed to retrieve hourly usage: %w", err)
@@ -210,8 +331,8 @@ func (s *APIService) GetHourlyUsage(hours int) ([]models.HourlyUsageData, error)
 }
 
 // GetModelDistribution retrieves usage distribution by model
-func (s *APIService) GetModelDistribution(startDate, endDate *time.Time) ([]models.ModelDistributionData, error) {
-	distribution, err := s.statsService.GetModelDistribution(startDate, endDate)
+func (s *APIService) GetModelDistribution(startDate, endDate *time.Time, accountID int) ([]models.ModelDistributionData, error) {
+	distribution, err := s.statsService.GetModelDistribution(startDate, endDate, accountID)
 	if err != nil {
 		log.Printf("Error getting model distribution: %v", err)
 		return nil, fmt.Errorf("failed to retrieve model distribution: %w", err)
@@ -220,28 +341,106 @@ func (s *APIService) GetModelDistribution(startDate, endDate *time.Time) ([]mode
 	return distribution, nil
 }
 
+// GetAPIKeyDistribution retrieves usage distribution by API key
+func (s *APIService) GetAPIKeyDistribution(startDate, endDate *time.Time, accountID int) ([]models.APIKeyDistributionData, error) {
+	distribution, err := s.statsService.GetAPIKeyDistribution(startDate, endDate, accountID)
+	if err != nil {
+		log.Printf("Error getting API key distribution: %v", err)
+		return nil, fmt.Errorf("failed to retrieve API key distribution: %w", err)
+	}
+
+	return distribution, nil
+}
+
+// GetAPIKeyTrend retrieves daily usage trend of a single API key
+func (s *APIService) GetAPIKeyTrend(key string, days, accountID int) ([]models.APIKeyTrendData, error) {
+	if days <= 0 {
+		days = 7
+	}
+
+	trendData, err := s.statsService.GetAPIKeyTrend(key, days, accountID)
+	if err != nil {
+		log.Printf("Error getting API key trend: %v", err)
+		return nil, fmt.Errorf("failed to retrieve API key trend: %w", err)
+	}
+
+	return trendData, nil
+}
+
+// GetRecentDaysTotals retrieves usage totals of the last days calendar days (including today)
+// in the reporting timezone
+func (s *APIService) GetRecentDaysTotals(days int) (*models.UsageTotals, error) {
+	if days <= 0 {
+		days = 1
+	}
+
+	now := models.ReportingNow()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	period := models.PeriodRange{Start: today.AddDate(0, 0, -(days - 1)), End: now}
+
+	totals, err := s.statsService.GetUsageTotals(period, 0)
+	if err != nil {
+		log.Printf("Error getting usage totals: %v", err)
+		return nil, fmt.Errorf("failed to retrieve usage totals: %w", err)
+	}
+
+	return totals, nil
+}
+
+// ComparePeriods compares usage between two custom periods
+func (s *APIService) ComparePeriods(currentStart, currentEnd, previousStart, previousEnd time.Time, accountID int) (*models.PeriodComparison, error) {
+	current := models.PeriodRange{Start: currentStart, End: currentEnd}
+	previous := models.PeriodRange{Start: previousStart, End: previousEnd}
+
+	comparison, err := s.statsService.ComparePeriods(current, previous, accountID)
+	if err != nil {
+		log.Printf("Error comparing periods: %v", err)
+		return nil, fmt.Errorf("failed to compare periods: %w", err)
+	}
+
+	return comparison, nil
+}
+
+// ComparePeriodPreset compares usage using a preset (week_over_week, month_over_month, same_day_last_week)
+func (s *APIService) ComparePeriodPreset(preset string, accountID int) (*models.PeriodComparison, error) {
+	current, previous, err := ComparisonPresetRanges(preset, time.Now())
+	if err != nil {
+		return nil, NewValidationError(ErrCodeInvalidParameter, err.Error())
+	}
+
+	comparison, err := s.statsService.ComparePeriods(current, previous, accountID)
+	if err != nil {
+		log.Printf("Error comparing periods with preset %s: %v", preset, err)
+		return nil, fmt.Errorf("failed to compare periods: %w", err)
+	}
+	comparison.Preset = preset
+
+	return comparison, nil
+}
+
 // GetRecentUsage retrieves recent usage records
-func (s *APIService) GetRecentUsage(limit int) ([]models.ExpenseBill, error) {
+func (s *APIService) GetRecentUsage(limit, accountID int) ([]models.ExpenseBill, error) {
 	if limit <= 0 {
 		limit = 10
 	}
 
-	recentUsage, err := s.statsService.GetRecentUsage(limit)
+	recentUsage, err := s.statsService.GetRecentUsage(limit, accountID)
 	if err != nil {
 		log.Printf("Error getting recent usage: %v", err)
 		return nil, fmt.Errorf("failed to retrieve recent usage: %w", err)
 	}
 
+	RedactExpenseBills(recentUsage)
 	return recentUsage, nil
 }
 
 // GetUsageTrend retrieves usage trend data
-func (s *APIService) GetUsageTrend(days int) ([]models.HourlyUsageData, error) {
+func (s *APIService) GetUsageTrend(days, accountID int) ([]models.HourlyUsageData, error) {
 	if days <= 0 {
 		days = 7
 	}
 
-	trendData, err := s.statsService.GetUsageTrend(days)
+	trendData, err := s.statsService.GetUsageTrend(days, accountID)
 	if err != nil {
 		log.Printf("Error getting usage trend: %v", err)
 		return nil, fmt.Errorf("failed to retrieve usage trend: %w", err)
@@ -250,6 +449,38 @@ func (s *APIService) GetUsageTrend(days int) ([]models.HourlyUsageData, error) {
 	return trendData, nil
 }
 
+// QueryUsage runs a generic aggregation over bills with the given dimensions, metrics and filter
+func (s *APIService) QueryUsage(query models.UsageQuery) (*models.UsageQueryResult, error) {
+	if err := query.Normalize(); err != nil {
+		return nil, NewValidationError(ErrCodeInvalidParameter, err.Error())
+	}
+
+	result, err := s.statsService.QueryUsage(&query)
+	if err != nil {
+		log.Printf("Error querying usage: %v", err)
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetUsageHeatmap retrieves a day-of-week × hour usage heatmap of calls, tokens or cost
+func (s *APIService) GetUsageHeatmap(startDate, endDate *time.Time, metric string, modelNames, apiKeys []string, accountIDs []int) (*models.UsageHeatmap, error) {
+	switch metric {
+	case "", models.UsageMetricCalls, models.UsageMetricTokens, models.UsageMetricCost:
+	default:
+		return nil, NewValidationError(ErrCodeInvalidParameter, "metric must be calls, tokens or cost")
+	}
+
+	heatmap, err := s.statsService.GetUsageHeatmap(startDate, endDate, metric, modelNames, apiKeys, accountIDs)
+	if err != nil {
+		log.Printf("Error getting usage heatmap: %v", err)
+		return nil, fmt.Errorf("failed to retrieve usage heatmap: %w", err)
+	}
+
+	return heatmap, nil
+}
+
 // ========== Token Management APIs ==========
 
 // SaveToken saves an API token (IPC_01: 修复参数顺序)
@@ -268,9 +499,20 @@ func (s *APIService) SaveToken(tokenValue, tokenName, provider, tokenType string
 		tokenType = "api_key"
 	}
 
+	encryptedValue, tokenHash, err := s.encryptToken(tokenValue)
+	if err != nil {
+		return err
+	}
+	// 单令牌设计下令牌固定保存为ID 1
+	if err := s.checkDuplicateToken(tokenHash, 1); err != nil {
+		return err
+	}
+
 	token := &models.APIToken{
 		TokenName:  tokenName,
-		TokenValue: tokenValue,
+		TokenValue: encryptedValue,
+		TokenHint:  models.MaskSecret(tokenValue),
+		TokenHash:  tokenHash,
 		Provider:   provider,
 		TokenType:  tokenType,
 		IsActive:   true,
@@ -278,19 +520,103 @@ func (s *APIService) SaveToken(tokenValue, tokenName, provider, tokenType string
 		UpdatedAt:  time.Now(),
 	}
 
-	err := s.dbService.SaveAPIToken(token)
+	err = s.dbService.SaveAPIToken(token)
 	if err != nil {
 		log.Printf("Error saving token: %v", err)
 		return fmt.Errorf("failed to save token: %w", err)
 	}
 
 	// Update Zhipu API service
-	s.zhipuAPIService = NewZhipuAPIService(tokenValue)
+	if err := s.useStoredToken(token); err != nil {
+		log.Printf("Error using saved token: %v", err)
+		return fmt.Errorf("failed to use saved token: %w", err)
+	}
+
+	// 令牌问题导致的自动同步暂停在更新令牌后恢复
+	if err := s.autoSyncService.Resume(); err != nil {
+		log.Printf("Error resuming auto sync: %v", err)
+	}
 
 	log.Printf("Successfully saved token: %s", tokenName)
 	return nil
 }
 
+// AddAccountToken adds the API token of another account; every active token is synced
+func (s *APIService) AddAccountToken(tokenValue, tokenName string) (int, error) {
+	if tokenValue == "" {
+		return 0, NewValidationError(ErrCodeInvalidParameter, "Token value cannot be empty")
+	}
+	if tokenName == "" {
+		return 0, NewValidationError(ErrCodeInvalidParameter, "Token name cannot be empty")
+	}
+
+	encryptedValue, tokenHash, err := s.encryptToken(tokenValue)
+	if err != nil {
+		return 0, err
+	}
+	// 同一令牌保存为两个账号会重复同步账单
+	if err := s.checkDuplicateToken(tokenHash, 0); err != nil {
+		return 0, err
+	}
+
+	token := &models.APIToken{
+		TokenName:  tokenName,
+		TokenValue: encryptedValue,
+		TokenHint:  models.MaskSecret(tokenValue),
+		TokenHash:  tokenHash,
+		Provider:   "zhipu",
+		TokenType:  "api_key",
+		IsActive:   true,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	if err := s.dbService.CreateAPIToken(token); err != nil {
+		log.Printf("Error adding account token: %v", err)
+		return 0, fmt.Errorf("failed to add account token: %w", err)
+	}
+
+	if s.zhipuAPIService == nil {
+		s.reloadActiveToken()
+	}
+	if err := s.autoSyncService.Resume(); err != nil {
+		log.Printf("Error resuming auto sync: %v", err)
+	}
+
+	log.Printf("Successfully added account token: %s", tokenName)
+	return token.ID, nil
+}
+
+// encryptToken encrypts a plaintext token with the current token key and returns it with its fingerprint
+func (s *APIService) encryptToken(tokenValue string) (string, string, error) {
+	tokenCipher, err := s.tokenVault.Cipher()
+	if err != nil {
+		return "", "", NewAuthError(ErrCodeInvalidToken, err.Error())
+	}
+
+	encryptedValue, err := tokenCipher.Encrypt(tokenValue)
+	if err != nil {
+		log.Printf("Error encrypting token: %v", err)
+		return "", "", fmt.Errorf("failed to encrypt token: %w", err)
+	}
+	DefaultRedactor().AddSecret(tokenValue)
+
+	return encryptedValue, tokenCipher.Hash(tokenValue), nil
+}
+
+// checkDuplicateToken rejects a token that is already saved for an account other than tokenID
+func (s *APIService) checkDuplicateToken(tokenHash string, tokenID int) error {
+	id, err := s.dbService.GetAPITokenIDByHash(tokenHash)
+	if err != nil {
+		log.Printf("Error checking for duplicate token: %v", err)
+		return fmt.Errorf("failed to check for duplicate token: %w", err)
+	}
+	if id != 0 && id != tokenID {
+		return NewValidationError(ErrCodeInvalidParameter, fmt.Sprintf("Token is already saved for account %d", id))
+	}
+	return nil
+}
+
 // GetToken retrieves active API token (IPC_02: 统一响应格式)
 func (s *APIService) GetToken() (*models.APIToken, error) {
 	token, err := s.dbService.GetActiveAPIToken()
@@ -299,14 +625,44 @@ func (s *APIService) GetToken() (*models.APIToken, error) {
 		return nil, fmt.Errorf("failed to retrieve token: %w", err)
 	}
 
+	if token == nil {
+		return nil, nil
+	}
+
 	// Update Zhipu API service if not already set
 	if s.zhipuAPIService == nil {
-		s.zhipuAPIService = NewZhipuAPIService(token.TokenValue)
+		if err := s.useStoredToken(token); err != nil {
+			log.Printf("Error using saved token: %v", err)
+		}
 	}
 
+	maskAPIToken(token)
 	return token, nil
 }
 
+// useStoredToken points the Zhipu API service at a stored (encrypted) token
+func (s *APIService) useStoredToken(token *models.APIToken) error {
+	tokenCipher, err := s.tokenVault.Cipher()
+	if err != nil {
+		return err
+	}
+
+	zhipuAPIService, err := NewZhipuAPIServiceForToken(token.TokenValue, tokenCipher)
+	if err != nil {
+		return err
+	}
+	s.zhipuAPIService = zhipuAPIService
+	return nil
+}
+
+// maskAPIToken replaces the stored token value with its masked hint before it reaches the frontend
+func maskAPIToken(token *models.APIToken) {
+	token.TokenValue = token.TokenHint
+	if token.TokenValue == "" {
+		token.TokenValue = "********"
+	}
+}
+
 // GetAllTokens retrieves all API tokens
 func (s *APIService) GetAllTokens() ([]models.APIToken, error) {
 	tokens, err := s.dbService.GetAllAPITokens()
@@ -315,135 +671,468 @@ func (s *APIService) GetAllTokens() ([]models.APIToken, error) {
 		return nil, fmt.Errorf("failed to retrieve tokens: %w", err)
 	}
 
+	for i := range tokens {
+		maskAPIToken(&tokens[i])
+	}
 	return tokens, nil
 }
 
 // DeleteToken deletes an API token by ID
 func (s *APIService) DeleteToken(id int) error {
-	err := s.dbService.DeleteAPIToken(id)
+	tokens, err := s.dbService.GetAllAPITokens()
+	if err != nil {
+		log.Printf("Error getting all tokens: %v", err)
+		return fmt.Errorf("failed to retrieve tokens: %w", err)
+	}
+
+	err = s.dbService.DeleteAPIToken(id)
 	if err != nil {
 		log.Printf("Error deleting token ID %d: %v", id, err)
 		return fmt.Errorf("failed to delete token: %w", err)
 	}
 
+	// 已删除的令牌不再需要脱敏
+	for _, token := range tokens {
+		if token.ID == id {
+			s.tokenVault.ForgetToken(token.TokenValue)
+		}
+	}
+
 	// Reset Zhipu API service if active token was deleted
 	activeToken, err := s.dbService.GetActiveAPIToken()
 	if err != nil || activeToken == nil {
 		s.zhipuAPIService = nil
-	} else if s.zhipuAPIService == nil || s.zhipuAPIService.GetAPIToken() != activeToken.TokenValue {
-		s.zhipuAPIService = NewZhipuAPIService(activeToken.TokenValue)
+	} else if s.zhipuAPIService == nil || s.zhipuAPIService.StoredToken() != activeToken.TokenValue {
+		s.zhipuAPIService = nil
+		if err := s.useStoredToken(activeToken); err != nil {
+			log.Printf("Error using saved token: %v", err)
+		}
+	}
+
+	// 已删除令牌的轮换记录不再保留旧令牌
+	if err := s.tokenRotator.Forget(id); err != nil {
+		log.Printf("Error discarding previous tokens of token ID %d: %v", id, err)
 	}
 
 	log.Printf("Successfully deleted token ID %d", id)
 	return nil
 }
 
-// ValidateToken validates an API token
-func (s *APIService) ValidateToken(token string) error {
-	zhipuService := NewZhipuAPIService(token)
-	err := zhipuService.ValidateAPIToken()
+// RotateToken replaces the active API token with newValue after validating it and checking
+// with a probe sync that it belongs to the same account. force confirms a rotation whose
+// account cannot be verified.
+func (s *APIService) RotateToken(newValue string, force bool) (*models.TokenRotation, error) {
+	token, err := s.dbService.GetActiveAPIToken()
 	if err != nil {
-		log.Printf("Token validation failed: %v", err)
-		return fmt.Errorf("token validation failed: %w", err)
+		log.Printf("Error getting token: %v", err)
+		return nil, fmt.Errorf("failed to retrieve token: %w", err)
+	}
+	if token == nil {
+		return nil, NewValidationError(ErrCodeInvalidParameter, "No active token to rotate")
 	}
 
-	log.Printf("Token validation successful")
-	return nil
+	return s.rotateToken(token, newValue, force)
 }
 
-// ValidateSavedToken validates currently saved API token
-func (s *APIService) ValidateSavedToken() (bool, error) {
-	token, err := s.GetToken()
+// RotateAccountToken replaces the API token of an account with newValue, like RotateToken
+func (s *APIService) RotateAccountToken(tokenID int, newValue string, force bool) (*models.TokenRotation, error) {
+	tokens, err := s.dbService.GetAllAPITokens()
 	if err != nil {
-		return false, fmt.Errorf("failed to get saved token: %w", err)
+		log.Printf("Error getting all tokens: %v", err)
+		return nil, fmt.Errorf("failed to retrieve tokens: %w", err)
 	}
 
-	if token == nil {
-		return false, nil // No token saved
+	for i := range tokens {
+		if tokens[i].ID == tokenID {
+			return s.rotateToken(&tokens[i], newValue, force)
+		}
+	}
+	return nil, NewValidationError(ErrCodeInvalidParameter, fmt.Sprintf("API token %d not found", tokenID))
+}
+
+// rotateToken switches token to newValue and points the Zhipu API service at it if it used the old value
+func (s *APIService) rotateToken(token *models.APIToken, newValue string, force bool) (*models.TokenRotation, error) {
+	newValue = strings.TrimSpace(newValue)
+	if newValue == "" {
+		return nil, NewValidationError(ErrCodeInvalidParameter, "Token value cannot be empty")
 	}
 
-	err = s.ValidateToken(token.TokenValue)
+	tokenCipher, err := s.tokenVault.Cipher()
 	if err != nil {
-		return false, nil // Token is invalid, but don't return error to caller
+		return nil, NewAuthError(ErrCodeInvalidToken, err.Error())
+	}
+	if err := s.checkDuplicateToken(tokenCipher.Hash(newValue), token.ID); err != nil {
+		return nil, err
 	}
 
-	// Update Zhipu API service if validation successful
-	if s.zhipuAPIService == nil {
-		s.zhipuAPIService = NewZhipuAPIService(token.TokenValue)
+	previousValue := token.TokenValue
+	rotation, err := s.tokenRotator.Rotate(token, newValue, force, time.Now())
+	if err != nil {
+		log.Printf("Error rotating token %s: %v", token.TokenName, err)
+		return nil, fmt.Errorf("failed to rotate token: %w", err)
 	}
 
-	return true, nil
-}
+	if s.zhipuAPIService == nil || s.zhipuAPIService.StoredToken() == previousValue {
+		if err := s.useStoredToken(token); err != nil {
+			log.Printf("Error using rotated token: %v", err)
+		}
+	}
 
-// ========== Sync Management APIs ==========
+	// 令牌问题导致的自动同步暂停在轮换后恢复
+	if err := s.autoSyncService.Resume(); err != nil {
+		log.Printf("Error resuming auto sync: %v", err)
+	}
 
-// StartSyncResponse 同步启动响应
-type StartSyncResponse struct {
-	Success bool   `json:"success"`
-	SyncID  int    `json:"sync_id"`
-	Message string `json:"message"`
+	log.Printf("Successfully rotated token %s (account check: %s)", token.TokenName, rotation.AccountCheck)
+	return rotation, nil
 }
 
-// SyncStatusResponse 同步状态响应
-type SyncStatusResponse struct {
-	Syncing      bool      `json:"syncing"`
-	Progress     float64   `json:"progress"`
-	CurrentPage  int       `json:"current_page"`
-	TotalPages   int       `json:"total_pages"`
-	SyncedCount  int       `json:"synced_count"`
-	FailedCount  int       `json:"failed_count"`
-	TotalCount   int       `json:"total_count"`
-	Message      string    `json:"message"`
-	LastSyncTime time.Time `json:"last_sync_time"`
-	Status       string    `json:"status"`
+// RollbackTokenRotation restores the previous token of a rotation within its grace period
+func (s *APIService) RollbackTokenRotation(rotationID int) (*models.TokenRotation, error) {
+	rotation, err := s.tokenRotator.Rollback(rotationID, time.Now())
+	if err != nil {
+		log.Printf("Error rolling back token rotation %d: %v", rotationID, err)
+		return nil, fmt.Errorf("failed to roll back token rotation: %w", err)
+	}
+
+	// 回滚后按恢复的令牌重建 Zhipu API 服务
+	s.zhipuAPIService = nil
+	s.reloadActiveToken()
+
+	log.Printf("Rolled back token rotation %d of token %s", rotationID, rotation.TokenName)
+	return rotation, nil
 }
 
-// SyncBills starts a sync operation for billing data (IPC_01: 修复参数签名)
-func (s *APIService) SyncBills(billingMonth, syncType string, progressCallback func(*models.SyncProgress)) (*models.SyncResult, error) {
-	// IPC_03: 添加参数校验
-	if billingMonth == "" {
-		return &models.SyncResult{
-			Success:      false,
-			ErrorMessage: "Billing month is required",
-		}, NewValidationError(ErrCodeInvalidParameter, "Billing month is required")
+// GetTokenRotations returns the token rotation audit trail, newest first
+func (s *APIService) GetTokenRotations(limit int) ([]models.TokenRotation, error) {
+	if limit <= 0 {
+		limit = 50
 	}
 
-	// 验证账单月份格式 (YYYY-MM)
-	if !isValidBillingMonth(billingMonth) {
-		return &models.SyncResult{
-			Success:      false,
-			ErrorMessage: "Invalid billing month format. Expected YYYY-MM",
-		}, NewValidationError(ErrCodeInvalidParameter, "Invalid billing month format")
+	if _, err := s.tokenRotator.Expire(time.Now()); err != nil {
+		log.Printf("Error expiring token rotations: %v", err)
 	}
 
-	// 验证同步类型
-	if syncType == "" {
-		syncType = "full" // 默认为全量同步
-	}
-	if syncType != "full" && syncType != "incremental" {
-		return &models.SyncResult{
-			Success:      false,
-			ErrorMessage: "Invalid sync type. Must be 'full' or 'incremental'",
-		}, NewValidationError(ErrCodeInvalidParameter, "Invalid sync type")
+	rotations, err := s.tokenRotator.GetRotations(limit, time.Now())
+	if err != nil {
+		log.Printf("Error getting token rotations: %v", err)
+		return nil, fmt.Errorf("failed to get token rotations: %w", err)
 	}
 
-	// 检查API令牌是否配置
-	if s.zhipuAPIService == nil {
-		return &models.SyncResult{
-			Success:      false,
-			ErrorMessage: "No API token configured",
-		}, NewAuthError(ErrCodeSyncNoToken, "No API token configured")
+	return rotations, nil
+}
+
+// SetTokenExpiry sets or clears (nil) the expiry time of an API token
+func (s *APIService) SetTokenExpiry(id int, expiresAt *time.Time) error {
+	if err := s.dbService.UpdateAPITokenExpiry(id, expiresAt); err != nil {
+		log.Printf("Error setting token expiry: %v", err)
+		return fmt.Errorf("failed to set token expiry: %w", err)
 	}
 
-	// 启动同步任务
-	year, month, err := parseBillingMonth(billingMonth)
-	if err != nil {
+	return nil
+}
+
+// GetTokenHealth returns the expiry state of every API token
+func (s *APIService) GetTokenHealth() ([]models.TokenHealth, error) {
+	health, err := s.tokenMonitor.GetTokenHealth(time.Now())
+	if err != nil {
+		log.Printf("Error getting token health: %v", err)
+		return nil, fmt.Errorf("failed to get token health: %w", err)
+	}
+
+	return health, nil
+}
+
+// CheckTokenExpiry checks token expiry immediately, sending warnings and deactivating expired tokens
+func (s *APIService) CheckTokenExpiry() ([]models.TokenHealth, error) {
+	health, err := s.tokenMonitor.CheckTokens(time.Now())
+	if err != nil {
+		log.Printf("Error checking token expiry: %v", err)
+		return nil, fmt.Errorf("failed to check token expiry: %w", err)
+	}
+
+	return health, nil
+}
+
+// StartTokenMonitor checks token expiry now and daily
+func (s *APIService) StartTokenMonitor() {
+	s.tokenMonitor.Start(DefaultTokenCheckInterval)
+}
+
+// StopTokenMonitor stops the daily token expiry check
+func (s *APIService) StopTokenMonitor() {
+	s.tokenMonitor.Stop()
+}
+
+// GetTokenEncryptionStatus returns the token key source and whether tokens are locked
+func (s *APIService) GetTokenEncryptionStatus() map[string]interface{} {
+	return s.tokenVault.Status()
+}
+
+// UnlockTokens unlocks passphrase-encrypted tokens for this session
+func (s *APIService) UnlockTokens(passphrase string) error {
+	if passphrase == "" {
+		return NewValidationError(ErrCodeInvalidParameter, "Passphrase cannot be empty")
+	}
+
+	if err := s.tokenVault.Unlock(passphrase); err != nil {
+		log.Printf("Error unlocking API tokens: %v", err)
+		return NewAuthError(ErrCodeInvalidToken, err.Error())
+	}
+
+	s.reloadActiveToken()
+	return nil
+}
+
+// SetTokenPassphrase re-encrypts all tokens with a key derived from passphrase;
+// an empty passphrase switches back to the key file
+func (s *APIService) SetTokenPassphrase(passphrase string) error {
+	if passphrase != "" && len(passphrase) < 8 {
+		return NewValidationError(ErrCodeInvalidParameter, "Passphrase must be at least 8 characters")
+	}
+
+	if err := s.tokenVault.SetPassphrase(passphrase); err != nil {
+		log.Printf("Error setting token passphrase: %v", err)
+		return fmt.Errorf("failed to set token passphrase: %w", err)
+	}
+
+	// 密文已变化，按新密钥重建 Zhipu API 服务
+	s.reloadActiveToken()
+	return nil
+}
+
+// reloadActiveToken rebuilds the Zhipu API service from the active token under the current key
+func (s *APIService) reloadActiveToken() {
+	token, err := s.dbService.GetActiveAPIToken()
+	if err != nil || token == nil {
+		return
+	}
+
+	if err := s.useStoredToken(token); err != nil {
+		log.Printf("Error using saved token: %v", err)
+	}
+}
+
+// GetRedactionPatterns returns the configured secret patterns masked in logs, errors and notifications
+func (s *APIService) GetRedactionPatterns() []string {
+	return DefaultRedactor().Patterns()
+}
+
+// SetRedactionPatterns validates and persists additional secret patterns (regular expressions)
+func (s *APIService) SetRedactionPatterns(patterns []string) error {
+	if patterns == nil {
+		patterns = []string{}
+	}
+
+	redactor := NewRedactor()
+	if err := redactor.SetPatterns(patterns); err != nil {
+		return NewValidationError(ErrCodeInvalidParameter, err.Error())
+	}
+
+	value, err := encodeRedactionPatterns(patterns)
+	if err != nil {
+		return err
+	}
+
+	err = s.dbService.SetAppSetting(RedactionPatternsConfigKey, value, "自定义脱敏规则（正则表达式）")
+	if err != nil {
+		log.Printf("Error saving redaction patterns: %v", err)
+		return fmt.Errorf("failed to save redaction patterns: %w", err)
+	}
+
+	return DefaultRedactor().SetPatterns(patterns)
+}
+
+// onTokenDeactivated stops syncing with a token the monitor deactivated after expiry,
+// pausing auto sync once no active account is left
+func (s *APIService) onTokenDeactivated(token models.APIToken) {
+	if s.zhipuAPIService != nil && s.zhipuAPIService.StoredToken() == token.TokenValue {
+		s.zhipuAPIService = nil
+		s.reloadActiveToken()
+	}
+
+	if tokens, err := s.dbService.GetActiveAPITokens(); err == nil && len(tokens) > 0 {
+		return // 其他账号仍可同步
+	}
+	s.autoSyncService.Pause("token_expired")
+}
+
+// onTokenRevoked notifies that the billing API rejected an account's token
+func (s *APIService) onTokenRevoked(tokenName, errorMessage string) {
+	log.Printf("API token %s was rejected by the billing API: %s", tokenName, errorMessage)
+	s.notificationService.AddTokenRevokedNotification(tokenName, errorMessage)
+}
+
+// ValidateToken validates an API token
+func (s *APIService) ValidateToken(token string) error {
+	zhipuService := NewZhipuAPIService(token)
+	err := zhipuService.ValidateAPIToken()
+	if err != nil {
+		log.Printf("Token validation failed: %v", err)
+		return fmt.Errorf("token validation failed: %w", err)
+	}
+
+	log.Printf("Token validation successful")
+	return nil
+}
+
+// ValidateSavedToken validates currently saved API token
+func (s *APIService) ValidateSavedToken() (bool, error) {
+	token, err := s.dbService.GetActiveAPIToken()
+	if err != nil {
+		return false, fmt.Errorf("failed to get saved token: %w", err)
+	}
+
+	if token == nil {
+		return false, nil // No token saved
+	}
+
+	// 令牌以密文保存，只在构造 Zhipu API 服务时解密
+	if s.zhipuAPIService == nil || s.zhipuAPIService.StoredToken() != token.TokenValue {
+		if err := s.useStoredToken(token); err != nil {
+			return false, fmt.Errorf("failed to use saved token: %w", err)
+		}
+	}
+
+	if err := s.zhipuAPIService.ValidateAPIToken(); err != nil {
+		return false, nil // Token is invalid, but don't return error to caller
+	}
+
+	return true, nil
+}
+
+// ========== Sync Management APIs ==========
+
+// StartSyncResponse 同步启动响应
+type StartSyncResponse struct {
+	Success bool   `json:"success"`
+	SyncID  int    `json:"sync_id"`
+	Message string `json:"message"`
+}
+
+// SyncStatusResponse 同步状态响应
+type SyncStatusResponse struct {
+	Syncing      bool      `json:"syncing"`
+	Progress     float64   `json:"progress"`
+	CurrentPage  int       `json:"current_page"`
+	TotalPages   int       `json:"total_pages"`
+	SyncedCount  int       `json:"synced_count"`
+	FailedCount  int       `json:"failed_count"`
+	TotalCount   int       `json:"total_count"`
+	Message      string    `json:"message"`
+	LastSyncTime time.Time `json:"last_sync_time"`
+	Status       string    `json:"status"`
+}
+
+// SyncBills syncs billing data of every active account for a month (IPC_01: 修复参数签名)
+func (s *APIService) SyncBills(billingMonth, syncType string, progressCallback func(*models.SyncProgress)) (*models.SyncResult, error) {
+	// IPC_03: 添加参数校验
+	if billingMonth == "" {
+		return &models.SyncResult{
+			Success:      false,
+			ErrorMessage: "Billing month is required",
+		}, NewValidationError(ErrCodeInvalidParameter, "Billing month is required")
+	}
+
+	// 验证账单月份格式 (YYYY-MM)
+	if !isValidBillingMonth(billingMonth) {
+		return &models.SyncResult{
+			Success:      false,
+			ErrorMessage: "Invalid billing month format. Expected YYYY-MM",
+		}, NewValidationError(ErrCodeInvalidParameter, "Invalid billing month format")
+	}
+
+	// 验证同步类型
+	if syncType == "" {
+		syncType = "full" // 默认为全量同步
+	}
+	if syncType != "full" && syncType != "incremental" {
+		return &models.SyncResult{
+			Success:      false,
+			ErrorMessage: "Invalid sync type. Must be 'full' or 'incremental'",
+		}, NewValidationError(ErrCodeInvalidParameter, "Invalid sync type")
+	}
+
+	// 启动同步任务
+	year, month, err := parseBillingMonth(billingMonth)
+	if err != nil {
 		return &models.SyncResult{
 			Success:      false,
 			ErrorMessage: "Invalid billing month format: " + err.Error(),
 		}, NewValidationError(ErrCodeInvalidParameter, "Invalid billing month format")
 	}
 
+	// 检查API令牌是否配置，每个启用的令牌对应一个账号
+	accounts, err := s.dbService.GetActiveAPITokens()
+	if err != nil {
+		log.Printf("Error getting API tokens: %v", err)
+		return &models.SyncResult{
+			Success:      false,
+			ErrorMessage: "Failed to get API tokens: " + err.Error(),
+		}, fmt.Errorf("failed to get API tokens: %w", err)
+	}
+	if len(accounts) == 0 {
+		return &models.SyncResult{
+			Success:      false,
+			ErrorMessage: "No API token configured",
+		}, NewAuthError(ErrCodeSyncNoToken, "No API token configured")
+	}
+
+	tokenCipher, err := s.tokenVault.Cipher()
+	if err != nil {
+		return &models.SyncResult{
+			Success:      false,
+			ErrorMessage: err.Error(),
+		}, NewAuthError(ErrCodeSyncNoToken, err.Error())
+	}
+
+	// 逐个账号同步，单个账号失败不影响其他账号
+	result := &models.SyncResult{
+		Success:  true,
+		Accounts: make([]models.AccountSyncResult, 0, len(accounts)),
+	}
+	var errorMessages []string
+	revokedCount := 0
+	for i := range accounts {
+		accountResult, errorCode := s.syncAccount(&accounts[i], tokenCipher, billingMonth, syncType, year, month, progressCallback)
+		result.Accounts = append(result.Accounts, accountResult)
+		result.SyncedItems += accountResult.SyncedItems
+		result.TotalItems += accountResult.TotalItems
+		result.FailedItems += accountResult.FailedItems
+
+		if !accountResult.Success {
+			result.Success = false
+			errorMessages = append(errorMessages, fmt.Sprintf("%s: %s", accountResult.AccountName, accountResult.ErrorMessage))
+		}
+
+		// 令牌被拒绝视为已撤销
+		if errorCode == ErrCodeAPIUnauthorized {
+			revokedCount++
+			s.onTokenRevoked(accountResult.AccountName, accountResult.ErrorMessage)
+		}
+	}
+	result.ErrorMessage = strings.Join(errorMessages, "; ")
+
+	// 所有账号的令牌都被拒绝时暂停自动同步
+	if revokedCount == len(accounts) {
+		s.autoSyncService.Pause("token_revoked")
+	}
+
+	// 同步完成后执行后续分析
+	s.afterSync()
+
+	return result, nil
+}
+
+// syncAccount syncs one account for a month, saves its bills tagged with the account and
+// records the run in its own sync history entry. The second result is the API error code, if any.
+func (s *APIService) syncAccount(token *models.APIToken, tokenCipher *TokenCipher, billingMonth, syncType string, year, month int,
+	progressCallback func(*models.SyncProgress)) (models.AccountSyncResult, string) {
+	accountResult := models.AccountSyncResult{
+		AccountID:   token.ID,
+		AccountName: token.TokenName,
+	}
+
 	// 创建同步历史记录
 	syncHistory := &models.SyncHistory{
 		SyncType:     syncType,
@@ -451,15 +1140,39 @@ func (s *APIService) SyncBills(billingMonth, syncType string, progressCallback f
 		Status:       "running",
 		BillingMonth: billingMonth,
 		SyncTime:     time.Now(),
+		AccountID:    token.ID,
+		AccountName:  token.TokenName,
+	}
+	if err := s.SaveSyncHistory(syncHistory); err != nil {
+		log.Printf("Failed to save sync history: %v", err)
 	}
 
-	// 保存同步历史
-	err = s.SaveSyncHistory(syncHistory)
+	// 更新同步历史为最终状态
+	finish := func(errorMessage string) {
+		syncHistory.Status = "completed"
+		if errorMessage != "" {
+			syncHistory.Status = "failed"
+			syncHistory.ErrorMessage = &errorMessage
+			accountResult.ErrorMessage = errorMessage
+		}
+		accountResult.Success = errorMessage == ""
+
+		endTime := time.Now()
+		syncHistory.EndTime = &endTime
+		syncHistory.Duration = int(endTime.Sub(syncHistory.StartTime).Seconds())
+		syncHistory.RecordsSynced = accountResult.SyncedItems
+		syncHistory.TotalRecords = accountResult.TotalItems
+		syncHistory.FailedCount = accountResult.FailedItems
+		s.SaveSyncHistory(syncHistory)
+	}
+
+	zhipuAPIService, err := NewZhipuAPIServiceForToken(token.TokenValue, tokenCipher)
 	if err != nil {
-		log.Printf("Failed to save sync history: %v", err)
+		finish("Failed to decrypt API token: " + err.Error())
+		return accountResult, ""
 	}
 
-	response, err := s.zhipuAPIService.SyncFullMonth(year, month, func(progress *SyncProgress) {
+	response, err := zhipuAPIService.SyncFullMonth(year, month, func(progress *SyncProgress) {
 		if progressCallback != nil {
 			// 转换类型：从 services.SyncProgress 到 models.SyncProgress
 			modelsProgress := &models.SyncProgress{
@@ -473,36 +1186,86 @@ func (s *APIService) SyncBills(billingMonth, syncType string, progressCallback f
 		}
 	})
 	if err != nil {
-		// 更新同步历史为失败状态
-		syncHistory.Status = "failed"
-		endTime := time.Now()
-		syncHistory.EndTime = &endTime
-		errorMsg := err.Error()
-		syncHistory.ErrorMessage = &errorMsg
-		s.SaveSyncHistory(syncHistory)
+		finish("Failed to start sync: " + err.Error())
+		return accountResult, ""
+	}
 
-		return &models.SyncResult{
-			Success:      false,
-			ErrorMessage: "Failed to start sync: " + err.Error(),
-		}, err
+	accountResult.TotalItems = response.TotalItems
+	accountResult.FailedItems = response.FailedItems
+
+	// 部分页面失败时仍保存已获取的账单
+	saved, err := s.saveSyncedBills(token.ID, response.ProcessedBills)
+	accountResult.SyncedItems = saved
+	if err != nil {
+		log.Printf("Error saving synced bills for account %s: %v", token.TokenName, err)
+		accountResult.FailedItems += len(response.ProcessedBills)
+		finish("Failed to save bills: " + err.Error())
+		return accountResult, response.ErrorCode
 	}
 
-	// 更新同步历史为完成状态
-	syncHistory.Status = "completed"
-	endTime := time.Now()
-	syncHistory.EndTime = &endTime
-	syncHistory.RecordsSynced = response.SyncedItems
-	syncHistory.TotalRecords = response.TotalItems
-	syncHistory.FailedCount = response.FailedItems
-	s.SaveSyncHistory(syncHistory)
-
-	return &models.SyncResult{
-		Success:      response.Success,
-		SyncedItems:  response.SyncedItems,
-		TotalItems:   response.TotalItems,
-		FailedItems:  response.FailedItems,
-		ErrorMessage: response.ErrorMessage,
-	}, nil
+	errorMessage := ""
+	if !response.Success {
+		errorMessage = response.ErrorMessage
+		if errorMessage == "" {
+			errorMessage = "Sync did not complete"
+		}
+	}
+	finish(errorMessage)
+
+	return accountResult, response.ErrorCode
+}
+
+// saveSyncedBills saves synced bills of an account in one transaction and returns how many were saved
+func (s *APIService) saveSyncedBills(accountID int, bills []models.ExpenseBill) (int, error) {
+	if len(bills) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.dbService.BeginTx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	earliest := time.Time{}
+	for i := range bills {
+		bill := &bills[i]
+		bill.AccountID = accountID
+		if err := s.dbService.CreateOrUpdateExpenseBillInTx(tx, bill); err != nil {
+			return 0, err
+		}
+		if !bill.TransactionTime.IsZero() && (earliest.IsZero() || bill.TransactionTime.Before(earliest)) {
+			earliest = bill.TransactionTime
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit synced bills: %w", err)
+	}
+
+	// 本次账单可能早于上次记录的等级变更，从最早的账单起识别
+	if _, err := s.dbService.UpdateMembershipTierHistory(accountID, earliest); err != nil {
+		log.Printf("Error updating membership tier history: %v", err)
+	}
+
+	return len(bills), nil
+}
+
+// afterSync runs post-sync analysis; failures are logged and never fail the sync itself
+func (s *APIService) afterSync() {
+	if _, err := s.anomalyDetector.DetectAnomalies(time.Now()); err != nil {
+		log.Printf("Error detecting usage anomalies after sync: %v", err)
+	}
+	if _, err := s.quotaTracker.CheckQuota(time.Now()); err != nil {
+		log.Printf("Error checking quota after sync: %v", err)
+	}
+	if _, err := s.budgetTracker.CheckBudgets(time.Now()); err != nil {
+		log.Printf("Error checking budgets after sync: %v", err)
+	}
+	if _, err := s.alertEngine.EvaluateRules(time.Now()); err != nil {
+		log.Printf("Error evaluating alert rules after sync: %v", err)
+	}
+	s.cleanupNotifications()
 }
 
 // isValidBillingMonth 验证账单月份格式
@@ -577,6 +1340,8 @@ func (s *APIService) GetSyncHistory(syncType string, pageNum, pageSize int) (*mo
 		FailedCount  int    `json:"failed_count"`
 		TotalCount   int    `json:"total_count"`
 		Message      string `json:"message"`
+		AccountID    int    `json:"account_id"`
+		AccountName  string `json:"account_name"`
 	}
 
 	var filteredHistory []SyncHistoryResponse
@@ -589,8 +1354,11 @@ func (s *APIService) GetSyncHistory(syncType string, pageNum, pageSize int) (*mo
 					continue
 				}
 
-				// Calculate billing month from start time
-				billingMonth := history.StartTime.Format("2006-01")
+				// 旧记录没有账单月份，按开始时间推算
+				billingMonth := history.BillingMonth
+				if billingMonth == "" {
+					billingMonth = history.StartTime.Format("2006-01")
+				}
 
 				// Calculate failed count
 				failedCount := 0
@@ -612,6 +1380,8 @@ func (s *APIService) GetSyncHistory(syncType string, pageNum, pageSize int) (*mo
 					FailedCount:  failedCount,
 					TotalCount:   history.TotalRecords,
 					Message:      message,
+					AccountID:    history.AccountID,
+					AccountName:  history.AccountName,
 				}
 				filteredHistory = append(filteredHistory, response)
 			}
@@ -670,72 +1440,840 @@ func getDisplayStatus(status string) string {
 	}
 }
 
-// SyncRecentMonths syncs billing data for recent months
+// SyncRecentMonths syncs billing data of every active account for recent months
 func (s *APIService) SyncRecentMonths(months int, progressCallback func(month, totalMonths int, monthProgress *SyncProgress)) ([]*SyncResult, error) {
-	if s.zhipuAPIService == nil {
-		return nil, fmt.Errorf("no API token configured")
+	if months <= 0 {
+		months = 3 // Default to last 3 months
 	}
 
-	results, err := s.zhipuAPIService.SyncRecentMonths(months, progressCallback)
-	if err != nil {
-		return nil, fmt.Errorf("sync recent months failed: %w", err)
-	}
+	var results []*SyncResult
+	now := time.Now()
+	for i := 0; i < months; i++ {
+		billingMonth := now.AddDate(0, -i, 0).Format("2006-01")
+
+		var monthProgressCallback func(*models.SyncProgress)
+		if progressCallback != nil {
+			monthIndex := i + 1
+			monthProgressCallback = func(progress *models.SyncProgress) {
+				progressCallback(monthIndex, months, &SyncProgress{
+					CurrentPage: progress.CurrentPage,
+					TotalPages:  progress.TotalPages,
+					TotalItems:  progress.TotalCount,
+					SyncedItems: progress.SyncedCount,
+				})
+			}
+		}
 
-	// Save all synced bills to database
-	for _, result := range results {
-		// TODO: Implement bill processing logic when ProcessedBills field is available
-		if result.Success {
-			log.Printf("Sync completed successfully: %d items synced", result.SyncedItems)
+		startTime := time.Now()
+		result, err := s.SyncBills(billingMonth, "full", monthProgressCallback)
+		if err != nil {
+			return results, fmt.Errorf("failed to sync month %s: %w", billingMonth, err)
 		}
+
+		results = append(results, &SyncResult{
+			Success:      result.Success,
+			Message:      billingMonth,
+			TotalItems:   result.TotalItems,
+			SyncedItems:  result.SyncedItems,
+			FailedItems:  result.FailedItems,
+			Duration:     time.Since(startTime),
+			ErrorMessage: result.ErrorMessage,
+		})
 	}
 
 	return results, nil
 }
 
-// ========== Configuration Management APIs ==========
+// ========== Anomaly Detection APIs ==========
 
-// GetConfig retrieves a configuration value
-func (s *APIService) GetConfig(key string) (string, error) {
-	value, err := s.dbService.GetAutoSyncConfig(key)
+// DetectUsageAnomalies runs anomaly detection immediately and returns newly detected anomalies
+func (s *APIService) DetectUsageAnomalies() ([]models.UsageAnomaly, error) {
+	anomalies, err := s.anomalyDetector.DetectAnomalies(time.Now())
 	if err != nil {
-		log.Printf("Error getting config %s: %v", key, err)
-		return "", fmt.Errorf("failed to retrieve config: %w", err)
+		log.Printf("Error detecting usage anomalies: %v", err)
+		return nil, fmt.Errorf("failed to detect usage anomalies: %w", err)
 	}
 
-	return value, nil
+	return anomalies, nil
 }
 
-// SetConfig saves a configuration value
-func (s *APIService) SetConfig(key, value, description string) error {
-	err := s.dbService.SetAutoSyncConfig(key, value, description)
+// GetUsageAnomalies retrieves recently detected usage anomalies
+func (s *APIService) GetUsageAnomalies(limit int) ([]models.UsageAnomaly, error) {
+	anomalies, err := s.anomalyDetector.GetRecentAnomalies(limit)
 	if err != nil {
-		log.Printf("Error setting config %s: %v", key, err)
-		return fmt.Errorf("failed to save config: %w", err)
+		log.Printf("Error getting usage anomalies: %v", err)
+		return nil, fmt.Errorf("failed to retrieve usage anomalies: %w", err)
 	}
 
-	log.Printf("Successfully set config: %s = %s", key, value)
-	return nil
+	return anomalies, nil
 }
 
-// GetAllConfigs retrieves all configuration values
-func (s *APIService) GetAllConfigs() ([]models.AutoSyncConfig, error) {
-	configs, err := s.dbService.GetAllAutoSyncConfigs()
+// ========== Quota Tracking APIs ==========
+
+// GetQuotaStatus retrieves the rolling-window quota usage of each active account's tier,
+// raising a notification if an account's usage has crossed 80% or 100% since the last check
+func (s *APIService) GetQuotaStatus() ([]*models.QuotaStatus, error) {
+	statuses, err := s.quotaTracker.CheckQuota(time.Now())
 	if err != nil {
-		log.Printf("Error getting all configs: %v", err)
-		return nil, fmt.Errorf("failed to retrieve configs: %w", err)
+		log.Printf("Error getting quota status: %v", err)
+		return nil, fmt.Errorf("failed to retrieve quota status: %w", err)
 	}
 
-	return configs, nil
+	return statuses, nil
 }
 
-// ========== Utility APIs ==========
+// ========== Work Session APIs ==========
 
-// GetDatabaseInfo retrieves database information
-func (s *APIService) GetDatabaseInfo() (map[string]interface{}, error) {
-	info := map[string]interface{}{
-		"path":    s.db.GetPath(),
-		"type":    "SQLite3",
-		"version": "3.x",
+// resolveSessionFilter fills in the configured idle gap when the filter does not set one
+func (s *APIService) resolveSessionFilter(filter *models.SessionFilter) error {
+	if filter.IdleGapMinutes < 0 {
+		return NewValidationError(ErrCodeInvalidParameter, "idle gap cannot be negative")
+	}
+	if filter.IdleGapMinutes == 0 {
+		filter.IdleGapMinutes = s.GetSessionIdleGap()
+	}
+	return nil
+}
+
+// GetSessions reconstructs work sessions from bill timestamps
+func (s *APIService) GetSessions(filter models.SessionFilter) ([]models.UsageSession, error) {
+	if err := s.resolveSessionFilter(&filter); err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.statsService.GetSessions(filter)
+	if err != nil {
+		log.Printf("Error getting sessions: %v", err)
+		return nil, fmt.Errorf("failed to retrieve sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// GetSessionStats retrieves session-level statistics such as cost per session hour
+func (s *APIService) GetSessionStats(filter models.SessionFilter) (*models.SessionStats, error) {
+	if err := s.resolveSessionFilter(&filter); err != nil {
+		return nil, err
+	}
+
+	stats, err := s.statsService.GetSessionStats(filter)
+	if err != nil {
+		log.Printf("Error getting session stats: %v", err)
+		return nil, fmt.Errorf("failed to retrieve session stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetSessionIdleGap returns the configured session idle gap in minutes
+func (s *APIService) GetSessionIdleGap() int {
+	value, err := s.dbService.GetAppSetting(models.SessionIdleGapConfigKey)
+	if err != nil {
+		return models.DefaultSessionIdleGapMinutes
+	}
+
+	minutes, err := strconv.Atoi(value)
+	if err != nil || minutes <= 0 {
+		return models.DefaultSessionIdleGapMinutes
+	}
+	return minutes
+}
+
+// SetSessionIdleGap persists the session idle gap in minutes
+func (s *APIService) SetSessionIdleGap(minutes int) error {
+	if minutes <= 0 || minutes > 24*60 {
+		return NewValidationError(ErrCodeInvalidParameter, "idle gap must be between 1 and 1440 minutes")
+	}
+
+	err := s.dbService.SetAppSetting(models.SessionIdleGapConfigKey, strconv.Itoa(minutes), "会话空闲间隔（分钟）")
+	if err != nil {
+		log.Printf("Error saving session idle gap: %v", err)
+		return fmt.Errorf("failed to save session idle gap: %w", err)
+	}
+
+	return nil
+}
+
+// ========== Budget APIs ==========
+
+// GetBudgets retrieves all budgets
+func (s *APIService) GetBudgets() ([]models.Budget, error) {
+	budgets, err := s.dbService.GetBudgets()
+	if err != nil {
+		log.Printf("Error getting budgets: %v", err)
+		return nil, fmt.Errorf("failed to retrieve budgets: %w", err)
+	}
+
+	return budgets, nil
+}
+
+// SaveBudget creates or updates a budget
+func (s *APIService) SaveBudget(budget models.Budget) (*models.Budget, error) {
+	if err := validateBudget(&budget); err != nil {
+		return nil, NewValidationError(ErrCodeInvalidParameter, err.Error())
+	}
+
+	if err := s.dbService.SaveBudget(&budget); err != nil {
+		log.Printf("Error saving budget: %v", err)
+		return nil, fmt.Errorf("failed to save budget: %w", err)
+	}
+
+	return &budget, nil
+}
+
+// DeleteBudget deletes a budget
+func (s *APIService) DeleteBudget(id int) error {
+	if err := s.dbService.DeleteBudget(id); err != nil {
+		log.Printf("Error deleting budget: %v", err)
+		return fmt.Errorf("failed to delete budget: %w", err)
+	}
+
+	return nil
+}
+
+// GetBudgetStatuses retrieves the current-period progress of every budget
+func (s *APIService) GetBudgetStatuses() ([]models.BudgetStatus, error) {
+	statuses, err := s.budgetTracker.GetBudgetStatuses(time.Now())
+	if err != nil {
+		log.Printf("Error getting budget statuses: %v", err)
+		return nil, fmt.Errorf("failed to retrieve budget statuses: %w", err)
+	}
+
+	return statuses, nil
+}
+
+// ========== Alert Rule APIs ==========
+
+// GetAlertRules retrieves all alert rules with their current state
+func (s *APIService) GetAlertRules() ([]models.AlertRule, error) {
+	rules, err := s.dbService.GetAlertRules()
+	if err != nil {
+		log.Printf("Error getting alert rules: %v", err)
+		return nil, fmt.Errorf("failed to retrieve alert rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// SaveAlertRule creates or updates an alert rule
+func (s *APIService) SaveAlertRule(rule models.AlertRule) (*models.AlertRule, error) {
+	if err := validateAlertRule(&rule); err != nil {
+		return nil, NewValidationError(ErrCodeInvalidParameter, err.Error())
+	}
+
+	if err := s.dbService.SaveAlertRule(&rule); err != nil {
+		log.Printf("Error saving alert rule: %v", err)
+		return nil, fmt.Errorf("failed to save alert rule: %w", err)
+	}
+
+	return &rule, nil
+}
+
+// DeleteAlertRule deletes an alert rule
+func (s *APIService) DeleteAlertRule(id int) error {
+	if err := s.dbService.DeleteAlertRule(id); err != nil {
+		log.Printf("Error deleting alert rule: %v", err)
+		return fmt.Errorf("failed to delete alert rule: %w", err)
+	}
+
+	return nil
+}
+
+// GetAlertEvents retrieves recent firing and resolved events, optionally of one rule
+func (s *APIService) GetAlertEvents(ruleID, limit int) ([]models.AlertEvent, error) {
+	events, err := s.dbService.GetAlertEvents(ruleID, limit)
+	if err != nil {
+		log.Printf("Error getting alert events: %v", err)
+		return nil, fmt.Errorf("failed to retrieve alert events: %w", err)
+	}
+
+	return events, nil
+}
+
+// EvaluateAlertRules evaluates all alert rules immediately
+func (s *APIService) EvaluateAlertRules() ([]models.AlertEvent, error) {
+	events, err := s.alertEngine.EvaluateRules(time.Now())
+	if err != nil {
+		log.Printf("Error evaluating alert rules: %v", err)
+		return nil, fmt.Errorf("failed to evaluate alert rules: %w", err)
+	}
+
+	return events, nil
+}
+
+// StartAlertEngine starts periodic alert rule evaluation
+func (s *APIService) StartAlertEngine() {
+	s.alertEngine.Start(DefaultAlertEvaluationInterval)
+}
+
+// StopAlertEngine stops periodic alert rule evaluation
+func (s *APIService) StopAlertEngine() {
+	s.alertEngine.Stop()
+}
+
+// ========== Usage Digest APIs ==========
+
+// GetDigestSchedules retrieves all digest schedules
+func (s *APIService) GetDigestSchedules() ([]models.DigestSchedule, error) {
+	schedules, err := s.dbService.GetDigestSchedules()
+	if err != nil {
+		log.Printf("Error getting digest schedules: %v", err)
+		return nil, fmt.Errorf("failed to retrieve digest schedules: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// SaveDigestSchedule creates or updates a digest schedule
+func (s *APIService) SaveDigestSchedule(schedule models.DigestSchedule) (*models.DigestSchedule, error) {
+	if err := validateDigestSchedule(&schedule); err != nil {
+		return nil, NewValidationError(ErrCodeInvalidParameter, err.Error())
+	}
+
+	if err := s.dbService.SaveDigestSchedule(&schedule); err != nil {
+		log.Printf("Error saving digest schedule: %v", err)
+		return nil, fmt.Errorf("failed to save digest schedule: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+// DeleteDigestSchedule deletes a digest schedule
+func (s *APIService) DeleteDigestSchedule(id int) error {
+	if err := s.dbService.DeleteDigestSchedule(id); err != nil {
+		log.Printf("Error deleting digest schedule: %v", err)
+		return fmt.Errorf("failed to delete digest schedule: %w", err)
+	}
+
+	return nil
+}
+
+// GenerateDigest generates, stores and sends a digest of the given kind immediately
+func (s *APIService) GenerateDigest(kind string) (*models.UsageDigest, error) {
+	if kind != DigestKindDaily && kind != DigestKindWeekly {
+		return nil, NewValidationError(ErrCodeInvalidParameter, "Digest kind must be daily or weekly")
+	}
+
+	digest, err := s.digestGenerator.Generate(kind, time.Now())
+	if err != nil {
+		log.Printf("Error generating digest: %v", err)
+		return nil, fmt.Errorf("failed to generate digest: %w", err)
+	}
+
+	return digest, nil
+}
+
+// GetUsageDigests retrieves the most recent digests
+func (s *APIService) GetUsageDigests(limit int) ([]models.UsageDigest, error) {
+	digests, err := s.dbService.GetUsageDigests(limit)
+	if err != nil {
+		log.Printf("Error getting usage digests: %v", err)
+		return nil, fmt.Errorf("failed to retrieve usage digests: %w", err)
+	}
+
+	return digests, nil
+}
+
+// GetUsageDigest retrieves a past digest by ID
+func (s *APIService) GetUsageDigest(id int) (*models.UsageDigest, error) {
+	digest, err := s.dbService.GetUsageDigest(id)
+	if err != nil {
+		log.Printf("Error getting usage digest: %v", err)
+		return nil, fmt.Errorf("failed to retrieve usage digest: %w", err)
+	}
+
+	return digest, nil
+}
+
+// StartDigestScheduler starts the digest schedule check
+func (s *APIService) StartDigestScheduler() {
+	s.digestGenerator.Start(DefaultDigestCheckInterval)
+}
+
+// StopDigestScheduler stops the digest schedule check
+func (s *APIService) StopDigestScheduler() {
+	s.digestGenerator.Stop()
+}
+
+// ========== Notification Center APIs ==========
+
+// GetNotifications retrieves a page of notifications, newest first
+func (s *APIService) GetNotifications(filter models.NotificationFilter) (*models.PaginatedResult, error) {
+	if filter.PageSize > 100 {
+		return nil, NewValidationError(ErrCodeInvalidParameter, "Page size must be between 1 and 100")
+	}
+
+	result, err := s.notificationService.QueryNotifications(&filter)
+	if err != nil {
+		log.Printf("Error getting notifications: %v", err)
+		return nil, fmt.Errorf("failed to retrieve notifications: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetNotificationsByType retrieves all notifications of a type, newest first
+func (s *APIService) GetNotificationsByType(notificationType int) ([]Notification, error) {
+	if notificationType < int(NotificationTypeInfo) || notificationType > int(NotificationTypeError) {
+		return nil, NewValidationError(ErrCodeInvalidParameter, "Invalid notification type")
+	}
+
+	notifications, err := s.notificationService.GetNotificationsByType(NotificationType(notificationType))
+	if err != nil {
+		log.Printf("Error getting notifications by type: %v", err)
+		return nil, fmt.Errorf("failed to retrieve notifications: %w", err)
+	}
+
+	return notifications, nil
+}
+
+// GetNotificationsByDateRange retrieves notifications last seen within [start, end), newest first
+func (s *APIService) GetNotificationsByDateRange(start, end time.Time) ([]Notification, error) {
+	if !end.After(start) {
+		return nil, NewValidationError(ErrCodeInvalidParameter, "End time must be after start time")
+	}
+
+	notifications, err := s.notificationService.GetNotificationsByDateRange(start, end)
+	if err != nil {
+		log.Printf("Error getting notifications by date range: %v", err)
+		return nil, fmt.Errorf("failed to retrieve notifications: %w", err)
+	}
+
+	return notifications, nil
+}
+
+// GetUnreadNotificationCount returns the number of unread notifications
+func (s *APIService) GetUnreadNotificationCount() (int, error) {
+	count, err := s.notificationService.GetNotificationCount()
+	if err != nil {
+		log.Printf("Error counting unread notifications: %v", err)
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkNotificationRead marks a notification as read
+func (s *APIService) MarkNotificationRead(id int) error {
+	if err := s.notificationService.MarkAsRead(id); err != nil {
+		log.Printf("Error marking notification as read: %v", err)
+		return fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+
+	return nil
+}
+
+// MarkAllNotificationsRead marks all notifications as read
+func (s *APIService) MarkAllNotificationsRead() error {
+	if err := s.notificationService.MarkAllAsRead(); err != nil {
+		log.Printf("Error marking notifications as read: %v", err)
+		return fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteNotification deletes a notification
+func (s *APIService) DeleteNotification(id int) error {
+	if err := s.notificationService.DeleteNotification(id); err != nil {
+		log.Printf("Error deleting notification: %v", err)
+		return fmt.Errorf("failed to delete notification: %w", err)
+	}
+
+	return nil
+}
+
+// ClearNotifications deletes all notifications
+func (s *APIService) ClearNotifications() error {
+	if err := s.notificationService.ClearNotifications(); err != nil {
+		log.Printf("Error clearing notifications: %v", err)
+		return fmt.Errorf("failed to clear notifications: %w", err)
+	}
+
+	return nil
+}
+
+// ExportNotifications exports all notifications as JSON
+func (s *APIService) ExportNotifications() (string, error) {
+	data, err := s.notificationService.ExportNotifications()
+	if err != nil {
+		log.Printf("Error exporting notifications: %v", err)
+		return "", fmt.Errorf("failed to export notifications: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// GetNotificationTTL returns the notification retention in days
+func (s *APIService) GetNotificationTTL() int {
+	value, err := s.dbService.GetAppSetting(NotificationTTLConfigKey)
+	if err != nil {
+		return DefaultNotificationTTLDays
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days <= 0 {
+		return DefaultNotificationTTLDays
+	}
+	return days
+}
+
+// SetNotificationTTL persists the notification retention in days and cleans up immediately
+func (s *APIService) SetNotificationTTL(days int) error {
+	if days <= 0 || days > 3650 {
+		return NewValidationError(ErrCodeInvalidParameter, "retention must be between 1 and 3650 days")
+	}
+
+	err := s.dbService.SetAppSetting(NotificationTTLConfigKey, strconv.Itoa(days), "通知保留天数")
+	if err != nil {
+		log.Printf("Error saving notification TTL: %v", err)
+		return fmt.Errorf("failed to save notification TTL: %w", err)
+	}
+
+	s.cleanupNotifications()
+	return nil
+}
+
+// cleanupNotifications deletes notifications older than the configured retention
+func (s *APIService) cleanupNotifications() {
+	if _, err := s.notificationService.CleanupExpired(s.GetNotificationTTL()); err != nil {
+		log.Printf("Error cleaning up notifications: %v", err)
+	}
+}
+
+// ========== Notification Channel APIs ==========
+
+// maskChannelSecret hides a channel's signing secret before it is returned
+func maskChannelSecret(channel *models.NotificationChannel) {
+	channel.Secret = models.MaskSecret(channel.Secret)
+}
+
+// GetNotificationChannels retrieves all notification channels with masked secrets
+func (s *APIService) GetNotificationChannels() ([]models.NotificationChannel, error) {
+	channels, err := s.dbService.GetNotificationChannels()
+	if err != nil {
+		log.Printf("Error getting notification channels: %v", err)
+		return nil, fmt.Errorf("failed to retrieve notification channels: %w", err)
+	}
+
+	for i := range channels {
+		maskChannelSecret(&channels[i])
+	}
+	return channels, nil
+}
+
+// SaveNotificationChannel creates or updates a notification channel. A secret equal to the masked
+// value returned by GetNotificationChannels keeps the stored secret.
+func (s *APIService) SaveNotificationChannel(channel models.NotificationChannel) (*models.NotificationChannel, error) {
+	if err := validateNotificationChannel(&channel); err != nil {
+		return nil, NewValidationError(ErrCodeInvalidParameter, err.Error())
+	}
+
+	if channel.ID != 0 && channel.Secret != "" {
+		existing, err := s.dbService.GetNotificationChannel(channel.ID)
+		if err != nil {
+			log.Printf("Error getting notification channel: %v", err)
+			return nil, fmt.Errorf("failed to save notification channel: %w", err)
+		}
+		if channel.Secret == models.MaskSecret(existing.Secret) {
+			channel.Secret = existing.Secret
+		}
+	}
+
+	if err := s.dbService.SaveNotificationChannel(&channel); err != nil {
+		log.Printf("Error saving notification channel: %v", err)
+		return nil, fmt.Errorf("failed to save notification channel: %w", err)
+	}
+
+	maskChannelSecret(&channel)
+	return &channel, nil
+}
+
+// DeleteNotificationChannel deletes a notification channel
+func (s *APIService) DeleteNotificationChannel(id int) error {
+	if err := s.dbService.DeleteNotificationChannel(id); err != nil {
+		log.Printf("Error deleting notification channel: %v", err)
+		return fmt.Errorf("failed to delete notification channel: %w", err)
+	}
+
+	return nil
+}
+
+// TestNotificationChannel sends a test notification to a channel and waits for the delivery result
+func (s *APIService) TestNotificationChannel(id int) (*models.NotificationDelivery, error) {
+	channel, err := s.dbService.GetNotificationChannel(id)
+	if err != nil {
+		log.Printf("Error getting notification channel: %v", err)
+		return nil, fmt.Errorf("failed to test notification channel: %w", err)
+	}
+
+	notification := Notification{
+		Type:      NotificationTypeInfo,
+		Title:     "测试通知",
+		Message:   fmt.Sprintf("这是来自 GLM 用量监控的测试通知（渠道：%s）", channel.Name),
+		Data:      map[string]interface{}{"type": "channel_test"},
+		CreatedAt: time.Now(),
+	}
+
+	return s.channelDispatcher.Deliver(*channel, notification), nil
+}
+
+// GetNotificationDeliveries retrieves the delivery log, optionally of one channel
+func (s *APIService) GetNotificationDeliveries(channelID, limit int) ([]models.NotificationDelivery, error) {
+	deliveries, err := s.dbService.GetNotificationDeliveries(channelID, limit)
+	if err != nil {
+		log.Printf("Error getting notification deliveries: %v", err)
+		return nil, fmt.Errorf("failed to retrieve notification deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// ========== Subscription Savings APIs ==========
+
+// GetSubscriptionSavings compares the list price of plan-covered usage with the subscription cost
+func (s *APIService) GetSubscriptionSavings(startDate, endDate *time.Time) (*models.SubscriptionSavingsReport, error) {
+	report, err := s.statsService.GetSubscriptionSavings(startDate, endDate)
+	if err != nil {
+		log.Printf("Error getting subscription savings: %v", err)
+		return nil, fmt.Errorf("failed to retrieve subscription savings: %w", err)
+	}
+
+	return report, nil
+}
+
+// ========== Price Catalogue APIs ==========
+
+// GetModelPrices retrieves the model price catalogue
+func (s *APIService) GetModelPrices() ([]models.ModelPrice, error) {
+	prices, err := s.dbService.GetModelPrices()
+	if err != nil {
+		log.Printf("Error getting model prices: %v", err)
+		return nil, fmt.Errorf("failed to retrieve model prices: %w", err)
+	}
+
+	return prices, nil
+}
+
+// SaveModelPrice creates or updates a model price
+func (s *APIService) SaveModelPrice(price models.ModelPrice) (*models.ModelPrice, error) {
+	if err := validateModelPrice(&price); err != nil {
+		return nil, NewValidationError(ErrCodeInvalidParameter, err.Error())
+	}
+
+	if err := s.dbService.SaveModelPrice(&price); err != nil {
+		log.Printf("Error saving model price: %v", err)
+		return nil, fmt.Errorf("failed to save model price: %w", err)
+	}
+
+	return &price, nil
+}
+
+// DeleteModelPrice deletes a model price
+func (s *APIService) DeleteModelPrice(id int) error {
+	if err := s.dbService.DeleteModelPrice(id); err != nil {
+		log.Printf("Error deleting model price: %v", err)
+		return fmt.Errorf("failed to delete model price: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyBilledCosts checks the month's bills against the price catalogue. Non-positive
+// tolerances use the defaults (0.01 元 absolute, 1% relative).
+func (s *APIService) VerifyBilledCosts(billingMonth string, absTolerance, relTolerance float64) (*models.CostVerificationReport, error) {
+	if !isValidBillingMonth(billingMonth) {
+		return nil, NewValidationError(ErrCodeInvalidParameter, "Invalid billing month format. Expected: YYYY-MM")
+	}
+
+	report, err := s.statsService.VerifyBilledCosts(billingMonth, absTolerance, relTolerance)
+	if err != nil {
+		log.Printf("Error verifying billed costs: %v", err)
+		return nil, fmt.Errorf("failed to verify billed costs: %w", err)
+	}
+
+	return report, nil
+}
+
+// ========== Cost Allocation APIs ==========
+
+// GetGroupUsageReport retrieves usage totals, daily series and top models per group
+func (s *APIService) GetGroupUsageReport(startDate, endDate *time.Time, groupType string) ([]models.GroupUsageData, error) {
+	report, err := s.statsService.GetGroupUsageReport(startDate, endDate, groupType)
+	if err != nil {
+		log.Printf("Error getting group usage report: %v", err)
+		return nil, fmt.Errorf("failed to retrieve group usage report: %w", err)
+	}
+
+	return report, nil
+}
+
+// GetCostCenterChargeback retrieves the monthly cost rolled up by cost center
+func (s *APIService) GetCostCenterChargeback(billingMonth, groupType string) ([]models.CostCenterChargeback, error) {
+	if !isValidBillingMonth(billingMonth) {
+		return nil, NewValidationError(ErrCodeInvalidParameter, "Invalid billing month format")
+	}
+
+	chargebacks, err := s.statsService.GetCostCenterChargeback(billingMonth, groupType)
+	if err != nil {
+		log.Printf("Error getting cost center chargeback: %v", err)
+		return nil, fmt.Errorf("failed to retrieve cost center chargeback: %w", err)
+	}
+
+	return chargebacks, nil
+}
+
+// GetCostAllocationTable retrieves the monthly chargeback table with one row per group
+func (s *APIService) GetCostAllocationTable(billingMonth, groupType string) (*models.ReportTable, error) {
+	if !isValidBillingMonth(billingMonth) {
+		return nil, NewValidationError(ErrCodeInvalidParameter, "Invalid billing month format")
+	}
+
+	table, err := s.statsService.GetCostAllocationTable(billingMonth, groupType)
+	if err != nil {
+		log.Printf("Error getting cost allocation table: %v", err)
+		return nil, fmt.Errorf("failed to retrieve cost allocation table: %w", err)
+	}
+
+	return table, nil
+}
+
+// ExportCostAllocationCSV exports the monthly chargeback table as CSV
+func (s *APIService) ExportCostAllocationCSV(billingMonth, groupType string) (string, error) {
+	table, err := s.GetCostAllocationTable(billingMonth, groupType)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := table.ToCSV()
+	if err != nil {
+		log.Printf("Error exporting cost allocation CSV: %v", err)
+		return "", fmt.Errorf("failed to export cost allocation CSV: %w", err)
+	}
+
+	return content, nil
+}
+
+// GetGroupCostCenters retrieves all group to cost center mappings
+func (s *APIService) GetGroupCostCenters() ([]models.GroupCostCenter, error) {
+	mappings, err := s.dbService.GetGroupCostCenters()
+	if err != nil {
+		log.Printf("Error getting group cost centers: %v", err)
+		return nil, fmt.Errorf("failed to retrieve group cost centers: %w", err)
+	}
+
+	return mappings, nil
+}
+
+// SaveGroupCostCenter creates or updates the cost center of a group
+func (s *APIService) SaveGroupCostCenter(groupID, groupName, costCenter, description string) error {
+	if groupID == "" {
+		return NewValidationError(ErrCodeInvalidParameter, "Group ID cannot be empty")
+	}
+	if costCenter == "" {
+		return NewValidationError(ErrCodeInvalidParameter, "Cost center cannot be empty")
+	}
+
+	mapping := &models.GroupCostCenter{
+		GroupID:     groupID,
+		GroupName:   groupName,
+		CostCenter:  costCenter,
+		Description: description,
+	}
+
+	if err := s.dbService.SaveGroupCostCenter(mapping); err != nil {
+		log.Printf("Error saving group cost center: %v", err)
+		return fmt.Errorf("failed to save group cost center: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteGroupCostCenter removes the cost center mapping of a group
+func (s *APIService) DeleteGroupCostCenter(groupID string) error {
+	if err := s.dbService.DeleteGroupCostCenter(groupID); err != nil {
+		log.Printf("Error deleting group cost center: %v", err)
+		return fmt.Errorf("failed to delete group cost center: %w", err)
+	}
+
+	return nil
+}
+
+// ========== Configuration Management APIs ==========
+
+// GetConfig retrieves a configuration value
+func (s *APIService) GetConfig(key string) (string, error) {
+	value, err := s.dbService.GetAutoSyncConfig(key)
+	if err != nil {
+		log.Printf("Error getting config %s: %v", key, err)
+		return "", fmt.Errorf("failed to retrieve config: %w", err)
+	}
+
+	return value, nil
+}
+
+// SetConfig saves a configuration value
+func (s *APIService) SetConfig(key, value, description string) error {
+	if key == models.ReportingTimezoneConfigKey {
+		return s.SetReportingTimezone(value)
+	}
+
+	err := s.dbService.SetAutoSyncConfig(key, value, description)
+	if err != nil {
+		log.Printf("Error setting config %s: %v", key, err)
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	log.Printf("Successfully set config: %s = %s", key, value)
+	return nil
+}
+
+// GetReportingTimezone returns the timezone used for daily, weekly and monthly statistics
+func (s *APIService) GetReportingTimezone() string {
+	return models.ReportingTimezone()
+}
+
+// SetReportingTimezone validates, applies and persists the reporting timezone
+func (s *APIService) SetReportingTimezone(timezone string) error {
+	if err := models.SetReportingTimezone(timezone); err != nil {
+		return NewValidationError(ErrCodeInvalidParameter, err.Error())
+	}
+
+	err := s.dbService.SetAppSetting(models.ReportingTimezoneConfigKey, timezone, "报表时区（IANA时区名称）")
+	if err != nil {
+		log.Printf("Error saving reporting timezone: %v", err)
+		return fmt.Errorf("failed to save reporting timezone: %w", err)
+	}
+
+	// time_window 按报表时区解析，时区变化后重新计算
+	if _, err := s.dbService.RederiveBillTimes(); err != nil {
+		log.Printf("Error re-deriving bill times: %v", err)
+		return fmt.Errorf("failed to re-derive bill times: %w", err)
+	}
+
+	log.Printf("Reporting timezone set to %s", timezone)
+	return nil
+}
+
+// GetAllConfigs retrieves all configuration values
+func (s *APIService) GetAllConfigs() ([]models.AutoSyncConfig, error) {
+	configs, err := s.dbService.GetAllAutoSyncConfigs()
+	if err != nil {
+		log.Printf("Error getting all configs: %v", err)
+		return nil, fmt.Errorf("failed to retrieve configs: %w", err)
+	}
+
+	return configs, nil
+}
+
+// ========== Utility APIs ==========
+
+// GetDatabaseInfo retrieves database information
+func (s *APIService) GetDatabaseInfo() (map[string]interface{}, error) {
+	info := map[string]interface{}{
+		"path":    s.db.GetPath(),
+		"type":    "SQLite3",
+		"version": "3.x",
 	}
 
 	// Get table counts
@@ -792,38 +2330,71 @@ func (s *APIService) CheckAPIConnectivity() (map[string]interface{}, error) {
 
 // GetCurrentMembershipTier 获取当前会员等级信息
 func (s *APIService) GetCurrentMembershipTier() (map[string]interface{}, error) {
-	// 获取当前会员等级
-	tier, err := s.dbService.GetCurrentMembershipTier()
+	tier, limits := s.getActiveTierLimit(time.Now())
+
+	result := map[string]interface{}{
+		"tier":               tier,
+		"tier_name":          getTierDisplayName(tier),
+		"daily_limit":        limits.DailyLimit,
+		"monthly_limit":      limits.MonthlyLimit,
+		"max_tokens":         limits.MaxTokens,
+		"period_hours":       limits.PeriodHours,
+		"call_limit":         limits.CallLimit,
+		"daily_cost_limit":   limits.DailyCostLimit,
+		"monthly_cost_limit": limits.MonthlyCostLimit,
+		"monthly_price":      limits.MonthlyPrice,
+		"features":           limits.Features,
+		"description":        limits.Description,
+	}
+
+	return result, nil
+}
+
+// getActiveTierLimit returns the tier of the active account in effect at t and its catalogue
+// entry. Tiers missing from the catalogue get an empty entry, i.e. no limits.
+func (s *APIService) getActiveTierLimit(t time.Time) (string, *models.MembershipTierLimit) {
+	accountID := 0
+	if token, err := s.dbService.GetActiveAPIToken(); err == nil && token != nil {
+		accountID = token.ID
+	}
+
+	tier, err := s.dbService.GetMembershipTierAt(accountID, t)
 	if err != nil {
-		log.Printf("Error getting current membership tier: %v", err)
-		// 使用默认值
-		tier = "free"
+		log.Printf("Error getting membership tier: %v", err)
+		tier = defaultMembershipTier
 	}
 
-	// 获取该等级的限制信息
-	limits, err := s.dbService.GetMembershipTierLimits(tier)
+	limits, err := s.dbService.GetMembershipTierLimit(tier)
 	if err != nil {
-		log.Printf("Failed to get tier limits for %s: %v", tier, err)
-		// 使用默认限制
-		limits = &models.MembershipTierLimit{
-			TierName:     tier,
-			DailyLimit:   &[]int{1000}[0],
-			MonthlyLimit: &[]int{30000}[0],
-			MaxTokens:    &[]int{1000000}[0],
-		}
+		log.Printf("No catalogue limits for tier %s: %v", tier, err)
+		limits = &models.MembershipTierLimit{TierName: tier}
 	}
 
-	result := map[string]interface{}{
-		"tier":          tier,
-		"tier_name":     getTierDisplayName(tier),
-		"daily_limit":   limits.DailyLimit,
-		"monthly_limit": limits.MonthlyLimit,
-		"max_tokens":    limits.MaxTokens,
-		"features":      limits.Features,
-		"description":   limits.Description,
+	return tier, limits
+}
+
+// limitPercentage returns usage as a percentage of limit, or 0 when there is no limit
+func limitPercentage(usage, limit float64) float64 {
+	if limit <= 0 {
+		return 0
+	}
+	return usage / limit * 100
+}
+
+// intLimit converts an optional integer limit to float64, 0 meaning no limit
+func intLimit(limit *int) float64 {
+	if limit == nil {
+		return 0
 	}
+	return float64(*limit)
+}
 
-	return result, nil
+// floatLimit converts an optional float limit to float64, 0 meaning no limit
+func floatLimit(limit *float64) float64 {
+	if limit == nil {
+		return 0
+	}
+	return *limit
 }
 
 // 获取会员等级显示名称
@@ -832,6 +2403,7 @@ func getTierDisplayName(tier string) string {
 		"free":       "免费版",
 		"lite":       "Lite版",
 		"pro":        "Pro版",
+		"max":        "Max版",
 		"plus":       "Plus版",
 		"enterprise": "企业版",
 	}
@@ -842,124 +2414,209 @@ func getTierDisplayName(tier string) string {
 	return tier
 }
 
-// GetApiUsageProgress retrieves API usage progress against limits
-func (s *APIService) GetApiUsageProgress() (map[string]interface{}, error) {
-	// Get current month's API usage
-	now := time.Now()
-	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+// ========== Membership Tier Detection APIs ==========
 
-	// 获取当前会员等级信息
-	tierInfo, err := s.GetCurrentMembershipTier()
+// GetTierDetectionRules retrieves the rules used to detect the membership tier
+func (s *APIService) GetTierDetectionRules() ([]models.TierDetectionRule, error) {
+	rules, err := s.dbService.GetTierDetectionRules()
 	if err != nil {
-		log.Printf("Error getting membership tier: %v", err)
-		// 使用默认值
-		tierInfo = map[string]interface{}{
-			"tier":          "free",
-			"daily_limit":   1000,
-			"monthly_limit": 30000,
-		}
+		log.Printf("Error getting tier detection rules: %v", err)
+		return nil, fmt.Errorf("failed to retrieve tier detection rules: %w", err)
 	}
 
-	// Get API usage count for current month
-	usageStats, err := s.statsService.GetOverallStats(&startOfMonth, &now)
-	if err != nil {
-		log.Printf("Error getting API usage stats: %v", err)
-		return nil, fmt.Errorf("failed to get API usage stats: %w", err)
+	return rules, nil
+}
+
+// SaveTierDetectionRule creates or updates a tier detection rule and re-detects the tier history
+func (s *APIService) SaveTierDetectionRule(rule models.TierDetectionRule) (*models.TierDetectionRule, error) {
+	if err := s.dbService.SaveTierDetectionRule(&rule); err != nil {
+		log.Printf("Error saving tier detection rule: %v", err)
+		return nil, NewValidationError(ErrCodeInvalidParameter, err.Error())
+	}
+
+	if _, err := s.dbService.RebuildMembershipTierHistory(); err != nil {
+		log.Printf("Error rebuilding membership tier history: %v", err)
+		return nil, fmt.Errorf("failed to rebuild membership tier history: %w", err)
 	}
 
-	apiUsageCount := usageStats.TotalRecords
-	dailyLimit := 1000
-	monthlyLimit := 30000
+	return &rule, nil
+}
 
-	// 从会员等级信息中获取限制
-	if daily, ok := tierInfo["daily_limit"]; ok && daily != nil {
-		if dl, ok := daily.(int); ok {
-			dailyLimit = dl
-		}
+// DeleteTierDetectionRule deletes a tier detection rule and re-detects the tier history
+func (s *APIService) DeleteTierDetectionRule(id int) error {
+	if err := s.dbService.DeleteTierDetectionRule(id); err != nil {
+		log.Printf("Error deleting tier detection rule: %v", err)
+		return fmt.Errorf("failed to delete tier detection rule: %w", err)
 	}
-	if monthly, ok := tierInfo["monthly_limit"]; ok && monthly != nil {
-		if ml, ok := monthly.(int); ok {
-			monthlyLimit = ml
-		}
+
+	if _, err := s.dbService.RebuildMembershipTierHistory(); err != nil {
+		log.Printf("Error rebuilding membership tier history: %v", err)
+		return fmt.Errorf("failed to rebuild membership tier history: %w", err)
 	}
 
-	// Calculate today's usage
-	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	todayStats, err := s.statsService.GetOverallStats(&todayStart, &now)
+	return nil
+}
+
+// GetMembershipTierHistory retrieves the timeline of detected membership tier changes
+func (s *APIService) GetMembershipTierHistory() ([]models.MembershipTierChange, error) {
+	history, err := s.dbService.GetMembershipTierHistory()
 	if err != nil {
-		log.Printf("Error getting today's API usage: %v", err)
-		todayStats = usageStats // Fallback to monthly stats
+		log.Printf("Error getting membership tier history: %v", err)
+		return nil, fmt.Errorf("failed to retrieve membership tier history: %w", err)
 	}
 
-	result := map[string]interface{}{
-		"current_usage":      apiUsageCount,
-		"daily_usage":        todayStats.TotalRecords,
-		"daily_limit":        dailyLimit,
-		"monthly_limit":      monthlyLimit,
-		"daily_percentage":   float64(todayStats.TotalRecords) / float64(dailyLimit) * 100,
-		"monthly_percentage": float64(apiUsageCount) / float64(monthlyLimit) * 100,
-		"tier":               "free",
-		"growthRate":         0.0,
+	return history, nil
+}
+
+// RefreshMembershipTierHistory re-detects the membership tier timeline from all bills
+func (s *APIService) RefreshMembershipTierHistory() ([]models.MembershipTierChange, error) {
+	history, err := s.dbService.RebuildMembershipTierHistory()
+	if err != nil {
+		log.Printf("Error rebuilding membership tier history: %v", err)
+		return nil, fmt.Errorf("failed to rebuild membership tier history: %w", err)
 	}
 
-	return result, nil
+	return history, nil
 }
 
-// GetTokenUsageProgress retrieves Token usage progress against limits
-func (s *APIService) GetTokenUsageProgress() (map[string]interface{}, error) {
-	// Get current month's Token usage
-	now := time.Now()
-	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+// ========== Membership Tier Catalogue APIs ==========
 
-	// Calculate token usage from stats
-	usageStats, err := s.statsService.GetOverallStats(&startOfMonth, &now)
+// GetMembershipTierCatalogue retrieves all tiers of the catalogue
+func (s *APIService) GetMembershipTierCatalogue() ([]models.MembershipTierLimit, error) {
+	limits, err := s.dbService.GetAllMembershipTierLimits()
 	if err != nil {
-		log.Printf("Error getting token usage stats: %v", err)
-		return nil, fmt.Errorf("failed to get token usage stats: %w", err)
+		log.Printf("Error getting membership tier catalogue: %v", err)
+		return nil, fmt.Errorf("failed to retrieve membership tier catalogue: %w", err)
 	}
 
-	// Get membership tier limits for tokens
-	limits, err := s.dbService.GetMembershipTierLimits("free")
+	return limits, nil
+}
+
+// GetMembershipTierLimit retrieves a single tier of the catalogue
+func (s *APIService) GetMembershipTierLimit(tierName string) (*models.MembershipTierLimit, error) {
+	limit, err := s.dbService.GetMembershipTierLimit(tierName)
 	if err != nil {
-		log.Printf("Error getting membership limits: %v", err)
-		limits = &models.MembershipTierLimit{
-			MaxTokens: &[]int{1000000}[0], // Default 1M tokens
-		}
+		log.Printf("Error getting membership tier %s: %v", tierName, err)
+		return nil, fmt.Errorf("failed to retrieve membership tier: %w", err)
 	}
 
-	// Calculate total token usage (sum of all token usage from bills)
-	var totalTokenUsage float64 = 0
-	for _, usage := range usageStats.HourlyUsage {
-		totalTokenUsage += usage.TokenUsage
+	return limit, nil
+}
+
+// SaveMembershipTierLimit creates or updates a tier of the catalogue
+func (s *APIService) SaveMembershipTierLimit(limit models.MembershipTierLimit) error {
+	if err := validateMembershipTierLimit(&limit); err != nil {
+		return NewValidationError(ErrCodeInvalidParameter, err.Error())
 	}
 
-	maxTokens := 1000000
-	if limits.MaxTokens != nil {
-		maxTokens = *limits.MaxTokens
+	if err := s.dbService.SaveMembershipTierLimit(&limit); err != nil {
+		log.Printf("Error saving membership tier %s: %v", limit.TierName, err)
+		return fmt.Errorf("failed to save membership tier: %w", err)
 	}
 
-	// Calculate today's token usage
-	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	todayStats, err := s.statsService.GetOverallStats(&todayStart, &now)
+	return nil
+}
+
+// DeleteMembershipTierLimit deletes a tier from the catalogue
+func (s *APIService) DeleteMembershipTierLimit(tierName string) error {
+	if err := s.dbService.DeleteMembershipTierLimit(tierName); err != nil {
+		log.Printf("Error deleting membership tier %s: %v", tierName, err)
+		return fmt.Errorf("failed to delete membership tier: %w", err)
+	}
+
+	return nil
+}
+
+// ExportMembershipTierCatalogue exports the tier catalogue as JSON
+func (s *APIService) ExportMembershipTierCatalogue() (string, error) {
+	data, err := s.dbService.ExportMembershipTierCatalogue()
+	if err != nil {
+		log.Printf("Error exporting membership tier catalogue: %v", err)
+		return "", fmt.Errorf("failed to export membership tier catalogue: %w", err)
+	}
+
+	return data, nil
+}
+
+// ImportMembershipTierCatalogue imports tiers from JSON and returns the number imported.
+// With replace, tiers missing from the import are removed.
+func (s *APIService) ImportMembershipTierCatalogue(data string, replace bool) (int, error) {
+	limits, err := ParseMembershipTierCatalogue(data)
 	if err != nil {
-		log.Printf("Error getting today's token usage: %v", err)
-		todayStats = usageStats
+		return 0, NewValidationError(ErrCodeInvalidParameter, err.Error())
+	}
+	if len(limits) == 0 {
+		return 0, NewValidationError(ErrCodeInvalidParameter, "Catalogue contains no tiers")
+	}
+
+	if err := s.dbService.ImportMembershipTierLimits(limits, replace); err != nil {
+		log.Printf("Error importing membership tier catalogue: %v", err)
+		return 0, fmt.Errorf("failed to import membership tier catalogue: %w", err)
 	}
 
-	var todayTokenUsage float64 = 0
-	for _, usage := range todayStats.HourlyUsage {
-		todayTokenUsage += usage.TokenUsage
+	return len(limits), nil
+}
+
+// GetApiUsageProgress retrieves API usage progress against the active tier's catalogue limits
+func (s *APIService) GetApiUsageProgress() (map[string]interface{}, error) {
+	now := models.ReportingNow()
+	tier, limits := s.getActiveTierLimit(now)
+
+	monthTotals, todayTotals, err := s.getMonthAndTodayTotals(now)
+	if err != nil {
+		log.Printf("Error getting API usage stats: %v", err)
+		return nil, fmt.Errorf("failed to get API usage stats: %w", err)
 	}
 
+	dailyLimit := intLimit(limits.DailyLimit)
+	monthlyLimit := intLimit(limits.MonthlyLimit)
+
 	result := map[string]interface{}{
-		"current_usage":      totalTokenUsage,
-		"daily_usage":        todayTokenUsage,
-		"monthly_limit":      float64(maxTokens),
-		"daily_percentage":   todayTokenUsage / float64(maxTokens/30) * 100, // Approximate daily limit
-		"monthly_percentage": totalTokenUsage / float64(maxTokens) * 100,
-		"tier":               "free",
-		"tokens_formatted":   formatTokenCount(totalTokenUsage),
-		"limit_formatted":    formatTokenCount(float64(maxTokens)),
+		"current_usage":      monthTotals.CallCount,
+		"daily_usage":        todayTotals.CallCount,
+		"daily_limit":        dailyLimit,
+		"monthly_limit":      monthlyLimit,
+		"daily_percentage":   limitPercentage(float64(todayTotals.CallCount), dailyLimit),
+		"monthly_percentage": limitPercentage(float64(monthTotals.CallCount), monthlyLimit),
+		"tier":               tier,
+		"growthRate":         0.0,
+	}
+
+	// 增长率：今天至今与上周同一天同一时段对比
+	if comparison, err := s.ComparePeriodPreset(ComparisonPresetSameDayLastWeek, 0); err == nil {
+		result["growthRate"] = comparison.Overall.Calls.DeltaPercent
+	}
+
+	return result, nil
+}
+
+// GetTokenUsageProgress retrieves Token usage progress against the active tier's catalogue limits
+func (s *APIService) GetTokenUsageProgress() (map[string]interface{}, error) {
+	now := models.ReportingNow()
+	tier, limits := s.getActiveTierLimit(now)
+
+	monthTotals, todayTotals, err := s.getMonthAndTodayTotals(now)
+	if err != nil {
+		log.Printf("Error getting token usage stats: %v", err)
+		return nil, fmt.Errorf("failed to get token usage stats: %w", err)
+	}
+
+	maxTokens := intLimit(limits.MaxTokens)
+
+	result := map[string]interface{}{
+		"current_usage":      monthTotals.TokenUsage,
+		"daily_usage":        todayTotals.TokenUsage,
+		"monthly_limit":      maxTokens,
+		"daily_percentage":   limitPercentage(todayTotals.TokenUsage, maxTokens/30), // 按月上限折算的日均额度
+		"monthly_percentage": limitPercentage(monthTotals.TokenUsage, maxTokens),
+		"tier":               tier,
+		"tokens_formatted":   formatTokenCount(monthTotals.TokenUsage),
+		"limit_formatted":    formatTokenCount(maxTokens),
+		"growthRate":         0.0,
+	}
+
+	if comparison, err := s.ComparePeriodPreset(ComparisonPresetSameDayLastWeek, 0); err == nil {
+		result["growthRate"] = comparison.Overall.Tokens.DeltaPercent
 	}
 
 	return result, nil
@@ -975,59 +2632,74 @@ func formatTokenCount(tokens float64) string {
 	return fmt.Sprintf("%.0f", tokens)
 }
 
-// GetTotalCostProgress retrieves total cost progress against limits
+// GetTotalCostProgress retrieves total cost progress against the active tier's catalogue limits
 func (s *APIService) GetTotalCostProgress() (map[string]interface{}, error) {
-	// Get current month's total cost
-	now := time.Now()
-	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	now := models.ReportingNow()
+	tier, limits := s.getActiveTierLimit(now)
 
-	usageStats, err := s.statsService.GetOverallStats(&startOfMonth, &now)
+	monthTotals, todayTotals, err := s.getMonthAndTodayTotals(now)
 	if err != nil {
 		log.Printf("Error getting cost stats: %v", err)
 		return nil, fmt.Errorf("failed to get cost stats: %w", err)
 	}
 
-	// Default cost limits (in yuan)
-	dailyCostLimit := 50.0     // 50 yuan per day
-	monthlyCostLimit := 1000.0 // 1000 yuan per month
-
-	// Calculate today's cost
-	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	todayStats, err := s.statsService.GetOverallStats(&todayStart, &now)
-	if err != nil {
-		log.Printf("Error getting today's cost: %v", err)
-		todayStats = usageStats
-	}
-
-	// Calculate total cost from stats
-	var monthlyCost float64 = 0
-	for _, usage := range usageStats.HourlyUsage {
-		monthlyCost += usage.CashCost
-	}
-
-	var todayCost float64 = 0
-	for _, usage := range todayStats.HourlyUsage {
-		todayCost += usage.CashCost
-	}
+	// 优先使用全局预算，未配置时使用会员等级目录中的费用上限
+	dailyCostLimit := s.costLimit(BudgetPeriodDay, limits.DailyCostLimit)
+	monthlyCostLimit := s.costLimit(BudgetPeriodMonth, limits.MonthlyCostLimit)
 
 	result := map[string]interface{}{
-		"current_usage":           monthlyCost,
-		"daily_usage":             todayCost,
+		"current_usage":           monthTotals.CashCost,
+		"daily_usage":             todayTotals.CashCost,
 		"daily_limit":             dailyCostLimit,
 		"monthly_limit":           monthlyCostLimit,
-		"daily_percentage":        todayCost / dailyCostLimit * 100,
-		"monthly_percentage":      monthlyCost / monthlyCostLimit * 100,
+		"daily_percentage":        limitPercentage(todayTotals.CashCost, dailyCostLimit),
+		"monthly_percentage":      limitPercentage(monthTotals.CashCost, monthlyCostLimit),
 		"currency":                "CNY",
-		"tier":                    "free",
-		"formatted_daily":         fmt.Sprintf("¥%.2f", todayCost),
-		"formatted_monthly":       fmt.Sprintf("¥%.2f", monthlyCost),
+		"tier":                    tier,
+		"formatted_daily":         fmt.Sprintf("¥%.2f", todayTotals.CashCost),
+		"formatted_monthly":       fmt.Sprintf("¥%.2f", monthTotals.CashCost),
 		"formatted_daily_limit":   fmt.Sprintf("¥%.2f", dailyCostLimit),
 		"formatted_monthly_limit": fmt.Sprintf("¥%.2f", monthlyCostLimit),
+		"growthRate":              0.0,
+	}
+
+	if comparison, err := s.ComparePeriodPreset(ComparisonPresetSameDayLastWeek, 0); err == nil {
+		result["growthRate"] = comparison.Overall.Cost.DeltaPercent
 	}
 
 	return result, nil
 }
 
+// costLimit returns the enabled global budget of the period, falling back to the catalogue limit
+func (s *APIService) costLimit(period string, catalogueLimit *float64) float64 {
+	amount, err := s.budgetTracker.GetPeriodBudgetAmount(period)
+	if err != nil {
+		log.Printf("Error getting %s budget: %v", period, err)
+	}
+	if amount > 0 {
+		return amount
+	}
+	return floatLimit(catalogueLimit)
+}
+
+// getMonthAndTodayTotals aggregates usage of the current month and of today up to now
+func (s *APIService) getMonthAndTodayTotals(now time.Time) (*models.UsageTotals, *models.UsageTotals, error) {
+	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	monthTotals, err := s.statsService.GetUsageTotals(models.PeriodRange{Start: startOfMonth, End: now}, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	todayTotals, err := s.statsService.GetUsageTotals(models.PeriodRange{Start: todayStart, End: now}, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return monthTotals, todayTotals, nil
+}
+
 // ForceResetSyncStatus forcefully resets all running syncs to failed status
 func (s *APIService) ForceResetSyncStatus() error {
 	db := s.dbService.GetDB()
@@ -15,6 +15,8 @@ type AutoSyncService struct {
 	stopChan   chan bool
 	running    bool
 	config     *models.AutoSyncConfig
+
+	pausedReason string // 非空表示因令牌问题暂停，更新令牌后恢复
 }
 
 // NewAutoSyncService 创建自动同步服务
@@ -135,6 +137,36 @@ func (s *AutoSyncService) Stop() error {
 	return nil
 }
 
+// Pause 因令牌过期或被撤销暂停自动同步，直到调用Resume
+func (s *AutoSyncService) Pause(reason string) {
+	if !s.running {
+		return
+	}
+
+	s.Stop()
+	s.pausedReason = reason
+	log.Printf("Auto sync paused: %s", reason)
+}
+
+// Resume 恢复被暂停的自动同步
+func (s *AutoSyncService) Resume() error {
+	if s.pausedReason == "" {
+		return nil
+	}
+	s.pausedReason = ""
+
+	config, err := s.GetConfig()
+	if err != nil {
+		return err
+	}
+	if !config.Enabled {
+		return nil
+	}
+
+	log.Println("Auto sync resumed")
+	return s.Start(config.FrequencySeconds)
+}
+
 // TriggerNow 立即触发一次同步
 func (s *AutoSyncService) TriggerNow() error {
 	return s.performAutoSync()
@@ -219,6 +251,7 @@ func (s *AutoSyncService) GetStatus() (map[string]interface{}, error) {
 		"frequency_seconds": config.FrequencySeconds,
 		"next_sync_time":    nil,
 		"last_sync_time":    lastSyncTime,
+		"paused_reason":     s.pausedReason,
 	}
 
 	// 计算下次同步时间
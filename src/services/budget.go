@@ -0,0 +1,461 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"glm-usage-monitor/models"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Budget scopes
+const (
+	BudgetScopeGlobal = "global"
+	BudgetScopeModel  = "model"
+	BudgetScopeAPIKey = "api_key"
+	BudgetScopeGroup  = "group"
+)
+
+// Budget periods
+const (
+	BudgetPeriodDay          = "day"
+	BudgetPeriodWeek         = "week"
+	BudgetPeriodMonth        = "month"
+	BudgetPeriodBillingCycle = "billing_cycle"
+)
+
+// defaultBudgetThresholds are used when a budget is saved without thresholds
+var defaultBudgetThresholds = []float64{50, 80, 100}
+
+// keyIDPattern matches the key_id of an API key (see models.SecretID)
+var keyIDPattern = regexp.MustCompile(`^[0-9a-f]{12}$`)
+
+// validateBudget checks a budget before it is saved and normalizes its thresholds
+func validateBudget(budget *models.Budget) error {
+	budget.Name = strings.TrimSpace(budget.Name)
+	budget.ScopeValue = strings.TrimSpace(budget.ScopeValue)
+	if budget.Name == "" {
+		return fmt.Errorf("budget name is required")
+	}
+	if budget.Amount <= 0 {
+		return fmt.Errorf("budget amount must be positive")
+	}
+
+	switch budget.ScopeType {
+	case "":
+		budget.ScopeType = BudgetScopeGlobal
+		fallthrough
+	case BudgetScopeGlobal:
+		budget.ScopeValue = ""
+	case BudgetScopeModel, BudgetScopeGroup:
+		if budget.ScopeValue == "" {
+			return fmt.Errorf("scope value is required for %s budgets", budget.ScopeType)
+		}
+	case BudgetScopeAPIKey:
+		// 不保存原始API Key，只保存key_id
+		budget.ScopeKeyID = strings.TrimSpace(budget.ScopeKeyID)
+		switch {
+		case budget.ScopeKeyID != "":
+			if !keyIDPattern.MatchString(budget.ScopeKeyID) {
+				return fmt.Errorf("invalid scope key id: %s", budget.ScopeKeyID)
+			}
+		case budget.ScopeValue != "":
+			budget.ScopeKeyID = models.SecretID(budget.ScopeValue)
+		default:
+			return fmt.Errorf("scope key id or API key is required for %s budgets", budget.ScopeType)
+		}
+		budget.ScopeValue = budget.ScopeKeyID
+	default:
+		return fmt.Errorf("invalid budget scope: %s", budget.ScopeType)
+	}
+
+	switch budget.Period {
+	case "":
+		budget.Period = BudgetPeriodMonth
+	case BudgetPeriodDay, BudgetPeriodWeek, BudgetPeriodMonth, BudgetPeriodBillingCycle:
+	default:
+		return fmt.Errorf("invalid budget period: %s", budget.Period)
+	}
+
+	if len(budget.Thresholds) == 0 {
+		budget.Thresholds = append([]float64(nil), defaultBudgetThresholds...)
+	}
+	seen := make(map[float64]bool, len(budget.Thresholds))
+	thresholds := make([]float64, 0, len(budget.Thresholds))
+	for _, threshold := range budget.Thresholds {
+		if threshold <= 0 || threshold > 1000 {
+			return fmt.Errorf("threshold must be between 0 and 1000 percent: %v", threshold)
+		}
+		if !seen[threshold] {
+			seen[threshold] = true
+			thresholds = append(thresholds, threshold)
+		}
+	}
+	sort.Float64s(thresholds)
+	budget.Thresholds = thresholds
+
+	return nil
+}
+
+// GetBudgets retrieves all budgets
+func (s *DatabaseService) GetBudgets() ([]models.Budget, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, scope_type, COALESCE(scope_value, ''), period, amount, COALESCE(thresholds, ''),
+		       enabled, COALESCE(description, ''), created_at, updated_at
+		FROM budgets
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query budgets: %w", err)
+	}
+	defer rows.Close()
+
+	var budgets []models.Budget
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, *budget)
+	}
+
+	return budgets, nil
+}
+
+// scanBudget scans a budget row, decoding its JSON thresholds
+func scanBudget(rows *sql.Rows) (*models.Budget, error) {
+	var budget models.Budget
+	var thresholds string
+	err := rows.Scan(&budget.ID, &budget.Name, &budget.ScopeType, &budget.ScopeValue, &budget.Period,
+		&budget.Amount, &thresholds, &budget.Enabled, &budget.Description, &budget.CreatedAt, &budget.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan budget: %w", err)
+	}
+
+	if thresholds != "" {
+		if err := json.Unmarshal([]byte(thresholds), &budget.Thresholds); err != nil {
+			return nil, fmt.Errorf("failed to parse thresholds of budget %d: %w", budget.ID, err)
+		}
+	}
+	if len(budget.Thresholds) == 0 {
+		budget.Thresholds = append([]float64(nil), defaultBudgetThresholds...)
+	}
+	if budget.ScopeType == BudgetScopeAPIKey {
+		budget.ScopeKeyID = budget.ScopeValue
+	}
+
+	return &budget, nil
+}
+
+// SaveBudget creates a budget or updates an existing one
+func (s *DatabaseService) SaveBudget(budget *models.Budget) error {
+	if err := validateBudget(budget); err != nil {
+		return err
+	}
+
+	thresholds, err := json.Marshal(budget.Thresholds)
+	if err != nil {
+		return fmt.Errorf("failed to marshal budget thresholds: %w", err)
+	}
+
+	now := time.Now()
+	if budget.ID == 0 {
+		result, err := s.db.Exec(`
+			INSERT INTO budgets (name, scope_type, scope_value, period, amount, thresholds, enabled, description, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, budget.Name, budget.ScopeType, budget.ScopeValue, budget.Period, budget.Amount,
+			string(thresholds), budget.Enabled, budget.Description, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to create budget: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get budget ID: %w", err)
+		}
+		budget.ID = int(id)
+		budget.CreatedAt = now
+		budget.UpdatedAt = now
+		return nil
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE budgets
+		SET name = ?, scope_type = ?, scope_value = ?, period = ?, amount = ?, thresholds = ?,
+		    enabled = ?, description = ?, updated_at = ?
+		WHERE id = ?
+	`, budget.Name, budget.ScopeType, budget.ScopeValue, budget.Period, budget.Amount,
+		string(thresholds), budget.Enabled, budget.Description, now, budget.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update budget: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("budget not found: %d", budget.ID)
+	}
+
+	budget.UpdatedAt = now
+	return nil
+}
+
+// DeleteBudget deletes a budget and its alert records
+func (s *DatabaseService) DeleteBudget(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM budgets WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete budget: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("budget not found: %d", id)
+	}
+
+	if _, err := tx.Exec("DELETE FROM budget_alerts WHERE budget_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete budget alerts: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit budget deletion: %w", err)
+	}
+
+	return nil
+}
+
+// BudgetTracker evaluates budgets and fires each crossed threshold once per period
+type BudgetTracker struct {
+	db                  *sql.DB
+	dbService           *DatabaseService
+	statsService        *StatisticsService
+	notificationService *NotificationService
+}
+
+// NewBudgetTracker creates a new budget tracker
+func NewBudgetTracker(db *sql.DB, dbService *DatabaseService, statsService *StatisticsService, notificationService *NotificationService) *BudgetTracker {
+	return &BudgetTracker{
+		db:                  db,
+		dbService:           dbService,
+		statsService:        statsService,
+		notificationService: notificationService,
+	}
+}
+
+// GetBudgetStatuses computes the current-period progress of every budget
+func (t *BudgetTracker) GetBudgetStatuses(now time.Time) ([]models.BudgetStatus, error) {
+	budgets, err := t.dbService.GetBudgets()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]models.BudgetStatus, 0, len(budgets))
+	for _, budget := range budgets {
+		status, err := t.getBudgetStatus(budget, now)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, *status)
+	}
+
+	return statuses, nil
+}
+
+// getBudgetStatus computes one budget's spending in the period containing now
+func (t *BudgetTracker) getBudgetStatus(budget models.Budget, now time.Time) (*models.BudgetStatus, error) {
+	start, end, key, err := t.budgetPeriod(budget.Period, now)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := models.UsageQueryFilter{StartTime: &start, EndTime: &end}
+	switch budget.ScopeType {
+	case BudgetScopeModel:
+		filter.ModelNames = []string{budget.ScopeValue}
+	case BudgetScopeAPIKey:
+		filter.APIKeys = []string{budget.ScopeValue}
+	case BudgetScopeGroup:
+		filter.GroupIDs = []string{budget.ScopeValue}
+	}
+
+	status := &models.BudgetStatus{
+		Budget:            budget,
+		PeriodKey:         key,
+		PeriodStart:       start,
+		PeriodEnd:         end,
+		CrossedThresholds: []float64{},
+	}
+
+	result, err := t.statsService.QueryUsage(&models.UsageQuery{
+		Metrics: []string{models.UsageMetricCost},
+		Filter:  filter,
+	})
+	if err != nil {
+		// 该API Key尚无账单时视为未产生费用
+		if !errors.Is(err, errAPIKeyNotFound) {
+			return nil, err
+		}
+	} else if len(result.Rows) > 0 {
+		status.Spent = math.Round(result.Rows[0].Metrics[models.UsageMetricCost]*10000) / 10000
+	}
+
+	status.Remaining = math.Max(0, budget.Amount-status.Spent)
+	status.Percentage = math.Round(limitPercentage(status.Spent, budget.Amount)*100) / 100
+	for _, threshold := range budget.Thresholds {
+		if status.Percentage >= threshold {
+			status.CrossedThresholds = append(status.CrossedThresholds, threshold)
+		} else if status.NextThreshold == nil {
+			next := threshold
+			status.NextThreshold = &next
+		}
+	}
+
+	return status, nil
+}
+
+// budgetPeriod returns the [start, end) range and key of the period containing now in the
+// reporting timezone
+func (t *BudgetTracker) budgetPeriod(period string, now time.Time) (time.Time, time.Time, string, error) {
+	now = now.In(models.ReportingLocation())
+	today := startOfReportingDay(now, models.ReportingLocation())
+
+	switch period {
+	case BudgetPeriodDay:
+		return today, today.AddDate(0, 0, 1), today.Format("2006-01-02"), nil
+	case BudgetPeriodWeek:
+		// 以周一为一周的开始
+		start := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		year, week := start.ISOWeek()
+		return start, start.AddDate(0, 0, 7), fmt.Sprintf("%d-W%02d", year, week), nil
+	case BudgetPeriodMonth:
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0), start.Format("2006-01"), nil
+	case BudgetPeriodBillingCycle:
+		start, end, err := t.billingCycleAt(now)
+		if err != nil {
+			return time.Time{}, time.Time{}, "", err
+		}
+		return start, end, "cycle-" + start.Format("2006-01-02"), nil
+	default:
+		return time.Time{}, time.Time{}, "", fmt.Errorf("invalid budget period: %s", period)
+	}
+}
+
+// billingCycleAt returns the monthly billing cycle containing now, anchored at the first usage of
+// the latest resource package. Without any package the calendar month is used.
+func (t *BudgetTracker) billingCycleAt(now time.Time) (time.Time, time.Time, error) {
+	var firstUsage sql.NullString
+	err := t.db.QueryRow(fmt.Sprintf(`
+		SELECT MIN(datetime(transaction_time)) as first_usage
+		FROM expense_bills
+		WHERE %s AND %s != ''
+		GROUP BY %s
+		HAVING first_usage <= ?
+		ORDER BY first_usage DESC
+		LIMIT 1
+	`, coveredBillCondition, resourceCycleExpr, resourceCycleExpr),
+		now.UTC().Format("2006-01-02 15:04:05")).Scan(&firstUsage)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to get billing cycle: %w", err)
+	}
+
+	anchor, parseErr := time.Parse("2006-01-02 15:04:05", firstUsage.String)
+	if err == sql.ErrNoRows || parseErr != nil {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0), nil
+	}
+
+	// 资源包按自然月续期，超过一个周期后顺延
+	anchor = startOfReportingDay(anchor, now.Location())
+	start := anchor
+	for months := 1; ; months++ {
+		end := addMonthsClamped(anchor, months)
+		if now.Before(end) {
+			return start, end, nil
+		}
+		start = end
+	}
+}
+
+// addMonthsClamped adds months to t, clamping the day to the end of the target month
+func addMonthsClamped(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	firstOfTarget := time.Date(year, month+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	lastDay := firstOfTarget.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(firstOfTarget.Year(), firstOfTarget.Month(), day, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+}
+
+// CheckBudgets evaluates enabled budgets and notifies every threshold crossed for the first
+// time in the current period
+func (t *BudgetTracker) CheckBudgets(now time.Time) ([]models.BudgetStatus, error) {
+	statuses, err := t.GetBudgetStatuses(now)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range statuses {
+		status := &statuses[i]
+		if !status.Budget.Enabled {
+			continue
+		}
+
+		for _, threshold := range status.CrossedThresholds {
+			// 唯一约束保证每个周期的每个阈值只记录一次
+			result, err := t.db.Exec(`
+				INSERT OR IGNORE INTO budget_alerts (budget_id, period_key, threshold, spent, amount, triggered_at)
+				VALUES (?, ?, ?, ?, ?, ?)
+			`, status.Budget.ID, status.PeriodKey, threshold, status.Spent, status.Budget.Amount, now)
+			if err != nil {
+				return nil, fmt.Errorf("failed to record budget alert: %w", err)
+			}
+
+			inserted, err := result.RowsAffected()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get rows affected: %w", err)
+			}
+			if inserted > 0 && t.notificationService != nil {
+				log.Printf("Budget %s crossed %.0f%% (%.2f/%.2f)", status.Budget.Name, threshold, status.Spent, status.Budget.Amount)
+				t.notificationService.AddBudgetNotification(status, threshold)
+			}
+		}
+	}
+
+	return statuses, nil
+}
+
+// GetPeriodBudgetAmount returns the amount of the first enabled global budget of the period, or 0
+func (t *BudgetTracker) GetPeriodBudgetAmount(period string) (float64, error) {
+	var amount float64
+	err := t.db.QueryRow(`
+		SELECT amount FROM budgets
+		WHERE enabled = 1 AND scope_type = ? AND period = ?
+		ORDER BY id
+		LIMIT 1
+	`, BudgetScopeGlobal, period).Scan(&amount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get budget amount: %w", err)
+	}
+
+	return amount, nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"glm-usage-monitor/models"
+	"testing"
+)
+
+func TestValidateBudgetAPIKeyScope(t *testing.T) {
+	// 长度恰为12的原始API Key也必须转换为key_id
+	rawKey := "abcdef123456"
+	budget := models.Budget{Name: "key", ScopeType: BudgetScopeAPIKey, ScopeValue: rawKey, Amount: 10}
+	if err := validateBudget(&budget); err != nil {
+		t.Fatalf("validateBudget failed: %v", err)
+	}
+	keyID := models.SecretID(rawKey)
+	if budget.ScopeValue != keyID || budget.ScopeKeyID != keyID {
+		t.Fatalf("expected key_id %s, got scope value %s and key id %s", keyID, budget.ScopeValue, budget.ScopeKeyID)
+	}
+
+	// 再次校验（如保存时）保持不变
+	if err := validateBudget(&budget); err != nil {
+		t.Fatalf("validateBudget failed: %v", err)
+	}
+	if budget.ScopeValue != keyID {
+		t.Errorf("key_id changed on revalidation: %s", budget.ScopeValue)
+	}
+
+	byKeyID := models.Budget{Name: "key", ScopeType: BudgetScopeAPIKey, ScopeKeyID: keyID, Amount: 10}
+	if err := validateBudget(&byKeyID); err != nil {
+		t.Fatalf("validateBudget failed: %v", err)
+	}
+	if byKeyID.ScopeValue != keyID {
+		t.Errorf("expected scope value %s, got %s", keyID, byKeyID.ScopeValue)
+	}
+
+	invalid := models.Budget{Name: "key", ScopeType: BudgetScopeAPIKey, ScopeKeyID: rawKey + "x", Amount: 10}
+	if err := validateBudget(&invalid); err == nil {
+		t.Error("expected an invalid key id to be rejected")
+	}
+
+	missing := models.Budget{Name: "key", ScopeType: BudgetScopeAPIKey, Amount: 10}
+	if err := validateBudget(&missing); err == nil {
+		t.Error("expected a budget without key to be rejected")
+	}
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"fmt"
+	"glm-usage-monitor/models"
+	"math"
+	"sort"
+	"time"
+)
+
+// Period comparison presets
+const (
+	ComparisonPresetWeekOverWeek    = "week_over_week"     // 最近7天 vs 之前7天
+	ComparisonPresetMonthOverMonth  = "month_over_month"   // 本月至今 vs 上月同期
+	ComparisonPresetSameDayLastWeek = "same_day_last_week" // 今天至今 vs 上周同一天同一时段
+)
+
+// periodTotals holds aggregated usage of a single dimension value within a period
+type periodTotals struct {
+	Calls  float64
+	Tokens float64
+	Cost   float64
+}
+
+// ComparisonPresetRanges returns the current and previous ranges of a preset relative to now,
+// with day and month boundaries in the reporting timezone
+func ComparisonPresetRanges(preset string, now time.Time) (models.PeriodRange, models.PeriodRange, error) {
+	now = now.In(models.ReportingLocation())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch preset {
+	case ComparisonPresetWeekOverWeek:
+		current := models.PeriodRange{Start: now.AddDate(0, 0, -7), End: now}
+		previous := models.PeriodRange{Start: now.AddDate(0, 0, -14), End: current.Start}
+		return current, previous, nil
+
+	case ComparisonPresetMonthOverMonth:
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		prevMonthStart := monthStart.AddDate(0, -1, 0)
+
+		// 上月同期：与本月已过去的时长相同，但不超过上月月底
+		prevEnd := prevMonthStart.Add(now.Sub(monthStart))
+		if prevEnd.After(monthStart) {
+			prevEnd = monthStart
+		}
+
+		current := models.PeriodRange{Start: monthStart, End: now}
+		previous := models.PeriodRange{Start: prevMonthStart, End: prevEnd}
+		return current, previous, nil
+
+	case ComparisonPresetSameDayLastWeek:
+		current := models.PeriodRange{Start: today, End: now}
+		previous := models.PeriodRange{Start: today.AddDate(0, 0, -7), End: now.AddDate(0, 0, -7)}
+		return current, previous, nil
+
+	default:
+		return models.PeriodRange{}, models.PeriodRange{}, fmt.Errorf("invalid comparison preset: %s. Valid presets are: %s, %s, %s",
+			preset, ComparisonPresetWeekOverWeek, ComparisonPresetMonthOverMonth, ComparisonPresetSameDayLastWeek)
+	}
+}
+
+// ComparePeriods compares calls, tokens and cost of two periods, overall and broken down
+// by model, charge type and API key. accountID 0 includes all accounts.
+func (s *StatisticsService) ComparePeriods(current, previous models.PeriodRange, accountID int) (*models.PeriodComparison, error) {
+	if !current.End.After(current.Start) || !previous.End.After(previous.Start) {
+		return nil, fmt.Errorf("invalid period: end time must be after start time")
+	}
+
+	comparison := &models.PeriodComparison{
+		Current:  current,
+		Previous: previous,
+	}
+
+	dimensions := []struct {
+		column string
+		target *[]models.UsageComparison
+	}{
+		{"", nil},
+		{"model_name", &comparison.ByModel},
+		{"charge_type", &comparison.ByChargeType},
+		{"api_key", &comparison.ByAPIKey},
+	}
+
+	for _, dimension := range dimensions {
+		currentTotals, err := s.getPeriodTotals(dimension.column, current, accountID)
+		if err != nil {
+			return nil, err
+		}
+		previousTotals, err := s.getPeriodTotals(dimension.column, previous, accountID)
+		if err != nil {
+			return nil, err
+		}
+
+		comparisons := buildUsageComparisons(currentTotals, previousTotals)
+		if dimension.target == nil {
+			if len(comparisons) > 0 {
+				comparison.Overall = comparisons[0]
+			}
+			continue
+		}
+
+		// API Key不直接返回，使用稳定标识和脱敏后的值
+		if dimension.column == "api_key" {
+			for i := range comparisons {
+				comparisons[i].Label = models.MaskSecret(comparisons[i].Key)
+				comparisons[i].Key = models.SecretID(comparisons[i].Key)
+			}
+		}
+
+		*dimension.target = comparisons
+	}
+
+	return comparison, nil
+}
+
+// GetUsageTotals aggregates calls, tokens and cost within the period; accountID 0 includes all accounts
+func (s *StatisticsService) GetUsageTotals(period models.PeriodRange, accountID int) (*models.UsageTotals, error) {
+	filter := models.UsageQueryFilter{StartTime: &period.Start, EndTime: &period.End}
+	if accountID != 0 {
+		filter.AccountIDs = []int{accountID}
+	}
+	result, err := s.QueryUsage(&models.UsageQuery{
+		Metrics: []string{models.UsageMetricCalls, models.UsageMetricTokens, models.UsageMetricCost},
+		Filter:  filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	totals := &models.UsageTotals{}
+	if len(result.Rows) > 0 {
+		metrics := result.Rows[0].Metrics
+		totals.CallCount = int(metrics[models.UsageMetricCalls])
+		totals.TokenUsage = metrics[models.UsageMetricTokens]
+		totals.CashCost = metrics[models.UsageMetricCost]
+	}
+	return totals, nil
+}
+
+// getPeriodTotals aggregates usage within the period, grouped by column (or in total when column is empty)
+func (s *StatisticsService) getPeriodTotals(column string, period models.PeriodRange, accountID int) (map[string]periodTotals, error) {
+	keyExpr := "''"
+	whereClause := "datetime(transaction_time) >= ? AND datetime(transaction_time) < ?"
+	if column != "" {
+		keyExpr = fmt.Sprintf("COALESCE(%s, '')", column)
+		whereClause += fmt.Sprintf(" AND %s IS NOT NULL AND %s != ''", column, column)
+	}
+
+	args := []interface{}{
+		period.Start.UTC().Format("2006-01-02 15:04:05"),
+		period.End.UTC().Format("2006-01-02 15:04:05"),
+	}
+	whereClause, args = accountWhere(whereClause, args, accountID)
+
+	query := fmt.Sprintf(`
+		SELECT
+			%s as dimension,
+			COUNT(*) as call_count,
+			COALESCE(SUM(cash_cost), 0) as cash_cost
+		FROM expense_bills
+		WHERE %s
+		GROUP BY dimension
+	`, keyExpr, whereClause)
+
+	usage, err := s.normalizedUsageBy(keyExpr, whereClause, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query period totals: %w", err)
+	}
+	defer rows.Close()
+
+	totals := make(map[string]periodTotals)
+	for rows.Next() {
+		var key string
+		var t periodTotals
+		if err := rows.Scan(&key, &t.Calls, &t.Cost); err != nil {
+			return nil, fmt.Errorf("failed to scan period totals: %w", err)
+		}
+		t.Tokens = usage[key].TotalTokens
+		totals[key] = t
+	}
+
+	return totals, nil
+}
+
+// buildUsageComparisons merges the totals of both periods, sorted by current cost
+func buildUsageComparisons(current, previous map[string]periodTotals) []models.UsageComparison {
+	keys := make(map[string]bool)
+	for key := range current {
+		keys[key] = true
+	}
+	for key := range previous {
+		keys[key] = true
+	}
+
+	comparisons := make([]models.UsageComparison, 0, len(keys))
+	for key := range keys {
+		cur, prev := current[key], previous[key]
+		comparisons = append(comparisons, models.UsageComparison{
+			Key:    key,
+			Label:  key,
+			Calls:  newMetricDelta(cur.Calls, prev.Calls),
+			Tokens: newMetricDelta(cur.Tokens, prev.Tokens),
+			Cost:   newMetricDelta(cur.Cost, prev.Cost),
+		})
+	}
+
+	sort.Slice(comparisons, func(i, j int) bool {
+		if comparisons[i].Cost.Current != comparisons[j].Cost.Current {
+			return comparisons[i].Cost.Current > comparisons[j].Cost.Current
+		}
+		if comparisons[i].Cost.Previous != comparisons[j].Cost.Previous {
+			return comparisons[i].Cost.Previous > comparisons[j].Cost.Previous
+		}
+		return comparisons[i].Key < comparisons[j].Key
+	})
+
+	return comparisons
+}
+
+// newMetricDelta calculates the absolute and percentage change from previous to current
+func newMetricDelta(current, previous float64) models.MetricDelta {
+	delta := models.MetricDelta{
+		Current:  current,
+		Previous: previous,
+		Delta:    current - previous,
+	}
+
+	if previous > 0 {
+		delta.DeltaPercent = math.Round((current-previous)/previous*100*100) / 100
+	} else if current > 0 {
+		// Growth from zero
+		delta.DeltaPercent = 100.0
+	}
+
+	return delta
+}
@@ -0,0 +1,372 @@
+package services
+
+import (
+	"fmt"
+	"glm-usage-monitor/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	groupTopModelsLimit  = 3
+	unassignedCostCenter = "未分配"
+	ungroupedGroupName   = "未分组"
+)
+
+// ========== GroupCostCenter Operations ==========
+
+// GetGroupCostCenters retrieves all group to cost center mappings
+func (s *DatabaseService) GetGroupCostCenters() ([]models.GroupCostCenter, error) {
+	query := `
+		SELECT group_id, COALESCE(group_name, ''), cost_center, COALESCE(description, ''), updated_at
+		FROM group_cost_centers
+		ORDER BY cost_center, group_id
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group cost centers: %w", err)
+	}
+	defer rows.Close()
+
+	var mappings []models.GroupCostCenter
+	for rows.Next() {
+		var mapping models.GroupCostCenter
+		err := rows.Scan(&mapping.GroupID, &mapping.GroupName, &mapping.CostCenter, &mapping.Description, &mapping.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group cost center: %w", err)
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, nil
+}
+
+// SaveGroupCostCenter creates or updates a group to cost center mapping
+func (s *DatabaseService) SaveGroupCostCenter(mapping *models.GroupCostCenter) error {
+	query := `
+		INSERT INTO group_cost_centers (group_id, group_name, cost_center, description, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(group_id) DO UPDATE SET
+			group_name = excluded.group_name,
+			cost_center = excluded.cost_center,
+			description = excluded.description,
+			updated_at = excluded.updated_at
+	`
+
+	_, err := s.db.Exec(query, mapping.GroupID, mapping.GroupName, mapping.CostCenter, mapping.Description, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save group cost center: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteGroupCostCenter deletes a group to cost center mapping
+func (s *DatabaseService) DeleteGroupCostCenter(groupID string) error {
+	_, err := s.db.Exec("DELETE FROM group_cost_centers WHERE group_id = ?", groupID)
+	if err != nil {
+		return fmt.Errorf("failed to delete group cost center: %w", err)
+	}
+	return nil
+}
+
+// ========== Group Statistics ==========
+
+// groupColumns returns the id and name columns of expense_bills for the given group type
+func groupColumns(groupType string) (string, string, error) {
+	switch groupType {
+	case "", "group":
+		return "group_id", "group_name", nil
+	case "use_group":
+		return "use_group_id", "use_group_name", nil
+	default:
+		return "", "", fmt.Errorf("invalid group type: %s. Valid types are: group, use_group", groupType)
+	}
+}
+
+// GetGroupUsageReport retrieves totals, share of spend, daily series and top models per group.
+// groupType selects the grouping column: "group" (group_id) or "use_group" (use_group_id).
+func (s *StatisticsService) GetGroupUsageReport(startDate, endDate *time.Time, groupType string) ([]models.GroupUsageData, error) {
+	idColumn, nameColumn, err := groupColumns(groupType)
+	if err != nil {
+		return nil, err
+	}
+
+	whereClause, args := dateRangeWhere(startDate, endDate)
+	groupKey := fmt.Sprintf("COALESCE(NULLIF(%s, ''), NULLIF(%s, ''), '')", idColumn, nameColumn)
+
+	// Totals per group, joined with the cost center mapping
+	query := fmt.Sprintf(`
+		SELECT g.group_key, g.group_name, COALESCE(c.cost_center, ''),
+		       g.call_count, g.cash_cost
+		FROM (
+			SELECT
+				%s as group_key,
+				COALESCE(MAX(%s), '') as group_name,
+				COUNT(*) as call_count,
+				COALESCE(SUM(cash_cost), 0) as cash_cost
+			FROM expense_bills
+			WHERE %s
+			GROUP BY group_key
+		) g
+		LEFT JOIN group_cost_centers c ON c.group_id = g.group_key
+		ORDER BY g.cash_cost DESC
+	`, groupKey, nameColumn, whereClause)
+
+	usage, err := s.normalizedUsageBy(groupKey, whereClause, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group usage: %w", err)
+	}
+	defer rows.Close()
+
+	var groupData []models.GroupUsageData
+	groupIndex := make(map[string]int)
+	var totalCashCost float64
+
+	for rows.Next() {
+		var data models.GroupUsageData
+		err := rows.Scan(&data.GroupID, &data.GroupName, &data.CostCenter, &data.CallCount, &data.CashCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group usage: %w", err)
+		}
+		data.TokenUsage = usage[data.GroupID].TotalTokens
+		if data.GroupName == "" {
+			data.GroupName = data.GroupID
+		}
+		if data.GroupID == "" {
+			data.GroupName = ungroupedGroupName
+		}
+		data.TopModels = []models.ModelDistributionData{}
+		data.DailySeries = []models.DailyUsageData{}
+
+		groupIndex[data.GroupID] = len(groupData)
+		groupData = append(groupData, data)
+		totalCashCost += data.CashCost
+	}
+
+	// Calculate share of spend
+	for i := range groupData {
+		if totalCashCost > 0 {
+			groupData[i].Percentage = (groupData[i].CashCost / totalCashCost) * 100
+		}
+	}
+
+	if err := s.fillGroupTopModels(groupData, groupIndex, groupKey, whereClause, args); err != nil {
+		return nil, err
+	}
+
+	if err := s.fillGroupDailySeries(groupData, groupIndex, groupKey, whereClause, args); err != nil {
+		return nil, err
+	}
+
+	return groupData, nil
+}
+
+// fillGroupTopModels attaches the top models by cost to each group
+func (s *StatisticsService) fillGroupTopModels(groupData []models.GroupUsageData, groupIndex map[string]int, groupKey, whereClause string, args []interface{}) error {
+	query := fmt.Sprintf(`
+		SELECT
+			%s as group_key,
+			model_name,
+			COUNT(*) as call_count,
+			COALESCE(SUM(cash_cost), 0) as cash_cost
+		FROM expense_bills
+		WHERE %s AND model_name IS NOT NULL AND model_name != ''
+		GROUP BY group_key, model_name
+		ORDER BY group_key, cash_cost DESC
+	`, groupKey, whereClause)
+
+	usage, err := s.normalizedUsageBy(groupKey+" || '|' || model_name", whereClause, args)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query group top models: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var data models.ModelDistributionData
+		if err := rows.Scan(&key, &data.ModelName, &data.CallCount, &data.CashCost); err != nil {
+			return fmt.Errorf("failed to scan group top model: %w", err)
+		}
+
+		i, ok := groupIndex[key]
+		if !ok || len(groupData[i].TopModels) >= groupTopModelsLimit {
+			continue
+		}
+		if groupData[i].CashCost > 0 {
+			data.Percentage = (data.CashCost / groupData[i].CashCost) * 100
+		}
+
+		modelUsage := usage[key+"|"+data.ModelName]
+		data.TokenUsage = modelUsage.TotalTokens
+		data.InputTokens = modelUsage.InputTokens
+		data.OutputTokens = modelUsage.OutputTokens
+		data.PricePerMillionTokens = models.PricePerMillionTokens(data.CashCost, modelUsage.TotalTokens)
+		groupData[i].TopModels = append(groupData[i].TopModels, data)
+	}
+
+	return nil
+}
+
+// fillGroupDailySeries attaches the daily usage series to each group
+func (s *StatisticsService) fillGroupDailySeries(groupData []models.GroupUsageData, groupIndex map[string]int, groupKey, whereClause string, args []interface{}) error {
+	dateExpr := reportingDateExpr("transaction_time")
+	query := fmt.Sprintf(`
+		SELECT
+			%s as group_key,
+			%s as date,
+			COUNT(*) as call_count,
+			COALESCE(SUM(cash_cost), 0) as cash_cost
+		FROM expense_bills
+		WHERE %s
+		GROUP BY group_key, date
+		ORDER BY date ASC
+	`, groupKey, dateExpr, whereClause)
+
+	usage, err := s.normalizedUsageBy(groupKey+" || '|' || "+dateExpr, whereClause, args)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query group daily series: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var data models.DailyUsageData
+		if err := rows.Scan(&key, &data.Date, &data.CallCount, &data.CashCost); err != nil {
+			return fmt.Errorf("failed to scan group daily series: %w", err)
+		}
+		data.TokenUsage = usage[key+"|"+data.Date].TotalTokens
+
+		if i, ok := groupIndex[key]; ok {
+			groupData[i].DailySeries = append(groupData[i].DailySeries, data)
+		}
+	}
+
+	return nil
+}
+
+// GetCostCenterChargeback rolls group costs of a billing month up to their cost centers.
+// Groups without a mapping are reported under the "未分配" cost center.
+func (s *StatisticsService) GetCostCenterChargeback(billingMonth, groupType string) ([]models.CostCenterChargeback, error) {
+	groupData, err := s.getMonthlyGroupUsage(billingMonth, groupType)
+	if err != nil {
+		return nil, err
+	}
+
+	chargebackIndex := make(map[string]int)
+	var chargebacks []models.CostCenterChargeback
+	var totalCashCost float64
+
+	for _, group := range groupData {
+		costCenter := group.CostCenter
+		if costCenter == "" {
+			costCenter = unassignedCostCenter
+		}
+
+		i, ok := chargebackIndex[costCenter]
+		if !ok {
+			i = len(chargebacks)
+			chargebackIndex[costCenter] = i
+			chargebacks = append(chargebacks, models.CostCenterChargeback{
+				CostCenter:   costCenter,
+				BillingMonth: billingMonth,
+				Groups:       []string{},
+			})
+		}
+
+		chargebacks[i].Groups = append(chargebacks[i].Groups, group.GroupName)
+		chargebacks[i].CallCount += group.CallCount
+		chargebacks[i].TokenUsage += group.TokenUsage
+		chargebacks[i].CashCost += group.CashCost
+		totalCashCost += group.CashCost
+	}
+
+	for i := range chargebacks {
+		if totalCashCost > 0 {
+			chargebacks[i].Percentage = (chargebacks[i].CashCost / totalCashCost) * 100
+		}
+	}
+
+	sort.SliceStable(chargebacks, func(i, j int) bool {
+		return chargebacks[i].CashCost > chargebacks[j].CashCost
+	})
+
+	return chargebacks, nil
+}
+
+// GetCostAllocationTable builds the monthly chargeback table with one row per group
+func (s *StatisticsService) GetCostAllocationTable(billingMonth, groupType string) (*models.ReportTable, error) {
+	groupData, err := s.getMonthlyGroupUsage(billingMonth, groupType)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(groupData, func(i, j int) bool {
+		if groupData[i].CostCenter != groupData[j].CostCenter {
+			return groupData[i].CostCenter < groupData[j].CostCenter
+		}
+		return groupData[i].CashCost > groupData[j].CashCost
+	})
+
+	table := &models.ReportTable{
+		Title:   fmt.Sprintf("%s 成本分摊报表", billingMonth),
+		Columns: []string{"账单月份", "成本中心", "分组ID", "分组名称", "调用次数", "Token用量", "费用(元)", "占比(%)", "主要模型"},
+		Rows:    [][]string{},
+	}
+
+	for _, group := range groupData {
+		costCenter := group.CostCenter
+		if costCenter == "" {
+			costCenter = unassignedCostCenter
+		}
+
+		topModels := make([]string, 0, len(group.TopModels))
+		for _, model := range group.TopModels {
+			topModels = append(topModels, model.ModelName)
+		}
+
+		table.Rows = append(table.Rows, []string{
+			billingMonth,
+			costCenter,
+			group.GroupID,
+			group.GroupName,
+			fmt.Sprintf("%d", group.CallCount),
+			fmt.Sprintf("%.0f", group.TokenUsage),
+			fmt.Sprintf("%.4f", group.CashCost),
+			fmt.Sprintf("%.2f", group.Percentage),
+			strings.Join(topModels, ", "),
+		})
+	}
+
+	return table, nil
+}
+
+// getMonthlyGroupUsage retrieves the group usage report for a billing month (YYYY-MM)
+func (s *StatisticsService) getMonthlyGroupUsage(billingMonth, groupType string) ([]models.GroupUsageData, error) {
+	year, month, err := parseBillingMonth(billingMonth)
+	if err != nil {
+		return nil, NewValidationError(ErrCodeInvalidParameter, fmt.Sprintf("invalid billing month %s: %v", billingMonth, err))
+	}
+
+	startDate := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, models.ReportingLocation())
+	endDate := startDate.AddDate(0, 1, -1)
+
+	return s.GetGroupUsageReport(&startDate, &endDate, groupType)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"glm-usage-monitor/models"
 	"log"
+	"sort"
 	"strings"
 	"time"
 )
@@ -26,38 +27,59 @@ func (s *DatabaseService) GetDB() *sql.DB {
 
 // ========== ExpenseBill Operations ==========
 
-// CreateExpenseBill creates a new expense bill record
-func (s *DatabaseService) CreateExpenseBill(bill *models.ExpenseBill) error {
-	query := `
-		INSERT INTO expense_bills (
-			charge_name, charge_type, model_name, use_group_name, group_name,
-			discount_rate, cost_rate, cash_cost, billing_no, order_time,
-			use_group_id, group_id, charge_unit, charge_count, charge_unit_symbol,
-			trial_cash_cost, transaction_time, time_window_start, time_window_end,
-			time_window, create_time,
-			
-			-- 新增字段：模型信息字段
-			api_key, model_code, model_product_type, model_product_subtype, model_product_code, model_product_name,
-			
-			-- 新增字段：支付和成本信息字段
-			payment_type, start_time, end_time, business_id, cost_price, cost_unit, usage_count, usage_exempt, usage_unit, currency,
-			
-			-- 新增字段：金额信息字段
-			settlement_amount, gift_deduct_amount, due_amount, paid_amount, unpaid_amount, billing_status, invoicing_amount, invoiced_amount,
-			
-			-- 新增字段：Token业务字段
-			token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
+// expenseBillColumns are the expense_bills columns written on insert, in expenseBillArgs order
+var expenseBillColumns = []string{
+	"id", "charge_name", "charge_type", "model_name", "use_group_name", "group_name",
+	"discount_rate", "cost_rate", "cash_cost", "billing_no", "order_time",
+	"use_group_id", "group_id", "charge_unit", "charge_count", "charge_unit_symbol",
+	"trial_cash_cost", "transaction_time", "time_window_start", "time_window_end",
+	"time_window", "create_time",
 
-	_, err := s.db.Exec(query,
-		// 原有字段
-		bill.ChargeName, bill.ChargeType, bill.ModelName, bill.UseGroupName, bill.GroupName,
+	// DB_01: 缺失的关键字段
+	"billing_date", "billing_time", "customer_id", "order_no", "original_amount", "original_cost_price",
+	"discount_type", "credit_pay_amount", "third_party", "cash_amount", "api_usage",
+
+	// 模型信息字段
+	"api_key", "model_code", "model_product_type", "model_product_subtype", "model_product_code", "model_product_name",
+
+	// 支付和成本信息字段
+	"payment_type", "start_time", "end_time", "business_id", "cost_price", "cost_unit", "usage_count", "usage_exempt", "usage_unit", "currency",
+
+	// 金额信息字段
+	"settlement_amount", "gift_deduct_amount", "due_amount", "paid_amount", "unpaid_amount", "billing_status", "invoicing_amount", "invoiced_amount",
+
+	// Token业务字段
+	"token_account_id", "token_resource_no", "token_resource_name", "deduct_usage", "deduct_after", "token_type",
+
+	// 账单所属账号（api_tokens.id）
+	"account_id",
+}
+
+// expenseBillInsertQuery returns the INSERT statement for expenseBillColumns
+func expenseBillInsertQuery() string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(expenseBillColumns)), ", ")
+	return fmt.Sprintf("INSERT INTO expense_bills (%s) VALUES (%s)", strings.Join(expenseBillColumns, ", "), placeholders)
+}
+
+// expenseBillArgs returns the values of expenseBillColumns for a bill.
+// The billing number doubles as the primary key when the bill has no ID.
+func expenseBillArgs(bill *models.ExpenseBill) []interface{} {
+	id := bill.ID
+	if id == "" {
+		id = bill.BillingNo
+	}
+
+	return []interface{}{
+		id, bill.ChargeName, bill.ChargeType, bill.ModelName, bill.UseGroupName, bill.GroupName,
 		bill.DiscountRate, bill.CostRate, bill.CashCost, bill.BillingNo, bill.OrderTime,
 		bill.UseGroupID, bill.GroupID, bill.ChargeUnit, bill.ChargeCount, bill.ChargeUnitSymbol,
-		bill.TrialCashCost, bill.TransactionTime, bill.TimeWindowStart, bill.TimeWindowEnd,
+		bill.TrialCashCost, bill.TransactionTime.UTC(), bill.TimeWindowStart.UTC(), bill.TimeWindowEnd.UTC(),
 		bill.TimeWindow, bill.CreateTime,
 
+		// DB_01: 缺失的关键字段
+		bill.BillingDate, bill.BillingTime, bill.CustomerID, bill.OrderNo, bill.OriginalAmount, bill.OriginalCostPrice,
+		bill.DiscountType, bill.CreditPayAmount, bill.ThirdParty, bill.CashAmount, bill.APIUsage,
+
 		// 模型信息字段
 		bill.APIKey, bill.ModelCode, bill.ModelProductType, bill.ModelProductSubtype, bill.ModelProductCode, bill.ModelProductName,
 
@@ -69,8 +91,22 @@ func (s *DatabaseService) CreateExpenseBill(bill *models.ExpenseBill) error {
 
 		// Token业务字段
 		bill.TokenAccountID, bill.TokenResourceNo, bill.TokenResourceName, bill.DeductUsage, bill.DeductAfter, bill.TokenType,
-	)
 
+		nullableAccountID(bill.AccountID),
+	}
+}
+
+// nullableAccountID stores bills without an account as NULL
+func nullableAccountID(accountID int) interface{} {
+	if accountID == 0 {
+		return nil
+	}
+	return accountID
+}
+
+// CreateExpenseBill creates a new expense bill record
+func (s *DatabaseService) CreateExpenseBill(bill *models.ExpenseBill) error {
+	_, err := s.db.Exec(expenseBillInsertQuery(), expenseBillArgs(bill)...)
 	if err != nil {
 		return fmt.Errorf("failed to create expense bill: %w", err)
 	}
@@ -90,33 +126,7 @@ func (s *DatabaseService) BatchCreateExpenseBills(bills []*models.ExpenseBill) e
 	}
 	defer tx.Rollback()
 
-	query := `
-		INSERT INTO expense_bills (
-			charge_name, charge_type, model_name, use_group_name, group_name,
-			discount_rate, cost_rate, cash_cost, billing_no, order_time,
-			use_group_id, group_id, charge_unit, charge_count, charge_unit_symbol,
-			trial_cash_cost, transaction_time, time_window_start, time_window_end,
-			time_window, create_time,
-			
-			-- DB_01: 缺失的关键字段
-			billing_date, billing_time, customer_id, order_no, original_amount, original_cost_price,
-			discount_type, credit_pay_amount, third_party, cash_amount, api_usage,
-			
-			-- 模型信息字段
-			api_key, model_code, model_product_type, model_product_subtype, model_product_code, model_product_name,
-			
-			-- 支付和成本信息字段
-			payment_type, start_time, end_time, business_id, cost_price, cost_unit, usage_count, usage_exempt, usage_unit, currency,
-			
-			-- 金额信息字段
-			settlement_amount, gift_deduct_amount, due_amount, paid_amount, unpaid_amount, billing_status, invoicing_amount, invoiced_amount,
-			
-			-- Token业务字段
-			token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-
-	stmt, err := tx.Prepare(query)
+	stmt, err := tx.Prepare(expenseBillInsertQuery())
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
@@ -128,32 +138,7 @@ func (s *DatabaseService) BatchCreateExpenseBills(bills []*models.ExpenseBill) e
 			continue
 		}
 
-		_, err := stmt.Exec(
-			// 原有字段
-			bill.ChargeName, bill.ChargeType, bill.ModelName, bill.UseGroupName, bill.GroupName,
-			bill.DiscountRate, bill.CostRate, bill.CashCost, bill.BillingNo, bill.OrderTime,
-			bill.UseGroupID, bill.GroupID, bill.ChargeUnit, bill.ChargeCount, bill.ChargeUnitSymbol,
-			bill.TrialCashCost, bill.TransactionTime, bill.TimeWindowStart, bill.TimeWindowEnd,
-			bill.TimeWindow, bill.CreateTime,
-
-			// DB_01: 缺失的关键字段
-			bill.BillingDate, bill.BillingTime, bill.CustomerID, bill.OrderNo, bill.OriginalAmount, bill.OriginalCostPrice,
-			bill.DiscountType, bill.CreditPayAmount, bill.ThirdParty, bill.CashAmount, bill.APIUsage,
-
-			// 模型信息字段
-			bill.APIKey, bill.ModelCode, bill.ModelProductType, bill.ModelProductSubtype, bill.ModelProductCode, bill.ModelProductName,
-
-			// 支付和成本信息字段
-			bill.PaymentType, bill.StartTime, bill.EndTime, bill.BusinessID, bill.CostPrice, bill.CostUnit, bill.UsageCount, bill.UsageExempt, bill.UsageUnit, bill.Currency,
-
-			// 金额信息字段
-			bill.SettlementAmount, bill.GiftDeductAmount, bill.DueAmount, bill.PaidAmount, bill.UnpaidAmount, bill.BillingStatus, bill.InvoicingAmount, bill.InvoicedAmount,
-
-			// Token业务字段
-			bill.TokenAccountID, bill.TokenResourceNo, bill.TokenResourceName, bill.DeductUsage, bill.DeductAfter, bill.TokenType,
-		)
-
-		if err != nil {
+		if _, err := stmt.Exec(expenseBillArgs(bill)...); err != nil {
 			return fmt.Errorf("failed to insert bill %s: %w", bill.BillingNo, err)
 		}
 	}
@@ -168,13 +153,13 @@ func (s *DatabaseService) GetExpenseBills(filter *models.BillFilter) (*models.Pa
 
 	// Build WHERE conditions
 	if filter.StartDate != nil {
-		whereConditions = append(whereConditions, "DATE(transaction_time) >= DATE(?)")
-		args = append(args, filter.StartDate.Format("2006-01-02"))
+		whereConditions = append(whereConditions, reportingDateExpr("transaction_time")+" >= DATE(?)")
+		args = append(args, reportingDateArg(*filter.StartDate))
 	}
 
 	if filter.EndDate != nil {
-		whereConditions = append(whereConditions, "DATE(transaction_time) <= DATE(?)")
-		args = append(args, filter.EndDate.Format("2006-01-02"))
+		whereConditions = append(whereConditions, reportingDateExpr("transaction_time")+" <= DATE(?)")
+		args = append(args, reportingDateArg(*filter.EndDate))
 	}
 
 	if filter.ModelName != nil && *filter.ModelName != "" {
@@ -208,6 +193,11 @@ func (s *DatabaseService) GetExpenseBills(filter *models.BillFilter) (*models.Pa
 		args = append(args, searchTerm, searchTerm, searchTerm)
 	}
 
+	if filter.AccountID != nil {
+		whereConditions = append(whereConditions, "COALESCE(account_id, 0) = ?")
+		args = append(args, *filter.AccountID)
+	}
+
 	whereClause := strings.Join(whereConditions, " AND ")
 
 	// Count total records
@@ -256,7 +246,10 @@ func (s *DatabaseService) GetExpenseBills(filter *models.BillFilter) (*models.Pa
 			   settlement_amount, gift_deduct_amount, due_amount, paid_amount, unpaid_amount, billing_status, invoicing_amount, invoiced_amount,
 			   
 			   -- Token业务字段
-			   token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type
+			   token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type,
+
+			   -- 账单所属账号
+			   COALESCE(account_id, 0)
 		FROM expense_bills
 		WHERE %s
 		ORDER BY transaction_time DESC
@@ -296,6 +289,9 @@ func (s *DatabaseService) GetExpenseBills(filter *models.BillFilter) (*models.Pa
 
 			// Token业务字段
 			&bill.TokenAccountID, &bill.TokenResourceNo, &bill.TokenResourceName, &bill.DeductUsage, &bill.DeductAfter, &bill.TokenType,
+
+			// 账单所属账号
+			&bill.AccountID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan expense bill: %w", err)
@@ -345,7 +341,10 @@ func (s *DatabaseService) GetExpenseBillByID(id string) (*models.ExpenseBill, er
 			   settlement_amount, gift_deduct_amount, due_amount, paid_amount, unpaid_amount, billing_status, invoicing_amount, invoiced_amount,
 			   
 			   -- Token业务字段
-			   token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type
+			   token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type,
+
+			   -- 账单所属账号
+			   COALESCE(account_id, 0)
 		FROM expense_bills
 		WHERE id = ?
 	`
@@ -373,6 +372,9 @@ func (s *DatabaseService) GetExpenseBillByID(id string) (*models.ExpenseBill, er
 
 		// Token业务字段
 		&bill.TokenAccountID, &bill.TokenResourceNo, &bill.TokenResourceName, &bill.DeductUsage, &bill.DeductAfter, &bill.TokenType,
+
+		// 账单所属账号
+		&bill.AccountID,
 	)
 
 	if err != nil {
@@ -428,7 +430,10 @@ func (s *DatabaseService) GetExpenseBillsByBillingNo(billingNo string) ([]models
 			   settlement_amount, gift_deduct_amount, due_amount, paid_amount, unpaid_amount, billing_status, invoicing_amount, invoiced_amount,
 			   
 			   -- Token业务字段
-			   token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type
+			   token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type,
+
+			   -- 账单所属账号
+			   COALESCE(account_id, 0)
 		FROM expense_bills
 		WHERE billing_no = ?
 		ORDER BY transaction_time DESC
@@ -465,6 +470,9 @@ func (s *DatabaseService) GetExpenseBillsByBillingNo(billingNo string) ([]models
 
 			// Token业务字段
 			&bill.TokenAccountID, &bill.TokenResourceNo, &bill.TokenResourceName, &bill.DeductUsage, &bill.DeductAfter, &bill.TokenType,
+
+			// 账单所属账号
+			&bill.AccountID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan expense bill: %w", err)
@@ -475,23 +483,99 @@ func (s *DatabaseService) GetExpenseBillsByBillingNo(billingNo string) ([]models
 	return bills, nil
 }
 
+// RederiveBillTimes recomputes transaction_time from billing_no and time_window_start/end from
+// time_window in the reporting timezone, storing all of them as UTC in the driver's format.
+// Bills whose source field cannot be parsed keep their stored value. Returns the bills updated.
+func (s *DatabaseService) RederiveBillTimes() (int, error) {
+	rows, err := s.db.Query(`
+		SELECT id, COALESCE(billing_no, ''), COALESCE(time_window, '')
+		FROM expense_bills
+		WHERE COALESCE(billing_no, '') != '' OR COALESCE(time_window, '') != ''
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query bill times: %w", err)
+	}
+
+	type billTimes struct {
+		id, billingNo, timeWindow string
+	}
+	var bills []billTimes
+	for rows.Next() {
+		var bill billTimes
+		if err := rows.Scan(&bill.id, &bill.billingNo, &bill.timeWindow); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan bill times: %w", err)
+		}
+		bills = append(bills, bill)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to iterate bill times: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	updated := 0
+	for _, bill := range bills {
+		changed := false
+		if transactionTime, err := models.ExtractTransactionTime(bill.billingNo); err == nil {
+			if _, err := tx.Exec("UPDATE expense_bills SET transaction_time = ? WHERE id = ?", transactionTime.UTC(), bill.id); err != nil {
+				return 0, fmt.Errorf("failed to update transaction time: %w", err)
+			}
+			changed = true
+		}
+
+		if timeWindow, err := models.ParseTimeWindow(bill.timeWindow); bill.timeWindow != "" && err == nil {
+			_, err := tx.Exec("UPDATE expense_bills SET time_window_start = ?, time_window_end = ? WHERE id = ?",
+				timeWindow.Start.UTC(), timeWindow.End.UTC(), bill.id)
+			if err != nil {
+				return 0, fmt.Errorf("failed to update time window: %w", err)
+			}
+			changed = true
+		}
+
+		if changed {
+			updated++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit bill times: %w", err)
+	}
+
+	return updated, nil
+}
+
 // ========== APIToken Operations ==========
 
+// nullableTokenHash stores tokens without a fingerprint as NULL, which the unique index ignores
+func nullableTokenHash(tokenHash string) interface{} {
+	if tokenHash == "" {
+		return nil
+	}
+	return tokenHash
+}
+
 // SaveAPIToken saves an API token (single token design)
 func (s *DatabaseService) SaveAPIToken(token *models.APIToken) error {
 	// 使用INSERT OR REPLACE简化逻辑：如果存在就替换，不存在就插入
 	query := `
 		INSERT OR REPLACE INTO api_tokens (
-			id, token_name, token_value, provider, token_type, is_active,
+			id, token_name, token_value, token_hint, token_hash, provider, token_type, is_active,
 			daily_limit, monthly_limit, expires_at, last_used_at,
 			created_at, updated_at
 		) VALUES (
-			1, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?, ?
+			1, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?, ?
 		)
 	`
 
 	_, err := s.db.Exec(query,
-		token.TokenName, token.TokenValue, token.Provider, token.TokenType,
+		token.TokenName, token.TokenValue, token.TokenHint, nullableTokenHash(token.TokenHash), token.Provider, token.TokenType,
 		token.DailyLimit, token.MonthlyLimit, token.ExpiresAt, token.LastUsedAt,
 		token.CreatedAt, token.UpdatedAt)
 	if err != nil {
@@ -505,20 +589,21 @@ func (s *DatabaseService) SaveAPIToken(token *models.APIToken) error {
 // GetActiveAPIToken retrieves the API token (single token design)
 func (s *DatabaseService) GetActiveAPIToken() (*models.APIToken, error) {
 	query := `
-		SELECT id, token_name, token_value,
+		SELECT id, token_name, token_value, COALESCE(token_hint, ''),
 			   CASE WHEN provider IS NULL THEN '' ELSE provider END as provider,
 			   CASE WHEN token_type IS NULL THEN '' ELSE token_type END as token_type,
 			   is_active,
 			   daily_limit, monthly_limit, expires_at, last_used_at,
 			   created_at, updated_at
 		FROM api_tokens
+		WHERE is_active = 1
 		ORDER BY updated_at DESC
 		LIMIT 1
 	`
 
 	var token models.APIToken
 	err := s.db.QueryRow(query).Scan(
-		&token.ID, &token.TokenName, &token.TokenValue, &token.Provider, &token.TokenType, &token.IsActive,
+		&token.ID, &token.TokenName, &token.TokenValue, &token.TokenHint, &token.Provider, &token.TokenType, &token.IsActive,
 		&token.DailyLimit, &token.MonthlyLimit, &token.ExpiresAt, &token.LastUsedAt,
 		&token.CreatedAt, &token.UpdatedAt)
 	if err != nil {
@@ -532,10 +617,55 @@ func (s *DatabaseService) GetActiveAPIToken() (*models.APIToken, error) {
 	return &token, nil
 }
 
+// CreateAPIToken inserts an additional API token and sets its ID
+func (s *DatabaseService) CreateAPIToken(token *models.APIToken) error {
+	query := `
+		INSERT INTO api_tokens (
+			token_name, token_value, token_hint, token_hash, provider, token_type, is_active,
+			daily_limit, monthly_limit, expires_at, last_used_at,
+			created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := s.db.Exec(query,
+		token.TokenName, token.TokenValue, token.TokenHint, nullableTokenHash(token.TokenHash), token.Provider, token.TokenType, token.IsActive,
+		token.DailyLimit, token.MonthlyLimit, token.ExpiresAt, token.LastUsedAt,
+		token.CreatedAt, token.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API token: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get API token ID: %w", err)
+	}
+	token.ID = int(id)
+
+	return nil
+}
+
+// GetActiveAPITokens retrieves all active API tokens, one per account, oldest first
+func (s *DatabaseService) GetActiveAPITokens() ([]models.APIToken, error) {
+	tokens, err := s.GetAllAPITokens()
+	if err != nil {
+		return nil, err
+	}
+
+	active := make([]models.APIToken, 0, len(tokens))
+	for _, token := range tokens {
+		if token.IsActive {
+			active = append(active, token)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].ID < active[j].ID })
+
+	return active, nil
+}
+
 // GetAllAPITokens retrieves all API tokens
 func (s *DatabaseService) GetAllAPITokens() ([]models.APIToken, error) {
 	query := `
-		SELECT id, token_name, token_value,
+		SELECT id, token_name, token_value, COALESCE(token_hint, ''),
 			   CASE WHEN provider IS NULL THEN '' ELSE provider END as provider,
 			   CASE WHEN token_type IS NULL THEN '' ELSE token_type END as token_type,
 			   is_active,
@@ -555,7 +685,7 @@ func (s *DatabaseService) GetAllAPITokens() ([]models.APIToken, error) {
 	for rows.Next() {
 		var token models.APIToken
 		err := rows.Scan(
-			&token.ID, &token.TokenName, &token.TokenValue, &token.Provider, &token.TokenType, &token.IsActive,
+			&token.ID, &token.TokenName, &token.TokenValue, &token.TokenHint, &token.Provider, &token.TokenType, &token.IsActive,
 			&token.DailyLimit, &token.MonthlyLimit, &token.ExpiresAt, &token.LastUsedAt,
 			&token.CreatedAt, &token.UpdatedAt)
 		if err != nil {
@@ -567,6 +697,19 @@ func (s *DatabaseService) GetAllAPITokens() ([]models.APIToken, error) {
 	return tokens, nil
 }
 
+// GetAPITokenIDByHash returns the ID of the token with the given fingerprint, or 0 if there is none
+func (s *DatabaseService) GetAPITokenIDByHash(tokenHash string) (int, error) {
+	var id int
+	err := s.db.QueryRow("SELECT id FROM api_tokens WHERE token_hash = ?", tokenHash).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to query API token: %w", err)
+	}
+	return id, nil
+}
+
 // DeactivateAPIToken deactivates an API token by ID
 func (s *DatabaseService) DeactivateAPIToken(id int) error {
 	query := "UPDATE api_tokens SET is_active = 0, updated_at = ? WHERE id = ?"
@@ -577,6 +720,24 @@ func (s *DatabaseService) DeactivateAPIToken(id int) error {
 	return nil
 }
 
+// UpdateAPITokenExpiry sets or clears the expiry time of an API token
+func (s *DatabaseService) UpdateAPITokenExpiry(id int, expiresAt *time.Time) error {
+	result, err := s.db.Exec("UPDATE api_tokens SET expires_at = ?, updated_at = ? WHERE id = ?", expiresAt, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update API token expiry: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("API token not found: %d", id)
+	}
+
+	return nil
+}
+
 // DeleteAPIToken deletes an API token by ID
 func (s *DatabaseService) DeleteAPIToken(id int) error {
 	query := "DELETE FROM api_tokens WHERE id = ?"
@@ -615,49 +776,7 @@ func (s *DatabaseService) CreateOrUpdateExpenseBillInTx(tx *sql.Tx, bill *models
 
 // createExpenseBillInTx 在事务中创建账单
 func (s *DatabaseService) createExpenseBillInTx(tx *sql.Tx, bill *models.ExpenseBill) error {
-	query := `
-		INSERT INTO expense_bills (
-			charge_name, charge_type, model_name, use_group_name, group_name,
-			discount_rate, cost_rate, cash_cost, billing_no, order_time,
-			use_group_id, group_id, charge_unit, charge_count, charge_unit_symbol,
-			trial_cash_cost, transaction_time, time_window_start, time_window_end,
-			time_window, create_time,
-
-			-- 模型信息字段
-			api_key, model_code, model_product_type, model_product_subtype, model_product_code, model_product_name,
-
-			-- 支付和成本信息字段
-			payment_type, start_time, end_time, business_id, cost_price, cost_unit, usage_count, usage_exempt, usage_unit, currency,
-
-			-- 金额信息字段
-			settlement_amount, gift_deduct_amount, due_amount, paid_amount, unpaid_amount, billing_status, invoicing_amount, invoiced_amount,
-
-			-- Token业务字段
-			token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-
-	_, err := tx.Exec(query,
-		// 原有字段
-		bill.ChargeName, bill.ChargeType, bill.ModelName, bill.UseGroupName, bill.GroupName,
-		bill.DiscountRate, bill.CostRate, bill.CashCost, bill.BillingNo, bill.OrderTime,
-		bill.UseGroupID, bill.GroupID, bill.ChargeUnit, bill.ChargeCount, bill.ChargeUnitSymbol,
-		bill.TrialCashCost, bill.TransactionTime, bill.TimeWindowStart, bill.TimeWindowEnd,
-		bill.TimeWindow, bill.CreateTime,
-
-		// 模型信息字段
-		bill.APIKey, bill.ModelCode, bill.ModelProductType, bill.ModelProductSubtype, bill.ModelProductCode, bill.ModelProductName,
-
-		// 支付和成本信息字段
-		bill.PaymentType, bill.StartTime, bill.EndTime, bill.BusinessID, bill.CostPrice, bill.CostUnit, bill.UsageCount, bill.UsageExempt, bill.UsageUnit, bill.Currency,
-
-		// 金额信息字段
-		bill.SettlementAmount, bill.GiftDeductAmount, bill.DueAmount, bill.PaidAmount, bill.UnpaidAmount, bill.BillingStatus, bill.InvoicingAmount, bill.InvoicedAmount,
-
-		// Token业务字段
-		bill.TokenAccountID, bill.TokenResourceNo, bill.TokenResourceName, bill.DeductUsage, bill.DeductAfter, bill.TokenType,
-	)
-
+	_, err := tx.Exec(expenseBillInsertQuery(), expenseBillArgs(bill)...)
 	if err != nil {
 		return fmt.Errorf("failed to create expense bill in transaction: %w", err)
 	}
@@ -665,125 +784,74 @@ func (s *DatabaseService) createExpenseBillInTx(tx *sql.Tx, bill *models.Expense
 	return nil
 }
 
-// updateExpenseBillInTx 在事务中更新账单
+// updateExpenseBillInTx 在事务中更新账单，保留原有的 id 和 create_time
 func (s *DatabaseService) updateExpenseBillInTx(tx *sql.Tx, bill *models.ExpenseBill) error {
-	query := `
-		UPDATE expense_bills SET
-			charge_name = ?, charge_type = ?, model_name = ?, use_group_name = ?, group_name = ?,
-			discount_rate = ?, cost_rate = ?, cash_cost = ?, order_time = ?,
-			use_group_id = ?, group_id = ?, charge_unit = ?, charge_count = ?, charge_unit_symbol = ?,
-			trial_cash_cost = ?, transaction_time = ?, time_window_start = ?, time_window_end = ?,
-			time_window = ?,
-
-			-- 模型信息字段
-			api_key = ?, model_code = ?, model_product_type = ?, model_product_subtype = ?, model_product_code = ?, model_product_name = ?,
-
-			-- 支付和成本信息字段
-			payment_type = ?, start_time = ?, end_time = ?, business_id = ?, cost_price = ?, cost_unit = ?, usage_count = ?, usage_exempt = ?, usage_unit = ?, currency = ?,
-
-			-- 金额信息字段
-			settlement_amount = ?, gift_deduct_amount = ?, due_amount = ?, paid_amount = ?, unpaid_amount = ?, billing_status = ?, invoicing_amount = ?, invoiced_amount = ?,
-
-			-- Token业务字段
-			token_account_id = ?, token_resource_no = ?, token_resource_name = ?, deduct_usage = ?, deduct_after = ?, token_type = ?
-		WHERE billing_no = ?
-	`
-
-	_, err := tx.Exec(query,
-		// 原有字段
-		bill.ChargeName, bill.ChargeType, bill.ModelName, bill.UseGroupName, bill.GroupName,
-		bill.DiscountRate, bill.CostRate, bill.CashCost, bill.OrderTime,
-		bill.UseGroupID, bill.GroupID, bill.ChargeUnit, bill.ChargeCount, bill.ChargeUnitSymbol,
-		bill.TrialCashCost, bill.TransactionTime, bill.TimeWindowStart, bill.TimeWindowEnd,
-		bill.TimeWindow,
-
-		// 模型信息字段
-		bill.APIKey, bill.ModelCode, bill.ModelProductType, bill.ModelProductSubtype, bill.ModelProductCode, bill.ModelProductName,
-
-		// 支付和成本信息字段
-		bill.PaymentType, bill.StartTime, bill.EndTime, bill.BusinessID, bill.CostPrice, bill.CostUnit, bill.UsageCount, bill.UsageExempt, bill.UsageUnit, bill.Currency,
-
-		// 金额信息字段
-		bill.SettlementAmount, bill.GiftDeductAmount, bill.DueAmount, bill.PaidAmount, bill.UnpaidAmount, bill.BillingStatus, bill.InvoicingAmount, bill.InvoicedAmount,
-
-		// Token业务字段
-		bill.TokenAccountID, bill.TokenResourceNo, bill.TokenResourceName, bill.DeductUsage, bill.DeductAfter, bill.TokenType,
-
-		// WHERE 条件
-		bill.BillingNo,
-	)
+	// 跳过 id 和 create_time
+	args := expenseBillArgs(bill)
+	assignments := make([]string, 0, len(expenseBillColumns))
+	values := make([]interface{}, 0, len(expenseBillColumns))
+	for i, column := range expenseBillColumns {
+		if column == "id" || column == "create_time" {
+			continue
+		}
+		assignments = append(assignments, column+" = ?")
+		values = append(values, args[i])
+	}
+	values = append(values, bill.BillingNo)
 
-	if err != nil {
+	query := fmt.Sprintf("UPDATE expense_bills SET %s WHERE billing_no = ?", strings.Join(assignments, ", "))
+	if _, err := tx.Exec(query, values...); err != nil {
 		return fmt.Errorf("failed to update expense bill in transaction: %w", err)
 	}
 
 	return nil
 }
 
-// ========== 会员等级智能匹配功能 ==========
-
-// GetCurrentMembershipTier 获取当前用户的会员等级
-func (s *DatabaseService) GetCurrentMembershipTier() (string, error) {
-	db := s.db
-
-	// 从expense_bills表获取最新的token_resource_name
-	query := `
-		SELECT token_resource_name 
-		FROM expense_bills 
-		WHERE token_resource_name IS NOT NULL 
-		  AND token_resource_name != ''
-		ORDER BY transaction_time DESC 
-		LIMIT 1
-	`
+// ========== MUTATION_01: 清理旧同步历史功能缺失 ==========
 
-	var tokenResourceName string
-	err := db.QueryRow(query).Scan(&tokenResourceName)
+// CleanOldSyncHistory 清理指定天数前的同步历史记录 (MUTATION_01)
+func (s *DatabaseService) CleanOldSyncHistory(days int) error {
+	cutoffTime := time.Now().AddDate(0, 0, -days)
+	query := "DELETE FROM sync_history WHERE start_time < ?"
+	_, err := s.db.Exec(query, cutoffTime)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return "free", nil // 默认为免费版
-		}
-		return "", fmt.Errorf("failed to get current membership tier: %w", err)
+		return fmt.Errorf("failed to clean old sync history: %w", err)
 	}
 
-	// 智能匹配会员等级
-	tier := s.matchMembershipTier(tokenResourceName)
-	return tier, nil
+	log.Printf("Cleaned sync history older than %d days", days)
+	return nil
 }
 
-// matchMembershipTier 智能匹配会员等级
-func (s *DatabaseService) matchMembershipTier(tokenResourceName string) string {
-	// 转换为小写便于匹配
-	name := strings.ToLower(tokenResourceName)
+// ========== AppSetting Operations ==========
 
-	// 匹配规则
-	if strings.Contains(name, "lite") {
-		return "lite"
-	} else if strings.Contains(name, "plus") {
-		return "plus"
-	} else if strings.Contains(name, "pro") {
-		return "pro"
-	} else if strings.Contains(name, "enterprise") || strings.Contains(name, "企业") {
-		return "enterprise"
-	} else if strings.Contains(name, "free") || strings.Contains(name, "免费") {
-		return "free"
+// GetAppSetting retrieves an application setting value by key
+func (s *DatabaseService) GetAppSetting(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow("SELECT setting_value FROM app_settings WHERE setting_key = ?", key).Scan(&value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("config key not found: %s", key)
+		}
+		return "", fmt.Errorf("failed to get app setting: %w", err)
 	}
-
-	// 默认返回pro（如果无法匹配）
-	return "pro"
+	return value, nil
 }
 
-// ========== MUTATION_01: 清理旧同步历史功能缺失 ==========
+// SetAppSetting creates or updates an application setting
+func (s *DatabaseService) SetAppSetting(key, value, description string) error {
+	query := `
+		INSERT INTO app_settings (setting_key, setting_value, description, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(setting_key) DO UPDATE SET
+			setting_value = excluded.setting_value,
+			description = COALESCE(NULLIF(excluded.description, ''), app_settings.description),
+			updated_at = excluded.updated_at
+	`
 
-// CleanOldSyncHistory 清理指定天数前的同步历史记录 (MUTATION_01)
-func (s *DatabaseService) CleanOldSyncHistory(days int) error {
-	cutoffTime := time.Now().AddDate(0, 0, -days)
-	query := "DELETE FROM sync_history WHERE start_time < ?"
-	_, err := s.db.Exec(query, cutoffTime)
+	_, err := s.db.Exec(query, key, value, description, time.Now())
 	if err != nil {
-		return fmt.Errorf("failed to clean old sync history: %w", err)
+		return fmt.Errorf("failed to save app setting: %w", err)
 	}
-
-	log.Printf("Cleaned sync history older than %d days", days)
 	return nil
 }
 
@@ -881,25 +949,11 @@ func (s *DatabaseService) DeleteAllExpenseBills() error {
 
 // ========== SyncHistory Operations ==========
 
-// SaveSyncHistory saves a sync history record
+// SaveSyncHistory saves a sync history record, inserting it on first save and updating it afterwards
 func (s *DatabaseService) SaveSyncHistory(history *models.SyncHistory) error {
-	query := `
-		INSERT INTO sync_history (
-			sync_type, start_time, end_time, status, records_synced,
-			error_message, total_records, page_synced, total_pages,
-			billing_month, failed_count, sync_time, duration, message
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-
-	_, err := s.db.Exec(query,
-		history.SyncType, history.StartTime, history.EndTime, history.Status, history.RecordsSynced,
-		history.ErrorMessage, history.TotalRecords, history.PageSynced, history.TotalPages,
-		history.BillingMonth, history.FailedCount, history.SyncTime, history.Duration, history.Message,
-	)
-
-	if err != nil {
-		return fmt.Errorf("failed to save sync history: %w", err)
+	if history.ID != 0 {
+		return s.UpdateSyncHistory(history.ID, history)
 	}
 
-	return nil
+	return s.CreateSyncHistory(history)
 }
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"glm-usage-monitor/models"
+	"testing"
+)
+
+func TestRederiveBillTimes(t *testing.T) {
+	db := newBillTestDB(t)
+	if err := models.SetReportingTimezone("America/New_York"); err != nil {
+		t.Fatalf("SetReportingTimezone failed: %v", err)
+	}
+	t.Cleanup(func() { models.SetReportingTimezone(models.DefaultReportingTimezone) })
+
+	// 旧版本迁移留下的格式：时间窗口按固定的 -8 小时转换，transaction_time 为 strftime 文本
+	_, err := db.Exec(`
+		INSERT INTO expense_bills (id, billing_no, time_window, transaction_time, time_window_start, time_window_end)
+		VALUES ('legacy', 'cust1_1761955200000', '2025-11-01 08:00:00 - 2025-11-01 08:59:59',
+		        '2025-11-01 00:00:00.000', '2025-11-01 00:00:00', '2025-11-01 00:59:59')
+	`)
+	if err != nil {
+		t.Fatalf("failed to insert legacy bill: %v", err)
+	}
+
+	dbService := NewDatabaseService(db)
+	updated, err := dbService.RederiveBillTimes()
+	if err != nil {
+		t.Fatalf("RederiveBillTimes failed: %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("expected 1 updated bill, got %d", updated)
+	}
+
+	// 与按当前时区新入库的账单存储完全一致
+	ingestBillingResponse(t, db, 0, `{"code": 200, "data": {"billList": [{
+		"billingNo": "cust1_1761955200000_fresh",
+		"timeWindow": "2025-11-01 08:00:00 - 2025-11-01 08:59:59"
+	}]}}`)
+
+	var legacyStart, freshStart, legacyTime string
+	err = db.QueryRow(`SELECT CAST(time_window_start AS TEXT), CAST(transaction_time AS TEXT) FROM expense_bills WHERE id = 'legacy'`).
+		Scan(&legacyStart, &legacyTime)
+	if err != nil {
+		t.Fatalf("failed to read legacy bill: %v", err)
+	}
+	err = db.QueryRow(`SELECT CAST(time_window_start AS TEXT) FROM expense_bills WHERE id = 'cust1_1761955200000_fresh'`).Scan(&freshStart)
+	if err != nil {
+		t.Fatalf("failed to read fresh bill: %v", err)
+	}
+	if legacyStart != freshStart {
+		t.Errorf("legacy time window start %q differs from fresh %q", legacyStart, freshStart)
+	}
+
+	var start, transactionTime string
+	err = db.QueryRow(`SELECT datetime(time_window_start), datetime(transaction_time) FROM expense_bills WHERE id = 'legacy'`).
+		Scan(&start, &transactionTime)
+	if err != nil {
+		t.Fatalf("failed to read normalized times: %v", err)
+	}
+	// 纽约 2025-11-01 08:00 (UTC-4) = 12:00 UTC
+	if start != "2025-11-01 12:00:00" {
+		t.Errorf("expected time window start 2025-11-01 12:00:00 UTC, got %s (%s)", start, legacyStart)
+	}
+	if transactionTime != "2025-11-01 00:00:00" {
+		t.Errorf("expected transaction time 2025-11-01 00:00:00 UTC, got %s (%s)", transactionTime, legacyTime)
+	}
+}
@@ -107,7 +107,7 @@ func (d *DependencyInjector) InjectDependencies(target interface{}) error {
 			// 检查服务是否实现了期望的接口
 			serviceType := reflect.TypeOf(service)
 			if !serviceType.Implements(fieldType) {
-				return fmt.Errorf("service %s does not implement expected interface for field %s", fieldName)
+				return fmt.Errorf("service %s does not implement expected interface %s", fieldName, fieldType)
 			}
 
 			// 设置字段值
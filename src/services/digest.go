@@ -0,0 +1,676 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"glm-usage-monitor/models"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Digest kinds
+const (
+	DigestKindDaily  = "daily"  // 昨日 + 本周至今
+	DigestKindWeekly = "weekly" // 上周 + 本月至今
+)
+
+// DefaultDigestCheckInterval is how often the digest scheduler checks for due schedules
+const DefaultDigestCheckInterval = time.Minute
+
+// digestTopN is the number of top models and API keys listed per digest period
+const digestTopN = 5
+
+// validateDigestSchedule checks a digest schedule before it is saved
+func validateDigestSchedule(schedule *models.DigestSchedule) error {
+	schedule.Name = strings.TrimSpace(schedule.Name)
+	if schedule.Name == "" {
+		return fmt.Errorf("schedule name is required")
+	}
+	if schedule.Kind != DigestKindDaily && schedule.Kind != DigestKindWeekly {
+		return fmt.Errorf("invalid digest kind: %s", schedule.Kind)
+	}
+	if _, err := time.Parse("15:04", schedule.TimeOfDay); err != nil {
+		return fmt.Errorf("invalid time of day (expected HH:MM): %s", schedule.TimeOfDay)
+	}
+	for _, weekday := range schedule.Weekdays {
+		if weekday < 0 || weekday > 6 {
+			return fmt.Errorf("invalid weekday: %d", weekday)
+		}
+	}
+
+	return nil
+}
+
+// digestScheduleColumns are the selected columns of digest_schedules, in scanDigestSchedule order
+const digestScheduleColumns = `id, name, kind, time_of_day, COALESCE(weekdays, ''), enabled, last_run_at,
+	created_at, updated_at`
+
+// scanDigestSchedule scans a digest schedule row, decoding its weekdays
+func scanDigestSchedule(rows *sql.Rows) (*models.DigestSchedule, error) {
+	var schedule models.DigestSchedule
+	var weekdays string
+	var lastRunAt sql.NullTime
+	err := rows.Scan(&schedule.ID, &schedule.Name, &schedule.Kind, &schedule.TimeOfDay, &weekdays,
+		&schedule.Enabled, &lastRunAt, &schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan digest schedule: %w", err)
+	}
+
+	schedule.Weekdays = []int{}
+	if weekdays != "" {
+		if err := json.Unmarshal([]byte(weekdays), &schedule.Weekdays); err != nil {
+			return nil, fmt.Errorf("failed to parse weekdays of digest schedule %d: %w", schedule.ID, err)
+		}
+	}
+	if lastRunAt.Valid {
+		schedule.LastRunAt = &lastRunAt.Time
+	}
+
+	return &schedule, nil
+}
+
+// GetDigestSchedules retrieves all digest schedules
+func (s *DatabaseService) GetDigestSchedules() ([]models.DigestSchedule, error) {
+	rows, err := s.db.Query("SELECT " + digestScheduleColumns + " FROM digest_schedules ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query digest schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []models.DigestSchedule{}
+	for rows.Next() {
+		schedule, err := scanDigestSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+// SaveDigestSchedule creates a digest schedule or updates an existing one
+func (s *DatabaseService) SaveDigestSchedule(schedule *models.DigestSchedule) error {
+	if err := validateDigestSchedule(schedule); err != nil {
+		return err
+	}
+	if schedule.Weekdays == nil {
+		schedule.Weekdays = []int{}
+	}
+
+	weekdays, err := json.Marshal(schedule.Weekdays)
+	if err != nil {
+		return fmt.Errorf("failed to marshal digest schedule weekdays: %w", err)
+	}
+
+	now := time.Now()
+	if schedule.ID == 0 {
+		result, err := s.db.Exec(`
+			INSERT INTO digest_schedules (name, kind, time_of_day, weekdays, enabled, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, schedule.Name, schedule.Kind, schedule.TimeOfDay, string(weekdays), schedule.Enabled, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to create digest schedule: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get digest schedule ID: %w", err)
+		}
+		schedule.ID = int(id)
+		schedule.CreatedAt = now
+		schedule.UpdatedAt = now
+		return nil
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE digest_schedules
+		SET name = ?, kind = ?, time_of_day = ?, weekdays = ?, enabled = ?, updated_at = ?
+		WHERE id = ?
+	`, schedule.Name, schedule.Kind, schedule.TimeOfDay, string(weekdays), schedule.Enabled, now, schedule.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update digest schedule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("digest schedule not found: %d", schedule.ID)
+	}
+
+	schedule.UpdatedAt = now
+	return nil
+}
+
+// DeleteDigestSchedule deletes a digest schedule; its digests are kept as history
+func (s *DatabaseService) DeleteDigestSchedule(id int) error {
+	result, err := s.db.Exec("DELETE FROM digest_schedules WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete digest schedule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("digest schedule not found: %d", id)
+	}
+
+	return nil
+}
+
+// SaveUsageDigest stores a generated digest in the digest history
+func (s *DatabaseService) SaveUsageDigest(digest *models.UsageDigest) error {
+	data, err := json.Marshal(digest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage digest: %w", err)
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO usage_digests (schedule_id, kind, title, summary, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, digest.ScheduleID, digest.Kind, digest.Title, digest.Summary, string(data), digest.GeneratedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save usage digest: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get usage digest ID: %w", err)
+	}
+	digest.ID = int(id)
+	return nil
+}
+
+// GetUsageDigests retrieves recent digests, newest first
+func (s *DatabaseService) GetUsageDigests(limit int) ([]models.UsageDigest, error) {
+	if limit <= 0 {
+		limit = 30
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, data, created_at
+		FROM usage_digests
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage digests: %w", err)
+	}
+	defer rows.Close()
+
+	digests := []models.UsageDigest{}
+	for rows.Next() {
+		digest, err := scanUsageDigest(rows)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, *digest)
+	}
+
+	return digests, rows.Err()
+}
+
+// GetUsageDigest retrieves a stored digest by ID
+func (s *DatabaseService) GetUsageDigest(id int) (*models.UsageDigest, error) {
+	rows, err := s.db.Query("SELECT id, data, created_at FROM usage_digests WHERE id = ?", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage digest: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to query usage digest: %w", err)
+		}
+		return nil, fmt.Errorf("usage digest not found: %d", id)
+	}
+
+	return scanUsageDigest(rows)
+}
+
+// scanUsageDigest scans a usage_digests row, decoding the stored digest
+func scanUsageDigest(rows *sql.Rows) (*models.UsageDigest, error) {
+	var digest models.UsageDigest
+	var id int
+	var data string
+	var createdAt time.Time
+	if err := rows.Scan(&id, &data, &createdAt); err != nil {
+		return nil, fmt.Errorf("failed to scan usage digest: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(data), &digest); err != nil {
+		return nil, fmt.Errorf("failed to parse usage digest %d: %w", id, err)
+	}
+	digest.ID = id
+	digest.GeneratedAt = createdAt
+
+	return &digest, nil
+}
+
+// DigestGenerator builds usage digests and runs them on their schedules
+type DigestGenerator struct {
+	db                  *sql.DB
+	dbService           *DatabaseService
+	statsService        *StatisticsService
+	budgetTracker       *BudgetTracker
+	notificationService *NotificationService
+
+	mu       sync.Mutex // 串行化定时生成与手动生成
+	ticker   *time.Ticker
+	stopChan chan bool
+	running  bool
+}
+
+// NewDigestGenerator creates a new digest generator
+func NewDigestGenerator(db *sql.DB, dbService *DatabaseService, statsService *StatisticsService,
+	budgetTracker *BudgetTracker, notificationService *NotificationService) *DigestGenerator {
+	return &DigestGenerator{
+		db:                  db,
+		dbService:           dbService,
+		statsService:        statsService,
+		budgetTracker:       budgetTracker,
+		notificationService: notificationService,
+		stopChan:            make(chan bool, 1),
+	}
+}
+
+// Start checks schedules periodically until Stop is called
+func (g *DigestGenerator) Start(interval time.Duration) {
+	g.mu.Lock()
+	if g.running {
+		g.mu.Unlock()
+		return
+	}
+	g.running = true
+	g.ticker = time.NewTicker(interval)
+	ticker := g.ticker
+	g.mu.Unlock()
+
+	log.Printf("Digest scheduler started with interval: %v", interval)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Digest scheduler goroutine panic recovered: %v", r)
+			}
+		}()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := g.RunDueSchedules(time.Now()); err != nil {
+					log.Printf("Error running digest schedules: %v", err)
+				}
+			case <-g.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic schedule check
+func (g *DigestGenerator) Stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.running {
+		return
+	}
+
+	g.running = false
+	g.ticker.Stop()
+	select {
+	case g.stopChan <- true:
+	default:
+	}
+
+	log.Println("Digest scheduler stopped")
+}
+
+// RunDueSchedules generates and sends a digest for every enabled schedule that is due at now.
+// A schedule runs at most once per day; a run missed while the app was closed happens on the next check.
+func (g *DigestGenerator) RunDueSchedules(now time.Time) ([]models.UsageDigest, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	schedules, err := g.dbService.GetDigestSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	var digests []models.UsageDigest
+	for _, schedule := range schedules {
+		if !schedule.Enabled || !digestScheduleDue(schedule, now) {
+			continue
+		}
+
+		digest, err := g.generate(schedule.Kind, schedule.ID, now)
+		if err != nil {
+			log.Printf("Error generating digest for schedule %s: %v", schedule.Name, err)
+			continue
+		}
+		if _, err := g.db.Exec("UPDATE digest_schedules SET last_run_at = ? WHERE id = ?", now, schedule.ID); err != nil {
+			log.Printf("Error updating digest schedule %s: %v", schedule.Name, err)
+		}
+		digests = append(digests, *digest)
+	}
+
+	return digests, nil
+}
+
+// digestScheduleDue reports whether the schedule's run for today (reporting timezone) is due at now
+// and has not happened yet. Schedules created after today's time first run on the next matching day.
+func digestScheduleDue(schedule models.DigestSchedule, now time.Time) bool {
+	timeOfDay, err := time.Parse("15:04", schedule.TimeOfDay)
+	if err != nil {
+		return false
+	}
+
+	loc := models.ReportingLocation()
+	local := now.In(loc)
+	if len(schedule.Weekdays) > 0 {
+		active := false
+		for _, day := range schedule.Weekdays {
+			if day == int(local.Weekday()) {
+				active = true
+				break
+			}
+		}
+		if !active {
+			return false
+		}
+	}
+
+	dueAt := time.Date(local.Year(), local.Month(), local.Day(), timeOfDay.Hour(), timeOfDay.Minute(), 0, 0, loc)
+	if now.Before(dueAt) {
+		return false
+	}
+	if schedule.LastRunAt != nil {
+		return schedule.LastRunAt.Before(dueAt)
+	}
+	return schedule.CreatedAt.Before(dueAt)
+}
+
+// Generate builds, stores and sends a digest of the given kind at now, outside of any schedule
+func (g *DigestGenerator) Generate(kind string, now time.Time) (*models.UsageDigest, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.generate(kind, 0, now)
+}
+
+// generate builds a digest, stores it in the history and sends it as an info notification
+func (g *DigestGenerator) generate(kind string, scheduleID int, now time.Time) (*models.UsageDigest, error) {
+	digest, err := g.BuildDigest(kind, now)
+	if err != nil {
+		return nil, err
+	}
+	digest.ScheduleID = scheduleID
+
+	if err := g.dbService.SaveUsageDigest(digest); err != nil {
+		return nil, err
+	}
+	if g.notificationService != nil {
+		g.notificationService.AddDigestNotification(digest)
+	}
+
+	log.Printf("Usage digest generated: %s", digest.Title)
+	return digest, nil
+}
+
+// BuildDigest summarizes the periods of the digest kind at now, with budget status and sync health
+func (g *DigestGenerator) BuildDigest(kind string, now time.Time) (*models.UsageDigest, error) {
+	loc := models.ReportingLocation()
+	now = now.In(loc)
+	today := startOfReportingDay(now, loc)
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+
+	digest := &models.UsageDigest{
+		Kind:        kind,
+		Timezone:    models.ReportingTimezone(),
+		GeneratedAt: now.UTC(),
+	}
+
+	type digestPeriodSpec struct {
+		key, label                             string
+		start, end, previousStart, previousEnd time.Time
+	}
+	var specs []digestPeriodSpec
+	switch kind {
+	case DigestKindDaily:
+		yesterday := today.AddDate(0, 0, -1)
+		digest.Title = "每日用量摘要 " + yesterday.Format("2006-01-02")
+		specs = []digestPeriodSpec{
+			{"yesterday", "昨日", yesterday, today, today.AddDate(0, 0, -2), yesterday},
+			{"week_to_date", "本周至今", weekStart, now, weekStart.AddDate(0, 0, -7), now.AddDate(0, 0, -7)},
+		}
+	case DigestKindWeekly:
+		lastWeek := weekStart.AddDate(0, 0, -7)
+		monthStart := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, loc)
+		digest.Title = fmt.Sprintf("每周用量摘要 %s ~ %s", lastWeek.Format("2006-01-02"),
+			weekStart.AddDate(0, 0, -1).Format("2006-01-02"))
+		specs = []digestPeriodSpec{
+			{"last_week", "上周", lastWeek, weekStart, lastWeek.AddDate(0, 0, -7), lastWeek},
+			{"month_to_date", "本月至今", monthStart, now, addMonthsClamped(monthStart, -1), addMonthsClamped(now, -1)},
+		}
+	default:
+		return nil, fmt.Errorf("invalid digest kind: %s", kind)
+	}
+
+	for _, spec := range specs {
+		period, err := g.summarizePeriod(spec.start, spec.end, spec.previousStart, spec.previousEnd)
+		if err != nil {
+			return nil, err
+		}
+		period.Key = spec.key
+		period.Label = spec.label
+		digest.Periods = append(digest.Periods, *period)
+	}
+
+	budgets, err := g.budgetTracker.GetBudgetStatuses(now)
+	if err != nil {
+		return nil, err
+	}
+	digest.Budgets = budgets
+
+	syncHealth, err := g.syncHealth(specs[0].start)
+	if err != nil {
+		return nil, err
+	}
+	digest.SyncHealth = *syncHealth
+
+	digest.Summary = formatDigestSummary(digest)
+	return digest, nil
+}
+
+// summarizePeriod computes totals, changes against the previous period and top items of [start, end)
+func (g *DigestGenerator) summarizePeriod(start, end, previousStart, previousEnd time.Time) (*models.DigestPeriod, error) {
+	metrics := []string{models.UsageMetricCalls, models.UsageMetricTokens, models.UsageMetricCost}
+
+	totals := func(start, end time.Time) (models.UsageQueryRow, error) {
+		result, err := g.statsService.QueryUsage(&models.UsageQuery{
+			Metrics: metrics,
+			Filter:  models.UsageQueryFilter{StartTime: &start, EndTime: &end},
+		})
+		if err != nil {
+			return models.UsageQueryRow{}, err
+		}
+		if len(result.Rows) == 0 {
+			return models.UsageQueryRow{Metrics: map[string]float64{}}, nil
+		}
+		return result.Rows[0], nil
+	}
+
+	current, err := totals(start, end)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := totals(previousStart, previousEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	period := &models.DigestPeriod{
+		StartTime:      start,
+		EndTime:        end,
+		Calls:          current.Metrics[models.UsageMetricCalls],
+		Tokens:         current.Metrics[models.UsageMetricTokens],
+		Cost:           math.Round(current.Metrics[models.UsageMetricCost]*100) / 100,
+		PreviousCalls:  previous.Metrics[models.UsageMetricCalls],
+		PreviousTokens: previous.Metrics[models.UsageMetricTokens],
+		PreviousCost:   math.Round(previous.Metrics[models.UsageMetricCost]*100) / 100,
+	}
+	period.CallsChange = percentChange(period.Calls, period.PreviousCalls)
+	period.TokensChange = percentChange(period.Tokens, period.PreviousTokens)
+	period.CostChange = percentChange(period.Cost, period.PreviousCost)
+
+	// 套餐抵扣的调用费用为0，按Token排序更能反映实际用量
+	top := func(dimension string) ([]models.DigestItem, error) {
+		result, err := g.statsService.QueryUsage(&models.UsageQuery{
+			Dimensions: []string{dimension},
+			Metrics:    metrics,
+			Filter:     models.UsageQueryFilter{StartTime: &start, EndTime: &end},
+			OrderBy:    models.UsageMetricTokens,
+			Descending: true,
+			Limit:      digestTopN,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		items := make([]models.DigestItem, 0, len(result.Rows))
+		for _, row := range result.Rows {
+			items = append(items, models.DigestItem{
+				Name:   row.Dimensions[dimension],
+				Calls:  row.Metrics[models.UsageMetricCalls],
+				Tokens: row.Metrics[models.UsageMetricTokens],
+				Cost:   math.Round(row.Metrics[models.UsageMetricCost]*100) / 100,
+			})
+		}
+		return items, nil
+	}
+
+	if period.TopModels, err = top(models.UsageDimensionModel); err != nil {
+		return nil, err
+	}
+	if period.TopAPIKeys, err = top(models.UsageDimensionAPIKey); err != nil {
+		return nil, err
+	}
+
+	return period, nil
+}
+
+// percentChange returns the change from previous to current in percent, or nil without a previous value
+func percentChange(current, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := math.Round((current-previous)/previous*10000) / 100
+	return &change
+}
+
+// syncHealth summarizes syncs started since the given time and the latest sync overall
+func (g *DigestGenerator) syncHealth(since time.Time) (*models.DigestSyncHealth, error) {
+	health := &models.DigestSyncHealth{}
+
+	err := g.db.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN status = 'completed' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), 0)
+		FROM sync_history
+		WHERE datetime(start_time) >= ?
+	`, since.UTC().Format("2006-01-02 15:04:05")).Scan(&health.CompletedSyncs, &health.FailedSyncs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count syncs: %w", err)
+	}
+
+	var lastSuccess sql.NullString
+	err = g.db.QueryRow(`
+		SELECT MAX(datetime(COALESCE(end_time, start_time)))
+		FROM sync_history
+		WHERE status = 'completed'
+	`).Scan(&lastSuccess)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last successful sync: %w", err)
+	}
+	if lastSuccess.Valid {
+		if t, err := time.Parse("2006-01-02 15:04:05", lastSuccess.String); err == nil {
+			health.LastSyncTime = &t
+		}
+	}
+
+	var lastError string
+	err = g.db.QueryRow(`
+		SELECT status, COALESCE(error_message, '')
+		FROM sync_history
+		ORDER BY datetime(start_time) DESC, id DESC
+		LIMIT 1
+	`).Scan(&health.LastStatus, &lastError)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get latest sync: %w", err)
+	}
+	if health.LastStatus == "failed" {
+		health.LastError = lastError
+	}
+
+	health.Healthy = health.LastSyncTime != nil && health.LastStatus != "failed"
+	return health, nil
+}
+
+// formatDigestSummary renders the plain-text digest used as the notification message
+func formatDigestSummary(digest *models.UsageDigest) string {
+	var lines []string
+	for _, period := range digest.Periods {
+		line := fmt.Sprintf("%s：费用 ¥%.2f%s，调用 %.0f 次%s，Token %.0f%s", period.Label,
+			period.Cost, formatDigestChange(period.CostChange),
+			period.Calls, formatDigestChange(period.CallsChange),
+			period.Tokens, formatDigestChange(period.TokensChange))
+		if len(period.TopModels) > 0 {
+			line += "，主要模型 " + period.TopModels[0].Name
+		}
+		lines = append(lines, line)
+	}
+
+	if len(digest.Budgets) > 0 {
+		highest := digest.Budgets[0]
+		for _, status := range digest.Budgets[1:] {
+			if status.Percentage > highest.Percentage {
+				highest = status
+			}
+		}
+		lines = append(lines, fmt.Sprintf("预算：共 %d 个，使用率最高为 %s（¥%.2f / ¥%.2f，%.0f%%）",
+			len(digest.Budgets), highest.Budget.Name, highest.Spent, highest.Budget.Amount, highest.Percentage))
+	}
+
+	health := digest.SyncHealth
+	switch {
+	case health.LastSyncTime == nil:
+		lines = append(lines, "同步：尚无成功的同步记录")
+	case health.Healthy:
+		lines = append(lines, fmt.Sprintf("同步：正常，最近成功于 %s",
+			health.LastSyncTime.In(models.ReportingLocation()).Format("01-02 15:04")))
+	default:
+		line := fmt.Sprintf("同步：异常，期间失败 %d 次", health.FailedSyncs)
+		if health.LastError != "" {
+			line += "，最近错误：" + health.LastError
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// formatDigestChange renders a change percentage as a parenthesized suffix
+func formatDigestChange(change *float64) string {
+	if change == nil {
+		return ""
+	}
+	return fmt.Sprintf("（%+.1f%%）", *change)
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"glm-usage-monitor/models"
+)
+
+func TestDigestScheduleDue(t *testing.T) {
+	// 报表时区为默认的UTC+8，09:00 对应 01:00 UTC；2025-11-10 为周一
+	created := time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)
+	lastRun := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		name     string
+		schedule models.DigestSchedule
+		now      time.Time
+		want     bool
+	}{
+		{
+			name:     "before the time of day",
+			schedule: models.DigestSchedule{TimeOfDay: "09:00", CreatedAt: created},
+			now:      time.Date(2025, 11, 10, 0, 59, 0, 0, time.UTC),
+		},
+		{
+			name:     "at the time of day",
+			schedule: models.DigestSchedule{TimeOfDay: "09:00", CreatedAt: created},
+			now:      time.Date(2025, 11, 10, 1, 0, 0, 0, time.UTC),
+			want:     true,
+		},
+		{
+			name:     "already ran today",
+			schedule: models.DigestSchedule{TimeOfDay: "09:00", CreatedAt: created, LastRunAt: lastRun(time.Date(2025, 11, 10, 1, 0, 0, 0, time.UTC))},
+			now:      time.Date(2025, 11, 10, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			// 应用关闭期间错过的运行在下次检查时补上
+			name:     "missed run while closed",
+			schedule: models.DigestSchedule{TimeOfDay: "09:00", CreatedAt: created, LastRunAt: lastRun(time.Date(2025, 11, 8, 1, 0, 0, 0, time.UTC))},
+			now:      time.Date(2025, 11, 10, 15, 0, 0, 0, time.UTC),
+			want:     true,
+		},
+		{
+			name:     "created after today's time",
+			schedule: models.DigestSchedule{TimeOfDay: "09:00", CreatedAt: time.Date(2025, 11, 10, 2, 0, 0, 0, time.UTC)},
+			now:      time.Date(2025, 11, 10, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "matching weekday",
+			schedule: models.DigestSchedule{TimeOfDay: "09:00", Weekdays: []int{1}, CreatedAt: created},
+			now:      time.Date(2025, 11, 10, 2, 0, 0, 0, time.UTC),
+			want:     true,
+		},
+		{
+			// 周日 20:00 UTC 在报表时区已是周一 04:00，尚未到 09:00
+			name:     "weekday in the reporting timezone before the time of day",
+			schedule: models.DigestSchedule{TimeOfDay: "09:00", Weekdays: []int{1}, CreatedAt: created},
+			now:      time.Date(2025, 11, 9, 20, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "other weekday",
+			schedule: models.DigestSchedule{TimeOfDay: "09:00", Weekdays: []int{0, 6}, CreatedAt: created},
+			now:      time.Date(2025, 11, 10, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "invalid time of day",
+			schedule: models.DigestSchedule{TimeOfDay: "9am", CreatedAt: created},
+			now:      time.Date(2025, 11, 10, 2, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := digestScheduleDue(tt.schedule, tt.now); got != tt.want {
+				t.Errorf("expected due %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDigestScheduleRunsOncePerMatchingDay(t *testing.T) {
+	schedule := models.DigestSchedule{
+		TimeOfDay: "09:30",
+		Weekdays:  []int{1, 3}, // 周一、周三
+		CreatedAt: time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	// 按调度器的检查间隔推进一周，记录每次运行的报表时间
+	var runs []string
+	start := time.Date(2025, 11, 9, 16, 0, 0, 0, time.UTC) // 周一 00:00 UTC+8
+	for now := start; now.Before(start.AddDate(0, 0, 7)); now = now.Add(DefaultDigestCheckInterval) {
+		if digestScheduleDue(schedule, now) {
+			ranAt := now
+			schedule.LastRunAt = &ranAt
+			runs = append(runs, now.In(models.ReportingLocation()).Format("Mon 15:04"))
+		}
+	}
+
+	want := []string{"Mon 09:30", "Wed 09:30"}
+	if len(runs) != len(want) {
+		t.Fatalf("expected runs %v, got %v", want, runs)
+	}
+	for i := range want {
+		if runs[i] != want[i] {
+			t.Errorf("expected runs %v, got %v", want, runs)
+			break
+		}
+	}
+}
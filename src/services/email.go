@@ -0,0 +1,449 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"glm-usage-monitor/models"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// SMTP TLS modes
+const (
+	SMTPTLSModeTLS      = "tls"      // 隐式TLS，默认端口465
+	SMTPTLSModeSTARTTLS = "starttls" // 明文连接后升级，默认端口587
+	SMTPTLSModeNone     = "none"     // 不加密，默认端口25，仅用于本地或内网
+)
+
+// emailQueueSize is the capacity of the email send queue
+const emailQueueSize = 100
+
+// smtpTimeout bounds connecting to and talking with the SMTP server
+const smtpTimeout = 15 * time.Second
+
+// defaultEmailTextTemplate renders the plain-text body of a notification email
+const defaultEmailTextTemplate = `{{.Title}}
+
+{{.Message}}
+
+级别：{{.Level}}{{if .Category}}
+类型：{{.Category}}{{end}}
+时间：{{.Time}}
+
+-- 
+GLM 用量监控
+`
+
+// defaultEmailHTMLTemplate renders the HTML body of a notification email
+const defaultEmailHTMLTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, 'Segoe UI', 'PingFang SC', 'Microsoft YaHei', sans-serif; color: #333;">
+  <div style="max-width: 600px; margin: 0 auto; padding: 16px;">
+    <h2 style="margin: 0 0 12px; border-left: 4px solid {{.Color}}; padding-left: 8px;">{{.Title}}</h2>
+    <p style="white-space: pre-wrap; line-height: 1.6;">{{.Message}}</p>
+    <table style="font-size: 13px; color: #666;">
+      <tr><td>级别：</td><td>{{.Level}}</td></tr>
+      {{if .Category}}<tr><td>类型：</td><td>{{.Category}}</td></tr>{{end}}
+      <tr><td>时间：</td><td>{{.Time}}</td></tr>
+    </table>
+    <p style="font-size: 12px; color: #999; margin-top: 24px;">GLM 用量监控</p>
+  </div>
+</body>
+</html>
+`
+
+// emailLevelColors are the accent colors of the HTML template per notification level
+var emailLevelColors = map[string]string{
+	"info":    "#1677ff",
+	"success": "#52c41a",
+	"warning": "#faad14",
+	"error":   "#ff4d4f",
+}
+
+// emailTemplateData is the data rendered by the email templates
+type emailTemplateData struct {
+	Title    string
+	Message  string
+	Level    string
+	Category string
+	Time     string
+	Color    string
+	Data     interface{}
+}
+
+// emailJob is a queued email delivery attempt
+type emailJob struct {
+	channel      models.NotificationChannel
+	notification Notification
+	delivery     *models.NotificationDelivery // 重试时沿用首次尝试的投递记录
+	backoff      time.Duration                // 本次失败后到下次重试的等待时间
+}
+
+// smtpSettings are the SMTP options of a channel, read from its config
+type smtpSettings struct {
+	host               string
+	port               int
+	tlsMode            string
+	username           string
+	password           string
+	from               string
+	insecureSkipVerify bool
+}
+
+// validateSMTPChannel checks the SMTP options of a channel
+func validateSMTPChannel(channel *models.NotificationChannel) error {
+	settings, err := parseSMTPSettings(*channel)
+	if err != nil {
+		return err
+	}
+	if settings.from == "" {
+		return fmt.Errorf("sender address (config.from) is required")
+	}
+	if _, err := mail.ParseAddress(settings.from); err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	hasRecipients := false
+	for key, value := range channel.Config {
+		if key == "to" || strings.HasPrefix(key, "to:") {
+			if len(splitRecipients(value)) > 0 {
+				hasRecipients = true
+			}
+		}
+	}
+	if !hasRecipients {
+		return fmt.Errorf("at least one recipient (config.to) is required")
+	}
+
+	for _, key := range []string{"text_template", "html_template"} {
+		if channel.Config[key] == "" {
+			continue
+		}
+		var err error
+		if key == "html_template" {
+			_, err = htmltemplate.New(key).Parse(channel.Config[key])
+		} else {
+			_, err = texttemplate.New(key).Parse(channel.Config[key])
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// parseSMTPSettings reads the SMTP options; the password is the channel secret
+func parseSMTPSettings(channel models.NotificationChannel) (*smtpSettings, error) {
+	settings := &smtpSettings{
+		host:               strings.TrimSpace(channel.Config["host"]),
+		tlsMode:            strings.ToLower(strings.TrimSpace(channel.Config["tls_mode"])),
+		username:           strings.TrimSpace(channel.Config["username"]),
+		password:           channel.Secret,
+		from:               strings.TrimSpace(channel.Config["from"]),
+		insecureSkipVerify: channel.Config["insecure_skip_verify"] == "true",
+	}
+	if settings.host == "" {
+		return nil, fmt.Errorf("SMTP host (config.host) is required")
+	}
+
+	defaultPort := 465
+	switch settings.tlsMode {
+	case "", SMTPTLSModeTLS:
+		settings.tlsMode = SMTPTLSModeTLS
+	case SMTPTLSModeSTARTTLS:
+		defaultPort = 587
+	case SMTPTLSModeNone:
+		defaultPort = 25
+	default:
+		return nil, fmt.Errorf("invalid tls_mode: %s", settings.tlsMode)
+	}
+
+	settings.port = defaultPort
+	if port := strings.TrimSpace(channel.Config["port"]); port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return nil, fmt.Errorf("invalid SMTP port: %s", port)
+		}
+		settings.port = p
+	}
+
+	return settings, nil
+}
+
+// splitRecipients splits a comma or semicolon separated address list
+func splitRecipients(value string) []string {
+	var recipients []string
+	for _, address := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		if address = strings.TrimSpace(address); address != "" {
+			recipients = append(recipients, address)
+		}
+	}
+	return recipients
+}
+
+// emailRecipients returns the recipients of a notification: config "to:<data type>", then
+// "to:<level>", then "to"
+func emailRecipients(channel models.NotificationChannel, notification Notification) []string {
+	if category := notificationCategory(notification); category != "" {
+		if recipients := splitRecipients(channel.Config["to:"+category]); len(recipients) > 0 {
+			return recipients
+		}
+	}
+	if recipients := splitRecipients(channel.Config["to:"+notification.Type.String()]); len(recipients) > 0 {
+		return recipients
+	}
+	return splitRecipients(channel.Config["to"])
+}
+
+// enqueueEmail queues an email delivery
+func (d *ChannelDispatcher) enqueueEmail(channel models.NotificationChannel, notification Notification) {
+	d.queueEmailJob(emailJob{channel: channel, notification: notification, backoff: d.baseBackoff})
+}
+
+// queueEmailJob puts a job on the email queue, starting the queue worker on first use
+func (d *ChannelDispatcher) queueEmailJob(job emailJob) bool {
+	d.emailWorkerOnce.Do(func() {
+		go func() {
+			for job := range d.emailQueue {
+				d.processEmailJob(job)
+			}
+		}()
+	})
+
+	select {
+	case d.emailQueue <- job:
+		return true
+	default:
+		log.Printf("Email queue full, notification %q not sent to %s", job.notification.Title, job.channel.Name)
+		return false
+	}
+}
+
+// processEmailJob makes one delivery attempt; a retry is queued again after the backoff so that
+// the worker keeps sending other emails in the meantime
+func (d *ChannelDispatcher) processEmailJob(job emailJob) {
+	if job.delivery == nil {
+		job.delivery = d.newDelivery(job.channel, job.notification)
+	}
+
+	if d.attempt(job.channel, job.notification, job.delivery) {
+		retry := job
+		retry.backoff = d.nextBackoff(job.backoff)
+		time.AfterFunc(job.backoff, func() {
+			if !d.queueEmailJob(retry) {
+				d.finishDelivery(retry.channel, retry.delivery)
+			}
+		})
+		return
+	}
+
+	d.finishDelivery(job.channel, job.delivery)
+}
+
+// sendEmail renders the notification and sends it through the channel's SMTP server
+func (d *ChannelDispatcher) sendEmail(channel models.NotificationChannel, notification Notification) (int, error) {
+	settings, err := parseSMTPSettings(channel)
+	if err != nil {
+		return 0, &deliveryError{err: err}
+	}
+	recipients := emailRecipients(channel, notification)
+	if len(recipients) == 0 {
+		return 0, &deliveryError{err: fmt.Errorf("no recipients for notification type %s", notification.Type.String())}
+	}
+
+	message, err := buildEmailMessage(channel, settings.from, recipients, notification, d.now())
+	if err != nil {
+		return 0, &deliveryError{err: err}
+	}
+
+	if err := sendSMTP(settings, recipients, message); err != nil {
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) {
+			// 4xx为临时错误，可重试；5xx为永久错误
+			return protoErr.Code, &deliveryError{retryable: protoErr.Code < 500, err: err}
+		}
+		return 0, &deliveryError{retryable: true, err: err}
+	}
+
+	return 250, nil
+}
+
+// sendSMTP delivers a message using implicit TLS, STARTTLS or a plain connection
+func sendSMTP(settings *smtpSettings, recipients []string, message []byte) error {
+	addr := net.JoinHostPort(settings.host, strconv.Itoa(settings.port))
+	tlsConfig := &tls.Config{ServerName: settings.host, InsecureSkipVerify: settings.insecureSkipVerify}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var conn net.Conn
+	var err error
+	if settings.tlsMode == SMTPTLSModeTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, settings.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to create SMTP client: %w", err)
+	}
+	defer client.Close()
+
+	if settings.tlsMode == SMTPTLSModeSTARTTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	if settings.username != "" {
+		auth := smtp.PlainAuth("", settings.username, settings.password, settings.host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	// 信封发件人只使用地址部分
+	envelopeFrom := settings.from
+	if address, err := mail.ParseAddress(settings.from); err == nil {
+		envelopeFrom = address.Address
+	}
+	if err := client.Mail(envelopeFrom); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("failed to add recipient %s: %w", recipient, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message data: %w", err)
+	}
+	if _, err := writer.Write(message); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// buildEmailMessage renders the templates into a multipart/alternative MIME message
+func buildEmailMessage(channel models.NotificationChannel, from string, recipients []string, notification Notification, now time.Time) ([]byte, error) {
+	createdAt := notification.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	data := emailTemplateData{
+		Title:    notification.Title,
+		Message:  notification.Message,
+		Level:    notification.Type.String(),
+		Category: notificationCategory(notification),
+		Time:     createdAt.In(models.ReportingLocation()).Format("2006-01-02 15:04:05"),
+		Color:    emailLevelColors[notification.Type.String()],
+		Data:     notification.Data,
+	}
+
+	textSource := channel.Config["text_template"]
+	if textSource == "" {
+		textSource = defaultEmailTextTemplate
+	}
+	textTmpl, err := texttemplate.New("text").Parse(textSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse text template: %w", err)
+	}
+	var textBody bytes.Buffer
+	if err := textTmpl.Execute(&textBody, data); err != nil {
+		return nil, fmt.Errorf("failed to render text template: %w", err)
+	}
+
+	htmlSource := channel.Config["html_template"]
+	if htmlSource == "" {
+		htmlSource = defaultEmailHTMLTemplate
+	}
+	htmlTmpl, err := htmltemplate.New("html").Parse(htmlSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML template: %w", err)
+	}
+	var htmlBody bytes.Buffer
+	if err := htmlTmpl.Execute(&htmlBody, data); err != nil {
+		return nil, fmt.Errorf("failed to render HTML template: %w", err)
+	}
+
+	subject := notification.Title
+	if prefix := channel.Config["subject_prefix"]; prefix != "" {
+		subject = prefix + " " + subject
+	}
+
+	boundary := randomToken(12)
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+
+	var msg bytes.Buffer
+	writeHeader := func(key, value string) {
+		msg.WriteString(key + ": " + value + "\r\n")
+	}
+	writeHeader("From", from)
+	writeHeader("To", strings.Join(recipients, ", "))
+	writeHeader("Subject", mime.BEncoding.Encode("utf-8", subject))
+	writeHeader("Date", now.Format(time.RFC1123Z))
+	writeHeader("Message-ID", fmt.Sprintf("<%s@%s>", randomToken(16), domain))
+	writeHeader("MIME-Version", "1.0")
+	writeHeader("Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", boundary))
+	msg.WriteString("\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{"text/plain; charset=utf-8", textBody.Bytes()},
+		{"text/html; charset=utf-8", htmlBody.Bytes()},
+	} {
+		msg.WriteString("--" + boundary + "\r\n")
+		writeHeader("Content-Type", part.contentType)
+		writeHeader("Content-Transfer-Encoding", "quoted-printable")
+		msg.WriteString("\r\n")
+		qp := quotedprintable.NewWriter(&msg)
+		if _, err := qp.Write(part.body); err != nil {
+			return nil, fmt.Errorf("failed to encode message body: %w", err)
+		}
+		qp.Close()
+		msg.WriteString("\r\n")
+	}
+	msg.WriteString("--" + boundary + "--\r\n")
+
+	return msg.Bytes(), nil
+}
+
+// randomToken returns n random bytes hex encoded
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"glm-usage-monitor/models"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTPMessage is a message accepted by the fake SMTP server
+type fakeSMTPMessage struct {
+	from       string
+	recipients []string
+	data       []byte
+	receivedAt time.Time
+}
+
+// fakeSMTPServer is a minimal plain-text SMTP server; RCPT commands are answered with the
+// queued reply codes in order, then with 250
+type fakeSMTPServer struct {
+	listener net.Listener
+
+	mu          sync.Mutex
+	rcptCodes   []int
+	connections int
+	messages    []fakeSMTPMessage
+}
+
+func newFakeSMTPServer(t *testing.T, rcptCodes ...int) *fakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := &fakeSMTPServer{listener: listener, rcptCodes: rcptCodes}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+// serve handles one SMTP session
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	s.mu.Lock()
+	s.connections++
+	s.mu.Unlock()
+
+	tp := textproto.NewConn(conn)
+	reply := func(line string) { tp.PrintfLine("%s", line) }
+	reply("220 fake.smtp ESMTP")
+
+	var message fakeSMTPMessage
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		argument := ""
+		if start, end := strings.Index(line, "<"), strings.Index(line, ">"); start >= 0 && end > start {
+			argument = line[start+1 : end]
+		}
+
+		switch command {
+		case "EHLO", "HELO":
+			reply("250-fake.smtp")
+			reply("250 8BITMIME")
+		case "MAIL":
+			message = fakeSMTPMessage{from: argument}
+			reply("250 OK")
+		case "RCPT":
+			code := 250
+			s.mu.Lock()
+			if len(s.rcptCodes) > 0 {
+				code, s.rcptCodes = s.rcptCodes[0], s.rcptCodes[1:]
+			}
+			s.mu.Unlock()
+			if code != 250 {
+				reply(strconv.Itoa(code) + " recipient rejected")
+				continue
+			}
+			message.recipients = append(message.recipients, argument)
+			reply("250 OK")
+		case "DATA":
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.data = data
+			message.receivedAt = time.Now()
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			reply("250 queued")
+		case "RSET", "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// snapshot returns the accepted messages and the number of sessions so far
+func (s *fakeSMTPServer) snapshot() ([]fakeSMTPMessage, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeSMTPMessage(nil), s.messages...), s.connections
+}
+
+// channel returns a plain SMTP channel sending through the fake server
+func (s *fakeSMTPServer) channel(config map[string]string) models.NotificationChannel {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	channelConfig := map[string]string{
+		"host":     "127.0.0.1",
+		"port":     port,
+		"tls_mode": SMTPTLSModeNone,
+		"from":     "GLM Monitor <monitor@example.com>",
+		"to":       "ops@example.com",
+	}
+	for key, value := range config {
+		channelConfig[key] = value
+	}
+	return models.NotificationChannel{ID: 5, Name: "邮件", ChannelType: ChannelTypeSMTP, Config: channelConfig, MaxRetries: 2}
+}
+
+func TestEmailMIMEMessage(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	d := newTestChannelDispatcher(t)
+	channel := server.channel(map[string]string{"subject_prefix": "[GLM]"})
+
+	notification := testWebhookNotification()
+	notification.Message = "本月支出已达到预算的80% <请关注>"
+	delivery := d.Deliver(channel, notification)
+	if delivery.Status != DeliveryStatusSuccess || delivery.StatusCode != 250 {
+		t.Fatalf("expected success, got %+v", delivery)
+	}
+
+	messages, _ := server.snapshot()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	if messages[0].from != "monitor@example.com" {
+		t.Errorf("expected envelope sender monitor@example.com, got %s", messages[0].from)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(messages[0].data)))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "[GLM] 预算提醒" {
+		t.Errorf("unexpected subject %q (%v)", subject, err)
+	}
+	if msg.Header.Get("From") != "GLM Monitor <monitor@example.com>" || msg.Header.Get("To") != "ops@example.com" {
+		t.Errorf("unexpected address headers: %v", msg.Header)
+	}
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>") || msg.Header.Get("Date") == "" {
+		t.Errorf("unexpected Message-ID or Date: %v", msg.Header)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected content type %q (%v)", msg.Header.Get("Content-Type"), err)
+	}
+
+	// multipart.Reader会解码quoted-printable
+	parts := map[string]string{}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		body, _ := io.ReadAll(part)
+		parts[part.Header.Get("Content-Type")] = string(body)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("expected text and HTML parts, got %v", parts)
+	}
+
+	text := parts["text/plain; charset=utf-8"]
+	for _, expected := range []string{"预算提醒", "本月支出已达到预算的80% <请关注>", "级别：warning", "类型：budget_threshold", "时间："} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("text part is missing %q:\n%s", expected, text)
+		}
+	}
+	html := parts["text/html; charset=utf-8"]
+	for _, expected := range []string{"<h2", "#faad14", "&lt;请关注&gt;", "budget_threshold"} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("HTML part is missing %q:\n%s", expected, html)
+		}
+	}
+}
+
+func TestEmailRecipientsPerType(t *testing.T) {
+	config := map[string]string{
+		"to":                   "ops@example.com",
+		"to:warning":           "oncall@example.com; lead@example.com",
+		"to:budget_threshold":  "finance@example.com",
+		"to:quota_usage_alert": "",
+	}
+	cases := []struct {
+		name         string
+		notification Notification
+		expected     []string
+	}{
+		{"data type", testWebhookNotification(), []string{"finance@example.com"}},
+		{"level", Notification{Type: NotificationTypeWarning, Title: "配额提醒",
+			Data: map[string]interface{}{"type": "quota_usage_alert"}}, []string{"oncall@example.com", "lead@example.com"}},
+		{"default", Notification{Type: NotificationTypeError, Title: "同步失败"}, []string{"ops@example.com"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newFakeSMTPServer(t)
+			d := newTestChannelDispatcher(t)
+
+			if delivery := d.Deliver(server.channel(config), tc.notification); delivery.Status != DeliveryStatusSuccess {
+				t.Fatalf("expected success, got %+v", delivery)
+			}
+
+			messages, _ := server.snapshot()
+			if len(messages) != 1 {
+				t.Fatalf("expected 1 message, got %d", len(messages))
+			}
+			if strings.Join(messages[0].recipients, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("expected recipients %v, got %v", tc.expected, messages[0].recipients)
+			}
+			msg, err := mail.ReadMessage(strings.NewReader(string(messages[0].data)))
+			if err != nil {
+				t.Fatalf("failed to parse message: %v", err)
+			}
+			if to := msg.Header.Get("To"); to != strings.Join(tc.expected, ", ") {
+				t.Errorf("unexpected To header: %s", to)
+			}
+		})
+	}
+}
+
+func TestEmailSMTPErrors(t *testing.T) {
+	cases := []struct {
+		name       string
+		rcptCodes  []int
+		attempts   int
+		sessions   int
+		status     string
+		statusCode int
+	}{
+		{"retries 4xx", []int{451}, 2, 2, DeliveryStatusSuccess, 250},
+		{"gives up after max retries", []int{421, 450, 452}, 3, 3, DeliveryStatusFailed, 452},
+		{"fails on 5xx", []int{550}, 1, 1, DeliveryStatusFailed, 550},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newFakeSMTPServer(t, tc.rcptCodes...)
+			d := newTestChannelDispatcher(t)
+
+			delivery := d.Deliver(server.channel(nil), testWebhookNotification())
+			if delivery.Attempts != tc.attempts || delivery.Status != tc.status || delivery.StatusCode != tc.statusCode {
+				t.Errorf("expected %d attempts, %s with %d, got %d attempts, %s with %d: %s", tc.attempts, tc.status,
+					tc.statusCode, delivery.Attempts, delivery.Status, delivery.StatusCode, delivery.ErrorMessage)
+			}
+			// 等待服务端处理完客户端断开
+			time.Sleep(20 * time.Millisecond)
+			if _, sessions := server.snapshot(); sessions != tc.sessions {
+				t.Errorf("expected %d SMTP sessions, got %d", tc.sessions, sessions)
+			}
+		})
+	}
+}
+
+func TestEmailQueueSchedulesRetries(t *testing.T) {
+	retried := newFakeSMTPServer(t, 451)
+	healthy := newFakeSMTPServer(t)
+	d := newTestChannelDispatcher(t)
+	d.baseBackoff = 200 * time.Millisecond
+	d.maxBackoff = time.Second
+
+	retriedChannel := retried.channel(nil)
+	healthyChannel := healthy.channel(nil)
+	healthyChannel.ID = 6
+	d.enqueueEmail(retriedChannel, testWebhookNotification())
+	d.enqueueEmail(healthyChannel, testWebhookNotification())
+
+	var deliveries []models.NotificationDelivery
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var err error
+		if deliveries, err = d.dbService.GetNotificationDeliveries(0, 10); err != nil {
+			t.Fatalf("GetNotificationDeliveries failed: %v", err)
+		}
+		if len(deliveries) == 2 {
+			break
+		}
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("expected 2 delivery rows, got %d", len(deliveries))
+	}
+
+	// 重试在退避期间不占用队列：后入队的邮件先送达
+	retriedMessages, _ := retried.snapshot()
+	healthyMessages, _ := healthy.snapshot()
+	if len(retriedMessages) != 1 || len(healthyMessages) != 1 {
+		t.Fatalf("expected one message per server, got %d and %d", len(retriedMessages), len(healthyMessages))
+	}
+	if !healthyMessages[0].receivedAt.Before(retriedMessages[0].receivedAt) {
+		t.Errorf("expected the queued email to be sent while the retry was waiting")
+	}
+
+	for _, delivery := range deliveries {
+		expectedAttempts := 1
+		if delivery.ChannelID == retriedChannel.ID {
+			expectedAttempts = 2
+		}
+		if delivery.Status != DeliveryStatusSuccess || delivery.Attempts != expectedAttempts {
+			t.Errorf("unexpected delivery of channel %d: %+v", delivery.ChannelID, delivery)
+		}
+	}
+}
@@ -38,9 +38,9 @@ type AppError struct {
 // Error 实现error接口
 func (e *AppError) Error() string {
 	if e.Details != "" {
-		return fmt.Sprintf("[%s] %s: %s - %s", e.Type, e.Code, e.Message, e.Details)
+		return Redact(fmt.Sprintf("[%s] %s: %s - %s", e.Type, e.Code, e.Message, e.Details))
 	}
-	return fmt.Sprintf("[%s] %s: %s", e.Type, e.Code, e.Message)
+	return Redact(fmt.Sprintf("[%s] %s: %s", e.Type, e.Code, e.Message))
 }
 
 // Unwrap 支持错误链
@@ -53,7 +53,7 @@ func NewAppError(errorType ErrorType, code, message string) *AppError {
 	return &AppError{
 		Type:      errorType,
 		Code:      code,
-		Message:   message,
+		Message:   Redact(message),
 		Timestamp: time.Now(),
 		Context:   make(map[string]interface{}),
 	}
@@ -61,7 +61,7 @@ func NewAppError(errorType ErrorType, code, message string) *AppError {
 
 // WithDetails 添加错误详情
 func (e *AppError) WithDetails(details string) *AppError {
-	e.Details = details
+	e.Details = Redact(details)
 	return e
 }
 
@@ -70,7 +70,7 @@ func (e *AppError) WithContext(key string, value interface{}) *AppError {
 	if e.Context == nil {
 		e.Context = make(map[string]interface{})
 	}
-	e.Context[key] = value
+	e.Context[key] = DefaultRedactor().redactField(key, value)
 	return e
 }
 
@@ -157,7 +157,7 @@ func (h *DefaultErrorHandler) logError(err *AppError) {
 	}
 
 	jsonLog, _ := json.Marshal(logData)
-	h.Logger.Printf("%s", string(jsonLog))
+	h.Logger.Printf("%s", Redact(string(jsonLog)))
 }
 
 // IsAppError 检查是否为应用程序错误
@@ -335,11 +335,11 @@ func GetErrorMessage(err error) string {
 	}
 
 	if appErr, ok := err.(*AppError); ok {
-		return appErr.Message
+		return Redact(appErr.Message)
 	}
 
 	// 对于普通错误，返回简化的消息
-	msg := err.Error()
+	msg := Redact(err.Error())
 	if len(msg) > 100 {
 		msg = msg[:100] + "..."
 	}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+	"glm-usage-monitor/models"
+	"strconv"
+	"time"
+)
+
+// heatmapDayLabels are the heatmap row labels, Monday first
+var heatmapDayLabels = []string{"周一", "周二", "周三", "周四", "周五", "周六", "周日"}
+
+// GetUsageHeatmap aggregates a metric (calls, tokens or cost) by day of week and hour of day in the
+// reporting timezone. Dates are inclusive; empty model names, API keys or account IDs mean no filtering.
+func (s *StatisticsService) GetUsageHeatmap(startDate, endDate *time.Time, metric string, modelNames, apiKeys []string, accountIDs []int) (*models.UsageHeatmap, error) {
+	switch metric {
+	case "":
+		metric = models.UsageMetricCalls
+	case models.UsageMetricCalls, models.UsageMetricTokens, models.UsageMetricCost:
+	default:
+		return nil, fmt.Errorf("invalid heatmap metric: %s", metric)
+	}
+
+	filter := models.UsageQueryFilter{ModelNames: modelNames, APIKeys: apiKeys, AccountIDs: accountIDs}
+	loc := models.ReportingLocation()
+	if startDate != nil {
+		start := startOfReportingDay(*startDate, loc)
+		filter.StartTime = &start
+	}
+	if endDate != nil {
+		end := startOfReportingDay(*endDate, loc).AddDate(0, 0, 1)
+		filter.EndTime = &end
+	}
+
+	result, err := s.QueryUsage(&models.UsageQuery{
+		Dimensions: []string{models.UsageDimensionWeekday, models.UsageDimensionHourOfDay},
+		Metrics:    []string{metric},
+		Filter:     filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	heatmap := &models.UsageHeatmap{
+		Metric:   metric,
+		Timezone: models.ReportingTimezone(),
+		Days:     heatmapDayLabels,
+		Hours:    make([]int, 24),
+	}
+	for hour := range heatmap.Hours {
+		heatmap.Hours[hour] = hour
+	}
+
+	for _, row := range result.Rows {
+		weekday, err := strconv.Atoi(row.Dimensions[models.UsageDimensionWeekday])
+		if err != nil || weekday < 0 || weekday > 6 {
+			continue
+		}
+		hour, err := strconv.Atoi(row.Dimensions[models.UsageDimensionHourOfDay])
+		if err != nil || hour < 0 || hour > 23 {
+			continue
+		}
+
+		// SQLite中0为周日，转换为周一在前
+		day := (weekday + 6) % 7
+		value := row.Metrics[metric]
+		heatmap.Values[day][hour] += value
+		heatmap.Total += value
+		if heatmap.Values[day][hour] > heatmap.Max {
+			heatmap.Max = heatmap.Values[day][hour]
+		}
+	}
+
+	return heatmap, nil
+}
+
+// startOfReportingDay returns midnight of t's date in loc
+func startOfReportingDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,444 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"glm-usage-monitor/models"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification channel types
+const (
+	ChannelTypeFeishu   = "feishu"
+	ChannelTypeDingTalk = "dingtalk"
+	ChannelTypeWeCom    = "wecom"
+	ChannelTypeSlack    = "slack"
+	ChannelTypeGeneric  = "generic"
+	ChannelTypeSMTP     = "smtp"
+)
+
+// Delivery statuses
+const (
+	DeliveryStatusSuccess = "success"
+	DeliveryStatusFailed  = "failed"
+)
+
+// notificationRouteAll routes every notification to a channel
+const notificationRouteAll = "*"
+
+// defaultNotificationRoutes are used when a channel is saved without notification types
+var defaultNotificationRoutes = []string{"warning", "error"}
+
+// maxDeliveryResponseLength caps the response body kept in the delivery log
+const maxDeliveryResponseLength = 512
+
+// validateNotificationChannel checks a channel before it is saved
+func validateNotificationChannel(channel *models.NotificationChannel) error {
+	channel.Name = strings.TrimSpace(channel.Name)
+	channel.URL = strings.TrimSpace(channel.URL)
+	if channel.Name == "" {
+		return fmt.Errorf("channel name is required")
+	}
+
+	switch channel.ChannelType {
+	case ChannelTypeFeishu, ChannelTypeDingTalk, ChannelTypeWeCom, ChannelTypeSlack, ChannelTypeGeneric:
+		if !strings.HasPrefix(channel.URL, "http://") && !strings.HasPrefix(channel.URL, "https://") {
+			return fmt.Errorf("webhook URL must start with http:// or https://")
+		}
+	case ChannelTypeSMTP:
+		if err := validateSMTPChannel(channel); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid channel type: %s", channel.ChannelType)
+	}
+
+	if channel.MaxRetries < 0 || channel.MaxRetries > 10 {
+		return fmt.Errorf("max retries must be between 0 and 10")
+	}
+	if len(channel.NotificationTypes) == 0 {
+		channel.NotificationTypes = append([]string(nil), defaultNotificationRoutes...)
+	}
+	if channel.Config == nil {
+		channel.Config = map[string]string{}
+	}
+
+	return nil
+}
+
+// channelAccepts reports whether a notification is routed to the channel, by level or data type
+func channelAccepts(channel models.NotificationChannel, notification Notification) bool {
+	level := notification.Type.String()
+	category := notificationCategory(notification)
+	for _, route := range channel.NotificationTypes {
+		if route == notificationRouteAll || route == level || (category != "" && route == category) {
+			return true
+		}
+	}
+	return false
+}
+
+// notificationChannelColumns are the selected columns of notification_channels, in scan order
+const notificationChannelColumns = `id, name, channel_type, url, secret, COALESCE(config, ''),
+	COALESCE(notification_types, ''), max_retries, enabled, created_at, updated_at`
+
+// scanNotificationChannel scans a channel row, decoding its JSON columns
+func scanNotificationChannel(scanner interface{ Scan(...interface{}) error }) (*models.NotificationChannel, error) {
+	var channel models.NotificationChannel
+	var config, notificationTypes string
+	err := scanner.Scan(&channel.ID, &channel.Name, &channel.ChannelType, &channel.URL, &channel.Secret,
+		&config, &notificationTypes, &channel.MaxRetries, &channel.Enabled, &channel.CreatedAt, &channel.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	DefaultRedactor().AddSecret(channel.Secret)
+
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), &channel.Config); err != nil {
+			return nil, fmt.Errorf("failed to parse config of channel %d: %w", channel.ID, err)
+		}
+	}
+	if notificationTypes != "" {
+		if err := json.Unmarshal([]byte(notificationTypes), &channel.NotificationTypes); err != nil {
+			return nil, fmt.Errorf("failed to parse notification types of channel %d: %w", channel.ID, err)
+		}
+	}
+	if channel.Config == nil {
+		channel.Config = map[string]string{}
+	}
+
+	return &channel, nil
+}
+
+// GetNotificationChannels retrieves all notification channels
+func (s *DatabaseService) GetNotificationChannels() ([]models.NotificationChannel, error) {
+	rows, err := s.db.Query("SELECT " + notificationChannelColumns + " FROM notification_channels ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channels []models.NotificationChannel
+	for rows.Next() {
+		channel, err := scanNotificationChannel(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification channel: %w", err)
+		}
+		channels = append(channels, *channel)
+	}
+
+	return channels, nil
+}
+
+// GetNotificationChannel retrieves a notification channel by ID
+func (s *DatabaseService) GetNotificationChannel(id int) (*models.NotificationChannel, error) {
+	row := s.db.QueryRow("SELECT "+notificationChannelColumns+" FROM notification_channels WHERE id = ?", id)
+	channel, err := scanNotificationChannel(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("notification channel not found: %d", id)
+		}
+		return nil, fmt.Errorf("failed to get notification channel: %w", err)
+	}
+
+	return channel, nil
+}
+
+// SaveNotificationChannel creates a channel or updates an existing one
+func (s *DatabaseService) SaveNotificationChannel(channel *models.NotificationChannel) error {
+	if err := validateNotificationChannel(channel); err != nil {
+		return err
+	}
+
+	config, err := json.Marshal(channel.Config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal channel config: %w", err)
+	}
+	notificationTypes, err := json.Marshal(channel.NotificationTypes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal channel notification types: %w", err)
+	}
+
+	now := time.Now()
+	if channel.ID == 0 {
+		result, err := s.db.Exec(`
+			INSERT INTO notification_channels (name, channel_type, url, secret, config, notification_types,
+			                                   max_retries, enabled, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, channel.Name, channel.ChannelType, channel.URL, channel.Secret, string(config),
+			string(notificationTypes), channel.MaxRetries, channel.Enabled, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to create notification channel: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get notification channel ID: %w", err)
+		}
+		channel.ID = int(id)
+		channel.CreatedAt = now
+		channel.UpdatedAt = now
+		return nil
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE notification_channels
+		SET name = ?, channel_type = ?, url = ?, secret = ?, config = ?, notification_types = ?,
+		    max_retries = ?, enabled = ?, updated_at = ?
+		WHERE id = ?
+	`, channel.Name, channel.ChannelType, channel.URL, channel.Secret, string(config),
+		string(notificationTypes), channel.MaxRetries, channel.Enabled, now, channel.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update notification channel: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("notification channel not found: %d", channel.ID)
+	}
+
+	channel.UpdatedAt = now
+	return nil
+}
+
+// DeleteNotificationChannel deletes a channel; its delivery log is kept
+func (s *DatabaseService) DeleteNotificationChannel(id int) error {
+	result, err := s.db.Exec("DELETE FROM notification_channels WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete notification channel: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("notification channel not found: %d", id)
+	}
+
+	return nil
+}
+
+// SaveNotificationDelivery records a delivery attempt in the delivery log
+func (s *DatabaseService) SaveNotificationDelivery(delivery *models.NotificationDelivery) error {
+	result, err := s.db.Exec(`
+		INSERT INTO notification_deliveries (channel_id, channel_name, notification_type, title, status, attempts,
+		                                     status_code, error_message, response_body, created_at, completed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, delivery.ChannelID, delivery.ChannelName, delivery.NotificationType, delivery.Title, delivery.Status,
+		delivery.Attempts, delivery.StatusCode, delivery.ErrorMessage, delivery.ResponseBody,
+		delivery.CreatedAt, delivery.CompletedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save notification delivery: %w", err)
+	}
+
+	if id, err := result.LastInsertId(); err == nil {
+		delivery.ID = int(id)
+	}
+	return nil
+}
+
+// GetNotificationDeliveries retrieves the delivery log, optionally of one channel (channelID > 0)
+func (s *DatabaseService) GetNotificationDeliveries(channelID, limit int) ([]models.NotificationDelivery, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	whereClause := "1=1"
+	args := []interface{}{}
+	if channelID > 0 {
+		whereClause = "channel_id = ?"
+		args = append(args, channelID)
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT id, channel_id, channel_name, notification_type, title, status, attempts,
+		       COALESCE(status_code, 0), COALESCE(error_message, ''), COALESCE(response_body, ''),
+		       created_at, completed_at
+		FROM notification_deliveries
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, whereClause), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []models.NotificationDelivery{}
+	for rows.Next() {
+		var delivery models.NotificationDelivery
+		var completedAt sql.NullTime
+		err := rows.Scan(&delivery.ID, &delivery.ChannelID, &delivery.ChannelName, &delivery.NotificationType,
+			&delivery.Title, &delivery.Status, &delivery.Attempts, &delivery.StatusCode, &delivery.ErrorMessage,
+			&delivery.ResponseBody, &delivery.CreatedAt, &completedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification delivery: %w", err)
+		}
+		if completedAt.Valid {
+			delivery.CompletedAt = &completedAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+// deliveryError is a failed send; retryable failures are attempted again after a backoff
+type deliveryError struct {
+	retryable bool
+	err       error
+}
+
+func (e *deliveryError) Error() string {
+	return e.err.Error()
+}
+
+// ChannelDispatcher delivers notifications to the configured channels with retry and backoff,
+// recording every delivery in the delivery log
+type ChannelDispatcher struct {
+	dbService   *DatabaseService
+	client      *http.Client
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	now         func() time.Time
+
+	emailQueue      chan emailJob // 邮件按顺序逐封发送
+	emailWorkerOnce sync.Once
+}
+
+// NewChannelDispatcher creates a channel dispatcher
+func NewChannelDispatcher(dbService *DatabaseService) *ChannelDispatcher {
+	return &ChannelDispatcher{
+		dbService:   dbService,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		baseBackoff: 2 * time.Second,
+		maxBackoff:  time.Minute,
+		now:         time.Now,
+		emailQueue:  make(chan emailJob, emailQueueSize),
+	}
+}
+
+// Dispatch sends the notification asynchronously to every enabled channel routing it
+func (d *ChannelDispatcher) Dispatch(notification Notification) {
+	channels, err := d.dbService.GetNotificationChannels()
+	if err != nil {
+		log.Printf("Error loading notification channels: %v", err)
+		return
+	}
+
+	for _, channel := range channels {
+		if !channel.Enabled || !channelAccepts(channel, notification) {
+			continue
+		}
+		if channel.ChannelType == ChannelTypeSMTP {
+			d.enqueueEmail(channel, notification)
+			continue
+		}
+		go d.Deliver(channel, notification)
+	}
+}
+
+// Deliver sends the notification to one channel, retrying with exponential backoff, and
+// records the outcome in the delivery log
+func (d *ChannelDispatcher) Deliver(channel models.NotificationChannel, notification Notification) *models.NotificationDelivery {
+	delivery := d.newDelivery(channel, notification)
+
+	backoff := d.baseBackoff
+	for d.attempt(channel, notification, delivery) {
+		time.Sleep(backoff)
+		backoff = d.nextBackoff(backoff)
+	}
+
+	d.finishDelivery(channel, delivery)
+	return delivery
+}
+
+// newDelivery starts the delivery record of a notification to a channel
+func (d *ChannelDispatcher) newDelivery(channel models.NotificationChannel, notification Notification) *models.NotificationDelivery {
+	return &models.NotificationDelivery{
+		ChannelID:        channel.ID,
+		ChannelName:      channel.Name,
+		NotificationType: notification.Type.String(),
+		Title:            notification.Title,
+		Status:           DeliveryStatusFailed,
+		CreatedAt:        d.now(),
+	}
+}
+
+// attempt makes the next delivery attempt and reports whether it should be retried
+func (d *ChannelDispatcher) attempt(channel models.NotificationChannel, notification Notification, delivery *models.NotificationDelivery) bool {
+	delivery.Attempts++
+
+	err := d.send(channel, notification, delivery)
+	if err == nil {
+		delivery.Status = DeliveryStatusSuccess
+		delivery.ErrorMessage = ""
+		return false
+	}
+
+	delivery.ErrorMessage = err.Error()
+	if de, ok := err.(*deliveryError); ok && !de.retryable {
+		return false
+	}
+	return delivery.Attempts <= channel.MaxRetries
+}
+
+// nextBackoff doubles the retry backoff, capped at the maximum
+func (d *ChannelDispatcher) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > d.maxBackoff {
+		backoff = d.maxBackoff
+	}
+	return backoff
+}
+
+// finishDelivery completes the delivery record and saves it in the delivery log
+func (d *ChannelDispatcher) finishDelivery(channel models.NotificationChannel, delivery *models.NotificationDelivery) {
+	completedAt := d.now()
+	delivery.CompletedAt = &completedAt
+	if delivery.Status == DeliveryStatusFailed {
+		log.Printf("Notification delivery to %s failed after %d attempts: %s", channel.Name, delivery.Attempts, delivery.ErrorMessage)
+	}
+
+	if err := d.dbService.SaveNotificationDelivery(delivery); err != nil {
+		log.Printf("Error recording notification delivery: %v", err)
+	}
+}
+
+// send performs a single delivery attempt through the channel's transport
+func (d *ChannelDispatcher) send(channel models.NotificationChannel, notification Notification, delivery *models.NotificationDelivery) error {
+	switch channel.ChannelType {
+	case ChannelTypeFeishu, ChannelTypeDingTalk, ChannelTypeWeCom, ChannelTypeSlack, ChannelTypeGeneric:
+		statusCode, body, err := d.sendWebhook(channel, notification)
+		delivery.StatusCode = statusCode
+		delivery.ResponseBody = truncateString(body, maxDeliveryResponseLength)
+		return err
+	case ChannelTypeSMTP:
+		statusCode, err := d.sendEmail(channel, notification)
+		delivery.StatusCode = statusCode
+		return err
+	default:
+		return &deliveryError{err: fmt.Errorf("unsupported channel type: %s", channel.ChannelType)}
+	}
+}
+
+// truncateString shortens s to at most n bytes without splitting a UTF-8 character
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && n < len(s) && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
@@ -1,8 +1,10 @@
 package services
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"glm-usage-monitor/models"
 	"log"
 	"sync"
 	"time"
@@ -18,15 +20,33 @@ const (
 	NotificationTypeError
 )
 
+// String returns the routing name of the notification type
+func (t NotificationType) String() string {
+	switch t {
+	case NotificationTypeSuccess:
+		return "success"
+	case NotificationTypeWarning:
+		return "warning"
+	case NotificationTypeError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
 // Notification represents a user notification
 type Notification struct {
-	ID        int              `json:"id"`
-	Type      NotificationType `json:"type"`
-	Title     string           `json:"title"`
-	Message   string           `json:"message"`
-	Data      interface{}      `json:"data,omitempty"`
-	CreatedAt time.Time        `json:"created_at"`
-	ReadAt    *time.Time       `json:"read_at,omitempty"`
+	ID          int              `json:"id"`
+	Type        NotificationType `json:"type"`
+	Category    string           `json:"category"` // 数据中的type，如 budget_threshold
+	Title       string           `json:"title"`
+	Message     string           `json:"message"`
+	Data        interface{}      `json:"data,omitempty"`
+	DedupKey    string           `json:"dedup_key,omitempty"` // 相同去重键的通知合并为一条
+	Occurrences int              `json:"occurrences"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"` // 最近一次出现的时间
+	ReadAt      *time.Time       `json:"read_at,omitempty"`
 }
 
 // WebSocketConnection represents a WebSocket connection
@@ -35,21 +55,36 @@ type WebSocketConnection interface {
 	Close() error
 }
 
+// maxInitialUnreadNotifications caps the unread notifications sent to a newly connected client
+const maxInitialUnreadNotifications = 50
+
+// NotificationTTLConfigKey is the app setting holding the notification retention in days
+const NotificationTTLConfigKey = "notification_ttl_days"
+
+// DefaultNotificationTTLDays is the notification retention used when none is configured
+const DefaultNotificationTTLDays = 30
+
+// NotificationDispatcher forwards notifications to external channels
+type NotificationDispatcher interface {
+	Dispatch(notification Notification)
+}
+
 // NotificationService provides notification management
 type NotificationService struct {
-	notifications    []Notification
-	nextID           int
+	db               *sql.DB
+	storeMutex       sync.Mutex // 保证去重更新与插入的原子性
 	connections      map[string]WebSocketConnection
 	connectionsMutex sync.RWMutex
 	broadcastChannel chan Notification
 	stopBroadcast    chan bool
+	dispatchers      []NotificationDispatcher
+	dispatchersMutex sync.RWMutex
 }
 
-// NewNotificationService creates a new notification service
-func NewNotificationService() *NotificationService {
+// NewNotificationService creates a new notification service storing notifications in SQLite
+func NewNotificationService(db *sql.DB) *NotificationService {
 	ns := &NotificationService{
-		notifications:    make([]Notification, 0),
-		nextID:           1,
+		db:               db,
 		connections:      make(map[string]WebSocketConnection),
 		broadcastChannel: make(chan Notification, 100),
 		stopBroadcast:    make(chan bool),
@@ -63,17 +98,34 @@ func NewNotificationService() *NotificationService {
 
 // AddNotification adds a new notification
 func (ns *NotificationService) AddNotification(notificationType NotificationType, title, message string, data interface{}) {
+	ns.AddNotificationWithKey("", notificationType, title, message, data)
+}
+
+// AddNotificationWithKey adds a notification; a non-empty dedup key updates the existing
+// notification with that key in place and marks it unread again instead of adding another
+func (ns *NotificationService) AddNotificationWithKey(dedupKey string, notificationType NotificationType, title, message string, data interface{}) {
+	// 通知会持久化并转发到外部渠道，写入前先脱敏
+	redactor := DefaultRedactor()
+	title = redactor.Redact(title)
+	message = redactor.Redact(message)
 	notification := Notification{
-		ID:        ns.nextID,
-		Type:      notificationType,
-		Title:     title,
-		Message:   message,
-		Data:      data,
-		CreatedAt: time.Now(),
+		Type:        notificationType,
+		Title:       title,
+		Message:     message,
+		Data:        redactor.RedactValue(data),
+		DedupKey:    dedupKey,
+		Occurrences: 1,
+		CreatedAt:   time.Now().UTC(),
+	}
+	notification.Category = notificationCategory(notification)
+	notification.UpdatedAt = notification.CreatedAt
+
+	// 去重合并到用户尚未读过的通知时不再转发，避免外部渠道重复提醒
+	unseen, err := ns.store(&notification)
+	if err != nil {
+		log.Printf("Error storing notification: %v", err)
+		unseen = true
 	}
-
-	ns.notifications = append(ns.notifications, notification)
-	ns.nextID++
 
 	log.Printf("Notification added: %s - %s", title, message)
 
@@ -83,6 +135,92 @@ func (ns *NotificationService) AddNotification(notificationType NotificationType
 	default:
 		log.Printf("Broadcast channel full, notification not sent to WebSocket clients")
 	}
+
+	if !unseen {
+		return
+	}
+
+	// 转发到外部通知渠道
+	ns.dispatchersMutex.RLock()
+	defer ns.dispatchersMutex.RUnlock()
+	for _, dispatcher := range ns.dispatchers {
+		dispatcher.Dispatch(notification)
+	}
+}
+
+// store persists a notification, merging it into an existing one with the same dedup key. It reports
+// whether the notification is new to the user: inserted, or merged into one the user had already read.
+func (ns *NotificationService) store(notification *Notification) (bool, error) {
+	data, err := json.Marshal(notification.Data)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal notification data: %w", err)
+	}
+
+	ns.storeMutex.Lock()
+	defer ns.storeMutex.Unlock()
+
+	if notification.DedupKey != "" {
+		var wasRead bool
+		err := ns.db.QueryRow("SELECT read_at IS NOT NULL FROM notifications WHERE dedup_key = ?",
+			notification.DedupKey).Scan(&wasRead)
+		if err != nil && err != sql.ErrNoRows {
+			return false, fmt.Errorf("failed to query notification: %w", err)
+		}
+
+		result, err := ns.db.Exec(`
+			UPDATE notifications
+			SET type = ?, category = ?, title = ?, message = ?, data = ?, occurrences = occurrences + 1,
+			    updated_at = ?, read_at = NULL
+			WHERE dedup_key = ?
+		`, notification.Type, notification.Category, notification.Title, notification.Message, string(data),
+			notification.UpdatedAt, notification.DedupKey)
+		if err != nil {
+			return false, fmt.Errorf("failed to update notification: %w", err)
+		}
+
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+			err := ns.db.QueryRow("SELECT id, occurrences, created_at FROM notifications WHERE dedup_key = ?",
+				notification.DedupKey).Scan(&notification.ID, &notification.Occurrences, &notification.CreatedAt)
+			return wasRead, err
+		}
+	}
+
+	var dedupKey interface{}
+	if notification.DedupKey != "" {
+		dedupKey = notification.DedupKey
+	}
+	result, err := ns.db.Exec(`
+		INSERT INTO notifications (type, category, title, message, data, dedup_key, occurrences, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?)
+	`, notification.Type, notification.Category, notification.Title, notification.Message, string(data),
+		dedupKey, notification.CreatedAt, notification.UpdatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert notification: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return false, fmt.Errorf("failed to get notification ID: %w", err)
+	}
+	notification.ID = int(id)
+	return true, nil
+}
+
+// AddDispatcher registers a dispatcher that receives every new notification
+func (ns *NotificationService) AddDispatcher(dispatcher NotificationDispatcher) {
+	ns.dispatchersMutex.Lock()
+	defer ns.dispatchersMutex.Unlock()
+	ns.dispatchers = append(ns.dispatchers, dispatcher)
+}
+
+// notificationCategory returns the "type" entry of a notification's data, if any
+func notificationCategory(notification Notification) string {
+	if data, ok := notification.Data.(map[string]interface{}); ok {
+		if category, ok := data["type"].(string); ok {
+			return category
+		}
+	}
+	return ""
 }
 
 // AddSyncSuccessNotification adds a sync success notification
@@ -97,7 +235,7 @@ func (ns *NotificationService) AddSyncSuccessNotification(billingMonth string, s
 		"type":          "sync_success",
 	}
 
-	ns.AddNotification(NotificationTypeSuccess, title, message, data)
+	ns.AddNotificationWithKey("sync:"+billingMonth, NotificationTypeSuccess, title, message, data)
 }
 
 // AddSyncFailureNotification adds a sync failure notification
@@ -111,7 +249,8 @@ func (ns *NotificationService) AddSyncFailureNotification(billingMonth string, e
 		"type":          "sync_failure",
 	}
 
-	ns.AddNotification(NotificationTypeError, title, message, data)
+	// 失败使用单独的去重键，成功后的失败不会被合并掉
+	ns.AddNotificationWithKey("sync:"+billingMonth+":failure", NotificationTypeError, title, message, data)
 }
 
 // AddTokenExpiredNotification adds a token expired notification
@@ -124,78 +263,397 @@ func (ns *NotificationService) AddTokenExpiredNotification(tokenName string) {
 		"type":       "token_expired",
 	}
 
-	ns.AddNotification(NotificationTypeWarning, title, message, data)
+	ns.AddNotificationWithKey("token_expired:"+tokenName, NotificationTypeWarning, title, message, data)
 }
 
-// GetUnreadNotifications retrieves all unread notifications
-func (ns *NotificationService) GetUnreadNotifications() []Notification {
-	var unread []Notification
-	for _, notification := range ns.notifications {
-		if notification.ReadAt == nil {
-			unread = append(unread, notification)
+// AddTokenExpiringNotification adds a warning that an API token expires soon
+func (ns *NotificationService) AddTokenExpiringNotification(token *models.APIToken, daysRemaining, threshold int) {
+	title := "令牌即将过期"
+	message := fmt.Sprintf("API令牌 %s 将于 %s 过期（剩余 %d 天），请及时更新令牌", token.TokenName,
+		token.ExpiresAt.In(models.ReportingLocation()).Format("2006-01-02 15:04"), daysRemaining)
+
+	data := map[string]interface{}{
+		"token_id":       token.ID,
+		"token_name":     token.TokenName,
+		"expires_at":     token.ExpiresAt,
+		"days_remaining": daysRemaining,
+		"threshold":      threshold,
+		"type":           "token_expiring",
+	}
+
+	// 每个提醒阈值单独去重，14/3/1 天的提醒都会转发
+	dedupKey := fmt.Sprintf("token_expiring:%d:%d", token.ID, threshold)
+	ns.AddNotificationWithKey(dedupKey, NotificationTypeWarning, title, message, data)
+}
+
+// AddTokenRevokedNotification adds an error when the billing API rejects the API token
+func (ns *NotificationService) AddTokenRevokedNotification(tokenName, errorMessage string) {
+	title := "令牌已失效"
+	message := fmt.Sprintf("API令牌 %s 被拒绝访问，可能已被撤销，请更新该账号的令牌", tokenName)
+
+	data := map[string]interface{}{
+		"token_name":    tokenName,
+		"error_message": errorMessage,
+		"type":          "token_revoked",
+	}
+
+	ns.AddNotificationWithKey("token_revoked:"+tokenName, NotificationTypeError, title, message, data)
+}
+
+// AddUsageAnomalyNotification adds a usage anomaly warning naming the top model and API key
+func (ns *NotificationService) AddUsageAnomalyNotification(anomaly *models.UsageAnomaly) {
+	metricNames := map[string]string{
+		"calls": "调用次数",
+		"cost":  "费用",
+	}
+	metricName := metricNames[anomaly.Metric]
+	if metricName == "" {
+		metricName = anomaly.Metric
+	}
+
+	title := "用量异常"
+	message := fmt.Sprintf("%s %s 异常：%.2f（基线 %.2f），主要来自模型 %s / API Key %s",
+		anomaly.HourStart.In(models.ReportingLocation()).Format("2006-01-02 15:00"), metricName, anomaly.Value, anomaly.Baseline,
+		anomaly.TopModel, anomaly.TopAPIKey)
+
+	data := map[string]interface{}{
+		"anomaly_id":  anomaly.ID,
+		"hour_start":  anomaly.HourStart,
+		"metric":      anomaly.Metric,
+		"value":       anomaly.Value,
+		"baseline":    anomaly.Baseline,
+		"score":       anomaly.Score,
+		"top_model":   anomaly.TopModel,
+		"top_api_key": anomaly.TopAPIKey,
+		"type":        "usage_anomaly",
+	}
+
+	// 同一小时同一指标只保留一条通知
+	dedupKey := fmt.Sprintf("anomaly:%s:%s", anomaly.HourStart.UTC().Format(anomalyHourFormat), anomaly.Metric)
+	ns.AddNotificationWithKey(dedupKey, NotificationTypeWarning, title, message, data)
+}
+
+// AddQuotaNotification adds a warning when rolling-window quota usage crosses 80% or 100%
+func (ns *NotificationService) AddQuotaNotification(status *models.QuotaStatus) {
+	title := "额度即将用尽"
+	notificationType := NotificationTypeWarning
+	if status.Level == QuotaLevelExceeded {
+		title = "额度已用尽"
+		notificationType = NotificationTypeError
+	}
+
+	message := fmt.Sprintf("%s（%s）最近 %d 小时已使用 %d/%d 次（%.0f%%）",
+		status.AccountName, status.TierName, status.PeriodHours, status.Used, status.CallLimit, status.Percentage)
+	if status.OldestExpiresAt != nil {
+		message += fmt.Sprintf("，最早的用量将于 %s 释放", status.OldestExpiresAt.In(models.ReportingLocation()).Format("15:04"))
+	}
+
+	data := map[string]interface{}{
+		"account_id":   status.AccountID,
+		"tier":         status.Tier,
+		"level":        status.Level,
+		"used":         status.Used,
+		"call_limit":   status.CallLimit,
+		"period_hours": status.PeriodHours,
+		"percentage":   status.Percentage,
+		"type":         "quota_" + status.Level,
+	}
+
+	dedupKey := fmt.Sprintf("quota:%d:%s:%s", status.AccountID, status.Tier, status.Level)
+	ns.AddNotificationWithKey(dedupKey, notificationType, title, message, data)
+}
+
+// AddBudgetNotification adds a notification when a budget crosses one of its thresholds
+func (ns *NotificationService) AddBudgetNotification(status *models.BudgetStatus, threshold float64) {
+	title := "预算提醒"
+	notificationType := NotificationTypeWarning
+	if threshold >= 100 {
+		title = "预算已超支"
+		notificationType = NotificationTypeError
+	}
+
+	message := fmt.Sprintf("%s（%s）已使用 ¥%.2f / ¥%.2f（%.0f%%），达到 %.0f%% 阈值",
+		status.Budget.Name, status.PeriodKey, status.Spent, status.Budget.Amount, status.Percentage, threshold)
+
+	data := map[string]interface{}{
+		"budget_id":   status.Budget.ID,
+		"scope_type":  status.Budget.ScopeType,
+		"scope_value": status.Budget.ScopeValue,
+		"period":      status.Budget.Period,
+		"period_key":  status.PeriodKey,
+		"threshold":   threshold,
+		"spent":       status.Spent,
+		"amount":      status.Budget.Amount,
+		"percentage":  status.Percentage,
+		"type":        "budget_threshold",
+	}
+
+	dedupKey := fmt.Sprintf("budget:%d:%s:%.0f", status.Budget.ID, status.PeriodKey, threshold)
+	ns.AddNotificationWithKey(dedupKey, notificationType, title, message, data)
+}
+
+// AddAlertNotification adds a notification for an alert rule firing or resolving
+func (ns *NotificationService) AddAlertNotification(event *models.AlertEvent) {
+	title := "告警：" + event.RuleName
+	notificationType := NotificationTypeWarning
+	switch {
+	case event.EventType == AlertEventResolved:
+		title = "告警恢复：" + event.RuleName
+		notificationType = NotificationTypeSuccess
+	case event.Severity == AlertSeverityCritical:
+		notificationType = NotificationTypeError
+	case event.Severity == AlertSeverityInfo:
+		notificationType = NotificationTypeInfo
+	}
+
+	data := map[string]interface{}{
+		"rule_id":    event.RuleID,
+		"event_id":   event.ID,
+		"event_type": event.EventType,
+		"severity":   event.Severity,
+		"value":      event.Value,
+		"threshold":  event.Threshold,
+		"type":       "alert_" + event.EventType,
+	}
+
+	dedupKey := fmt.Sprintf("alert:%d:%s", event.RuleID, event.EventType)
+	ns.AddNotificationWithKey(dedupKey, notificationType, title, event.Message, data)
+}
+
+// AddDigestNotification adds an info notification carrying a generated usage digest
+func (ns *NotificationService) AddDigestNotification(digest *models.UsageDigest) {
+	data := map[string]interface{}{
+		"digest_id":   digest.ID,
+		"schedule_id": digest.ScheduleID,
+		"kind":        digest.Kind,
+		"timezone":    digest.Timezone,
+		"periods":     digest.Periods,
+		"budgets":     digest.Budgets,
+		"sync_health": digest.SyncHealth,
+		"type":        "usage_digest",
+	}
+
+	ns.AddNotification(NotificationTypeInfo, digest.Title, digest.Summary, data)
+}
+
+// notificationColumns are the selected columns of notifications, in scanNotification order
+const notificationColumns = `id, type, category, title, message, COALESCE(data, ''), COALESCE(dedup_key, ''),
+	occurrences, created_at, updated_at, read_at`
+
+// scanNotification scans a notification row, decoding its JSON data
+func scanNotification(rows *sql.Rows) (*Notification, error) {
+	var notification Notification
+	var data string
+	var readAt sql.NullTime
+	err := rows.Scan(&notification.ID, &notification.Type, &notification.Category, &notification.Title,
+		&notification.Message, &data, &notification.DedupKey, &notification.Occurrences,
+		&notification.CreatedAt, &notification.UpdatedAt, &readAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan notification: %w", err)
+	}
+
+	if data != "" {
+		if err := json.Unmarshal([]byte(data), &notification.Data); err != nil {
+			log.Printf("Failed to parse data of notification %d: %v", notification.ID, err)
 		}
 	}
-	return unread
+	if readAt.Valid {
+		notification.ReadAt = &readAt.Time
+	}
+
+	return &notification, nil
 }
 
-// MarkAsRead marks notifications as read
-func (ns *NotificationService) MarkAsRead(notificationID int) {
-	for i, notification := range ns.notifications {
-		if notification.ID == notificationID {
-			ns.notifications[i].ReadAt = &[]time.Time{time.Now()}[0]
-			log.Printf("Notification %d marked as read", notificationID)
-			break
+// listNotifications retrieves notifications matching the WHERE clause, newest first
+func (ns *NotificationService) listNotifications(whereClause string, args []interface{}, limit, offset int) ([]Notification, error) {
+	query := "SELECT " + notificationColumns + " FROM notifications WHERE " + whereClause +
+		" ORDER BY datetime(updated_at) DESC, id DESC"
+	if limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
+	}
+
+	rows, err := ns.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
 		}
+		notifications = append(notifications, *notification)
+	}
+
+	return notifications, nil
+}
+
+// notificationFilterWhere builds the WHERE clause of a notification filter
+func notificationFilterWhere(filter *models.NotificationFilter) (string, []interface{}) {
+	whereClause := "1=1"
+	args := []interface{}{}
+
+	if filter.Type != nil {
+		whereClause += " AND type = ?"
+		args = append(args, *filter.Type)
+	}
+	if filter.Category != "" {
+		whereClause += " AND category = ?"
+		args = append(args, filter.Category)
 	}
+	if filter.UnreadOnly {
+		whereClause += " AND read_at IS NULL"
+	}
+	if filter.StartTime != nil {
+		whereClause += " AND datetime(updated_at) >= datetime(?)"
+		args = append(args, filter.StartTime.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if filter.EndTime != nil {
+		whereClause += " AND datetime(updated_at) < datetime(?)"
+		args = append(args, filter.EndTime.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if filter.SearchTerm != "" {
+		whereClause += " AND (title LIKE ? OR message LIKE ?)"
+		term := "%" + filter.SearchTerm + "%"
+		args = append(args, term, term)
+	}
+
+	return whereClause, args
+}
+
+// QueryNotifications retrieves a page of notifications matching the filter
+func (ns *NotificationService) QueryNotifications(filter *models.NotificationFilter) (*models.PaginatedResult, error) {
+	if filter.PageNum < 1 {
+		filter.PageNum = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = 20
+	}
+
+	whereClause, args := notificationFilterWhere(filter)
+
+	var total int
+	if err := ns.db.QueryRow("SELECT COUNT(*) FROM notifications WHERE "+whereClause, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count notifications: %w", err)
+	}
+
+	notifications, err := ns.listNotifications(whereClause, args, filter.PageSize, (filter.PageNum-1)*filter.PageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	totalPages := (total + filter.PageSize - 1) / filter.PageSize
+	return &models.PaginatedResult{
+		Data: notifications,
+		Pagination: models.PaginationParams{
+			Page:    filter.PageNum,
+			Size:    filter.PageSize,
+			Total:   total,
+			HasNext: filter.PageNum < totalPages,
+		},
+		Total: total,
+	}, nil
+}
+
+// GetUnreadNotifications retrieves all unread notifications
+func (ns *NotificationService) GetUnreadNotifications() ([]Notification, error) {
+	return ns.listNotifications("read_at IS NULL", nil, 0, 0)
+}
+
+// MarkAsRead marks a notification as read
+func (ns *NotificationService) MarkAsRead(notificationID int) error {
+	result, err := ns.db.Exec("UPDATE notifications SET read_at = ? WHERE id = ? AND read_at IS NULL",
+		time.Now().UTC(), notificationID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected > 0 {
+		log.Printf("Notification %d marked as read", notificationID)
+	}
+	return nil
 }
 
 // MarkAllAsRead marks all notifications as read
-func (ns *NotificationService) MarkAllAsRead() {
-	now := time.Now()
-	for i := range ns.notifications {
-		if ns.notifications[i].ReadAt == nil {
-			ns.notifications[i].ReadAt = &now
-		}
+func (ns *NotificationService) MarkAllAsRead() error {
+	if _, err := ns.db.Exec("UPDATE notifications SET read_at = ? WHERE read_at IS NULL", time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to mark notifications as read: %w", err)
 	}
 	log.Println("All notifications marked as read")
+	return nil
+}
+
+// DeleteNotification deletes a notification
+func (ns *NotificationService) DeleteNotification(notificationID int) error {
+	if _, err := ns.db.Exec("DELETE FROM notifications WHERE id = ?", notificationID); err != nil {
+		return fmt.Errorf("failed to delete notification: %w", err)
+	}
+	return nil
 }
 
 // ClearNotifications clears all notifications
-func (ns *NotificationService) ClearNotifications() {
-	ns.notifications = make([]Notification, 0)
-	ns.nextID = 1
+func (ns *NotificationService) ClearNotifications() error {
+	if _, err := ns.db.Exec("DELETE FROM notifications"); err != nil {
+		return fmt.Errorf("failed to clear notifications: %w", err)
+	}
 	log.Println("All notifications cleared")
+	return nil
+}
+
+// CleanupExpired deletes notifications whose last occurrence is older than ttlDays
+func (ns *NotificationService) CleanupExpired(ttlDays int) (int64, error) {
+	if ttlDays <= 0 {
+		return 0, nil
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -ttlDays).Format("2006-01-02 15:04:05")
+	result, err := ns.db.Exec("DELETE FROM notifications WHERE datetime(updated_at) < datetime(?)", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clean up notifications: %w", err)
+	}
+
+	deleted, _ := result.RowsAffected()
+	if deleted > 0 {
+		log.Printf("Cleaned up %d notifications older than %d days", deleted, ttlDays)
+	}
+	return deleted, nil
 }
 
 // GetNotificationCount returns the count of unread notifications
-func (ns *NotificationService) GetNotificationCount() int {
-	count := 0
-	for _, notification := range ns.notifications {
-		if notification.ReadAt == nil {
-			count++
-		}
+func (ns *NotificationService) GetNotificationCount() (int, error) {
+	var count int
+	if err := ns.db.QueryRow("SELECT COUNT(*) FROM notifications WHERE read_at IS NULL").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
 	}
-	return count
+	return count, nil
 }
 
 // GetRecentNotifications returns recent notifications with limit
-func (ns *NotificationService) GetRecentNotifications(limit int) []Notification {
-	if limit <= 0 || limit > len(ns.notifications) {
-		limit = len(ns.notifications)
-	}
+func (ns *NotificationService) GetRecentNotifications(limit int) ([]Notification, error) {
+	return ns.listNotifications("1=1", nil, limit, 0)
+}
 
-	// Return the most recent notifications (in reverse order)
-	recent := make([]Notification, limit)
-	total := len(ns.notifications)
+// GetNotificationsByType returns notifications filtered by type
+func (ns *NotificationService) GetNotificationsByType(notificationType NotificationType) ([]Notification, error) {
+	return ns.listNotifications("type = ?", []interface{}{notificationType}, 0, 0)
+}
 
-	for i := 0; i < limit; i++ {
-		index := total - 1 - i
-		if index >= 0 {
-			recent[i] = ns.notifications[index]
-		}
-	}
+// GetNotificationsByDateRange returns notifications within a date range
+func (ns *NotificationService) GetNotificationsByDateRange(start, end time.Time) ([]Notification, error) {
+	whereClause, args := notificationFilterWhere(&models.NotificationFilter{StartTime: &start, EndTime: &end})
+	return ns.listNotifications(whereClause, args, 0, 0)
+}
 
-	return recent
+// ExportNotifications exports notifications as JSON
+func (ns *NotificationService) ExportNotifications() ([]byte, error) {
+	notifications, err := ns.listNotifications("1=1", nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(notifications, "", "  ")
 }
 
 // RegisterConnection registers a WebSocket connection
@@ -207,7 +665,10 @@ func (ns *NotificationService) RegisterConnection(clientID string, conn WebSocke
 	log.Printf("WebSocket connection registered: %s", clientID)
 
 	// Send unread notifications to new connection
-	unreadNotifications := ns.GetUnreadNotifications()
+	unreadNotifications, err := ns.listNotifications("read_at IS NULL", nil, maxInitialUnreadNotifications, 0)
+	if err != nil {
+		log.Printf("Failed to load unread notifications for client %s: %v", clientID, err)
+	}
 	for _, notification := range unreadNotifications {
 		if err := conn.WriteJSON(notification); err != nil {
 			log.Printf("Failed to send notification to client %s: %v", clientID, err)
@@ -338,7 +799,7 @@ func (ns *NotificationService) AddSyncProgressNotification(billingMonth string,
 		"type":          "sync_progress",
 	}
 
-	ns.AddNotification(NotificationTypeInfo, title, message, data)
+	ns.AddNotificationWithKey("sync:"+billingMonth, NotificationTypeInfo, title, message, data)
 }
 
 // AddSystemNotification adds a system-level notification
@@ -349,30 +810,3 @@ func (ns *NotificationService) AddSystemNotification(title, message string, noti
 
 	ns.AddNotification(notificationType, title, message, data)
 }
-
-// ExportNotifications exports notifications as JSON
-func (ns *NotificationService) ExportNotifications() ([]byte, error) {
-	return json.MarshalIndent(ns.notifications, "", "  ")
-}
-
-// GetNotificationsByType returns notifications filtered by type
-func (ns *NotificationService) GetNotificationsByType(notificationType NotificationType) []Notification {
-	var filtered []Notification
-	for _, notification := range ns.notifications {
-		if notification.Type == notificationType {
-			filtered = append(filtered, notification)
-		}
-	}
-	return filtered
-}
-
-// GetNotificationsByDateRange returns notifications within a date range
-func (ns *NotificationService) GetNotificationsByDateRange(start, end time.Time) []Notification {
-	var filtered []Notification
-	for _, notification := range ns.notifications {
-		if notification.CreatedAt.After(start) && notification.CreatedAt.Before(end) {
-			filtered = append(filtered, notification)
-		}
-	}
-	return filtered
-}
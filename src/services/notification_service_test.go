@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"glm-usage-monitor/models"
+)
+
+func TestDedupedNotificationIsDispatchedOnlyWhenUnseen(t *testing.T) {
+	ns := newTestNotificationService(t)
+	dispatcher := &capturingDispatcher{}
+	ns.AddDispatcher(dispatcher)
+
+	ns.AddNotificationWithKey("quota:1:lite", NotificationTypeWarning, "额度即将用尽", "80%", nil)
+	ns.AddNotificationWithKey("quota:1:lite", NotificationTypeWarning, "额度即将用尽", "85%", nil)
+	if len(dispatcher.notifications) != 1 {
+		t.Fatalf("expected the unread duplicate not to be dispatched, got %d dispatches", len(dispatcher.notifications))
+	}
+
+	var id, occurrences int
+	if err := ns.db.QueryRow("SELECT id, occurrences FROM notifications").Scan(&id, &occurrences); err != nil {
+		t.Fatalf("failed to read notification: %v", err)
+	}
+	if occurrences != 2 {
+		t.Errorf("expected 2 occurrences, got %d", occurrences)
+	}
+
+	// 用户已读后再次出现时重新转发
+	if err := ns.MarkAsRead(id); err != nil {
+		t.Fatalf("MarkAsRead failed: %v", err)
+	}
+	ns.AddNotificationWithKey("quota:1:lite", NotificationTypeWarning, "额度即将用尽", "90%", nil)
+	if len(dispatcher.notifications) != 2 {
+		t.Fatalf("expected the read notification to be dispatched again, got %d dispatches", len(dispatcher.notifications))
+	}
+
+	ns.AddNotificationWithKey("", NotificationTypeInfo, "同步完成", "ok", nil)
+	ns.AddNotificationWithKey("", NotificationTypeInfo, "同步完成", "ok", nil)
+	if len(dispatcher.notifications) != 4 {
+		t.Errorf("expected notifications without dedup key to always be dispatched, got %d dispatches", len(dispatcher.notifications))
+	}
+}
+
+func TestEscalatedNotificationIsDispatchedWhileUnread(t *testing.T) {
+	ns := newTestNotificationService(t)
+	dispatcher := &capturingDispatcher{}
+	ns.AddDispatcher(dispatcher)
+
+	budget := &models.BudgetStatus{Budget: models.Budget{ID: 1, Name: "月度预算", Amount: 100}, PeriodKey: "2024-01"}
+	budget.Spent, budget.Percentage = 80, 80
+	ns.AddBudgetNotification(budget, 80)
+	budget.Spent, budget.Percentage = 100, 100
+	ns.AddBudgetNotification(budget, 100)
+
+	quota := &models.QuotaStatus{AccountID: 1, Tier: "lite", Level: QuotaLevelWarning}
+	ns.AddQuotaNotification(quota)
+	quota.Level = QuotaLevelExceeded
+	ns.AddQuotaNotification(quota)
+
+	ns.AddAlertNotification(&models.AlertEvent{RuleID: 1, RuleName: "费用", EventType: AlertEventFiring})
+	ns.AddAlertNotification(&models.AlertEvent{RuleID: 1, RuleName: "费用", EventType: AlertEventResolved})
+
+	ns.AddSyncSuccessNotification("2024-01", 10, 10)
+	ns.AddSyncFailureNotification("2024-01", "timeout")
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	token := &models.APIToken{ID: 1, TokenName: "main", ExpiresAt: &expiresAt}
+	for _, days := range []int{14, 3, 1} {
+		ns.AddTokenExpiringNotification(token, days, days)
+	}
+
+	// 升级的通知在前一条未读时也必须转发
+	if len(dispatcher.notifications) != 11 {
+		t.Fatalf("expected every escalation to be dispatched, got %d dispatches", len(dispatcher.notifications))
+	}
+	last := dispatcher.notifications[len(dispatcher.notifications)-1]
+	if last.Type != NotificationTypeWarning || last.DedupKey != "token_expiring:1:1" {
+		t.Errorf("unexpected last dispatch %+v", last)
+	}
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"glm-usage-monitor/models"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCostAbsTolerance = 0.01 // 元
+	defaultCostRelTolerance = 0.01 // 1%
+)
+
+// validateModelPrice checks a price catalogue entry before it is saved
+func validateModelPrice(price *models.ModelPrice) error {
+	price.ModelCode = strings.TrimSpace(price.ModelCode)
+	price.ContextBand = strings.TrimSpace(price.ContextBand)
+	price.TokenType = strings.ToLower(strings.TrimSpace(price.TokenType))
+
+	if price.ModelCode == "" {
+		return fmt.Errorf("model code is required")
+	}
+	if strings.TrimSpace(price.Unit) == "" {
+		return fmt.Errorf("unit is required")
+	}
+	if price.Price < 0 {
+		return fmt.Errorf("price cannot be negative")
+	}
+	if price.TokenType != "" && price.TokenType != string(models.TokenDirectionInput) && price.TokenType != string(models.TokenDirectionOutput) {
+		return fmt.Errorf("invalid token type: %s. Valid types are: input, output", price.TokenType)
+	}
+	if _, err := time.Parse("2006-01-02", price.EffectiveFrom); err != nil {
+		return fmt.Errorf("invalid effective date %s, expected YYYY-MM-DD", price.EffectiveFrom)
+	}
+
+	return nil
+}
+
+// ========== ModelPrice Operations ==========
+
+// GetModelPrices retrieves the price catalogue ordered by model and effective date
+func (s *DatabaseService) GetModelPrices() ([]models.ModelPrice, error) {
+	return queryModelPrices(s.db)
+}
+
+// queryModelPrices loads the price catalogue ordered by model and effective date
+func queryModelPrices(db *sql.DB) ([]models.ModelPrice, error) {
+	rows, err := db.Query(`
+		SELECT id, model_code, context_band, token_type, unit, price,
+		       strftime('%Y-%m-%d', effective_from), COALESCE(description, ''), updated_at
+		FROM model_prices
+		ORDER BY model_code, context_band, token_type, effective_from DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query model prices: %w", err)
+	}
+	defer rows.Close()
+
+	var prices []models.ModelPrice
+	for rows.Next() {
+		var price models.ModelPrice
+		err := rows.Scan(&price.ID, &price.ModelCode, &price.ContextBand, &price.TokenType, &price.Unit,
+			&price.Price, &price.EffectiveFrom, &price.Description, &price.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan model price: %w", err)
+		}
+		prices = append(prices, price)
+	}
+
+	return prices, nil
+}
+
+// SaveModelPrice creates a price when its ID is zero, otherwise updates it
+func (s *DatabaseService) SaveModelPrice(price *models.ModelPrice) error {
+	if err := validateModelPrice(price); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if price.ID == 0 {
+		result, err := s.db.Exec(`
+			INSERT INTO model_prices (model_code, context_band, token_type, unit, price, effective_from, description, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, price.ModelCode, price.ContextBand, price.TokenType, price.Unit, price.Price,
+			price.EffectiveFrom, price.Description, now)
+		if err != nil {
+			return fmt.Errorf("failed to create model price: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get model price ID: %w", err)
+		}
+		price.ID = int(id)
+		price.UpdatedAt = now
+		return nil
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE model_prices
+		SET model_code = ?, context_band = ?, token_type = ?, unit = ?, price = ?,
+		    effective_from = ?, description = ?, updated_at = ?
+		WHERE id = ?
+	`, price.ModelCode, price.ContextBand, price.TokenType, price.Unit, price.Price,
+		price.EffectiveFrom, price.Description, now, price.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update model price: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("model price not found: %d", price.ID)
+	}
+
+	price.UpdatedAt = now
+	return nil
+}
+
+// DeleteModelPrice deletes a price from the catalogue
+func (s *DatabaseService) DeleteModelPrice(id int) error {
+	result, err := s.db.Exec("DELETE FROM model_prices WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete model price: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("model price not found: %d", id)
+	}
+
+	return nil
+}
+
+// ========== Billed Cost Verification ==========
+
+// pricedBill holds the bill fields needed to recompute its cost
+type pricedBill struct {
+	ID, BillingNo                         string
+	TransactionTime                       time.Time
+	ModelCode, ProductCode, ModelName     string
+	ChargeName, ProductSubtype, TokenType string
+	UsageCount, ChargeCount               float64
+	UsageUnit, ChargeUnitSymbol           string
+	DiscountRate, CashCost, GiftDeduct    float64
+}
+
+// findModelPrice picks the catalogue price for a bill: the code must match the bill's model code,
+// product code or model name, the price must be effective on the bill date, and the most specific
+// context band / token type wins, then the latest effective date
+func findModelPrice(prices []models.ModelPrice, bill *pricedBill, billDate string) *models.ModelPrice {
+	codes := []string{strings.ToLower(bill.ModelCode), strings.ToLower(bill.ProductCode), strings.ToLower(bill.ModelName)}
+	direction := string(models.ParseTokenDirection(bill.TokenType, bill.ChargeName))
+	bandSource := strings.ToLower(bill.ChargeName + " " + bill.ProductSubtype)
+
+	var best *models.ModelPrice
+	bestScore := -1
+	for i := range prices {
+		price := &prices[i]
+		if price.EffectiveFrom > billDate {
+			continue
+		}
+
+		code := strings.ToLower(price.ModelCode)
+		matched := false
+		for _, c := range codes {
+			if c != "" && c == code {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		score := 0
+		if price.TokenType != "" {
+			if price.TokenType != direction {
+				continue
+			}
+			score++
+		}
+		if price.ContextBand != "" {
+			if !strings.Contains(bandSource, strings.ToLower(price.ContextBand)) {
+				continue
+			}
+			score += 2
+		}
+
+		if score > bestScore || (score == bestScore && price.EffectiveFrom > best.EffectiveFrom) {
+			best = price
+			bestScore = score
+		}
+	}
+
+	return best
+}
+
+// normalizeDiscountRate converts a discount rate into the paid fraction: 0 means no discount
+// and values above 1 are treated as percentages
+func normalizeDiscountRate(rate float64) float64 {
+	switch {
+	case rate <= 0:
+		return 1
+	case rate > 1 && rate <= 100:
+		return rate / 100
+	default:
+		return rate
+	}
+}
+
+// VerifyBilledCosts recomputes the expected cost of each bill in the month from its usage, the
+// catalogue price and its discount rate, and flags bills whose billed amount differs by more than
+// max(absTolerance, relTolerance × expected). Bills covered by resource packages are skipped.
+func (s *StatisticsService) VerifyBilledCosts(billingMonth string, absTolerance, relTolerance float64) (*models.CostVerificationReport, error) {
+	year, month, err := parseBillingMonth(billingMonth)
+	if err != nil {
+		return nil, NewValidationError(ErrCodeInvalidParameter, fmt.Sprintf("invalid billing month %s: %v", billingMonth, err))
+	}
+	if absTolerance <= 0 {
+		absTolerance = defaultCostAbsTolerance
+	}
+	if relTolerance <= 0 {
+		relTolerance = defaultCostRelTolerance
+	}
+
+	prices, err := queryModelPrices(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, models.ReportingLocation())
+	end := start.AddDate(0, 1, 0)
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT id, COALESCE(billing_no, ''), datetime(transaction_time),
+		       COALESCE(model_code, ''), COALESCE(model_product_code, ''), COALESCE(model_name, ''),
+		       COALESCE(charge_name, ''), COALESCE(model_product_subtype, ''), COALESCE(token_type, ''),
+		       COALESCE(usage_count, 0), COALESCE(charge_count, 0), COALESCE(usage_unit, ''), COALESCE(charge_unit_symbol, ''),
+		       COALESCE(discount_rate, 0), COALESCE(cash_cost, 0), COALESCE(gift_deduct_amount, 0),
+		       CASE WHEN %s THEN 1 ELSE 0 END
+		FROM expense_bills
+		WHERE datetime(transaction_time) >= ? AND datetime(transaction_time) < ?
+		ORDER BY datetime(transaction_time)
+	`, coveredBillCondition),
+		start.UTC().Format("2006-01-02 15:04:05"), end.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bills for cost verification: %w", err)
+	}
+	defer rows.Close()
+
+	report := &models.CostVerificationReport{
+		BillingMonth:   billingMonth,
+		UnpricedModels: []string{},
+		Discrepancies:  []models.CostDiscrepancy{},
+	}
+	unpriced := make(map[string]bool)
+
+	for rows.Next() {
+		var bill pricedBill
+		var transactionTime string
+		var covered bool
+		err := rows.Scan(&bill.ID, &bill.BillingNo, &transactionTime,
+			&bill.ModelCode, &bill.ProductCode, &bill.ModelName,
+			&bill.ChargeName, &bill.ProductSubtype, &bill.TokenType,
+			&bill.UsageCount, &bill.ChargeCount, &bill.UsageUnit, &bill.ChargeUnitSymbol,
+			&bill.DiscountRate, &bill.CashCost, &bill.GiftDeduct, &covered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan bill for cost verification: %w", err)
+		}
+
+		if covered {
+			report.CoveredBills++
+			continue
+		}
+
+		bill.TransactionTime, err = time.Parse("2006-01-02 15:04:05", transactionTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse transaction time: %w", err)
+		}
+		billDate := bill.TransactionTime.In(models.ReportingLocation()).Format("2006-01-02")
+
+		price := findModelPrice(prices, &bill, billDate)
+		if price == nil {
+			report.UnpricedBills++
+			name := bill.ModelName
+			if name == "" {
+				name = bill.ModelCode
+			}
+			unpriced[name] = true
+			continue
+		}
+
+		quantity, unit := bill.UsageCount, bill.UsageUnit
+		if quantity <= 0 {
+			quantity, unit = bill.ChargeCount, bill.ChargeUnitSymbol
+		}
+
+		// 账单金额包含赠送抵扣部分，抵扣不属于计价差异
+		expected := models.ListPrice(quantity, unit, price.Price, price.Unit) * normalizeDiscountRate(bill.DiscountRate)
+		billed := bill.CashCost + bill.GiftDeduct
+		difference := billed - expected
+
+		report.CheckedBills++
+		report.ExpectedTotal += expected
+		report.BilledTotal += billed
+
+		if math.Abs(difference) <= math.Max(absTolerance, relTolerance*expected) {
+			report.MatchedBills++
+			continue
+		}
+
+		report.Discrepancies = append(report.Discrepancies, models.CostDiscrepancy{
+			BillID:          bill.ID,
+			BillingNo:       bill.BillingNo,
+			TransactionTime: bill.TransactionTime.In(models.ReportingLocation()),
+			ModelName:       bill.ModelName,
+			ChargeName:      bill.ChargeName,
+			PriceID:         price.ID,
+			UsageCount:      quantity,
+			UsageUnit:       unit,
+			DiscountRate:    bill.DiscountRate,
+			ExpectedCost:    math.Round(expected*10000) / 10000,
+			BilledCost:      billed,
+			Difference:      math.Round(difference*10000) / 10000,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate bills for cost verification: %w", err)
+	}
+
+	for name := range unpriced {
+		report.UnpricedModels = append(report.UnpricedModels, name)
+	}
+	sort.Strings(report.UnpricedModels)
+
+	// 差异金额绝对值大的排在前面
+	sort.SliceStable(report.Discrepancies, func(i, j int) bool {
+		return math.Abs(report.Discrepancies[i].Difference) > math.Abs(report.Discrepancies[j].Difference)
+	})
+
+	report.ExpectedTotal = math.Round(report.ExpectedTotal*100) / 100
+	report.BilledTotal = math.Round(report.BilledTotal*100) / 100
+	report.DifferenceTotal = math.Round((report.BilledTotal-report.ExpectedTotal)*100) / 100
+
+	return report, nil
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+// pricingBillingResponse has GLM-4.6 input and output bills, a GLM-4.6 bill deducted from a
+// resource package and a bill of a model missing from the catalogue, all in November 2025
+const pricingBillingResponse = `{
+	"code": 200,
+	"data": {
+		"billList": [
+			{
+				"billingNo": "cust123_1762000000000",
+				"chargeName": "GLM-4.6 输出",
+				"modelName": "GLM-4.6",
+				"modelCode": "glm-4.6",
+				"tokenType": "output",
+				"usageCount": 1000000,
+				"usageUnit": "tokens",
+				"cashCost": 8
+			},
+			{
+				"billingNo": "cust123_1762000100000",
+				"chargeName": "GLM-4.6 输入",
+				"modelName": "GLM-4.6",
+				"modelCode": "glm-4.6",
+				"tokenType": "input",
+				"usageCount": 1000000,
+				"usageUnit": "tokens",
+				"cashCost": 1,
+				"giftDeductAmount": 4
+			},
+			{
+				"billingNo": "cust123_1762000200000",
+				"chargeName": "GLM-4.6 输入",
+				"modelCode": "glm-4.6",
+				"usageCount": 5000000,
+				"usageUnit": "tokens",
+				"tokenResourceNo": "RES-001",
+				"tokenResourceName": "GLM Coding Lite",
+				"deductUsage": 5000000
+			},
+			{
+				"billingNo": "cust123_1762000300000",
+				"chargeName": "CogView-4",
+				"modelName": "cogview-4",
+				"modelCode": "cogview-4",
+				"chargeCount": 2,
+				"chargeUnitSymbol": "张",
+				"cashCost": 0.12
+			}
+		]
+	}
+}`
+
+func TestVerifyBilledCostsFromIngestedBills(t *testing.T) {
+	db := newBillTestDB(t)
+	_, err := db.Exec(`
+		CREATE TABLE model_prices (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			model_code TEXT NOT NULL,
+			context_band TEXT NOT NULL DEFAULT '',
+			token_type TEXT NOT NULL DEFAULT '',
+			unit TEXT NOT NULL,
+			price REAL NOT NULL,
+			effective_from DATE NOT NULL,
+			description TEXT,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO model_prices (model_code, token_type, unit, price, effective_from) VALUES
+			('glm-4.6', 'input', '百万tokens', 2, '2025-09-30'),
+			('glm-4.6', 'output', '百万tokens', 8, '2025-09-30');
+	`)
+	if err != nil {
+		t.Fatalf("failed to prepare model prices: %v", err)
+	}
+	ingestBillingResponse(t, db, 1, pricingBillingResponse)
+
+	report, err := NewStatisticsService(db).VerifyBilledCosts("2025-11", 0, 0)
+	if err != nil {
+		t.Fatalf("VerifyBilledCosts failed: %v", err)
+	}
+
+	if report.CoveredBills != 1 {
+		t.Errorf("expected 1 covered bill, got %d", report.CoveredBills)
+	}
+	if report.UnpricedBills != 1 || len(report.UnpricedModels) != 1 || report.UnpricedModels[0] != "cogview-4" {
+		t.Errorf("expected cogview-4 to be unpriced, got %d %v", report.UnpricedBills, report.UnpricedModels)
+	}
+	if report.CheckedBills != 2 {
+		t.Fatalf("expected 2 checked bills, got %d", report.CheckedBills)
+	}
+
+	// 输出账单与价格一致；输入账单应为2元，现金1元+赠送抵扣4元多出3元
+	if report.MatchedBills != 1 || len(report.Discrepancies) != 1 {
+		t.Fatalf("expected 1 matched bill and 1 discrepancy, got %d and %+v", report.MatchedBills, report.Discrepancies)
+	}
+	discrepancy := report.Discrepancies[0]
+	if discrepancy.BillingNo != "cust123_1762000100000" {
+		t.Errorf("unexpected discrepancy bill: %s", discrepancy.BillingNo)
+	}
+	if math.Abs(report.ExpectedTotal-10) > 1e-9 || math.Abs(report.BilledTotal-13) > 1e-9 {
+		t.Errorf("expected totals 10/13, got %v/%v", report.ExpectedTotal, report.BilledTotal)
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"glm-usage-monitor/models"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	quotaWarningPercent  = 80.0
+	quotaExceededPercent = 100.0
+	quotaMinPaceWindow   = 10 * time.Minute // 计算当前速度的最短时间跨度，避免单次突发导致估算失真
+)
+
+// Quota levels
+const (
+	QuotaLevelNormal   = "normal"
+	QuotaLevelWarning  = "warning"
+	QuotaLevelExceeded = "exceeded"
+)
+
+// QuotaTracker tracks usage of each account's rolling-window call quota
+type QuotaTracker struct {
+	db                  *sql.DB
+	dbService           *DatabaseService
+	notificationService *NotificationService
+
+	mu              sync.Mutex
+	lastAlertLevels map[int]string // 各账号最近一次通知的等级，回落到normal后重置
+}
+
+// NewQuotaTracker creates a new quota tracker
+func NewQuotaTracker(db *sql.DB, dbService *DatabaseService, notificationService *NotificationService) *QuotaTracker {
+	return &QuotaTracker{
+		db:                  db,
+		dbService:           dbService,
+		notificationService: notificationService,
+		lastAlertLevels:     make(map[int]string),
+	}
+}
+
+// GetQuotaStatus computes the quota usage of an account from its own bills, using the
+// period_hours and call_limit of the catalogue entry of the account's tier in effect at now
+func (t *QuotaTracker) GetQuotaStatus(account models.APIToken, now time.Time) (*models.QuotaStatus, error) {
+	tier, err := t.dbService.GetMembershipTierAt(account.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.QuotaStatus{
+		AccountID:   account.ID,
+		AccountName: account.TokenName,
+		Tier:        tier,
+		TierName:    getTierDisplayName(tier),
+		Level:       QuotaLevelNormal,
+	}
+
+	periodHours, callLimit := 0, 0
+	if limit, err := t.dbService.GetMembershipTierLimit(tier); err == nil {
+		if limit.PeriodHours != nil {
+			periodHours = *limit.PeriodHours
+		}
+		if limit.CallLimit != nil {
+			callLimit = *limit.CallLimit
+		}
+	}
+	if periodHours <= 0 || callLimit <= 0 {
+		return status, nil // 当前等级没有周期性次数限制
+	}
+
+	status.Tracked = true
+	status.PeriodHours = periodHours
+	status.CallLimit = callLimit
+	status.WindowEnd = now
+	status.WindowStart = now.Add(-time.Duration(periodHours) * time.Hour)
+
+	var used int
+	var oldest sql.NullString
+	err = t.db.QueryRow(`
+		SELECT COUNT(*), MIN(datetime(transaction_time))
+		FROM expense_bills
+		WHERE COALESCE(account_id, 0) = ? AND datetime(transaction_time) > ? AND datetime(transaction_time) <= ?
+	`, account.ID, status.WindowStart.UTC().Format("2006-01-02 15:04:05"), now.UTC().Format("2006-01-02 15:04:05")).Scan(&used, &oldest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quota usage: %w", err)
+	}
+
+	status.Used = used
+	status.Remaining = callLimit - used
+	if status.Remaining < 0 {
+		status.Remaining = 0
+	}
+	status.Percentage = math.Round(float64(used)/float64(callLimit)*10000) / 100
+
+	switch {
+	case status.Percentage >= quotaExceededPercent:
+		status.Level = QuotaLevelExceeded
+	case status.Percentage >= quotaWarningPercent:
+		status.Level = QuotaLevelWarning
+	}
+
+	if !oldest.Valid {
+		return status, nil
+	}
+
+	oldestAt, err := time.Parse("2006-01-02 15:04:05", oldest.String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse oldest usage time: %w", err)
+	}
+	oldestAt = oldestAt.In(now.Location())
+	expiresAt := oldestAt.Add(time.Duration(periodHours) * time.Hour)
+	status.OldestUsageAt = &oldestAt
+	status.OldestExpiresAt = &expiresAt
+
+	// 当前速度：窗口内用量除以自最早用量以来经过的时间
+	elapsed := now.Sub(oldestAt)
+	if elapsed < quotaMinPaceWindow {
+		elapsed = quotaMinPaceWindow
+	}
+	status.CallsPerHour = math.Round(float64(used)/elapsed.Hours()*100) / 100
+
+	// 达到上限的剩余时间按当前速度线性估算，不考虑期间旧用量移出窗口
+	var untilLimit time.Duration
+	if used < callLimit {
+		untilLimit = time.Duration(float64(callLimit-used) / (float64(used) / elapsed.Hours()) * float64(time.Hour))
+	}
+	seconds := int64(untilLimit.Seconds())
+	limitAt := now.Add(untilLimit)
+	status.TimeToLimitSeconds = &seconds
+	status.EstimatedLimitAt = &limitAt
+
+	return status, nil
+}
+
+// CheckQuota computes the quota status of every active account and raises a notification when
+// an account's usage crosses 80% or 100% of its limit. Each level is notified once per account
+// until usage drops back below 80%.
+func (t *QuotaTracker) CheckQuota(now time.Time) ([]*models.QuotaStatus, error) {
+	accounts, err := t.dbService.GetActiveAPITokens()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*models.QuotaStatus, 0, len(accounts))
+	for _, account := range accounts {
+		status, err := t.GetQuotaStatus(account, now)
+		if err != nil {
+			return nil, err
+		}
+		t.notifyLevel(status)
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// notifyLevel raises a notification when an account's quota level rose since the last notification
+func (t *QuotaTracker) notifyLevel(status *models.QuotaStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !status.Tracked || status.Level == QuotaLevelNormal {
+		t.lastAlertLevels[status.AccountID] = QuotaLevelNormal
+		return
+	}
+
+	if quotaLevelRank(status.Level) > quotaLevelRank(t.lastAlertLevels[status.AccountID]) {
+		t.lastAlertLevels[status.AccountID] = status.Level
+		if t.notificationService != nil {
+			t.notificationService.AddQuotaNotification(status)
+		}
+		log.Printf("Quota %s for account %s: %d/%d calls in the last %d hours", status.Level, status.AccountName,
+			status.Used, status.CallLimit, status.PeriodHours)
+	}
+}
+
+// quotaLevelRank orders quota levels by severity
+func quotaLevelRank(level string) int {
+	switch level {
+	case QuotaLevelWarning:
+		return 1
+	case QuotaLevelExceeded:
+		return 2
+	default:
+		return 0
+	}
+}
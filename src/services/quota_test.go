@@ -0,0 +1,124 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCheckQuotaWindowAndEscalation(t *testing.T) {
+	db := newTestDB(t, expenseBillsTestSchema(), tierTestSchema, apiTokensTestSchema, notificationsTestSchema)
+	start := time.Date(2025, 11, 10, 8, 0, 0, 0, time.UTC)
+
+	// 账号1为 lite 套餐：每5小时10次
+	statements := []string{
+		"UPDATE membership_tier_limits SET period_hours = 5, call_limit = 10 WHERE tier_name = 'lite'",
+		"INSERT INTO membership_tier_history (tier_name, effective_from, account_id) VALUES ('lite', '2025-11-01 00:00:00', 1)",
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("failed to prepare quota: %v", err)
+		}
+	}
+	_, err := db.Exec(`
+		INSERT INTO api_tokens (token_name, token_value, is_active, created_at, updated_at)
+		VALUES ('main', 'enc:v1:main', 1, ?, ?)
+	`, start, start)
+	if err != nil {
+		t.Fatalf("failed to insert token: %v", err)
+	}
+
+	tracker := NewQuotaTracker(db, NewDatabaseService(db), newTestNotificationServiceOn(db))
+	billCount := 0
+	addBills := func(offsets ...time.Duration) {
+		for _, offset := range offsets {
+			billCount++
+			_, err := db.Exec("INSERT INTO expense_bills (id, account_id, transaction_time) VALUES (?, 1, ?)",
+				fmt.Sprintf("bill-%d", billCount), start.Add(offset))
+			if err != nil {
+				t.Fatalf("failed to insert bill: %v", err)
+			}
+		}
+	}
+	minutes := func(from, to int) []time.Duration {
+		var offsets []time.Duration
+		for m := from; m <= to; m++ {
+			offsets = append(offsets, time.Duration(m)*time.Minute)
+		}
+		return offsets
+	}
+
+	steps := []struct {
+		name        string
+		bills       []time.Duration
+		at          time.Duration
+		wantUsed    int
+		wantLevel   string
+		wantOldest  time.Duration // 窗口内最早用量的时间，到期时间为其后5小时
+		wantNotices map[string]int
+	}{
+		{"below the warning", minutes(0, 6), 6*time.Minute + 30*time.Second, 7, QuotaLevelNormal, 0,
+			map[string]int{}},
+		{"warning at 80%", minutes(7, 7), 7*time.Minute + 30*time.Second, 8, QuotaLevelWarning, 0,
+			map[string]int{"quota:1:lite:warning": 1}},
+		{"warning is notified once", minutes(8, 8), 8*time.Minute + 30*time.Second, 9, QuotaLevelWarning, 0,
+			map[string]int{"quota:1:lite:warning": 1}},
+		{"escalates to exceeded", minutes(9, 9), 9*time.Minute + 30*time.Second, 10, QuotaLevelExceeded, 0,
+			map[string]int{"quota:1:lite:warning": 1, "quota:1:lite:exceeded": 1}},
+		// 5小时后前8次用量移出窗口
+		{"old usage leaves the window", nil, 5*time.Hour + 7*time.Minute + 30*time.Second, 2, QuotaLevelNormal, 8 * time.Minute,
+			map[string]int{"quota:1:lite:warning": 1, "quota:1:lite:exceeded": 1}},
+		{"warning again after dropping to normal", minutes(5*60+8, 5*60+15), 5*time.Hour + 15*time.Minute + 30*time.Second, 8,
+			QuotaLevelWarning, 5*time.Hour + 8*time.Minute,
+			map[string]int{"quota:1:lite:warning": 2, "quota:1:lite:exceeded": 1}},
+	}
+
+	for _, step := range steps {
+		addBills(step.bills...)
+		now := start.Add(step.at)
+
+		statuses, err := tracker.CheckQuota(now)
+		if err != nil {
+			t.Fatalf("%s: CheckQuota failed: %v", step.name, err)
+		}
+		if len(statuses) != 1 || !statuses[0].Tracked {
+			t.Fatalf("%s: expected one tracked account, got %+v", step.name, statuses)
+		}
+
+		status := statuses[0]
+		if status.Used != step.wantUsed || status.Remaining != 10-step.wantUsed || status.Level != step.wantLevel {
+			t.Errorf("%s: expected %d used at level %s, got %d used (%d remaining) at level %s",
+				step.name, step.wantUsed, step.wantLevel, status.Used, status.Remaining, status.Level)
+		}
+		wantExpiry := start.Add(step.wantOldest + 5*time.Hour)
+		if status.OldestExpiresAt == nil || !status.OldestExpiresAt.Equal(wantExpiry) {
+			t.Errorf("%s: expected the oldest usage to expire at %s, got %v", step.name, wantExpiry, status.OldestExpiresAt)
+		}
+
+		notices := map[string]int{}
+		rows, err := db.Query("SELECT dedup_key, occurrences FROM notifications")
+		if err != nil {
+			t.Fatalf("failed to query notifications: %v", err)
+		}
+		for rows.Next() {
+			var key string
+			var occurrences int
+			if err := rows.Scan(&key, &occurrences); err != nil {
+				t.Fatalf("failed to scan notification: %v", err)
+			}
+			notices[key] = occurrences
+		}
+		rows.Close()
+
+		if len(notices) != len(step.wantNotices) {
+			t.Errorf("%s: expected notifications %v, got %v", step.name, step.wantNotices, notices)
+			continue
+		}
+		for key, occurrences := range step.wantNotices {
+			if notices[key] != occurrences {
+				t.Errorf("%s: expected notifications %v, got %v", step.name, step.wantNotices, notices)
+				break
+			}
+		}
+	}
+}
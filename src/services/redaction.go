@@ -0,0 +1,279 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"glm-usage-monitor/models"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RedactionPatternsConfigKey stores user-configured secret patterns as a JSON array of regular expressions
+const RedactionPatternsConfigKey = "redaction_patterns"
+
+// minRedactedSecretLength is the shortest registered secret that is masked; shorter values
+// would match ordinary text
+const minRedactedSecretLength = 8
+
+// redactionRule masks one capture group of every match (0 = the whole match)
+type redactionRule struct {
+	re    *regexp.Regexp
+	group int
+}
+
+// builtinRedactionRules cover the credential formats seen in this app
+var builtinRedactionRules = []redactionRule{
+	// Authorization: Bearer <token>
+	{regexp.MustCompile(`(?i)\b(bearer\s+)([A-Za-z0-9\-._~+/]{8,}=*)`), 2},
+	// api_key=..., "token": "...", password: ...
+	{regexp.MustCompile(`(?i)\b((?:api[_-]?key|(?:api|access|refresh)[_-]?token|token|secret|password|passwd|passphrase|authorization)["']?\s*[:=]\s*["']?)([A-Za-z0-9\-._~+/=*]{8,})`), 2},
+	// 智谱API Key：32位ID + "." + 16位密钥
+	{regexp.MustCompile(`\b[0-9A-Za-z]{32}\.[0-9A-Za-z]{16}\b`), 0},
+	// JWT
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`), 0},
+	// sk- 前缀的API Key
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`), 0},
+}
+
+// secretFieldNames are map keys whose string values are always masked
+var secretFieldNames = map[string]bool{
+	"api_key":       true,
+	"apikey":        true,
+	"token":         true,
+	"token_value":   true,
+	"access_token":  true,
+	"refresh_token": true,
+	"secret":        true,
+	"password":      true,
+	"passphrase":    true,
+	"authorization": true,
+}
+
+// Redactor masks bearer tokens, API keys, registered secret values and configured patterns
+// in text before it leaves the process through logs, errors, notifications or bindings
+type Redactor struct {
+	mu       sync.RWMutex
+	secrets  map[string]string // 已知密钥原文 -> 脱敏值
+	patterns []*regexp.Regexp  // 用户配置的模式，整段匹配脱敏
+}
+
+// NewRedactor creates a redactor with the built-in rules
+func NewRedactor() *Redactor {
+	return &Redactor{
+		secrets: make(map[string]string),
+	}
+}
+
+var defaultRedactor = NewRedactor()
+
+// DefaultRedactor returns the process-wide redactor used by logs, errors and notifications
+func DefaultRedactor() *Redactor {
+	return defaultRedactor
+}
+
+// Redact masks secrets in text using the default redactor
+func Redact(text string) string {
+	return defaultRedactor.Redact(text)
+}
+
+// AddSecret registers a secret value, such as a decrypted API token, to be masked wherever it appears
+func (r *Redactor) AddSecret(secret string) {
+	secret = strings.TrimSpace(secret)
+	if len(secret) < minRedactedSecretLength {
+		return
+	}
+
+	r.mu.Lock()
+	r.secrets[secret] = models.MaskSecret(secret)
+	r.mu.Unlock()
+}
+
+// RemoveSecret unregisters a secret value, such as the API token of a deleted account
+func (r *Redactor) RemoveSecret(secret string) {
+	r.mu.Lock()
+	delete(r.secrets, strings.TrimSpace(secret))
+	r.mu.Unlock()
+}
+
+// SetPatterns replaces the configured secret patterns; the whole match of each pattern is masked
+func (r *Redactor) SetPatterns(patterns []string) error {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+
+	r.mu.Lock()
+	r.patterns = compiled
+	r.mu.Unlock()
+	return nil
+}
+
+// Patterns returns the configured secret patterns
+func (r *Redactor) Patterns() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	patterns := make([]string, 0, len(r.patterns))
+	for _, re := range r.patterns {
+		patterns = append(patterns, re.String())
+	}
+	return patterns
+}
+
+// Redact returns text with every secret masked
+func (r *Redactor) Redact(text string) string {
+	if text == "" {
+		return text
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// 先替换已知密钥原文，避免被正则拆分后漏掉
+	for secret, masked := range r.secrets {
+		text = strings.ReplaceAll(text, secret, masked)
+	}
+	for _, rule := range builtinRedactionRules {
+		text = maskGroup(rule.re, rule.group, text)
+	}
+	for _, re := range r.patterns {
+		text = maskGroup(re, 0, text)
+	}
+
+	return text
+}
+
+// maskGroup masks the given capture group of every match of re in text
+func maskGroup(re *regexp.Regexp, group int, text string) string {
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[2*group], m[2*group+1]
+		if start < 0 {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(models.MaskSecret(text[start:end]))
+		last = end
+	}
+	b.WriteString(text[last:])
+
+	return b.String()
+}
+
+// RedactValue returns a copy of a log context, notification payload or similar value with
+// strings redacted and secret-named fields masked; other values are returned unchanged
+func (r *Redactor) RedactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return r.Redact(v)
+	case error:
+		return r.Redact(v.Error())
+	case []string:
+		redacted := make([]string, len(v))
+		for i, item := range v {
+			redacted[i] = r.Redact(item)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = r.RedactValue(item)
+		}
+		return redacted
+	case map[string]string:
+		redacted := make(map[string]string, len(v))
+		for key, item := range v {
+			redacted[key] = r.redactField(key, item).(string)
+		}
+		return redacted
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			redacted[key] = r.redactField(key, item)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// redactField masks the whole value of secret-named fields and redacts the rest
+func (r *Redactor) redactField(key string, value interface{}) interface{} {
+	if s, ok := value.(string); ok && secretFieldNames[strings.ToLower(key)] {
+		return models.MaskSecret(s)
+	}
+	return r.RedactValue(value)
+}
+
+// redactingWriter redacts everything written through it
+type redactingWriter struct {
+	w        io.Writer
+	redactor *Redactor
+}
+
+// NewRedactingWriter wraps w so that secrets are masked before they are written, e.g. for log.SetOutput
+func NewRedactingWriter(w io.Writer) io.Writer {
+	return &redactingWriter{w: w, redactor: defaultRedactor}
+}
+
+// Write redacts p and writes it to the underlying writer
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.redactor.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// RedactExpenseBill masks the API key of a bill before it is returned to the frontend and
+// adds its stable key_id for filtering
+func RedactExpenseBill(bill *models.ExpenseBill) {
+	if bill == nil || bill.APIKey == "" {
+		return
+	}
+	bill.APIKeyID = models.SecretID(bill.APIKey)
+	bill.APIKey = models.MaskSecret(bill.APIKey)
+}
+
+// RedactExpenseBills masks the API keys of bills before they are returned to the frontend
+func RedactExpenseBills(bills []models.ExpenseBill) {
+	for i := range bills {
+		RedactExpenseBill(&bills[i])
+	}
+}
+
+// parseRedactionPatterns decodes the stored pattern list
+func parseRedactionPatterns(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var patterns []string
+	if err := json.Unmarshal([]byte(value), &patterns); err != nil {
+		return nil, fmt.Errorf("failed to parse redaction patterns: %w", err)
+	}
+	return patterns, nil
+}
+
+// encodeRedactionPatterns encodes the pattern list for storage
+func encodeRedactionPatterns(patterns []string) (string, error) {
+	data, err := json.Marshal(patterns)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode redaction patterns: %w", err)
+	}
+	return string(data), nil
+}
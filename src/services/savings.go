@@ -0,0 +1,253 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"glm-usage-monitor/models"
+	"math"
+	"sort"
+	"time"
+)
+
+// coveredBillCondition matches bills whose usage was deducted from a coding-plan resource package
+const coveredBillCondition = `(COALESCE(token_resource_no, '') != '' OR COALESCE(token_resource_name, '') != ''
+	OR COALESCE(deduct_usage, 0) > 0)`
+
+// resourceCycleExpr identifies the billing cycle (resource package) a covered bill belongs to
+const resourceCycleExpr = "COALESCE(NULLIF(token_resource_no, ''), NULLIF(token_resource_name, ''), '')"
+
+// GetSubscriptionSavings compares, per month and per billing cycle, the list price of usage covered
+// by resource packages with the monthly price of the tier in effect when each package was first used.
+// A package's subscription cost is attributed to the month of its first usage.
+func (s *StatisticsService) GetSubscriptionSavings(startDate, endDate *time.Time) (*models.SubscriptionSavingsReport, error) {
+	whereClause, args := dateRangeWhere(startDate, endDate)
+	coveredWhere := whereClause + " AND " + coveredBillCondition
+	monthExpr := reportingTimeExpr("%Y-%m", "transaction_time")
+
+	report := &models.SubscriptionSavingsReport{
+		ByMonth: []models.SubscriptionSavings{},
+		ByCycle: []models.SubscriptionSavings{},
+		Total:   models.SubscriptionSavings{Period: "total", Label: "合计"},
+	}
+
+	// 按资源包（计费周期）统计
+	cycleListPrices, err := s.listPriceBy(resourceCycleExpr, coveredWhere, args)
+	if err != nil {
+		return nil, err
+	}
+	cycleUsage, err := s.normalizedUsageBy(resourceCycleExpr, coveredWhere, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT
+			%s as cycle,
+			COALESCE(MAX(token_resource_name), '') as resource_name,
+			MIN(COALESCE(account_id, 0)) as account_id,
+			MIN(datetime(transaction_time)) as first_usage,
+			MAX(datetime(transaction_time)) as last_usage,
+			COUNT(*) as call_count
+		FROM expense_bills
+		WHERE %s
+		GROUP BY cycle
+		ORDER BY first_usage
+	`, resourceCycleExpr, coveredWhere), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query billing cycles: %w", err)
+	}
+
+	type cycleRow struct {
+		key, name, first, last string
+		accountID, calls       int
+	}
+	var cycles []cycleRow
+	for rows.Next() {
+		var c cycleRow
+		var first, last sql.NullString
+		if err := rows.Scan(&c.key, &c.name, &c.accountID, &first, &last, &c.calls); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan billing cycle: %w", err)
+		}
+		c.first, c.last = first.String, last.String
+		cycles = append(cycles, c)
+	}
+	rows.Close()
+
+	monthSubscription := make(map[string]float64)
+	for _, c := range cycles {
+		saving := models.SubscriptionSavings{
+			Period:        c.key,
+			Label:         c.name,
+			CoveredCalls:  c.calls,
+			CoveredTokens: cycleUsage[c.key].TotalTokens,
+			ListPriceCost: cycleListPrices[c.key],
+		}
+		if saving.Label == "" {
+			saving.Label = "未知资源包"
+		}
+
+		if start, err := time.Parse("2006-01-02 15:04:05", c.first); err == nil {
+			start = start.In(models.ReportingLocation())
+			saving.StartTime = &start
+
+			// 没有资源包标识的抵扣无法对应套餐，不计套餐费用
+			if c.key != "" {
+				tier, price, err := s.tierPriceAt(c.accountID, start)
+				if err != nil {
+					return nil, err
+				}
+				saving.Tier = tier
+				saving.SubscriptionCost = price
+				monthSubscription[start.Format("2006-01")] += price
+			}
+		}
+		if end, err := time.Parse("2006-01-02 15:04:05", c.last); err == nil {
+			end = end.In(models.ReportingLocation())
+			saving.EndTime = &end
+		}
+
+		finalizeSavings(&saving)
+		report.ByCycle = append(report.ByCycle, saving)
+	}
+
+	// 按月统计
+	monthListPrices, err := s.listPriceBy(monthExpr, coveredWhere, args)
+	if err != nil {
+		return nil, err
+	}
+	monthUsage, err := s.normalizedUsageBy(monthExpr, coveredWhere, args)
+	if err != nil {
+		return nil, err
+	}
+
+	months := make(map[string]*models.SubscriptionSavings)
+	getMonth := func(month string) *models.SubscriptionSavings {
+		if m, ok := months[month]; ok {
+			return m
+		}
+		m := &models.SubscriptionSavings{Period: month, Label: month}
+		months[month] = m
+		return m
+	}
+
+	rows, err = s.db.Query(fmt.Sprintf(`
+		SELECT
+			%s as month,
+			SUM(CASE WHEN %s THEN 1 ELSE 0 END) as covered_calls,
+			COALESCE(SUM(CASE WHEN %s THEN 0 ELSE cash_cost END), 0) as pay_as_you_go_cost
+		FROM expense_bills
+		WHERE %s
+		GROUP BY month
+	`, monthExpr, coveredBillCondition, coveredBillCondition, whereClause), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query monthly savings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var month sql.NullString
+		var coveredCalls int
+		var payAsYouGo float64
+		if err := rows.Scan(&month, &coveredCalls, &payAsYouGo); err != nil {
+			return nil, fmt.Errorf("failed to scan monthly savings: %w", err)
+		}
+		if !month.Valid {
+			continue
+		}
+
+		m := getMonth(month.String)
+		m.CoveredCalls = coveredCalls
+		m.PayAsYouGoCost = payAsYouGo
+		m.CoveredTokens = monthUsage[month.String].TotalTokens
+		m.ListPriceCost = monthListPrices[month.String]
+	}
+	for month, price := range monthSubscription {
+		getMonth(month).SubscriptionCost = price
+	}
+
+	for _, m := range months {
+		finalizeSavings(m)
+		report.ByMonth = append(report.ByMonth, *m)
+
+		report.Total.CoveredCalls += m.CoveredCalls
+		report.Total.CoveredTokens += m.CoveredTokens
+		report.Total.ListPriceCost += m.ListPriceCost
+		report.Total.SubscriptionCost += m.SubscriptionCost
+		report.Total.PayAsYouGoCost += m.PayAsYouGoCost
+	}
+	sort.Slice(report.ByMonth, func(i, j int) bool {
+		return report.ByMonth[i].Period < report.ByMonth[j].Period
+	})
+	finalizeSavings(&report.Total)
+
+	return report, nil
+}
+
+// finalizeSavings derives the net saving and saving percentage
+func finalizeSavings(saving *models.SubscriptionSavings) {
+	saving.NetSaving = math.Round((saving.ListPriceCost-saving.SubscriptionCost)*100) / 100
+	saving.SavingPercent = 0
+	if saving.ListPriceCost > 0 {
+		saving.SavingPercent = math.Round(saving.NetSaving/saving.ListPriceCost*10000) / 100
+	}
+}
+
+// listPriceBy aggregates the list price (usage at the bill's cost_price per cost_unit) per key
+func (s *StatisticsService) listPriceBy(keyExpr, whereClause string, args []interface{}) (map[string]float64, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			COALESCE(CAST(%s AS TEXT), '') as price_key,
+			COALESCE(usage_unit, '') as usage_unit,
+			COALESCE(charge_unit_symbol, '') as charge_unit_symbol,
+			COALESCE(cost_unit, '') as cost_unit,
+			COALESCE(cost_price, 0) as cost_price,
+			COALESCE(SUM(CASE WHEN usage_count > 0 THEN usage_count ELSE 0 END), 0) as usage_count,
+			COALESCE(SUM(CASE WHEN usage_count > 0 THEN 0 ELSE charge_count END), 0) as charge_count
+		FROM expense_bills
+		WHERE %s
+		GROUP BY price_key, usage_unit, charge_unit_symbol, cost_unit, cost_price
+	`, keyExpr, whereClause)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query list prices: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]float64)
+	for rows.Next() {
+		var key, usageUnit, chargeUnitSymbol, costUnit string
+		var costPrice, usageCount, chargeCount float64
+		if err := rows.Scan(&key, &usageUnit, &chargeUnitSymbol, &costUnit, &costPrice, &usageCount, &chargeCount); err != nil {
+			return nil, fmt.Errorf("failed to scan list price: %w", err)
+		}
+
+		result[key] += models.ListPrice(usageCount, usageUnit, costPrice, costUnit) +
+			models.ListPrice(chargeCount, chargeUnitSymbol, costPrice, costUnit)
+	}
+
+	return result, nil
+}
+
+// tierPriceAt returns the tier of an account in effect at t and its monthly price from the catalogue
+func (s *StatisticsService) tierPriceAt(accountID int, t time.Time) (string, float64, error) {
+	var tier string
+	var price sql.NullFloat64
+	err := s.db.QueryRow(`
+		SELECT h.tier_name, l.monthly_price
+		FROM membership_tier_history h
+		LEFT JOIN membership_tier_limits l ON l.tier_name = h.tier_name
+		WHERE h.account_id = ? AND datetime(h.effective_from) <= ?
+		ORDER BY datetime(h.effective_from) DESC, h.id DESC
+		LIMIT 1
+	`, accountID, t.UTC().Format("2006-01-02 15:04:05")).Scan(&tier, &price)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return defaultMembershipTier, 0, nil
+		}
+		return "", 0, fmt.Errorf("failed to get tier price: %w", err)
+	}
+
+	return tier, price.Float64, nil
+}
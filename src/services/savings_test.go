@@ -0,0 +1,117 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"glm-usage-monitor/models"
+	"math"
+	"testing"
+)
+
+// ingestBillingResponse stores the bills of an account's raw billing API response the way a sync does
+func ingestBillingResponse(t *testing.T, db *sql.DB, accountID int, body string) {
+	t.Helper()
+
+	var response BillingResponse
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatalf("failed to decode billing response: %v", err)
+	}
+
+	api := &ZhipuAPIService{}
+	dbService := NewDatabaseService(db)
+	for i := range response.Data.BillList {
+		billMap, err := api.BillItemToMap(&response.Data.BillList[i])
+		if err != nil {
+			t.Fatalf("failed to convert bill item: %v", err)
+		}
+		bill, err := models.TransformExpenseBill(billMap)
+		if err != nil {
+			t.Fatalf("failed to transform bill: %v", err)
+		}
+		bill.AccountID = accountID
+		if err := dbService.CreateExpenseBill(bill); err != nil {
+			t.Fatalf("failed to store bill: %v", err)
+		}
+	}
+}
+
+// savingsBillingResponse has one bill deducted from a GLM Coding Lite package and one
+// pay-as-you-go bill, both on 2025-11-01 UTC
+const savingsBillingResponse = `{
+	"code": 200,
+	"data": {
+		"billList": [
+			{
+				"billingNo": "cust123_1761955200000",
+				"chargeName": "GLM-4.6",
+				"modelName": "glm-4.6",
+				"modelCode": "glm-4.6",
+				"modelProductCode": "coding-plan",
+				"cashCost": 0,
+				"usageCount": 10000000,
+				"usageUnit": "tokens",
+				"costPrice": 5,
+				"costUnit": "百万tokens",
+				"tokenResourceNo": "RES-001",
+				"tokenResourceName": "GLM Coding Lite",
+				"tokenAccountId": 98765,
+				"deductUsage": 10000000,
+				"timeWindow": "2025-11-01 08:00:00 - 2025-11-01 08:59:59"
+			},
+			{
+				"billingNo": "cust123_1761958800000",
+				"chargeName": "GLM-4.5",
+				"modelName": "glm-4.5",
+				"modelCode": "glm-4.5",
+				"cashCost": 3,
+				"usageCount": 1000000,
+				"usageUnit": "tokens",
+				"costPrice": 3,
+				"costUnit": "百万tokens"
+			}
+		]
+	}
+}`
+
+func TestSubscriptionSavingsFromIngestedBills(t *testing.T) {
+	db := newBillTestDB(t)
+	ingestBillingResponse(t, db, 1, savingsBillingResponse)
+
+	changes, err := NewDatabaseService(db).RebuildMembershipTierHistory()
+	if err != nil {
+		t.Fatalf("RebuildMembershipTierHistory failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0].TierName != "lite" {
+		t.Fatalf("expected one change to lite, got %+v", changes)
+	}
+
+	report, err := NewStatisticsService(db).GetSubscriptionSavings(nil, nil)
+	if err != nil {
+		t.Fatalf("GetSubscriptionSavings failed: %v", err)
+	}
+
+	if len(report.ByCycle) != 1 {
+		t.Fatalf("expected one billing cycle, got %+v", report.ByCycle)
+	}
+	cycle := report.ByCycle[0]
+	if cycle.Period != "RES-001" || cycle.Label != "GLM Coding Lite" || cycle.Tier != "lite" {
+		t.Errorf("unexpected cycle: %+v", cycle)
+	}
+
+	total := report.Total
+	if total.CoveredCalls != 1 {
+		t.Errorf("expected 1 covered call, got %d", total.CoveredCalls)
+	}
+	if math.Abs(total.ListPriceCost-50) > 1e-9 {
+		t.Errorf("expected list price 50, got %v", total.ListPriceCost)
+	}
+	if total.SubscriptionCost != 20 {
+		t.Errorf("expected subscription cost 20, got %v", total.SubscriptionCost)
+	}
+	if total.NetSaving != 30 {
+		t.Errorf("expected net saving 30, got %v", total.NetSaving)
+	}
+	if total.PayAsYouGoCost != 3 {
+		t.Errorf("expected pay-as-you-go cost 3, got %v", total.PayAsYouGoCost)
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"glm-usage-monitor/models"
+	"math"
+	"sort"
+	"time"
+)
+
+// GetSessions reconstructs work sessions: consecutive bills on the same API key less than the
+// idle gap apart belong to one session. Sessions are returned newest first.
+func (s *StatisticsService) GetSessions(filter models.SessionFilter) ([]models.UsageSession, error) {
+	sessions, err := s.buildSessions(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].StartTime.After(sessions[j].StartTime)
+	})
+	if filter.Limit > 0 && len(sessions) > filter.Limit {
+		sessions = sessions[:filter.Limit]
+	}
+
+	return sessions, nil
+}
+
+// GetSessionStats aggregates all sessions matching the filter. Single-call sessions have no
+// duration, so they add cost but no hours to the per-session-hour figures.
+func (s *StatisticsService) GetSessionStats(filter models.SessionFilter) (*models.SessionStats, error) {
+	sessions, err := s.buildSessions(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.SessionStats{
+		IdleGapMinutes: sessionIdleGap(filter),
+		SessionCount:   len(sessions),
+	}
+	var totalSeconds int64
+	for i := range sessions {
+		session := &sessions[i]
+		stats.TotalCalls += session.Calls
+		stats.TotalTokens += session.Tokens
+		stats.TotalCost += session.Cost
+		totalSeconds += session.DurationSeconds
+		if stats.LongestSession == nil || session.DurationSeconds > stats.LongestSession.DurationSeconds {
+			stats.LongestSession = session
+		}
+	}
+	if stats.SessionCount == 0 {
+		return stats, nil
+	}
+
+	stats.TotalHours = float64(totalSeconds) / 3600
+	stats.AvgDurationMinutes = math.Round(float64(totalSeconds)/60/float64(stats.SessionCount)*100) / 100
+	stats.AvgCallsPerSession = math.Round(float64(stats.TotalCalls)/float64(stats.SessionCount)*100) / 100
+	stats.AvgCostPerSession = math.Round(stats.TotalCost/float64(stats.SessionCount)*10000) / 10000
+	if stats.TotalHours > 0 {
+		stats.CostPerSessionHour = math.Round(stats.TotalCost/stats.TotalHours*10000) / 10000
+		stats.TokensPerSessionHour = math.Round(stats.TotalTokens / stats.TotalHours)
+	}
+	stats.TotalHours = math.Round(stats.TotalHours*100) / 100
+
+	return stats, nil
+}
+
+// sessionIdleGap returns the filter's idle gap in minutes, falling back to the default
+func sessionIdleGap(filter models.SessionFilter) int {
+	if filter.IdleGapMinutes > 0 {
+		return filter.IdleGapMinutes
+	}
+	return models.DefaultSessionIdleGapMinutes
+}
+
+// buildSessions walks bills ordered by API key and time and splits them at idle gaps
+func (s *StatisticsService) buildSessions(filter models.SessionFilter) ([]models.UsageSession, error) {
+	whereClause, args, err := s.usageQueryWhere(models.UsageQueryFilter{
+		StartTime:  filter.StartTime,
+		EndTime:    filter.EndTime,
+		ModelNames: filter.ModelNames,
+		APIKeys:    filter.APIKeys,
+	})
+	if err != nil {
+		return nil, err
+	}
+	gap := time.Duration(sessionIdleGap(filter)) * time.Minute
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT
+			COALESCE(api_key, '') as api_key,
+			datetime(transaction_time) as transaction_time,
+			COALESCE(model_name, '') as model_name,
+			COALESCE(cash_cost, 0) as cash_cost,
+			COALESCE(usage_unit, '') as usage_unit,
+			COALESCE(charge_unit_symbol, '') as charge_unit_symbol,
+			COALESCE(token_type, '') as token_type,
+			COALESCE(charge_name, '') as charge_name,
+			COALESCE(usage_count, 0) as usage_count,
+			COALESCE(charge_count, 0) as charge_count
+		FROM expense_bills
+		WHERE %s AND transaction_time IS NOT NULL
+		ORDER BY api_key, datetime(transaction_time), id
+	`, whereClause), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session bills: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.UsageSession
+	var current *models.UsageSession
+	var currentKey string
+	var modelCalls map[string]int
+
+	// 结束当前会话并确定主要模型
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.DurationSeconds = int64(current.EndTime.Sub(current.StartTime).Seconds())
+		current.Cost = math.Round(current.Cost*10000) / 10000
+		for model, calls := range modelCalls {
+			if calls > modelCalls[current.DominantModel] ||
+				(calls == modelCalls[current.DominantModel] && model < current.DominantModel) {
+				current.DominantModel = model
+			}
+		}
+		sessions = append(sessions, *current)
+		current = nil
+	}
+
+	for rows.Next() {
+		var apiKey, modelName, usageUnit, chargeUnitSymbol, tokenType, chargeName string
+		var transactionTime sql.NullString
+		var cost, usageCount, chargeCount float64
+		if err := rows.Scan(&apiKey, &transactionTime, &modelName, &cost, &usageUnit, &chargeUnitSymbol,
+			&tokenType, &chargeName, &usageCount, &chargeCount); err != nil {
+			return nil, fmt.Errorf("failed to scan session bill: %w", err)
+		}
+
+		t, err := time.Parse("2006-01-02 15:04:05", transactionTime.String)
+		if err != nil {
+			continue
+		}
+		t = t.In(models.ReportingLocation())
+
+		if current == nil || apiKey != currentKey || t.Sub(current.EndTime) >= gap {
+			flush()
+			currentKey = apiKey
+			modelCalls = make(map[string]int)
+			current = &models.UsageSession{
+				APIKey:    models.MaskSecret(apiKey),
+				KeyID:     models.SecretID(apiKey),
+				StartTime: t,
+			}
+		}
+
+		current.EndTime = t
+		current.Calls++
+		current.Cost += cost
+		modelCalls[modelName]++
+
+		// 与normalizedUsageBy一致：优先使用usage_count，否则使用charge_count
+		var usage models.NormalizedUsage
+		if usageCount > 0 {
+			usage = models.NormalizeUsage(usageCount, usageUnit, tokenType, chargeName)
+		} else {
+			usage = models.NormalizeUsage(chargeCount, chargeUnitSymbol, tokenType, chargeName)
+		}
+		current.Tokens += usage.TotalTokens
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate session bills: %w", err)
+	}
+	flush()
+
+	return sessions, nil
+}
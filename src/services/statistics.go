@@ -2,11 +2,16 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"glm-usage-monitor/models"
+	"strconv"
 	"time"
 )
 
+// errAPIKeyNotFound is returned when no bill uses the requested API key
+var errAPIKeyNotFound = errors.New("API key not found")
+
 // StatisticsService provides statistical analysis operations
 type StatisticsService struct {
 	db *sql.DB
@@ -17,24 +22,97 @@ func NewStatisticsService(db *sql.DB) *StatisticsService {
 	return &StatisticsService{db: db}
 }
 
-// GetOverallStats retrieves overall usage statistics
-func (s *StatisticsService) GetOverallStats(startDate, endDate *time.Time) (*models.StatsResponse, error) {
-	stats := &models.StatsResponse{}
+// reportingDateExpr returns the SQL expression of a UTC column's date in the reporting timezone
+func reportingDateExpr(column string) string {
+	return fmt.Sprintf("DATE(%s, %s)", column, models.ReportingOffsetExpr(column))
+}
 
-	// Get total records and cash cost
+// reportingTimeExpr returns the strftime expression of a UTC column in the reporting timezone
+func reportingTimeExpr(format, column string) string {
+	return fmt.Sprintf("strftime('%s', %s, %s)", format, column, models.ReportingOffsetExpr(column))
+}
+
+// reportingDateArg formats a time as a date in the reporting timezone
+func reportingDateArg(t time.Time) string {
+	return t.In(models.ReportingLocation()).Format("2006-01-02")
+}
+
+// dateRangeWhere builds the WHERE clause restricting transaction_time to the given dates
+// (inclusive, in the reporting timezone)
+func dateRangeWhere(startDate, endDate *time.Time) (string, []interface{}) {
 	whereClause := "1=1"
 	args := []interface{}{}
+	dateExpr := reportingDateExpr("transaction_time")
 
 	if startDate != nil {
-		whereClause += " AND DATE(transaction_time) >= DATE(?)"
-		args = append(args, startDate.Format("2006-01-02"))
+		whereClause += fmt.Sprintf(" AND %s >= DATE(?)", dateExpr)
+		args = append(args, reportingDateArg(*startDate))
 	}
 
 	if endDate != nil {
-		whereClause += " AND DATE(transaction_time) <= DATE(?)"
-		args = append(args, endDate.Format("2006-01-02"))
+		whereClause += fmt.Sprintf(" AND %s <= DATE(?)", dateExpr)
+		args = append(args, reportingDateArg(*endDate))
+	}
+
+	return whereClause, args
+}
+
+// accountWhere restricts whereClause to the bills of an account; accountID 0 includes all accounts
+func accountWhere(whereClause string, args []interface{}, accountID int) (string, []interface{}) {
+	if accountID == 0 {
+		return whereClause, args
+	}
+	return whereClause + " AND account_id = ?", append(args, accountID)
+}
+
+// normalizedUsageBy aggregates normalized consumption (see models.NormalizeUsage) per key.
+// Bills are grouped by key and unit fields in SQL, then each group is normalized in Go.
+func (s *StatisticsService) normalizedUsageBy(keyExpr, whereClause string, args []interface{}) (map[string]models.NormalizedUsage, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			COALESCE(CAST(%s AS TEXT), '') as usage_key,
+			COALESCE(usage_unit, '') as usage_unit,
+			COALESCE(charge_unit_symbol, '') as charge_unit_symbol,
+			COALESCE(token_type, '') as token_type,
+			COALESCE(charge_name, '') as charge_name,
+			COALESCE(SUM(CASE WHEN usage_count > 0 THEN usage_count ELSE 0 END), 0) as usage_count,
+			COALESCE(SUM(CASE WHEN usage_count > 0 THEN 0 ELSE charge_count END), 0) as charge_count
+		FROM expense_bills
+		WHERE %s
+		GROUP BY usage_key, usage_unit, charge_unit_symbol, token_type, charge_name
+	`, keyExpr, whereClause)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query normalized usage: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]models.NormalizedUsage)
+	for rows.Next() {
+		var key, usageUnit, chargeUnitSymbol, tokenType, chargeName string
+		var usageCount, chargeCount float64
+		if err := rows.Scan(&key, &usageUnit, &chargeUnitSymbol, &tokenType, &chargeName, &usageCount, &chargeCount); err != nil {
+			return nil, fmt.Errorf("failed to scan normalized usage: %w", err)
+		}
+
+		usage := result[key]
+		usage.Add(models.NormalizeUsage(usageCount, usageUnit, tokenType, chargeName))
+		usage.Add(models.NormalizeUsage(chargeCount, chargeUnitSymbol, tokenType, chargeName))
+		result[key] = usage
 	}
 
+	return result, nil
+}
+
+// GetOverallStats retrieves overall usage statistics of an account, or of all accounts when accountID is 0
+func (s *StatisticsService) GetOverallStats(startDate, endDate *time.Time, accountID int) (*models.StatsResponse, error) {
+	stats := &models.StatsResponse{}
+
+	// Get total records and cash cost
+	whereClause, args := dateRangeWhere(startDate, endDate)
+	whereClause, args = accountWhere(whereClause, args, accountID)
+
 	// Total records and cash cost
 	query := fmt.Sprintf(`
 		SELECT COUNT(*), COALESCE(SUM(cash_cost), 0), COALESCE(SUM(charge_unit), 0)
@@ -47,28 +125,28 @@ func (s *StatisticsService) GetOverallStats(startDate, endDate *time.Time) (*mod
 	}
 
 	// Get hourly usage data
-	hourlyUsage, err := s.GetHourlyUsage(startDate, endDate)
+	hourlyUsage, err := s.GetHourlyUsage(startDate, endDate, accountID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get hourly usage: %w", err)
 	}
 	stats.HourlyUsage = hourlyUsage
 
 	// Get model distribution
-	modelDist, err := s.GetModelDistribution(startDate, endDate)
+	modelDist, err := s.GetModelDistribution(startDate, endDate, accountID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get model distribution: %w", err)
 	}
 	stats.ModelDistribution = modelDist
 
 	// Get charge type statistics
-	chargeStats, err := s.GetChargeTypeStats(startDate, endDate)
+	chargeStats, err := s.GetChargeTypeStats(startDate, endDate, accountID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get charge type stats: %w", err)
 	}
 	stats.ChargeTypeStats = chargeStats
 
 	// Get recent usage
-	recentUsage, err := s.GetRecentUsage(10)
+	recentUsage, err := s.GetRecentUsage(10, accountID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recent usage: %w", err)
 	}
@@ -78,43 +156,34 @@ func (s *StatisticsService) GetOverallStats(startDate, endDate *time.Time) (*mod
 }
 
 // GetHourlyUsage retrieves hourly usage statistics for the last 5 hours
-func (s *StatisticsService) GetHourlyUsage(startDate, endDate *time.Time) ([]models.HourlyUsageData, error) {
-	whereClause := "1=1"
-	args := []interface{}{}
-
-	if startDate != nil {
-		whereClause += " AND DATE(transaction_time) >= DATE(?)"
-		args = append(args, startDate.Format("2006-01-02"))
-	}
-
-	if endDate != nil {
-		whereClause += " AND DATE(transaction_time) <= DATE(?)"
-		args = append(args, endDate.Format("2006-01-02"))
-	}
+func (s *StatisticsService) GetHourlyUsage(startDate, endDate *time.Time, accountID int) ([]models.HourlyUsageData, error) {
+	whereClause, args := dateRangeWhere(startDate, endDate)
+	whereClause, args = accountWhere(whereClause, args, accountID)
 
 	// If no specific date range, get last 5 hours
 	if startDate == nil && endDate == nil {
 		whereClause += " AND transaction_time >= DATETIME('now', '-5 hours')"
 	}
 
-	query := fmt.Sprintf(`
-		SELECT
-			CASE
+	hourExpr := fmt.Sprintf(`CASE
 				WHEN transaction_time >= DATETIME('now', '-5 hours') AND transaction_time < DATETIME('now', '-4 hours') THEN -4
 				WHEN transaction_time >= DATETIME('now', '-4 hours') AND transaction_time < DATETIME('now', '-3 hours') THEN -3
 				WHEN transaction_time >= DATETIME('now', '-3 hours') AND transaction_time < DATETIME('now', '-2 hours') THEN -2
 				WHEN transaction_time >= DATETIME('now', '-2 hours') AND transaction_time < DATETIME('now', '-1 hours') THEN -1
 				WHEN transaction_time >= DATETIME('now', '-1 hours') THEN 0
-				ELSE strftime('%%H', transaction_time)
-			END as hour,
+				ELSE %s
+			END`, reportingTimeExpr("%H", "transaction_time"))
+
+	query := fmt.Sprintf(`
+		SELECT
+			%s as hour,
 			COUNT(*) as call_count,
-			COALESCE(SUM(charge_unit), 0) as token_usage,
 			COALESCE(SUM(cash_cost), 0) as cash_cost
 		FROM expense_bills
 		WHERE %s
 		GROUP BY hour
 		ORDER BY hour
-	`, whereClause)
+	`, hourExpr, whereClause)
 
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
@@ -125,36 +194,34 @@ func (s *StatisticsService) GetHourlyUsage(startDate, endDate *time.Time) ([]mod
 	var hourlyData []models.HourlyUsageData
 	for rows.Next() {
 		var data models.HourlyUsageData
-		err := rows.Scan(&data.Hour, &data.CallCount, &data.TokenUsage, &data.CashCost)
+		err := rows.Scan(&data.Hour, &data.CallCount, &data.CashCost)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan hourly usage: %w", err)
 		}
 		hourlyData = append(hourlyData, data)
 	}
 
+	// Token usage from normalized consumption
+	usage, err := s.normalizedUsageBy(fmt.Sprintf("CAST(%s AS INTEGER)", hourExpr), whereClause, args)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hourlyData {
+		hourlyData[i].TokenUsage = usage[strconv.Itoa(hourlyData[i].Hour)].TotalTokens
+	}
+
 	return hourlyData, nil
 }
 
 // GetModelDistribution retrieves usage distribution by model
-func (s *StatisticsService) GetModelDistribution(startDate, endDate *time.Time) ([]models.ModelDistributionData, error) {
-	whereClause := "1=1"
-	args := []interface{}{}
-
-	if startDate != nil {
-		whereClause += " AND DATE(transaction_time) >= DATE(?)"
-		args = append(args, startDate.Format("2006-01-02"))
-	}
-
-	if endDate != nil {
-		whereClause += " AND DATE(transaction_time) <= DATE(?)"
-		args = append(args, endDate.Format("2006-01-02"))
-	}
+func (s *StatisticsService) GetModelDistribution(startDate, endDate *time.Time, accountID int) ([]models.ModelDistributionData, error) {
+	whereClause, args := dateRangeWhere(startDate, endDate)
+	whereClause, args = accountWhere(whereClause, args, accountID)
 
 	query := fmt.Sprintf(`
 		SELECT
 			model_name,
 			COUNT(*) as call_count,
-			COALESCE(SUM(charge_unit), 0) as token_usage,
 			COALESCE(SUM(cash_cost), 0) as cash_cost
 		FROM expense_bills
 		WHERE %s AND model_name IS NOT NULL AND model_name != ''
@@ -174,7 +241,7 @@ func (s *StatisticsService) GetModelDistribution(startDate, endDate *time.Time)
 	// First pass: collect data and total
 	for rows.Next() {
 		var data models.ModelDistributionData
-		err := rows.Scan(&data.ModelName, &data.CallCount, &data.TokenUsage, &data.CashCost)
+		err := rows.Scan(&data.ModelName, &data.CallCount, &data.CashCost)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan model distribution: %w", err)
 		}
@@ -182,30 +249,31 @@ func (s *StatisticsService) GetModelDistribution(startDate, endDate *time.Time)
 		totalCashCost += data.CashCost
 	}
 
-	// Calculate percentages
+	usage, err := s.normalizedUsageBy("model_name", whereClause, args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Calculate percentages and token prices
 	for i := range modelData {
 		if totalCashCost > 0 {
 			modelData[i].Percentage = (modelData[i].CashCost / totalCashCost) * 100
 		}
+
+		modelUsage := usage[modelData[i].ModelName]
+		modelData[i].TokenUsage = modelUsage.TotalTokens
+		modelData[i].InputTokens = modelUsage.InputTokens
+		modelData[i].OutputTokens = modelUsage.OutputTokens
+		modelData[i].PricePerMillionTokens = models.PricePerMillionTokens(modelData[i].CashCost, modelUsage.TotalTokens)
 	}
 
 	return modelData, nil
 }
 
 // GetChargeTypeStats retrieves statistics by charge type
-func (s *StatisticsService) GetChargeTypeStats(startDate, endDate *time.Time) ([]models.ChargeTypeStatsData, error) {
-	whereClause := "1=1"
-	args := []interface{}{}
-
-	if startDate != nil {
-		whereClause += " AND DATE(transaction_time) >= DATE(?)"
-		args = append(args, startDate.Format("2006-01-02"))
-	}
-
-	if endDate != nil {
-		whereClause += " AND DATE(transaction_time) <= DATE(?)"
-		args = append(args, endDate.Format("2006-01-02"))
-	}
+func (s *StatisticsService) GetChargeTypeStats(startDate, endDate *time.Time, accountID int) ([]models.ChargeTypeStatsData, error) {
+	whereClause, args := dateRangeWhere(startDate, endDate)
+	whereClause, args = accountWhere(whereClause, args, accountID)
 
 	query := fmt.Sprintf(`
 		SELECT
@@ -248,11 +316,143 @@ func (s *StatisticsService) GetChargeTypeStats(startDate, endDate *time.Time) ([
 	return chargeData, nil
 }
 
+// GetAPIKeyDistribution retrieves usage distribution by API key, with keys masked
+func (s *StatisticsService) GetAPIKeyDistribution(startDate, endDate *time.Time, accountID int) ([]models.APIKeyDistributionData, error) {
+	whereClause, args := dateRangeWhere(startDate, endDate)
+	whereClause, args = accountWhere(whereClause, args, accountID)
+
+	query := fmt.Sprintf(`
+		SELECT
+			api_key,
+			COUNT(*) as call_count,
+			COALESCE(SUM(cash_cost), 0) as cash_cost
+		FROM expense_bills
+		WHERE %s AND api_key IS NOT NULL AND api_key != ''
+		GROUP BY api_key
+		ORDER BY cash_cost DESC
+	`, whereClause)
+
+	usage, err := s.normalizedUsageBy("api_key", whereClause, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API key distribution: %w", err)
+	}
+	defer rows.Close()
+
+	var keyData []models.APIKeyDistributionData
+	var totalCashCost float64
+
+	// First pass: collect data and total
+	for rows.Next() {
+		var data models.APIKeyDistributionData
+		var apiKey string
+		err := rows.Scan(&apiKey, &data.CallCount, &data.CashCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key distribution: %w", err)
+		}
+		data.TokenUsage = usage[apiKey].TotalTokens
+		data.KeyID = models.SecretID(apiKey)
+		data.APIKey = models.MaskSecret(apiKey)
+		keyData = append(keyData, data)
+		totalCashCost += data.CashCost
+	}
+
+	// Calculate percentages
+	for i := range keyData {
+		if totalCashCost > 0 {
+			keyData[i].Percentage = (keyData[i].CashCost / totalCashCost) * 100
+		}
+	}
+
+	return keyData, nil
+}
+
+// GetAPIKeyTrend retrieves daily usage of a single API key for the specified period.
+// The key may be given either as the raw API key or as the key_id from GetAPIKeyDistribution.
+func (s *StatisticsService) GetAPIKeyTrend(key string, days, accountID int) ([]models.APIKeyTrendData, error) {
+	if days <= 0 {
+		days = 7
+	}
+
+	apiKey, err := s.resolveAPIKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	dateExpr := reportingDateExpr("transaction_time")
+	whereClause := fmt.Sprintf("api_key = ? AND %s >= DATE('now', '%s', '-%d days')", dateExpr, models.ReportingOffsetModifier(), days)
+	whereClause, args := accountWhere(whereClause, []interface{}{apiKey}, accountID)
+	query := fmt.Sprintf(`
+		SELECT
+			%s as date,
+			COUNT(*) as call_count,
+			COALESCE(SUM(cash_cost), 0) as cash_cost
+		FROM expense_bills
+		WHERE %s
+		GROUP BY date
+		ORDER BY date ASC
+	`, dateExpr, whereClause)
+
+	usage, err := s.normalizedUsageBy(dateExpr, whereClause, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API key trend: %w", err)
+	}
+	defer rows.Close()
+
+	var trendData []models.APIKeyTrendData
+	for rows.Next() {
+		var data models.APIKeyTrendData
+		err := rows.Scan(&data.Date, &data.CallCount, &data.CashCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key trend: %w", err)
+		}
+		data.TokenUsage = usage[data.Date].TotalTokens
+		trendData = append(trendData, data)
+	}
+
+	return trendData, nil
+}
+
+// resolveAPIKey maps a raw API key or its key_id to the raw API key stored in expense_bills
+func (s *StatisticsService) resolveAPIKey(key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("API key is required")
+	}
+
+	rows, err := s.db.Query("SELECT DISTINCT api_key FROM expense_bills WHERE api_key IS NOT NULL AND api_key != ''")
+	if err != nil {
+		return "", fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var apiKey string
+		if err := rows.Scan(&apiKey); err != nil {
+			return "", fmt.Errorf("failed to scan API key: %w", err)
+		}
+		if apiKey == key || models.SecretID(apiKey) == key {
+			return apiKey, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", errAPIKeyNotFound, models.MaskSecret(key))
+}
+
 // GetRecentUsage retrieves recent usage records
-func (s *StatisticsService) GetRecentUsage(limit int) ([]models.ExpenseBill, error) {
+func (s *StatisticsService) GetRecentUsage(limit, accountID int) ([]models.ExpenseBill, error) {
 	if limit <= 0 {
 		limit = 10
 	}
+	whereClause, args := accountWhere("1=1", nil, accountID)
 
 	query := `
 		SELECT id, charge_name, charge_type, model_name, use_group_name, group_name,
@@ -275,13 +475,17 @@ func (s *StatisticsService) GetRecentUsage(limit int) ([]models.ExpenseBill, err
 			   settlement_amount, gift_deduct_amount, due_amount, paid_amount, unpaid_amount, billing_status, invoicing_amount, invoiced_amount,
 			   
 			   -- Token业务字段
-			   token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type
+			   token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type,
+
+			   -- 账单所属账号
+			   COALESCE(account_id, 0)
 		FROM expense_bills
+		WHERE ` + whereClause + `
 		ORDER BY transaction_time DESC, create_time DESC
 		LIMIT ?
 	`
 
-	rows, err := s.db.Query(query, limit)
+	rows, err := s.db.Query(query, append(args, limit)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query recent usage: %w", err)
 	}
@@ -312,6 +516,9 @@ func (s *StatisticsService) GetRecentUsage(limit int) ([]models.ExpenseBill, err
 
 			// Token业务字段
 			&bill.TokenAccountID, &bill.TokenResourceNo, &bill.TokenResourceName, &bill.DeductUsage, &bill.DeductAfter, &bill.TokenType,
+
+			// 账单所属账号
+			&bill.AccountID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan recent usage: %w", err)
@@ -323,24 +530,31 @@ func (s *StatisticsService) GetRecentUsage(limit int) ([]models.ExpenseBill, err
 }
 
 // GetUsageTrend retrieves usage trend data for the specified period
-func (s *StatisticsService) GetUsageTrend(days int) ([]models.HourlyUsageData, error) {
+func (s *StatisticsService) GetUsageTrend(days, accountID int) ([]models.HourlyUsageData, error) {
 	if days <= 0 {
 		days = 7
 	}
 
+	dateExpr := reportingDateExpr("transaction_time")
+	whereClause := fmt.Sprintf("%s >= DATE('now', '%s', '-%d days')", dateExpr, models.ReportingOffsetModifier(), days)
+	whereClause, args := accountWhere(whereClause, nil, accountID)
 	query := fmt.Sprintf(`
 		SELECT
-			DATE(transaction_time) as date,
+			%s as date,
 			COUNT(*) as call_count,
-			COALESCE(SUM(charge_unit), 0) as token_usage,
 			COALESCE(SUM(cash_cost), 0) as cash_cost
 		FROM expense_bills
-		WHERE transaction_time >= DATE('now', '-%d days')
-		GROUP BY DATE(transaction_time)
+		WHERE %s
+		GROUP BY date
 		ORDER BY date ASC
-	`, days)
+	`, dateExpr, whereClause)
+
+	usage, err := s.normalizedUsageBy(dateExpr, whereClause, args)
+	if err != nil {
+		return nil, err
+	}
 
-	rows, err := s.db.Query(query)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query usage trend: %w", err)
 	}
@@ -350,10 +564,11 @@ func (s *StatisticsService) GetUsageTrend(days int) ([]models.HourlyUsageData, e
 	for rows.Next() {
 		var data models.HourlyUsageData
 		var dateStr string
-		err := rows.Scan(&dateStr, &data.CallCount, &data.TokenUsage, &data.CashCost)
+		err := rows.Scan(&dateStr, &data.CallCount, &data.CashCost)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan usage trend: %w", err)
 		}
+		data.TokenUsage = usage[dateStr].TotalTokens
 
 		// Convert date string to hour representation for simplicity
 		// In a real implementation, you might want a different structure
@@ -364,10 +579,11 @@ func (s *StatisticsService) GetUsageTrend(days int) ([]models.HourlyUsageData, e
 }
 
 // GetTopExpenses retrieves top expenses by amount
-func (s *StatisticsService) GetTopExpenses(limit int) ([]models.ExpenseBill, error) {
+func (s *StatisticsService) GetTopExpenses(limit, accountID int) ([]models.ExpenseBill, error) {
 	if limit <= 0 {
 		limit = 10
 	}
+	whereClause, args := accountWhere("cash_cost > 0", nil, accountID)
 
 	query := `
 		SELECT id, charge_name, charge_type, model_name, use_group_name, group_name,
@@ -390,14 +606,17 @@ func (s *StatisticsService) GetTopExpenses(limit int) ([]models.ExpenseBill, err
 			   settlement_amount, gift_deduct_amount, due_amount, paid_amount, unpaid_amount, billing_status, invoicing_amount, invoiced_amount,
 			   
 			   -- Token业务字段
-			   token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type
+			   token_account_id, token_resource_no, token_resource_name, deduct_usage, deduct_after, token_type,
+
+			   -- 账单所属账号
+			   COALESCE(account_id, 0)
 		FROM expense_bills
-		WHERE cash_cost > 0
+		WHERE ` + whereClause + `
 		ORDER BY cash_cost DESC
 		LIMIT ?
 	`
 
-	rows, err := s.db.Query(query, limit)
+	rows, err := s.db.Query(query, append(args, limit)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query top expenses: %w", err)
 	}
@@ -428,6 +647,9 @@ func (s *StatisticsService) GetTopExpenses(limit int) ([]models.ExpenseBill, err
 
 			// Token业务字段
 			&bill.TokenAccountID, &bill.TokenResourceNo, &bill.TokenResourceName, &bill.DeductUsage, &bill.DeductAfter, &bill.TokenType,
+
+			// 账单所属账号
+			&bill.AccountID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan top expenses: %w", err)
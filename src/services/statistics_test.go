@@ -0,0 +1,109 @@
+package services
+
+import (
+	"glm-usage-monitor/models"
+	"testing"
+	"time"
+)
+
+func TestStatisticsAccountFilter(t *testing.T) {
+	db := newBillTestDB(t)
+	ingestBillingResponse(t, db, 1, savingsBillingResponse)
+	ingestBillingResponse(t, db, 2, `{"code": 200, "data": {"billList": [{
+		"billingNo": "cust456_1761955200000",
+		"chargeName": "GLM-4-Air",
+		"modelName": "glm-4-air",
+		"cashCost": 7,
+		"usageCount": 2000000,
+		"usageUnit": "tokens",
+		"timeWindow": "2025-11-01 08:00:00 - 2025-11-01 08:59:59"
+	}]}}`)
+	stats := NewStatisticsService(db)
+
+	// 账号ID为0时包含全部账号
+	distribution, err := stats.GetModelDistribution(nil, nil, 0)
+	if err != nil {
+		t.Fatalf("GetModelDistribution failed: %v", err)
+	}
+	if len(distribution) != 3 {
+		t.Errorf("expected the models of both accounts, got %+v", distribution)
+	}
+
+	distribution, err = stats.GetModelDistribution(nil, nil, 2)
+	if err != nil {
+		t.Fatalf("GetModelDistribution failed: %v", err)
+	}
+	if len(distribution) != 1 || distribution[0].ModelName != "glm-4-air" || distribution[0].Percentage != 100 {
+		t.Errorf("expected only the model of account 2, got %+v", distribution)
+	}
+
+	overall, err := stats.GetOverallStats(nil, nil, 1)
+	if err != nil {
+		t.Fatalf("GetOverallStats failed: %v", err)
+	}
+	if overall.TotalRecords != 2 || overall.TotalCashCost != 3 || len(overall.RecentUsage) != 2 {
+		t.Errorf("expected the 2 bills of account 1, got %d records costing %.2f", overall.TotalRecords, overall.TotalCashCost)
+	}
+	for _, bill := range overall.RecentUsage {
+		if bill.AccountID != 1 {
+			t.Errorf("expected recent usage of account 1 only, got a bill of account %d", bill.AccountID)
+		}
+	}
+
+	period := models.PeriodRange{
+		Start: time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2025, 11, 2, 0, 0, 0, 0, time.UTC),
+	}
+	totals, err := stats.GetUsageTotals(period, 2)
+	if err != nil {
+		t.Fatalf("GetUsageTotals failed: %v", err)
+	}
+	if totals.CallCount != 1 || totals.CashCost != 7 {
+		t.Errorf("expected the totals of account 2, got %+v", totals)
+	}
+
+	comparison, err := stats.ComparePeriods(period, models.PeriodRange{Start: period.Start.AddDate(0, 0, -1), End: period.Start}, 1)
+	if err != nil {
+		t.Fatalf("ComparePeriods failed: %v", err)
+	}
+	if comparison.Overall.Cost.Current != 3 || len(comparison.ByModel) != 2 {
+		t.Errorf("expected the comparison of account 1, got %+v", comparison.Overall)
+	}
+}
+
+func TestReportingDateAcrossDST(t *testing.T) {
+	if err := models.SetReportingTimezone("America/New_York"); err != nil {
+		t.Fatalf("SetReportingTimezone failed: %v", err)
+	}
+	t.Cleanup(func() { models.SetReportingTimezone(models.DefaultReportingTimezone) })
+
+	db := newBillTestDB(t)
+	// 同为UTC 04:30，夏令时(UTC-4)落在当天，冬令时(UTC-5)落在前一天
+	bills := []struct {
+		id   string
+		time time.Time
+		want string
+	}{
+		{"summer", time.Date(2025, 7, 1, 4, 30, 0, 0, time.UTC), "2025-07-01"},
+		{"winter", time.Date(2025, 1, 15, 4, 30, 0, 0, time.UTC), "2025-01-14"},
+		{"transition", time.Date(2025, 3, 9, 6, 59, 0, 0, time.UTC), "2025-03-09"},
+	}
+	for _, bill := range bills {
+		if _, err := db.Exec("INSERT INTO expense_bills (id, transaction_time) VALUES (?, ?)", bill.id, bill.time); err != nil {
+			t.Fatalf("failed to insert bill: %v", err)
+		}
+	}
+
+	for _, bill := range bills {
+		var date, hour string
+		query := "SELECT " + reportingDateExpr("transaction_time") + ", " + reportingTimeExpr("%H", "transaction_time") +
+			" FROM expense_bills WHERE id = ?"
+		if err := db.QueryRow(query, bill.id).Scan(&date, &hour); err != nil {
+			t.Fatalf("failed to query bill %s: %v", bill.id, err)
+		}
+		wantHour := bill.time.In(models.ReportingLocation()).Format("15")
+		if date != bill.want || hour != wantHour {
+			t.Errorf("bill %s: expected %s hour %s, got %s hour %s", bill.id, bill.want, wantHour, date, hour)
+		}
+	}
+}
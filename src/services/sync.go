@@ -4,33 +4,41 @@ import (
 	"database/sql"
 	"fmt"
 	"glm-usage-monitor/models"
+	"log"
 	"strconv"
 	"time"
 )
 
 // ========== SyncHistory Operations ==========
 
-// CreateSyncHistory creates a new sync history record
+// CreateSyncHistory creates a new sync history record and sets its ID
 func (s *DatabaseService) CreateSyncHistory(history *models.SyncHistory) error {
 	query := `
 		INSERT INTO sync_history (
 			sync_type, start_time, end_time, status, records_synced, error_message,
 			total_records, page_synced, total_pages, billing_month, failed_count,
-			sync_time, duration, message
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			sync_time, duration, message, account_id, account_name
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := s.db.Exec(query,
+	result, err := s.db.Exec(query,
 		history.SyncType, history.StartTime, history.EndTime, history.Status,
 		history.RecordsSynced, history.ErrorMessage, history.TotalRecords,
 		history.PageSynced, history.TotalPages, history.BillingMonth, history.FailedCount,
 		history.SyncTime, history.Duration, history.Message,
+		nullableAccountID(history.AccountID), history.AccountName,
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to create sync history: %w", err)
 	}
 
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get sync history ID: %w", err)
+	}
+	history.ID = int(id)
+
 	return nil
 }
 
@@ -111,9 +119,11 @@ func (s *DatabaseService) GetSyncHistory(syncType string, pageNum, pageSize int)
 	query := fmt.Sprintf(`
 		SELECT id, sync_type, start_time, end_time, status, records_synced, error_message,
 		       total_records, page_synced, total_pages, billing_month, failed_count,
-		       COALESCE(sync_time, start_time) as sync_time,
+		       sync_time,
 		       COALESCE(duration, 0) as duration,
-		       COALESCE(message, '') as message
+		       COALESCE(message, '') as message,
+		       COALESCE(account_id, 0) as account_id,
+		       COALESCE(account_name, '') as account_name
 		FROM sync_history
 		WHERE %s
 		ORDER BY start_time DESC
@@ -134,15 +144,18 @@ func (s *DatabaseService) GetSyncHistory(syncType string, pageNum, pageSize int)
 	var history []models.SyncHistory
 	for rows.Next() {
 		var h models.SyncHistory
+		var syncTime *time.Time
 		err := rows.Scan(
 			&h.ID, &h.SyncType, &h.StartTime, &h.EndTime, &h.Status,
 			&h.RecordsSynced, &h.ErrorMessage, &h.TotalRecords,
 			&h.PageSynced, &h.TotalPages, &h.BillingMonth, &h.FailedCount,
-			&h.SyncTime, &h.Duration, &h.Message,
+			&syncTime, &h.Duration, &h.Message,
+			&h.AccountID, &h.AccountName,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan sync history: %w", err)
 		}
+		h.SyncTime = syncTimeOrStart(syncTime, h.StartTime)
 		history = append(history, h)
 	}
 
@@ -171,20 +184,24 @@ func (s *DatabaseService) GetLatestSyncHistory() (*models.SyncHistory, error) {
 	query := `
 		SELECT id, sync_type, start_time, end_time, status, records_synced, error_message,
 		       total_records, page_synced, total_pages, billing_month, failed_count,
-		       COALESCE(sync_time, start_time) as sync_time,
+		       sync_time,
 		       COALESCE(duration, 0) as duration,
-		       COALESCE(message, '') as message
+		       COALESCE(message, '') as message,
+		       COALESCE(account_id, 0) as account_id,
+		       COALESCE(account_name, '') as account_name
 		FROM sync_history
 		ORDER BY start_time DESC
 		LIMIT 1
 	`
 
 	var history models.SyncHistory
+	var syncTime *time.Time
 	err := s.db.QueryRow(query).Scan(
 		&history.ID, &history.SyncType, &history.StartTime, &history.EndTime, &history.Status,
 		&history.RecordsSynced, &history.ErrorMessage, &history.TotalRecords,
 		&history.PageSynced, &history.TotalPages, &history.BillingMonth, &history.FailedCount,
-		&history.SyncTime, &history.Duration, &history.Message,
+		&syncTime, &history.Duration, &history.Message,
+		&history.AccountID, &history.AccountName,
 	)
 
 	if err != nil {
@@ -193,17 +210,27 @@ func (s *DatabaseService) GetLatestSyncHistory() (*models.SyncHistory, error) {
 		}
 		return nil, fmt.Errorf("failed to get latest sync history: %w", err)
 	}
+	history.SyncTime = syncTimeOrStart(syncTime, history.StartTime)
 
 	return &history, nil
 }
 
+// syncTimeOrStart falls back to the start time for records without sync_time.
+// COALESCE in SQL would lose the DATETIME column type and return a string.
+func syncTimeOrStart(syncTime *time.Time, startTime time.Time) time.Time {
+	if syncTime != nil {
+		return *syncTime
+	}
+	return startTime
+}
+
 // GetRunningSyncCount counts the number of currently running syncs
 func (s *DatabaseService) GetRunningSyncCount() (int, error) {
 	// First, clean up any stale running syncs (older than 10 minutes)
 	err := s.CleanupStaleRunningSyncs()
 	if err != nil {
 		// Log error but don't fail the count
-		fmt.Printf("Warning: failed to cleanup stale running syncs: %v\n", err)
+		log.Printf("Warning: failed to cleanup stale running syncs: %v", err)
 	}
 
 	var count int
@@ -289,7 +316,8 @@ func (s *DatabaseService) GetAutoSyncConfig(key string) (string, error) {
 		case "sync_type":
 			return config.SyncType, nil
 		default:
-			return "", fmt.Errorf("config key not found: %s", key)
+			// 其他配置项存储在通用设置表中
+			return s.GetAppSetting(key)
 		}
 	}
 }
@@ -344,7 +372,8 @@ func (s *DatabaseService) SetAutoSyncConfig(key, value, description string) erro
 		case "sync_type":
 			config.SyncType = value
 		default:
-			return fmt.Errorf("config key not supported: %s", key)
+			// 其他配置项存储在通用设置表中
+			return s.SetAppSetting(key, value, description)
 		}
 
 		// 保存更新后的配置
@@ -532,7 +561,7 @@ func (s *DatabaseService) GetMembershipTierLimits(tierName string) (*models.Memb
 func (s *DatabaseService) GetMembershipTierLimit(tierName string) (*models.MembershipTierLimit, error) {
 	query := `
 		SELECT id, tier_name, daily_limit, monthly_limit, max_tokens, max_context_length,
-		       features, description, updated_at
+		       features, description, period_hours, call_limit, daily_cost_limit, monthly_cost_limit, monthly_price, updated_at
 		FROM membership_tier_limits
 		WHERE tier_name = ?
 	`
@@ -541,7 +570,8 @@ func (s *DatabaseService) GetMembershipTierLimit(tierName string) (*models.Membe
 	err := s.db.QueryRow(query, tierName).Scan(
 		&limit.ID, &limit.TierName, &limit.DailyLimit, &limit.MonthlyLimit,
 		&limit.MaxTokens, &limit.MaxContextLength, &limit.Features,
-		&limit.Description, &limit.UpdatedAt,
+		&limit.Description, &limit.PeriodHours, &limit.CallLimit,
+		&limit.DailyCostLimit, &limit.MonthlyCostLimit, &limit.MonthlyPrice, &limit.UpdatedAt,
 	)
 
 	if err != nil {
@@ -559,8 +589,8 @@ func (s *DatabaseService) SaveMembershipTierLimit(limit *models.MembershipTierLi
 	query := `
 		INSERT INTO membership_tier_limits
 		(tier_name, daily_limit, monthly_limit, max_tokens, max_context_length,
-		 features, description, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		 features, description, period_hours, call_limit, daily_cost_limit, monthly_cost_limit, monthly_price, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(tier_name) DO UPDATE SET
 			daily_limit = excluded.daily_limit,
 			monthly_limit = excluded.monthly_limit,
@@ -568,12 +598,18 @@ func (s *DatabaseService) SaveMembershipTierLimit(limit *models.MembershipTierLi
 			max_context_length = excluded.max_context_length,
 			features = excluded.features,
 			description = excluded.description,
+			period_hours = excluded.period_hours,
+			call_limit = excluded.call_limit,
+			daily_cost_limit = excluded.daily_cost_limit,
+			monthly_cost_limit = excluded.monthly_cost_limit,
+			monthly_price = excluded.monthly_price,
 			updated_at = excluded.updated_at
 	`
 
 	_, err := s.db.Exec(query,
 		limit.TierName, limit.DailyLimit, limit.MonthlyLimit, limit.MaxTokens,
-		limit.MaxContextLength, limit.Features, limit.Description, time.Now(),
+		limit.MaxContextLength, limit.Features, limit.Description, limit.PeriodHours, limit.CallLimit,
+		limit.DailyCostLimit, limit.MonthlyCostLimit, limit.MonthlyPrice, time.Now(),
 	)
 
 	if err != nil {
@@ -587,7 +623,7 @@ func (s *DatabaseService) SaveMembershipTierLimit(limit *models.MembershipTierLi
 func (s *DatabaseService) GetAllMembershipTierLimits() ([]models.MembershipTierLimit, error) {
 	query := `
 		SELECT id, tier_name, daily_limit, monthly_limit, max_tokens, max_context_length,
-		       features, description, updated_at
+		       features, description, period_hours, call_limit, daily_cost_limit, monthly_cost_limit, monthly_price, updated_at
 		FROM membership_tier_limits
 		ORDER BY tier_name
 	`
@@ -604,7 +640,8 @@ func (s *DatabaseService) GetAllMembershipTierLimits() ([]models.MembershipTierL
 		err := rows.Scan(
 			&limit.ID, &limit.TierName, &limit.DailyLimit, &limit.MonthlyLimit,
 			&limit.MaxTokens, &limit.MaxContextLength, &limit.Features,
-			&limit.Description, &limit.UpdatedAt,
+			&limit.Description, &limit.PeriodHours, &limit.CallLimit,
+			&limit.DailyCostLimit, &limit.MonthlyCostLimit, &limit.MonthlyPrice, &limit.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan membership tier limit: %w", err)
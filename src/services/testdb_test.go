@@ -0,0 +1,242 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// newTestDB opens an in-memory database prepared with the given schema statements. A single
+// connection keeps every statement on the same in-memory database; it is closed with the test.
+func newTestDB(t *testing.T, schema ...string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("failed to prepare test schema: %v", err)
+		}
+	}
+
+	return db
+}
+
+// expenseBillsTestSchema creates expense_bills with the columns the services read and write
+func expenseBillsTestSchema() string {
+	columns := make([]string, 0, len(expenseBillColumns))
+	for _, column := range expenseBillColumns {
+		switch column {
+		case "id":
+			columns = append(columns, "id TEXT PRIMARY KEY")
+		case "transaction_time", "time_window_start", "time_window_end", "create_time":
+			columns = append(columns, column+" DATETIME")
+		default:
+			columns = append(columns, column)
+		}
+	}
+	return fmt.Sprintf("CREATE TABLE expense_bills (%s)", strings.Join(columns, ", "))
+}
+
+// Test schemas of the remaining tables, mirroring the migrated columns the services use
+const (
+	tierTestSchema = `
+		CREATE TABLE tier_detection_rules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			tier_name TEXT NOT NULL,
+			match_field TEXT NOT NULL,
+			match_type TEXT NOT NULL DEFAULT 'contains',
+			pattern TEXT NOT NULL,
+			priority INTEGER NOT NULL DEFAULT 100,
+			enabled BOOLEAN NOT NULL DEFAULT 1,
+			description TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE membership_tier_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			tier_name TEXT NOT NULL,
+			effective_from DATETIME NOT NULL,
+			rule_id INTEGER,
+			match_field TEXT,
+			match_value TEXT,
+			detected_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			account_id INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE membership_tier_limits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			tier_name TEXT NOT NULL UNIQUE,
+			daily_limit INTEGER,
+			monthly_limit INTEGER,
+			max_tokens INTEGER,
+			max_context_length INTEGER,
+			features TEXT,
+			description TEXT,
+			period_hours INTEGER,
+			call_limit INTEGER,
+			daily_cost_limit REAL,
+			monthly_cost_limit REAL,
+			monthly_price REAL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO tier_detection_rules (tier_name, match_field, match_type, pattern, priority) VALUES
+			('lite', 'token_resource_name', 'contains', 'lite', 10),
+			('pro', 'token_resource_name', 'contains', 'pro', 40);
+		INSERT INTO membership_tier_limits (tier_name, monthly_price) VALUES ('free', 0), ('lite', 20), ('pro', 100);
+	`
+
+	appSettingsTestSchema = `CREATE TABLE app_settings (
+		setting_key TEXT PRIMARY KEY,
+		setting_value TEXT,
+		description TEXT,
+		updated_at DATETIME
+	)`
+
+	apiTokensTestSchema = `
+		CREATE TABLE api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token_name TEXT NOT NULL,
+			token_value TEXT NOT NULL,
+			token_hint TEXT NOT NULL DEFAULT '',
+			token_hash TEXT,
+			provider TEXT,
+			token_type TEXT,
+			is_active INTEGER DEFAULT 1,
+			daily_limit INTEGER,
+			monthly_limit INTEGER,
+			expires_at DATETIME,
+			last_used_at DATETIME,
+			created_at DATETIME,
+			updated_at DATETIME
+		);
+		CREATE UNIQUE INDEX idx_api_tokens_unique_hash ON api_tokens(token_hash) WHERE token_hash IS NOT NULL;
+	`
+
+	tokenRotationsTestSchema = `CREATE TABLE token_rotations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		token_id INTEGER NOT NULL,
+		token_name TEXT NOT NULL DEFAULT '',
+		previous_token_value TEXT NOT NULL DEFAULT '',
+		previous_token_hint TEXT NOT NULL DEFAULT '',
+		previous_expires_at DATETIME,
+		new_token_hint TEXT NOT NULL DEFAULT '',
+		customer_id TEXT NOT NULL DEFAULT '',
+		account_check TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		message TEXT NOT NULL DEFAULT '',
+		grace_until DATETIME,
+		rotated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		rolled_back_at DATETIME,
+		new_token_value TEXT NOT NULL DEFAULT ''
+	)`
+
+	tokenExpiryWarningsTestSchema = `CREATE TABLE token_expiry_warnings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		token_id INTEGER NOT NULL,
+		expires_at DATETIME NOT NULL,
+		days_before INTEGER NOT NULL,
+		warned_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(token_id, expires_at, days_before)
+	)`
+
+	notificationsTestSchema = `CREATE TABLE notifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, type INTEGER, category TEXT, title TEXT, message TEXT, data TEXT,
+		dedup_key TEXT UNIQUE, occurrences INTEGER, created_at DATETIME, updated_at DATETIME, read_at DATETIME)`
+
+	notificationDeliveriesTestSchema = `CREATE TABLE notification_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		channel_id INTEGER NOT NULL,
+		channel_name TEXT NOT NULL,
+		notification_type TEXT NOT NULL,
+		title TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		status_code INTEGER,
+		error_message TEXT,
+		response_body TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		completed_at DATETIME
+	)`
+
+	usageAnomaliesTestSchema = `
+		CREATE TABLE usage_anomalies (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			hour_start DATETIME NOT NULL,
+			metric TEXT NOT NULL,
+			value REAL NOT NULL,
+			baseline REAL NOT NULL,
+			deviation REAL NOT NULL,
+			score REAL NOT NULL,
+			top_model TEXT,
+			top_api_key TEXT,
+			detected_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE UNIQUE INDEX idx_usage_anomalies_hour_metric ON usage_anomalies(hour_start, metric);
+	`
+
+	alertRulesTestSchema = `
+		CREATE TABLE alert_rules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			metric TEXT NOT NULL,
+			filter TEXT NOT NULL DEFAULT '{}',
+			comparison TEXT NOT NULL,
+			threshold REAL NOT NULL,
+			window_minutes INTEGER NOT NULL,
+			cooldown_minutes INTEGER NOT NULL DEFAULT 60,
+			severity TEXT NOT NULL DEFAULT 'warning',
+			weekdays TEXT NOT NULL DEFAULT '[]',
+			enabled BOOLEAN DEFAULT 1,
+			description TEXT,
+			state TEXT NOT NULL DEFAULT 'ok',
+			last_value REAL,
+			last_evaluated_at DATETIME,
+			last_fired_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE alert_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			rule_id INTEGER NOT NULL,
+			rule_name TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			value REAL NOT NULL,
+			threshold REAL NOT NULL,
+			message TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+	`
+)
+
+// newBillTestDB opens an in-memory database with the expense_bills table and the tier tables
+// used by tier detection and savings
+func newBillTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	return newTestDB(t, expenseBillsTestSchema(), tierTestSchema)
+}
+
+// newTokenVaultTestDB opens an in-memory database with the tables used by the token vault and
+// the token rotator
+func newTokenVaultTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	return newTestDB(t, appSettingsTestSchema, apiTokensTestSchema, tokenRotationsTestSchema)
+}
+
+// newTestNotificationService creates a notification service on an in-memory notifications table
+func newTestNotificationService(t *testing.T) *NotificationService {
+	t.Helper()
+	return newTestNotificationServiceOn(newTestDB(t, notificationsTestSchema))
+}
+
+// newTestNotificationServiceOn creates a notification service on a test database that has
+// the notifications table
+func newTestNotificationServiceOn(db *sql.DB) *NotificationService {
+	return &NotificationService{db: db, broadcastChannel: make(chan Notification, 100)}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"glm-usage-monitor/models"
+	"strings"
+	"time"
+)
+
+// membershipTierCatalogueVersion is the current JSON catalogue format version
+const membershipTierCatalogueVersion = 1
+
+// validateMembershipTierLimit checks a catalogue entry before it is saved
+func validateMembershipTierLimit(limit *models.MembershipTierLimit) error {
+	limit.TierName = strings.TrimSpace(limit.TierName)
+	if limit.TierName == "" {
+		return fmt.Errorf("tier name is required")
+	}
+
+	for name, value := range map[string]*int{
+		"daily_limit":        limit.DailyLimit,
+		"monthly_limit":      limit.MonthlyLimit,
+		"max_tokens":         limit.MaxTokens,
+		"max_context_length": limit.MaxContextLength,
+		"period_hours":       limit.PeriodHours,
+		"call_limit":         limit.CallLimit,
+	} {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("%s cannot be negative", name)
+		}
+	}
+	for name, value := range map[string]*float64{
+		"daily_cost_limit":   limit.DailyCostLimit,
+		"monthly_cost_limit": limit.MonthlyCostLimit,
+		"monthly_price":      limit.MonthlyPrice,
+	} {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("%s cannot be negative", name)
+		}
+	}
+
+	// 周期次数限制需要同时配置周期和次数
+	if (limit.PeriodHours == nil) != (limit.CallLimit == nil) {
+		return fmt.Errorf("period_hours and call_limit must be set together")
+	}
+
+	return nil
+}
+
+// DeleteMembershipTierLimit deletes a tier from the catalogue
+func (s *DatabaseService) DeleteMembershipTierLimit(tierName string) error {
+	result, err := s.db.Exec("DELETE FROM membership_tier_limits WHERE tier_name = ?", tierName)
+	if err != nil {
+		return fmt.Errorf("failed to delete membership tier limit: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("membership tier not found: %s", tierName)
+	}
+
+	return nil
+}
+
+// ImportMembershipTierLimits saves all tiers in one transaction. With replace, tiers missing
+// from the import are removed; otherwise they are kept.
+func (s *DatabaseService) ImportMembershipTierLimits(limits []models.MembershipTierLimit, replace bool) error {
+	seen := make(map[string]bool, len(limits))
+	for i := range limits {
+		if err := validateMembershipTierLimit(&limits[i]); err != nil {
+			return fmt.Errorf("invalid tier #%d: %w", i+1, err)
+		}
+		if seen[limits[i].TierName] {
+			return fmt.Errorf("duplicate tier: %s", limits[i].TierName)
+		}
+		seen[limits[i].TierName] = true
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.Exec("DELETE FROM membership_tier_limits"); err != nil {
+			return fmt.Errorf("failed to clear membership tier limits: %w", err)
+		}
+	}
+
+	now := time.Now()
+	for _, limit := range limits {
+		_, err := tx.Exec(`
+			INSERT INTO membership_tier_limits
+			(tier_name, daily_limit, monthly_limit, max_tokens, max_context_length,
+			 features, description, period_hours, call_limit, daily_cost_limit, monthly_cost_limit, monthly_price, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(tier_name) DO UPDATE SET
+				daily_limit = excluded.daily_limit,
+				monthly_limit = excluded.monthly_limit,
+				max_tokens = excluded.max_tokens,
+				max_context_length = excluded.max_context_length,
+				features = excluded.features,
+				description = excluded.description,
+				period_hours = excluded.period_hours,
+				call_limit = excluded.call_limit,
+				daily_cost_limit = excluded.daily_cost_limit,
+				monthly_cost_limit = excluded.monthly_cost_limit,
+				monthly_price = excluded.monthly_price,
+				updated_at = excluded.updated_at
+		`, limit.TierName, limit.DailyLimit, limit.MonthlyLimit, limit.MaxTokens,
+			limit.MaxContextLength, limit.Features, limit.Description, limit.PeriodHours, limit.CallLimit,
+			limit.DailyCostLimit, limit.MonthlyCostLimit, limit.MonthlyPrice, now)
+		if err != nil {
+			return fmt.Errorf("failed to import membership tier %s: %w", limit.TierName, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit membership tier import: %w", err)
+	}
+
+	return nil
+}
+
+// ExportMembershipTierCatalogue serializes the tier catalogue as JSON
+func (s *DatabaseService) ExportMembershipTierCatalogue() (string, error) {
+	limits, err := s.GetAllMembershipTierLimits()
+	if err != nil {
+		return "", err
+	}
+	if limits == nil {
+		limits = []models.MembershipTierLimit{}
+	}
+
+	catalogue := models.MembershipTierCatalogue{
+		Version:    membershipTierCatalogueVersion,
+		ExportedAt: time.Now(),
+		Tiers:      limits,
+	}
+
+	data, err := json.MarshalIndent(catalogue, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal membership tier catalogue: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// ParseMembershipTierCatalogue parses a JSON catalogue, accepting either the exported
+// object format or a bare array of tiers
+func ParseMembershipTierCatalogue(data string) ([]models.MembershipTierLimit, error) {
+	trimmed := strings.TrimSpace(data)
+	if strings.HasPrefix(trimmed, "[") {
+		var limits []models.MembershipTierLimit
+		if err := json.Unmarshal([]byte(trimmed), &limits); err != nil {
+			return nil, fmt.Errorf("failed to parse membership tier catalogue: %w", err)
+		}
+		return limits, nil
+	}
+
+	var catalogue models.MembershipTierCatalogue
+	if err := json.Unmarshal([]byte(trimmed), &catalogue); err != nil {
+		return nil, fmt.Errorf("failed to parse membership tier catalogue: %w", err)
+	}
+	if catalogue.Version > membershipTierCatalogueVersion {
+		return nil, fmt.Errorf("unsupported catalogue version: %d", catalogue.Version)
+	}
+
+	return catalogue.Tiers, nil
+}
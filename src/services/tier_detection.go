@@ -0,0 +1,539 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"glm-usage-monitor/models"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Tier detection match fields
+const (
+	TierMatchFieldTokenResourceName = "token_resource_name"
+	TierMatchFieldTokenResourceNo   = "token_resource_no"
+	TierMatchFieldModelProductCode  = "model_product_code"
+)
+
+// Tier detection match types
+const (
+	TierMatchTypeContains = "contains"
+	TierMatchTypeEquals   = "equals"
+	TierMatchTypePrefix   = "prefix"
+	TierMatchTypeRegex    = "regex"
+)
+
+// defaultMembershipTier is used before the first detected tier change
+const defaultMembershipTier = "free"
+
+// tierMatcher is a compiled tier detection rule
+type tierMatcher struct {
+	rule models.TierDetectionRule
+	re   *regexp.Regexp
+}
+
+// matches reports whether the value matches the rule, case-insensitively
+func (m *tierMatcher) matches(value string) bool {
+	if value == "" {
+		return false
+	}
+
+	v := strings.ToLower(value)
+	pattern := strings.ToLower(m.rule.Pattern)
+	switch m.rule.MatchType {
+	case TierMatchTypeEquals:
+		return v == pattern
+	case TierMatchTypePrefix:
+		return strings.HasPrefix(v, pattern)
+	case TierMatchTypeRegex:
+		return m.re != nil && m.re.MatchString(value)
+	default:
+		return strings.Contains(v, pattern)
+	}
+}
+
+// newTierMatcher validates and compiles a tier detection rule
+func newTierMatcher(rule models.TierDetectionRule) (*tierMatcher, error) {
+	if strings.TrimSpace(rule.TierName) == "" {
+		return nil, fmt.Errorf("tier name is required")
+	}
+	if rule.Pattern == "" {
+		return nil, fmt.Errorf("pattern is required")
+	}
+
+	switch rule.MatchField {
+	case TierMatchFieldTokenResourceName, TierMatchFieldTokenResourceNo, TierMatchFieldModelProductCode:
+	default:
+		return nil, fmt.Errorf("invalid match field: %s. Valid fields are: %s, %s, %s", rule.MatchField,
+			TierMatchFieldTokenResourceName, TierMatchFieldTokenResourceNo, TierMatchFieldModelProductCode)
+	}
+
+	matcher := &tierMatcher{rule: rule}
+	switch rule.MatchType {
+	case TierMatchTypeContains, TierMatchTypeEquals, TierMatchTypePrefix:
+	case TierMatchTypeRegex:
+		re, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern: %w", err)
+		}
+		matcher.re = re
+	default:
+		return nil, fmt.Errorf("invalid match type: %s. Valid types are: %s, %s, %s, %s", rule.MatchType,
+			TierMatchTypeContains, TierMatchTypeEquals, TierMatchTypePrefix, TierMatchTypeRegex)
+	}
+
+	return matcher, nil
+}
+
+// ========== TierDetectionRule Operations ==========
+
+// GetTierDetectionRules retrieves all tier detection rules ordered by priority
+func (s *DatabaseService) GetTierDetectionRules() ([]models.TierDetectionRule, error) {
+	query := `
+		SELECT id, tier_name, match_field, match_type, pattern, priority, enabled,
+		       COALESCE(description, ''), created_at, updated_at
+		FROM tier_detection_rules
+		ORDER BY priority, id
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tier detection rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []models.TierDetectionRule
+	for rows.Next() {
+		var rule models.TierDetectionRule
+		err := rows.Scan(
+			&rule.ID, &rule.TierName, &rule.MatchField, &rule.MatchType, &rule.Pattern,
+			&rule.Priority, &rule.Enabled, &rule.Description, &rule.CreatedAt, &rule.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tier detection rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// SaveTierDetectionRule creates a rule when its ID is zero, otherwise updates it
+func (s *DatabaseService) SaveTierDetectionRule(rule *models.TierDetectionRule) error {
+	if rule.MatchType == "" {
+		rule.MatchType = TierMatchTypeContains
+	}
+	if _, err := newTierMatcher(*rule); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if rule.ID == 0 {
+		result, err := s.db.Exec(`
+			INSERT INTO tier_detection_rules
+			(tier_name, match_field, match_type, pattern, priority, enabled, description, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, rule.TierName, rule.MatchField, rule.MatchType, rule.Pattern, rule.Priority, rule.Enabled,
+			rule.Description, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to create tier detection rule: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get tier detection rule ID: %w", err)
+		}
+		rule.ID = int(id)
+		rule.CreatedAt = now
+		rule.UpdatedAt = now
+		return nil
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE tier_detection_rules
+		SET tier_name = ?, match_field = ?, match_type = ?, pattern = ?, priority = ?,
+		    enabled = ?, description = ?, updated_at = ?
+		WHERE id = ?
+	`, rule.TierName, rule.MatchField, rule.MatchType, rule.Pattern, rule.Priority,
+		rule.Enabled, rule.Description, now, rule.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update tier detection rule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("tier detection rule not found: %d", rule.ID)
+	}
+
+	rule.UpdatedAt = now
+	return nil
+}
+
+// DeleteTierDetectionRule deletes a tier detection rule
+func (s *DatabaseService) DeleteTierDetectionRule(id int) error {
+	result, err := s.db.Exec("DELETE FROM tier_detection_rules WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tier detection rule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("tier detection rule not found: %d", id)
+	}
+
+	return nil
+}
+
+// ========== MembershipTierHistory Operations ==========
+
+// loadTierMatchers compiles the enabled tier detection rules in priority order
+func (s *DatabaseService) loadTierMatchers() ([]*tierMatcher, error) {
+	rules, err := s.GetTierDetectionRules()
+	if err != nil {
+		return nil, err
+	}
+
+	var matchers []*tierMatcher
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		matcher, err := newTierMatcher(rule)
+		if err != nil {
+			log.Printf("Skipping invalid tier detection rule %d: %v", rule.ID, err)
+			continue
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	return matchers, nil
+}
+
+// RebuildMembershipTierHistory re-detects the tier of every bill of each account in chronological
+// order using the enabled rules, e.g. after the rules changed, and returns the resulting history.
+// Recorded changes that are detected again keep their detected_at.
+func (s *DatabaseService) RebuildMembershipTierHistory() ([]models.MembershipTierChange, error) {
+	matchers, err := s.loadTierMatchers()
+	if err != nil {
+		return nil, err
+	}
+
+	// 包括已没有账单的账号，以清除其历史
+	accountIDs, err := s.queryAccountIDs(`
+		SELECT DISTINCT COALESCE(account_id, 0) FROM expense_bills
+		UNION
+		SELECT DISTINCT account_id FROM membership_tier_history
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, accountID := range accountIDs {
+		if _, err := s.detectAccountTierChanges(matchers, accountID, time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetMembershipTierHistory()
+}
+
+// UpdateAllMembershipTierHistory detects new tier changes of every account from its last
+// recorded change and returns the changes added
+func (s *DatabaseService) UpdateAllMembershipTierHistory() ([]models.MembershipTierChange, error) {
+	accountIDs, err := s.queryAccountIDs("SELECT DISTINCT COALESCE(account_id, 0) FROM expense_bills")
+	if err != nil {
+		return nil, err
+	}
+
+	var added []models.MembershipTierChange
+	for _, accountID := range accountIDs {
+		changes, err := s.UpdateMembershipTierHistory(accountID, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+		added = append(added, changes...)
+	}
+
+	return added, nil
+}
+
+// UpdateMembershipTierHistory detects new tier changes of an account from its last recorded change,
+// or from since when bills earlier than that change were added (zero since is ignored), and returns
+// the changes added. Bills before the starting point are not read again.
+func (s *DatabaseService) UpdateMembershipTierHistory(accountID int, since time.Time) ([]models.MembershipTierChange, error) {
+	matchers, err := s.loadTierMatchers()
+	if err != nil {
+		return nil, err
+	}
+
+	var lastChange sql.NullString
+	err = s.db.QueryRow(`
+		SELECT MAX(datetime(effective_from)) FROM membership_tier_history WHERE account_id = ?
+	`, accountID).Scan(&lastChange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last membership tier change: %w", err)
+	}
+
+	// 没有历史时从头识别
+	start := time.Time{}
+	if lastChange.Valid {
+		start, err = time.Parse("2006-01-02 15:04:05", lastChange.String)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse last membership tier change: %w", err)
+		}
+		if !since.IsZero() && since.Before(start) {
+			start = since
+		}
+	}
+
+	return s.detectAccountTierChanges(matchers, accountID, start)
+}
+
+// queryAccountIDs runs a query returning a single column of account IDs
+func (s *DatabaseService) queryAccountIDs(query string) ([]int, error) {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query accounts for tier detection: %w", err)
+	}
+	defer rows.Close()
+
+	var accountIDs []int
+	for rows.Next() {
+		var accountID int
+		if err := rows.Scan(&accountID); err != nil {
+			return nil, fmt.Errorf("failed to scan account for tier detection: %w", err)
+		}
+		accountIDs = append(accountIDs, accountID)
+	}
+
+	return accountIDs, rows.Err()
+}
+
+// detectAccountTierChanges re-detects the tier changes of an account from its bills at or after
+// start and reconciles the recorded history from start on: changes still detected are kept
+// unchanged, new ones are inserted and the rest are removed. Bills that match no rule (e.g.
+// pay-as-you-go usage) carry no tier information and are skipped. Returns the inserted changes.
+func (s *DatabaseService) detectAccountTierChanges(matchers []*tierMatcher, accountID int, start time.Time) ([]models.MembershipTierChange, error) {
+	startArg := start.UTC().Format("2006-01-02 15:04:05")
+
+	// 起点之前最近一次记录的等级，相同等级不重复记录
+	var lastTier string
+	err := s.db.QueryRow(`
+		SELECT tier_name
+		FROM membership_tier_history
+		WHERE account_id = ? AND datetime(effective_from) < ?
+		ORDER BY datetime(effective_from) DESC, id DESC
+		LIMIT 1
+	`, accountID, startArg).Scan(&lastTier)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get previous membership tier: %w", err)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT datetime(transaction_time),
+		       COALESCE(token_resource_name, ''), COALESCE(token_resource_no, ''), COALESCE(model_product_code, '')
+		FROM expense_bills
+		WHERE COALESCE(account_id, 0) = ? AND datetime(transaction_time) >= ?
+		  AND (COALESCE(token_resource_name, '') != '' OR COALESCE(token_resource_no, '') != ''
+		       OR COALESCE(model_product_code, '') != '')
+		ORDER BY datetime(transaction_time)
+	`, accountID, startArg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bills for tier detection: %w", err)
+	}
+
+	// 相同资源信息的账单结果相同，缓存匹配结果
+	cache := make(map[string]*models.MembershipTierChange)
+	var changes []models.MembershipTierChange
+	for rows.Next() {
+		var transactionTime string
+		values := make(map[string]string, 3)
+		var name, no, code string
+		if err := rows.Scan(&transactionTime, &name, &no, &code); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan bill for tier detection: %w", err)
+		}
+		values[TierMatchFieldTokenResourceName] = name
+		values[TierMatchFieldTokenResourceNo] = no
+		values[TierMatchFieldModelProductCode] = code
+
+		cacheKey := name + "\x1f" + no + "\x1f" + code
+		detected, ok := cache[cacheKey]
+		if !ok {
+			detected = detectTier(matchers, values)
+			cache[cacheKey] = detected
+		}
+		if detected == nil || detected.TierName == lastTier {
+			continue
+		}
+
+		effectiveFrom, err := time.Parse("2006-01-02 15:04:05", transactionTime)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to parse transaction time: %w", err)
+		}
+
+		change := *detected
+		change.AccountID = accountID
+		change.EffectiveFrom = effectiveFrom
+		changes = append(changes, change)
+		lastTier = detected.TierName
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate bills for tier detection: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 起点之后已记录的变更：等级和生效时间相同则保留
+	recorded := make(map[string]int)
+	existing, err := tx.Query(`
+		SELECT id, tier_name, datetime(effective_from)
+		FROM membership_tier_history
+		WHERE account_id = ? AND datetime(effective_from) >= ?
+	`, accountID, startArg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recorded membership tier changes: %w", err)
+	}
+	for existing.Next() {
+		var id int
+		var tierName, effectiveFrom string
+		if err := existing.Scan(&id, &tierName, &effectiveFrom); err != nil {
+			existing.Close()
+			return nil, fmt.Errorf("failed to scan recorded membership tier change: %w", err)
+		}
+		recorded[tierName+"\x1f"+effectiveFrom] = id
+	}
+	existing.Close()
+
+	now := time.Now()
+	var added []models.MembershipTierChange
+	for _, change := range changes {
+		effectiveFrom := change.EffectiveFrom.Format("2006-01-02 15:04:05")
+		key := change.TierName + "\x1f" + effectiveFrom
+		if _, ok := recorded[key]; ok {
+			delete(recorded, key)
+			continue
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO membership_tier_history (account_id, tier_name, effective_from, rule_id, match_field, match_value, detected_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, change.AccountID, change.TierName, effectiveFrom, change.RuleID,
+			change.MatchField, change.MatchValue, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save membership tier change: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get membership tier change ID: %w", err)
+		}
+		change.ID = int(id)
+		change.DetectedAt = now
+		added = append(added, change)
+	}
+
+	// 不再识别出的变更
+	for _, id := range recorded {
+		if _, err := tx.Exec("DELETE FROM membership_tier_history WHERE id = ?", id); err != nil {
+			return nil, fmt.Errorf("failed to remove membership tier change: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit membership tier history: %w", err)
+	}
+
+	return added, nil
+}
+
+// detectTier returns the change produced by the first matching rule, or nil when no rule matches
+func detectTier(matchers []*tierMatcher, values map[string]string) *models.MembershipTierChange {
+	for _, matcher := range matchers {
+		value := values[matcher.rule.MatchField]
+		if !matcher.matches(value) {
+			continue
+		}
+
+		ruleID := matcher.rule.ID
+		return &models.MembershipTierChange{
+			TierName:   matcher.rule.TierName,
+			RuleID:     &ruleID,
+			MatchField: matcher.rule.MatchField,
+			MatchValue: value,
+		}
+	}
+	return nil
+}
+
+// GetMembershipTierHistory retrieves the detected tier changes of every account in chronological order
+func (s *DatabaseService) GetMembershipTierHistory() ([]models.MembershipTierChange, error) {
+	rows, err := s.db.Query(`
+		SELECT id, account_id, tier_name, effective_from, rule_id, COALESCE(match_field, ''), COALESCE(match_value, ''), detected_at
+		FROM membership_tier_history
+		ORDER BY datetime(effective_from), id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query membership tier history: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []models.MembershipTierChange
+	for rows.Next() {
+		var change models.MembershipTierChange
+		var ruleID sql.NullInt64
+		err := rows.Scan(&change.ID, &change.AccountID, &change.TierName, &change.EffectiveFrom, &ruleID,
+			&change.MatchField, &change.MatchValue, &change.DetectedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan membership tier change: %w", err)
+		}
+		if ruleID.Valid {
+			id := int(ruleID.Int64)
+			change.RuleID = &id
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// GetMembershipTierAt returns the tier of an account in effect at the given time, or the default
+// tier before the account's first detected change
+func (s *DatabaseService) GetMembershipTierAt(accountID int, t time.Time) (string, error) {
+	var tier string
+	err := s.db.QueryRow(`
+		SELECT tier_name
+		FROM membership_tier_history
+		WHERE account_id = ? AND datetime(effective_from) <= ?
+		ORDER BY datetime(effective_from) DESC, id DESC
+		LIMIT 1
+	`, accountID, t.UTC().Format("2006-01-02 15:04:05")).Scan(&tier)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return defaultMembershipTier, nil
+		}
+		return "", fmt.Errorf("failed to get membership tier: %w", err)
+	}
+
+	return tier, nil
+}
+
+// GetCurrentMembershipTier 获取账号当前的会员等级
+func (s *DatabaseService) GetCurrentMembershipTier(accountID int) (string, error) {
+	return s.GetMembershipTierAt(accountID, time.Now())
+}
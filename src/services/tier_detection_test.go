@@ -0,0 +1,107 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// tierBillingResponse returns a response with a single bill deducted from the named resource package
+func tierBillingResponse(billingNo, resourceName string) string {
+	return `{"code": 200, "data": {"billList": [{
+		"billingNo": "` + billingNo + `",
+		"chargeName": "GLM-4.6",
+		"modelCode": "glm-4.6",
+		"usageCount": 1000,
+		"usageUnit": "tokens",
+		"tokenResourceNo": "RES-` + billingNo + `",
+		"tokenResourceName": "` + resourceName + `",
+		"deductUsage": 1000
+	}]}}`
+}
+
+func TestMembershipTierHistoryIsScopedByAccount(t *testing.T) {
+	db := newBillTestDB(t)
+	ingestBillingResponse(t, db, 1, tierBillingResponse("cust1_1761955200000", "GLM Coding Lite"))
+	ingestBillingResponse(t, db, 2, tierBillingResponse("cust2_1761958800000", "GLM Coding Pro"))
+	ingestBillingResponse(t, db, 1, tierBillingResponse("cust1_1761962400000", "GLM Coding Lite"))
+
+	dbService := NewDatabaseService(db)
+	changes, err := dbService.RebuildMembershipTierHistory()
+	if err != nil {
+		t.Fatalf("RebuildMembershipTierHistory failed: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected one change per account, got %+v", changes)
+	}
+
+	at := time.Date(2025, 11, 2, 0, 0, 0, 0, time.UTC)
+	for accountID, want := range map[int]string{1: "lite", 2: "pro", 3: defaultMembershipTier} {
+		tier, err := dbService.GetMembershipTierAt(accountID, at)
+		if err != nil {
+			t.Fatalf("GetMembershipTierAt(%d) failed: %v", accountID, err)
+		}
+		if tier != want {
+			t.Errorf("account %d: expected tier %s, got %s", accountID, want, tier)
+		}
+	}
+}
+
+func TestMembershipTierHistoryIsUpdatedIncrementally(t *testing.T) {
+	db := newBillTestDB(t)
+	dbService := NewDatabaseService(db)
+
+	ingestBillingResponse(t, db, 1, tierBillingResponse("cust1_1761955200000", "GLM Coding Lite")) // 2025-11-01 00:00
+	if _, err := dbService.UpdateAllMembershipTierHistory(); err != nil {
+		t.Fatalf("UpdateAllMembershipTierHistory failed: %v", err)
+	}
+	before, err := dbService.GetMembershipTierHistory()
+	if err != nil || len(before) != 1 {
+		t.Fatalf("expected one recorded change, got %+v (%v)", before, err)
+	}
+
+	// 之后的账单只追加新的变更，已有记录保持不变
+	ingestBillingResponse(t, db, 1, tierBillingResponse("cust1_1762041600000", "GLM Coding Pro")) // 2025-11-02 00:00
+	added, err := dbService.UpdateMembershipTierHistory(1, time.Time{})
+	if err != nil {
+		t.Fatalf("UpdateMembershipTierHistory failed: %v", err)
+	}
+	if len(added) != 1 || added[0].TierName != "pro" {
+		t.Fatalf("expected the change to pro to be added, got %+v", added)
+	}
+
+	history, err := dbService.GetMembershipTierHistory()
+	if err != nil || len(history) != 2 {
+		t.Fatalf("expected two recorded changes, got %+v (%v)", history, err)
+	}
+	if history[0].ID != before[0].ID || !history[0].DetectedAt.Equal(before[0].DetectedAt) {
+		t.Errorf("existing change was rewritten: %+v -> %+v", before[0], history[0])
+	}
+
+	// 补同步更早的账单时从该账单起重新识别
+	ingestBillingResponse(t, db, 1, tierBillingResponse("cust1_1761868800000", "GLM Coding Pro")) // 2025-10-31 00:00
+	if _, err := dbService.UpdateMembershipTierHistory(1, time.Date(2025, 10, 31, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("UpdateMembershipTierHistory failed: %v", err)
+	}
+	history, err = dbService.GetMembershipTierHistory()
+	if err != nil {
+		t.Fatalf("GetMembershipTierHistory failed: %v", err)
+	}
+	var tiers []string
+	for _, change := range history {
+		tiers = append(tiers, change.TierName)
+	}
+	if len(tiers) != 3 || tiers[0] != "pro" || tiers[1] != "lite" || tiers[2] != "pro" {
+		t.Fatalf("expected pro -> lite -> pro, got %v", tiers)
+	}
+
+	// 规则未变时完整重建不改写已有记录
+	rebuilt, err := dbService.RebuildMembershipTierHistory()
+	if err != nil {
+		t.Fatalf("RebuildMembershipTierHistory failed: %v", err)
+	}
+	for i := range rebuilt {
+		if rebuilt[i].ID != history[i].ID || !rebuilt[i].DetectedAt.Equal(history[i].DetectedAt) {
+			t.Errorf("rebuild rewrote change %d: %+v -> %+v", i, history[i], rebuilt[i])
+		}
+	}
+}
@@ -0,0 +1,580 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"glm-usage-monitor/models"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// tokenCipherPrefix marks token values encrypted by TokenCipher
+const tokenCipherPrefix = "enc:v1:"
+
+// Token encryption key sources
+const (
+	TokenKeySourceKeyFile    = "keyfile"    // 随机密钥保存在数据库目录之外的密钥文件
+	TokenKeySourcePassphrase = "passphrase" // 由用户口令派生密钥
+)
+
+// TokenKeySourceConfigKey is the app setting holding the token encryption key source
+const TokenKeySourceConfigKey = "token_key_source"
+
+// App settings used to derive and verify the token encryption key
+const (
+	tokenKeySaltConfigKey  = "token_key_salt"
+	tokenKeyCheckConfigKey = "token_key_check"
+)
+
+// tokensEncryptedConfigKey marks that the plaintext tokens stored before encryption was
+// introduced have been encrypted
+const tokensEncryptedConfigKey = "tokens_encrypted"
+
+// Environment variables that configure the token encryption key
+const (
+	TokenPassphraseEnv = "GLM_USAGE_MONITOR_PASSPHRASE"
+	TokenKeyFileEnv    = "GLM_USAGE_MONITOR_KEY_FILE"
+)
+
+// tokenKeyIterations is the PBKDF2-HMAC-SHA256 iteration count for passphrase-derived keys
+const tokenKeyIterations = 210000
+
+// tokenHashContext separates the token fingerprint key from the encryption key
+const tokenHashContext = "token-hash"
+
+// tokenKeyCheckValue is encrypted with the current key to detect a wrong passphrase or key file
+const tokenKeyCheckValue = "glm-usage-monitor"
+
+// errTokensLocked is returned while the passphrase needed to decrypt tokens has not been entered
+var errTokensLocked = errors.New("API tokens are locked, enter the passphrase first")
+
+// TokenCipher encrypts API token values with AES-256-GCM
+type TokenCipher struct {
+	aead    cipher.AEAD
+	hashKey []byte // 令牌指纹的HMAC密钥，由加密密钥派生
+}
+
+// NewTokenCipher creates a cipher from a 32-byte key
+func NewTokenCipher(key []byte) (*TokenCipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("token key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(tokenHashContext))
+	return &TokenCipher{aead: aead, hashKey: mac.Sum(nil)}, nil
+}
+
+// Encrypt returns the prefixed base64 encoding of nonce and ciphertext
+func (c *TokenCipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return tokenCipherPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt
+func (c *TokenCipher) Decrypt(value string) (string, error) {
+	if !isEncryptedToken(value) {
+		return "", fmt.Errorf("token value is not encrypted")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, tokenCipherPrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode token value: %w", err)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", fmt.Errorf("token value is too short")
+	}
+
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt token value: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// Hash returns a keyed fingerprint of a plaintext token. Unlike the ciphertext it is the same
+// every time, so it identifies a token saved for two accounts.
+func (c *TokenCipher) Hash(plaintext string) string {
+	mac := hmac.New(sha256.New, c.hashKey)
+	mac.Write([]byte(plaintext))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// isEncryptedToken reports whether a stored token value was encrypted by TokenCipher
+func isEncryptedToken(value string) bool {
+	return strings.HasPrefix(value, tokenCipherPrefix)
+}
+
+// deriveTokenKey derives a 32-byte key from a passphrase with PBKDF2-HMAC-SHA256
+func deriveTokenKey(passphrase string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, tokenKeyIterations, 32, sha256.New)
+}
+
+// tokenKeyPath returns the key file location: $GLM_USAGE_MONITOR_KEY_FILE, or the user config
+// directory, which is kept apart from the database directory
+func tokenKeyPath() (string, error) {
+	if path := os.Getenv(TokenKeyFileEnv); path != "" {
+		return path, nil
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "glm-usage-monitor", "token.key"), nil
+}
+
+// loadOrCreateTokenKey reads the hex-encoded key file, creating it with a random key if missing
+func loadOrCreateTokenKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse token key file %s: %w", path, err)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read token key file %s: %w", path, err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate token key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create token key directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write token key file %s: %w", path, err)
+	}
+
+	log.Printf("Created token key file: %s", path)
+	return key, nil
+}
+
+// TokenVault holds the key used to encrypt API tokens at rest
+type TokenVault struct {
+	db        *sql.DB
+	dbService *DatabaseService
+
+	mu     sync.RWMutex
+	cipher *TokenCipher
+	source string
+}
+
+// NewTokenVault creates a new token vault; call Open before use
+func NewTokenVault(db *sql.DB, dbService *DatabaseService) *TokenVault {
+	return &TokenVault{
+		db:        db,
+		dbService: dbService,
+		source:    TokenKeySourceKeyFile,
+	}
+}
+
+// Open loads the key of the configured source. In passphrase mode without
+// $GLM_USAGE_MONITOR_PASSPHRASE the vault stays locked until Unlock is called.
+func (v *TokenVault) Open() error {
+	source, err := v.dbService.GetAppSetting(TokenKeySourceConfigKey)
+	if err != nil || source == "" {
+		source = TokenKeySourceKeyFile
+	}
+
+	v.mu.Lock()
+	v.source = source
+	v.mu.Unlock()
+
+	if source == TokenKeySourcePassphrase {
+		passphrase := os.Getenv(TokenPassphraseEnv)
+		if passphrase == "" {
+			log.Printf("API tokens are encrypted with a passphrase and stay locked until it is entered")
+			return nil
+		}
+		return v.Unlock(passphrase)
+	}
+
+	path, err := tokenKeyPath()
+	if err != nil {
+		return err
+	}
+	key, err := loadOrCreateTokenKey(path)
+	if err != nil {
+		return err
+	}
+	c, err := NewTokenCipher(key)
+	if err != nil {
+		return err
+	}
+
+	return v.use(c)
+}
+
+// Unlock derives the key from the passphrase and verifies it against the stored check value
+func (v *TokenVault) Unlock(passphrase string) error {
+	saltHex, err := v.dbService.GetAppSetting(tokenKeySaltConfigKey)
+	if err != nil {
+		return fmt.Errorf("no passphrase has been set")
+	}
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return fmt.Errorf("failed to parse token key salt: %w", err)
+	}
+
+	c, err := NewTokenCipher(deriveTokenKey(passphrase, salt))
+	if err != nil {
+		return err
+	}
+
+	return v.use(c)
+}
+
+// use verifies the cipher against the stored check value, then makes it current
+func (v *TokenVault) use(c *TokenCipher) error {
+	check, err := v.dbService.GetAppSetting(tokenKeyCheckConfigKey)
+	if err == nil && check != "" {
+		value, err := c.Decrypt(check)
+		if err != nil || value != tokenKeyCheckValue {
+			return fmt.Errorf("token encryption key does not match the stored tokens")
+		}
+	} else {
+		check, err := c.Encrypt(tokenKeyCheckValue)
+		if err != nil {
+			return err
+		}
+		if err := v.dbService.SetAppSetting(tokenKeyCheckConfigKey, check, "令牌加密密钥校验值"); err != nil {
+			return err
+		}
+	}
+
+	v.mu.Lock()
+	v.cipher = c
+	v.mu.Unlock()
+
+	if err := v.encryptLegacyTokens(); err != nil {
+		return err
+	}
+	return hashTokens(v.db, c)
+}
+
+// encryptLegacyTokens encrypts the plaintext tokens left from before encryption was introduced.
+// It runs once, on the first open with a key; tokens saved afterwards are always encrypted.
+func (v *TokenVault) encryptLegacyTokens() error {
+	if value, err := v.dbService.GetAppSetting(tokensEncryptedConfigKey); err == nil && value == "true" {
+		return nil
+	}
+
+	count, err := v.EncryptExistingTokens()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		log.Printf("Encrypted %d plaintext API token(s)", count)
+	}
+
+	return v.dbService.SetAppSetting(tokensEncryptedConfigKey, "true", "升级前保存的明文令牌已加密")
+}
+
+// hashTokens records the fingerprint of stored tokens that have none. Of a token saved for several
+// accounts only the first keeps its fingerprint and stays active, so its bills are not synced twice.
+func hashTokens(exec interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, c *TokenCipher) error {
+	rows, err := exec.Query("SELECT id, token_value FROM api_tokens WHERE token_hash IS NULL ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("failed to query API tokens: %w", err)
+	}
+	var ids []int
+	var values []string
+	for rows.Next() {
+		var id int
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan API token: %w", err)
+		}
+		ids = append(ids, id)
+		values = append(values, value)
+	}
+	rows.Close()
+
+	for i, id := range ids {
+		plaintext, err := c.Decrypt(values[i])
+		if err != nil {
+			log.Printf("Error hashing API token %d: %v", id, err)
+			continue
+		}
+		hash := c.Hash(plaintext)
+
+		result, err := exec.Exec(`
+			UPDATE api_tokens SET token_hash = ?
+			WHERE id = ? AND NOT EXISTS (SELECT 1 FROM api_tokens WHERE token_hash = ?)
+		`, hash, id, hash)
+		if err != nil {
+			return fmt.Errorf("failed to hash API token %d: %w", id, err)
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+			continue
+		}
+
+		// 重复保存的令牌停用，避免同一账号的账单被同步两次
+		if _, err := exec.Exec("UPDATE api_tokens SET is_active = 0 WHERE id = ?", id); err != nil {
+			return fmt.Errorf("failed to deactivate duplicate API token %d: %w", id, err)
+		}
+		log.Printf("API token %d duplicates the token of another account and was deactivated", id)
+	}
+
+	return nil
+}
+
+// Cipher returns the current cipher, or errTokensLocked
+func (v *TokenVault) Cipher() (*TokenCipher, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.cipher == nil {
+		return nil, errTokensLocked
+	}
+	return v.cipher, nil
+}
+
+// ForgetToken unregisters the plaintext of a discarded stored token from the redactor
+func (v *TokenVault) ForgetToken(storedToken string) {
+	c, err := v.Cipher()
+	if err != nil {
+		return
+	}
+	if plaintext, err := c.Decrypt(storedToken); err == nil {
+		DefaultRedactor().RemoveSecret(plaintext)
+	}
+}
+
+// Status reports the key source and whether tokens can currently be decrypted
+func (v *TokenVault) Status() map[string]interface{} {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	status := map[string]interface{}{
+		"source": v.source,
+		"locked": v.cipher == nil,
+	}
+	if v.source == TokenKeySourceKeyFile {
+		if path, err := tokenKeyPath(); err == nil {
+			status["key_file"] = path
+		}
+	}
+	return status
+}
+
+// EncryptExistingTokens encrypts plaintext token values and records their masked hint
+func (v *TokenVault) EncryptExistingTokens() (int, error) {
+	c, err := v.Cipher()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := v.db.Query("SELECT id, token_value FROM api_tokens")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query API tokens: %w", err)
+	}
+	plaintext := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan API token: %w", err)
+		}
+		if !isEncryptedToken(value) {
+			plaintext[id] = value
+		}
+	}
+	rows.Close()
+
+	for id, value := range plaintext {
+		encrypted, err := c.Encrypt(value)
+		if err != nil {
+			return 0, err
+		}
+		DefaultRedactor().AddSecret(value)
+		_, err = v.db.Exec("UPDATE api_tokens SET token_value = ?, token_hint = ? WHERE id = ?",
+			encrypted, models.MaskSecret(value), id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt API token %d: %w", id, err)
+		}
+	}
+
+	return len(plaintext), nil
+}
+
+// reencryptTokenColumn re-encrypts the non-empty token values of a table column from current to next
+func reencryptTokenColumn(tx *sql.Tx, table, column string, current, next *TokenCipher) error {
+	rows, err := tx.Query(fmt.Sprintf("SELECT id, %s FROM %s WHERE %s != ''", column, table, column))
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", table, err)
+	}
+	stored := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan %s: %w", table, err)
+		}
+		stored[id] = value
+	}
+	rows.Close()
+
+	for id, value := range stored {
+		plaintext := value
+		if isEncryptedToken(value) {
+			if plaintext, err = current.Decrypt(value); err != nil {
+				return fmt.Errorf("failed to decrypt %s %d: %w", table, id, err)
+			}
+		}
+		encrypted, err := next.Encrypt(plaintext)
+		if err != nil {
+			return err
+		}
+		query := fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", table, column)
+		if _, err := tx.Exec(query, encrypted, id); err != nil {
+			return fmt.Errorf("failed to re-encrypt %s %d: %w", table, id, err)
+		}
+	}
+
+	return nil
+}
+
+// SetPassphrase re-encrypts all tokens under a key derived from passphrase, or under the key
+// file when passphrase is empty. The vault must be unlocked.
+func (v *TokenVault) SetPassphrase(passphrase string) error {
+	current, err := v.Cipher()
+	if err != nil {
+		return err
+	}
+
+	source := TokenKeySourceKeyFile
+	var key []byte
+	saltHex := ""
+	if passphrase != "" {
+		source = TokenKeySourcePassphrase
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return fmt.Errorf("failed to generate salt: %w", err)
+		}
+		saltHex = hex.EncodeToString(salt)
+		key = deriveTokenKey(passphrase, salt)
+	} else {
+		path, err := tokenKeyPath()
+		if err != nil {
+			return err
+		}
+		if key, err = loadOrCreateTokenKey(path); err != nil {
+			return err
+		}
+	}
+
+	next, err := NewTokenCipher(key)
+	if err != nil {
+		return err
+	}
+	check, err := next.Encrypt(tokenKeyCheckValue)
+	if err != nil {
+		return err
+	}
+
+	tx, err := v.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 轮换记录中的新令牌密文须与api_tokens保持一致，回滚时按密文比对
+	_, err = tx.Exec(`
+		UPDATE token_rotations SET new_token_value = ''
+		WHERE new_token_value != '' AND new_token_value != COALESCE(
+			(SELECT token_value FROM api_tokens WHERE api_tokens.id = token_rotations.token_id), '')
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to clear replaced rotation tokens: %w", err)
+	}
+	if err := reencryptTokenColumn(tx, "api_tokens", "token_value", current, next); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE token_rotations
+		SET new_token_value = (SELECT token_value FROM api_tokens WHERE api_tokens.id = token_rotations.token_id)
+		WHERE new_token_value != ''
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update rotation tokens: %w", err)
+	}
+	// 轮换宽限期内保留的旧令牌
+	if err := reencryptTokenColumn(tx, "token_rotations", "previous_token_value", current, next); err != nil {
+		return err
+	}
+	// 令牌指纹的密钥随加密密钥变化
+	if _, err := tx.Exec("UPDATE api_tokens SET token_hash = NULL"); err != nil {
+		return fmt.Errorf("failed to clear token hashes: %w", err)
+	}
+	if err := hashTokens(tx, next); err != nil {
+		return err
+	}
+
+	for key, value := range map[string]string{
+		TokenKeySourceConfigKey: source,
+		tokenKeySaltConfigKey:   saltHex,
+		tokenKeyCheckConfigKey:  check,
+	} {
+		_, err := tx.Exec(`
+			INSERT INTO app_settings (setting_key, setting_value, updated_at)
+			VALUES (?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(setting_key) DO UPDATE SET
+				setting_value = excluded.setting_value,
+				updated_at = excluded.updated_at
+		`, key, value)
+		if err != nil {
+			return fmt.Errorf("failed to save token key setting: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit token re-encryption: %w", err)
+	}
+
+	v.mu.Lock()
+	v.cipher = next
+	v.source = source
+	v.mu.Unlock()
+
+	log.Printf("API tokens re-encrypted with key source: %s", source)
+	return nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"database/sql"
+	"glm-usage-monitor/models"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenVaultEncryptsLegacyTokensOnce(t *testing.T) {
+	t.Setenv(TokenKeyFileEnv, filepath.Join(t.TempDir(), "token.key"))
+	db := newTokenVaultTestDB(t)
+	if _, err := db.Exec("INSERT INTO api_tokens (token_name, token_value) VALUES ('main', ?)", testZhipuKey); err != nil {
+		t.Fatalf("failed to insert token: %v", err)
+	}
+
+	vault := NewTokenVault(db, NewDatabaseService(db))
+	if err := vault.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	var value, hint string
+	if err := db.QueryRow("SELECT token_value, token_hint FROM api_tokens WHERE id = 1").Scan(&value, &hint); err != nil {
+		t.Fatalf("failed to query token: %v", err)
+	}
+	if !isEncryptedToken(value) || hint == "" {
+		t.Fatalf("expected the legacy token to be encrypted with a hint, got %q %q", value, hint)
+	}
+	c, _ := vault.Cipher()
+	if plaintext, err := c.Decrypt(value); err != nil || plaintext != testZhipuKey {
+		t.Errorf("expected the encrypted token to decrypt to the original, got %q (%v)", plaintext, err)
+	}
+
+	// 迁移只执行一次，之后打开不再扫描令牌表
+	if _, err := db.Exec("INSERT INTO api_tokens (token_name, token_value) VALUES ('raw', 'raw-value')"); err != nil {
+		t.Fatalf("failed to insert token: %v", err)
+	}
+	reopened := NewTokenVault(db, NewDatabaseService(db))
+	if err := reopened.Open(); err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if err := db.QueryRow("SELECT token_value FROM api_tokens WHERE id = 2").Scan(&value); err != nil {
+		t.Fatalf("failed to query token: %v", err)
+	}
+	if value != "raw-value" {
+		t.Errorf("expected no token sweep after the one-time migration, got %q", value)
+	}
+}
+
+func TestTokenVaultHashesTokens(t *testing.T) {
+	t.Setenv(TokenKeyFileEnv, filepath.Join(t.TempDir(), "token.key"))
+	db := newTokenVaultTestDB(t)
+	for _, name := range []string{"main", "copy"} {
+		if _, err := db.Exec("INSERT INTO api_tokens (token_name, token_value) VALUES (?, ?)", name, testZhipuKey); err != nil {
+			t.Fatalf("failed to insert token: %v", err)
+		}
+	}
+
+	vault := NewTokenVault(db, NewDatabaseService(db))
+	if err := vault.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	// 同一令牌保存两次时只保留第一个账号
+	hashOf := func(id int) (string, bool) {
+		var hash sql.NullString
+		var active bool
+		if err := db.QueryRow("SELECT token_hash, is_active FROM api_tokens WHERE id = ?", id).Scan(&hash, &active); err != nil {
+			t.Fatalf("failed to query token %d: %v", id, err)
+		}
+		return hash.String, active
+	}
+	c, _ := vault.Cipher()
+	if hash, active := hashOf(1); hash != c.Hash(testZhipuKey) || !active {
+		t.Errorf("expected the first token to be hashed and active, got %q %v", hash, active)
+	}
+	if hash, active := hashOf(2); hash != "" || active {
+		t.Errorf("expected the duplicate token to be deactivated without a hash, got %q %v", hash, active)
+	}
+
+	// 更换口令后指纹随密钥更新
+	if err := vault.SetPassphrase("correct horse battery staple"); err != nil {
+		t.Fatalf("SetPassphrase failed: %v", err)
+	}
+	next, _ := vault.Cipher()
+	if hash, _ := hashOf(1); hash != next.Hash(testZhipuKey) || hash == c.Hash(testZhipuKey) {
+		t.Errorf("expected the token to be rehashed with the new key, got %q", hash)
+	}
+}
+
+func TestAddAccountTokenRejectsDuplicate(t *testing.T) {
+	t.Setenv(TokenKeyFileEnv, filepath.Join(t.TempDir(), "token.key"))
+	db := newTokenVaultTestDB(t)
+	dbService := NewDatabaseService(db)
+	vault := NewTokenVault(db, dbService)
+	if err := vault.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	s := &APIService{dbService: dbService, tokenVault: vault}
+
+	encryptedValue, tokenHash, err := s.encryptToken(testZhipuKey)
+	if err != nil {
+		t.Fatalf("encryptToken failed: %v", err)
+	}
+	if err := dbService.CreateAPIToken(&models.APIToken{TokenName: "main", TokenValue: encryptedValue, TokenHash: tokenHash}); err != nil {
+		t.Fatalf("CreateAPIToken failed: %v", err)
+	}
+
+	// 密文每次不同，按指纹发现同一令牌
+	if _, err := s.AddAccountToken(testZhipuKey, "copy"); err == nil {
+		t.Fatalf("expected adding the same token for another account to fail")
+	}
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM api_tokens").Scan(&count)
+	if count != 1 {
+		t.Errorf("expected the duplicate token not to be saved, got %d tokens", count)
+	}
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"glm-usage-monitor/models"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// Token health statuses
+const (
+	TokenStatusOK       = "ok"
+	TokenStatusExpiring = "expiring"
+	TokenStatusExpired  = "expired"
+	TokenStatusInactive = "inactive"
+	TokenStatusNoExpiry = "no_expiry"
+)
+
+// DefaultTokenCheckInterval is how often the token monitor checks expiry on its timer
+const DefaultTokenCheckInterval = 24 * time.Hour
+
+// tokenExpiryWarningDays are the days before expiry at which a warning is sent, largest first
+var tokenExpiryWarningDays = []int{14, 3, 1}
+
+// isUnauthorizedError reports whether err carries an API_UNAUTHORIZED error from the billing API
+func isUnauthorizedError(err error) bool {
+	var appErr *AppError
+	return errors.As(err, &appErr) && appErr.Code == ErrCodeAPIUnauthorized
+}
+
+// TokenMonitor warns before API tokens expire and deactivates expired tokens
+type TokenMonitor struct {
+	db                  *sql.DB
+	dbService           *DatabaseService
+	notificationService *NotificationService
+	onDeactivate        func(token models.APIToken) // 令牌因过期停用后的回调
+
+	mu       sync.Mutex // 串行化定时检查与手动检查
+	ticker   *time.Ticker
+	stopChan chan bool
+	running  bool
+}
+
+// NewTokenMonitor creates a new token monitor
+func NewTokenMonitor(db *sql.DB, dbService *DatabaseService, notificationService *NotificationService,
+	onDeactivate func(token models.APIToken)) *TokenMonitor {
+	return &TokenMonitor{
+		db:                  db,
+		dbService:           dbService,
+		notificationService: notificationService,
+		onDeactivate:        onDeactivate,
+		stopChan:            make(chan bool, 1),
+	}
+}
+
+// Start checks tokens immediately and then periodically until Stop is called
+func (m *TokenMonitor) Start(interval time.Duration) {
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return
+	}
+	m.running = true
+	m.ticker = time.NewTicker(interval)
+	ticker := m.ticker
+	m.mu.Unlock()
+
+	log.Printf("Token monitor started with interval: %v", interval)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Token monitor goroutine panic recovered: %v", r)
+			}
+		}()
+
+		if _, err := m.CheckTokens(time.Now()); err != nil {
+			log.Printf("Error checking API tokens: %v", err)
+		}
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := m.CheckTokens(time.Now()); err != nil {
+					log.Printf("Error checking API tokens: %v", err)
+				}
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic check
+func (m *TokenMonitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.running {
+		return
+	}
+
+	m.running = false
+	m.ticker.Stop()
+	select {
+	case m.stopChan <- true:
+	default:
+	}
+
+	log.Println("Token monitor stopped")
+}
+
+// GetTokenHealth returns the expiry state of every token at now without notifying
+func (m *TokenMonitor) GetTokenHealth(now time.Time) ([]models.TokenHealth, error) {
+	tokens, err := m.dbService.GetAllAPITokens()
+	if err != nil {
+		return nil, err
+	}
+
+	health := make([]models.TokenHealth, 0, len(tokens))
+	for _, token := range tokens {
+		health = append(health, tokenHealth(token, now))
+	}
+
+	return health, nil
+}
+
+// tokenHealth derives the expiry state of a token at now
+func tokenHealth(token models.APIToken, now time.Time) models.TokenHealth {
+	health := models.TokenHealth{
+		TokenID:   token.ID,
+		TokenName: token.TokenName,
+		IsActive:  token.IsActive,
+		ExpiresAt: token.ExpiresAt,
+		Status:    TokenStatusNoExpiry,
+	}
+
+	if token.ExpiresAt != nil {
+		days := int(math.Ceil(token.ExpiresAt.Sub(now).Hours() / 24))
+		health.DaysRemaining = &days
+		switch {
+		case !token.ExpiresAt.After(now):
+			health.Status = TokenStatusExpired
+		case days <= tokenExpiryWarningDays[0]:
+			health.Status = TokenStatusExpiring
+		default:
+			health.Status = TokenStatusOK
+		}
+	}
+	if !token.IsActive && health.Status != TokenStatusExpired {
+		health.Status = TokenStatusInactive
+	}
+
+	return health
+}
+
+// CheckTokens warns once per threshold for active tokens close to expiry and deactivates
+// active tokens that have expired
+func (m *TokenMonitor) CheckTokens(now time.Time) ([]models.TokenHealth, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokens, err := m.dbService.GetAllAPITokens()
+	if err != nil {
+		return nil, err
+	}
+
+	healths := make([]models.TokenHealth, 0, len(tokens))
+	for _, token := range tokens {
+		health := tokenHealth(token, now)
+		if !token.IsActive {
+			healths = append(healths, health)
+			continue
+		}
+
+		switch health.Status {
+		case TokenStatusExpired:
+			if err := m.dbService.DeactivateAPIToken(token.ID); err != nil {
+				return nil, err
+			}
+			log.Printf("API token %s expired at %s and was deactivated", token.TokenName, token.ExpiresAt.Format(time.RFC3339))
+
+			health.IsActive = false
+			if m.notificationService != nil {
+				m.notificationService.AddTokenExpiredNotification(token.TokenName)
+			}
+			if m.onDeactivate != nil {
+				m.onDeactivate(token)
+			}
+		case TokenStatusExpiring:
+			if err := m.warnExpiring(token, *health.DaysRemaining); err != nil {
+				return nil, err
+			}
+		}
+
+		healths = append(healths, health)
+	}
+
+	return healths, nil
+}
+
+// warnExpiring records every threshold the token has reached and notifies the closest one
+// reached for the first time
+func (m *TokenMonitor) warnExpiring(token models.APIToken, daysRemaining int) error {
+	newThreshold := 0
+	for _, days := range tokenExpiryWarningDays {
+		if daysRemaining > days {
+			continue
+		}
+
+		// 唯一约束保证同一过期时间的每个阈值只提醒一次
+		result, err := m.db.Exec(`
+			INSERT OR IGNORE INTO token_expiry_warnings (token_id, expires_at, days_before, warned_at)
+			VALUES (?, ?, ?, ?)
+		`, token.ID, token.ExpiresAt.UTC().Format("2006-01-02 15:04:05"), days, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to record token expiry warning: %w", err)
+		}
+
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if inserted > 0 {
+			newThreshold = days
+		}
+	}
+
+	if newThreshold > 0 && m.notificationService != nil {
+		log.Printf("API token %s expires in %d day(s)", token.TokenName, daysRemaining)
+		m.notificationService.AddTokenExpiringNotification(&token, daysRemaining, newThreshold)
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"glm-usage-monitor/models"
+)
+
+// tokenMonitorTestExpiry is the expiry time of the monitored test token
+var tokenMonitorTestExpiry = time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestTokenMonitor creates a token monitor over an in-memory database holding one active
+// token expiring at tokenMonitorTestExpiry, capturing its notifications and deactivations
+func newTestTokenMonitor(t *testing.T) (*TokenMonitor, *capturingDispatcher, *[]models.APIToken) {
+	t.Helper()
+
+	db := newTestDB(t, apiTokensTestSchema, tokenExpiryWarningsTestSchema, notificationsTestSchema)
+	created := tokenMonitorTestExpiry.AddDate(0, -3, 0)
+	_, err := db.Exec(`
+		INSERT INTO api_tokens (token_name, token_value, is_active, expires_at, created_at, updated_at)
+		VALUES ('main', 'enc:v1:main', 1, ?, ?, ?)
+	`, tokenMonitorTestExpiry, created, created)
+	if err != nil {
+		t.Fatalf("failed to insert token: %v", err)
+	}
+
+	ns := newTestNotificationServiceOn(db)
+	dispatcher := &capturingDispatcher{}
+	ns.AddDispatcher(dispatcher)
+
+	deactivated := &[]models.APIToken{}
+	monitor := NewTokenMonitor(db, NewDatabaseService(db), ns, func(token models.APIToken) {
+		*deactivated = append(*deactivated, token)
+	})
+	return monitor, dispatcher, deactivated
+}
+
+func TestCheckTokensWarnsAndDeactivates(t *testing.T) {
+	monitor, dispatcher, deactivated := newTestTokenMonitor(t)
+
+	steps := []struct {
+		before      time.Duration // 距过期的时间，负数表示已过期
+		wantStatus  string
+		wantNotices []string // 本次新转发的通知去重键
+	}{
+		{20 * 24 * time.Hour, TokenStatusOK, nil},
+		{14 * 24 * time.Hour, TokenStatusExpiring, []string{"token_expiring:1:14"}},
+		{13 * 24 * time.Hour, TokenStatusExpiring, nil},
+		{3 * 24 * time.Hour, TokenStatusExpiring, []string{"token_expiring:1:3"}},
+		{60 * time.Hour, TokenStatusExpiring, nil},
+		{12 * time.Hour, TokenStatusExpiring, []string{"token_expiring:1:1"}},
+		{-time.Minute, TokenStatusExpired, []string{"token_expired:main"}},
+		// 已停用的令牌不再处理
+		{-24 * time.Hour, TokenStatusExpired, nil},
+	}
+
+	for _, step := range steps {
+		now := tokenMonitorTestExpiry.Add(-step.before)
+		dispatched := len(dispatcher.notifications)
+
+		healths, err := monitor.CheckTokens(now)
+		if err != nil {
+			t.Fatalf("CheckTokens at %s failed: %v", now, err)
+		}
+		if len(healths) != 1 || healths[0].Status != step.wantStatus {
+			t.Errorf("at %v before expiry: expected status %s, got %+v", step.before, step.wantStatus, healths)
+		}
+
+		var notices []string
+		for _, notification := range dispatcher.notifications[dispatched:] {
+			notices = append(notices, notification.DedupKey)
+		}
+		if len(notices) != len(step.wantNotices) || (len(notices) == 1 && notices[0] != step.wantNotices[0]) {
+			t.Errorf("at %v before expiry: expected notifications %v, got %v", step.before, step.wantNotices, notices)
+		}
+	}
+
+	if len(*deactivated) != 1 || (*deactivated)[0].TokenName != "main" {
+		t.Fatalf("expected the expired token to be deactivated once, got %+v", *deactivated)
+	}
+	tokens, err := monitor.dbService.GetAllAPITokens()
+	if err != nil {
+		t.Fatalf("GetAllAPITokens failed: %v", err)
+	}
+	if tokens[0].IsActive {
+		t.Error("expected the expired token to be inactive")
+	}
+}
+
+func TestCheckTokensNotifiesClosestThresholdOnly(t *testing.T) {
+	monitor, dispatcher, _ := newTestTokenMonitor(t)
+
+	// 首次检查时已不足3天，14天阈值一并记录但只提醒最近的阈值
+	if _, err := monitor.CheckTokens(tokenMonitorTestExpiry.Add(-48 * time.Hour)); err != nil {
+		t.Fatalf("CheckTokens failed: %v", err)
+	}
+	if len(dispatcher.notifications) != 1 || dispatcher.notifications[0].DedupKey != "token_expiring:1:3" {
+		t.Fatalf("expected a single 3-day warning, got %+v", dispatcher.notifications)
+	}
+
+	var recorded int
+	if err := monitor.db.QueryRow("SELECT COUNT(*) FROM token_expiry_warnings WHERE days_before IN (14, 3)").Scan(&recorded); err != nil {
+		t.Fatalf("failed to count warnings: %v", err)
+	}
+	if recorded != 2 {
+		t.Errorf("expected the 14 and 3 day thresholds to be recorded, got %d", recorded)
+	}
+}
+
+func TestTokenDeactivationPausesAutoSync(t *testing.T) {
+	tests := []struct {
+		name        string
+		otherActive bool
+		wantPaused  string
+	}{
+		{"last active account", false, "token_expired"},
+		{"another account still active", true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			monitor, _, _ := newTestTokenMonitor(t)
+			if tt.otherActive {
+				_, err := monitor.db.Exec(`
+					INSERT INTO api_tokens (token_name, token_value, is_active, created_at, updated_at)
+					VALUES ('backup', 'enc:v1:backup', 1, ?, ?)
+				`, time.Now(), time.Now())
+				if err != nil {
+					t.Fatalf("failed to insert token: %v", err)
+				}
+			}
+
+			apiService := &APIService{dbService: monitor.dbService}
+			apiService.autoSyncService = NewAutoSyncService(apiService, monitor.dbService)
+			apiService.autoSyncService.running = true // 模拟已启动的自动同步
+			monitor.onDeactivate = apiService.onTokenDeactivated
+
+			if _, err := monitor.CheckTokens(tokenMonitorTestExpiry.Add(time.Minute)); err != nil {
+				t.Fatalf("CheckTokens failed: %v", err)
+			}
+			if apiService.autoSyncService.pausedReason != tt.wantPaused {
+				t.Errorf("expected paused reason %q, got %q", tt.wantPaused, apiService.autoSyncService.pausedReason)
+			}
+		})
+	}
+}
+
+func TestSyncReportsRejectedToken(t *testing.T) {
+	retryConfig := DefaultRetryConfig
+	DefaultRetryConfig = RetryConfig{MaxRetries: 0, Backoff: 1}
+	t.Cleanup(func() { DefaultRetryConfig = retryConfig })
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"HTTP 401", http.StatusUnauthorized, `{"code": 401, "msg": "token expired"}`},
+		{"HTTP 403", http.StatusForbidden, `{"code": 403, "msg": "forbidden"}`},
+		{"response code 401", http.StatusOK, `{"code": 401, "msg": "token revoked"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			t.Cleanup(server.Close)
+
+			service := NewZhipuAPIService(testZhipuKey)
+			service.SetBaseURL(server.URL)
+
+			// 同步结果带上错误码，所有账号都被拒绝时 SyncBills 据此暂停自动同步
+			result, err := service.SyncFullMonth(2025, 11, nil)
+			if err != nil {
+				t.Fatalf("SyncFullMonth failed: %v", err)
+			}
+			if result.Success || result.ErrorCode != ErrCodeAPIUnauthorized {
+				t.Errorf("expected an unauthorized sync result, got success %v code %q", result.Success, result.ErrorCode)
+			}
+		})
+	}
+}
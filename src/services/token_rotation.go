@@ -0,0 +1,458 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"glm-usage-monitor/models"
+	"log"
+	"sync"
+	"time"
+)
+
+// Token rotation statuses
+const (
+	TokenRotationFailed     = "failed"
+	TokenRotationRotated    = "rotated"     // 已切换，宽限期内可回滚
+	TokenRotationRolledBack = "rolled_back" // 已回滚到旧令牌
+	TokenRotationCompleted  = "completed"   // 宽限期结束，旧令牌已清除
+)
+
+// Account checks of a rotation probe
+const (
+	AccountCheckMatched    = "matched"
+	AccountCheckUnverified = "unverified" // 本月无账单或账号无历史账单，无法比对
+)
+
+// DefaultTokenRotationGracePeriod is how long the previous token is kept for rollback
+const DefaultTokenRotationGracePeriod = 7 * 24 * time.Hour
+
+// tokenRotationProbePageSize is the number of bills fetched by the rotation probe sync
+const tokenRotationProbePageSize = 20
+
+const tokenRotationSelectColumns = `id, token_id, token_name, previous_token_value, previous_token_hint, previous_expires_at,
+	new_token_hint, new_token_value, customer_id, account_check, status, message, grace_until, rotated_at, rolled_back_at`
+
+// TokenRotator replaces API tokens after validating them against the billing API, keeping
+// the previous token for a grace period and recording every rotation
+type TokenRotator struct {
+	db          *sql.DB
+	tokenVault  *TokenVault
+	gracePeriod time.Duration
+	baseURL     string     // 探测使用的计费 API 地址
+	mu          sync.Mutex // 串行化轮换与回滚
+}
+
+// NewTokenRotator creates a new token rotator
+func NewTokenRotator(db *sql.DB, tokenVault *TokenVault) *TokenRotator {
+	return &TokenRotator{
+		db:          db,
+		tokenVault:  tokenVault,
+		gracePeriod: DefaultTokenRotationGracePeriod,
+		baseURL:     DefaultZhipuBaseURL,
+	}
+}
+
+// Rotate validates newValue, probes the current month to check it belongs to the same account
+// as token and switches token to it. A token whose account cannot be verified is only switched
+// to when force is set. Failed attempts are recorded too.
+func (r *TokenRotator) Rotate(token *models.APIToken, newValue string, force bool, now time.Time) (*models.TokenRotation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now = now.UTC()
+	if _, err := r.expire(now); err != nil {
+		log.Printf("Error expiring token rotations: %v", err)
+	}
+
+	tokenCipher, err := r.tokenVault.Cipher()
+	if err != nil {
+		return nil, NewAuthError(ErrCodeInvalidToken, err.Error())
+	}
+	// 新令牌先加密，探测与旧令牌都通过加密令牌创建服务，不在此处解密
+	encryptedValue, err := tokenCipher.Encrypt(newValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt token: %w", err)
+	}
+	previousService, err := r.newService(token.TokenValue, tokenCipher)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt current token: %w", err)
+	}
+	newService, err := r.newService(encryptedValue, tokenCipher)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt new token: %w", err)
+	}
+	if newService.GetAPIToken() == previousService.GetAPIToken() {
+		return nil, NewValidationError(ErrCodeInvalidParameter, "New token is the same as the current token")
+	}
+
+	rotation := &models.TokenRotation{
+		TokenID:           token.ID,
+		TokenName:         token.TokenName,
+		PreviousTokenHint: models.MaskSecret(previousService.GetAPIToken()),
+		PreviousExpiresAt: token.ExpiresAt,
+		NewTokenHint:      models.MaskSecret(newService.GetAPIToken()),
+		RotatedAt:         now,
+	}
+
+	err = r.probe(rotation, previousService, newService, now)
+	if err == nil && rotation.AccountCheck == AccountCheckUnverified && !force {
+		// 无法确认是同一账号时需要用户明确确认后才切换
+		err = NewValidationError(ErrCodeInvalidParameter,
+			"New token account could not be verified, confirm the rotation to switch anyway")
+	}
+	if err != nil {
+		rotation.Status = TokenRotationFailed
+		rotation.Message = err.Error()
+		if recordErr := r.insertRotation(r.db, rotation); recordErr != nil {
+			log.Printf("Error recording failed token rotation: %v", recordErr)
+		}
+		return rotation, err
+	}
+
+	graceUntil := now.Add(r.gracePeriod)
+	rotation.PreviousTokenValue = token.TokenValue
+	rotation.NewTokenValue = encryptedValue
+	rotation.GraceUntil = &graceUntil
+	rotation.Status = TokenRotationRotated
+
+	tokenHash := tokenCipher.Hash(newValue)
+	if err := r.switchToken(token, encryptedValue, tokenHash, rotation, now); err != nil {
+		return nil, err
+	}
+
+	token.TokenValue = encryptedValue
+	token.TokenHint = rotation.NewTokenHint
+	token.TokenHash = tokenHash
+	token.ExpiresAt = nil
+	rotation.CanRollback = true
+	return rotation, nil
+}
+
+// newService creates a Zhipu API service for a stored token against the rotator's billing API
+func (r *TokenRotator) newService(storedToken string, tokenCipher *TokenCipher) (*ZhipuAPIService, error) {
+	service, err := NewZhipuAPIServiceForToken(storedToken, tokenCipher)
+	if err != nil {
+		return nil, err
+	}
+	service.SetBaseURL(r.baseURL)
+	return service, nil
+}
+
+// probe validates the new token and checks with a probe sync of the current month that it
+// belongs to the same account as the previous token
+func (r *TokenRotator) probe(rotation *models.TokenRotation, previousService, newService *ZhipuAPIService, now time.Time) error {
+	if err := newService.ValidateAPIToken(); err != nil {
+		return NewAuthError(ErrCodeInvalidToken, "New token validation failed").WithCause(err)
+	}
+
+	billingMonth := now.In(models.ReportingLocation()).Format("2006-01")
+	customerID, err := r.probeCustomerID(newService, billingMonth)
+	if err != nil {
+		return fmt.Errorf("probe sync of %s failed: %w", billingMonth, err)
+	}
+	rotation.CustomerID = customerID
+
+	expected, err := r.accountCustomerID(rotation.TokenID)
+	if err != nil {
+		return err
+	}
+	if expected == "" {
+		// 账号没有已保存的账单时，用旧令牌探测（旧令牌可能已被撤销）
+		if expected, err = r.probeCustomerID(previousService, billingMonth); err != nil {
+			log.Printf("Previous token probe of %s failed: %v", billingMonth, err)
+			expected = ""
+		}
+	}
+
+	switch {
+	case customerID == "" || expected == "":
+		rotation.AccountCheck = AccountCheckUnverified
+		rotation.Message = "账号无法比对：本月无账单或该账号没有历史账单"
+	case customerID != expected:
+		return NewValidationError(ErrCodeInvalidParameter,
+			fmt.Sprintf("New token belongs to a different account (%s, expected %s)", customerID, expected))
+	default:
+		rotation.AccountCheck = AccountCheckMatched
+	}
+
+	return nil
+}
+
+// probeCustomerID fetches the first page of billingMonth and returns the account of its bills,
+// or "" when the month has no bills
+func (r *TokenRotator) probeCustomerID(service *ZhipuAPIService, billingMonth string) (string, error) {
+	resp, err := service.GetBillingData(&BillingRequest{
+		BillingMonth: billingMonth,
+		PageNum:      1,
+		PageSize:     tokenRotationProbePageSize,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	customerID := ""
+	for _, item := range resp.Data.BillList {
+		id := models.ExtractCustomerID(item.BillingNo)
+		if id == "" {
+			continue
+		}
+		if customerID != "" && id != customerID {
+			return "", fmt.Errorf("bills of %s belong to several accounts", billingMonth)
+		}
+		customerID = id
+	}
+
+	return customerID, nil
+}
+
+// accountCustomerID returns the account of the latest stored bill synced with the token
+func (r *TokenRotator) accountCustomerID(tokenID int) (string, error) {
+	var billingNo string
+	err := r.db.QueryRow(`
+		SELECT billing_no FROM expense_bills
+		WHERE account_id = ? AND billing_no != ''
+		ORDER BY transaction_time DESC
+		LIMIT 1
+	`, tokenID).Scan(&billingNo)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query account bills: %w", err)
+	}
+
+	return models.ExtractCustomerID(billingNo), nil
+}
+
+// switchToken replaces the stored token and records the rotation in one transaction. Earlier
+// rotations of the token still in their grace period are completed, so only the latest can be rolled back.
+func (r *TokenRotator) switchToken(token *models.APIToken, encryptedValue, tokenHash string, rotation *models.TokenRotation, now time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 令牌在探测期间被其他操作修改时放弃切换
+	result, err := tx.Exec(`
+		UPDATE api_tokens
+		SET token_value = ?, token_hint = ?, token_hash = ?, is_active = 1, expires_at = NULL, updated_at = ?
+		WHERE id = ? AND token_value = ?
+	`, encryptedValue, rotation.NewTokenHint, tokenHash, now, token.ID, token.TokenValue)
+	if err != nil {
+		return fmt.Errorf("failed to update API token: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("API token %d was changed during rotation", token.ID)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE token_rotations SET status = ?, previous_token_value = '', new_token_value = ''
+		WHERE token_id = ? AND status = ?
+	`, TokenRotationCompleted, token.ID, TokenRotationRotated)
+	if err != nil {
+		return fmt.Errorf("failed to complete earlier rotations: %w", err)
+	}
+
+	if err := r.insertRotation(tx, rotation); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit token rotation: %w", err)
+	}
+	return nil
+}
+
+// insertRotation records a rotation and sets its ID
+func (r *TokenRotator) insertRotation(exec interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, rotation *models.TokenRotation) error {
+	result, err := exec.Exec(`
+		INSERT INTO token_rotations (
+			token_id, token_name, previous_token_value, previous_token_hint, previous_expires_at,
+			new_token_hint, new_token_value, customer_id, account_check, status, message, grace_until, rotated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, rotation.TokenID, rotation.TokenName, rotation.PreviousTokenValue, rotation.PreviousTokenHint, rotation.PreviousExpiresAt,
+		rotation.NewTokenHint, rotation.NewTokenValue, rotation.CustomerID, rotation.AccountCheck, rotation.Status, rotation.Message,
+		rotation.GraceUntil, rotation.RotatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record token rotation: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get token rotation ID: %w", err)
+	}
+	rotation.ID = int(id)
+	return nil
+}
+
+// Rollback restores the previous token of a rotation that is still in its grace period
+func (r *TokenRotator) Rollback(rotationID int, now time.Time) (*models.TokenRotation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now = now.UTC()
+	rotation, err := r.getRotation(rotationID)
+	if err != nil {
+		return nil, err
+	}
+	if rotation == nil {
+		return nil, NewValidationError(ErrCodeInvalidParameter, fmt.Sprintf("Token rotation %d not found", rotationID))
+	}
+	if !canRollback(rotation, now) {
+		return nil, NewValidationError(ErrCodeInvalidParameter,
+			fmt.Sprintf("Token rotation %d can no longer be rolled back", rotationID))
+	}
+
+	tokenCipher, err := r.tokenVault.Cipher()
+	if err != nil {
+		return nil, NewAuthError(ErrCodeInvalidToken, err.Error())
+	}
+	previousToken, err := tokenCipher.Decrypt(rotation.PreviousTokenValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt previous token: %w", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 轮换后令牌又被替换时，不能用旧令牌覆盖
+	result, err := tx.Exec(`
+		UPDATE api_tokens
+		SET token_value = ?, token_hint = ?, token_hash = ?, expires_at = ?, is_active = 1, updated_at = ?
+		WHERE id = ? AND token_value = ?
+	`, rotation.PreviousTokenValue, rotation.PreviousTokenHint, tokenCipher.Hash(previousToken), rotation.PreviousExpiresAt, now,
+		rotation.TokenID, rotation.NewTokenValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore API token: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, NewValidationError(ErrCodeInvalidParameter,
+			fmt.Sprintf("API token %d was changed after rotation %d", rotation.TokenID, rotationID))
+	}
+
+	_, err = tx.Exec(`
+		UPDATE token_rotations SET status = ?, previous_token_value = '', new_token_value = '', rolled_back_at = ?
+		WHERE id = ?
+	`, TokenRotationRolledBack, now, rotationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record token rollback: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit token rollback: %w", err)
+	}
+	// 回滚后的新令牌不再使用，取消脱敏注册
+	r.tokenVault.ForgetToken(rotation.NewTokenValue)
+
+	rotation.Status = TokenRotationRolledBack
+	rotation.PreviousTokenValue = ""
+	rotation.NewTokenValue = ""
+	rotation.RolledBackAt = &now
+	rotation.CanRollback = false
+	return rotation, nil
+}
+
+// canRollback reports whether the previous token of rotation can still be restored
+func canRollback(rotation *models.TokenRotation, now time.Time) bool {
+	return rotation.Status == TokenRotationRotated && rotation.PreviousTokenValue != "" && rotation.NewTokenValue != "" &&
+		rotation.GraceUntil != nil && now.Before(*rotation.GraceUntil)
+}
+
+// Expire completes rotations whose grace period has ended, discarding their previous tokens
+func (r *TokenRotator) Expire(now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.expire(now.UTC())
+}
+
+// expire completes rotations past their grace period; the caller holds r.mu
+func (r *TokenRotator) expire(now time.Time) (int, error) {
+	result, err := r.db.Exec(`
+		UPDATE token_rotations SET status = ?, previous_token_value = '', new_token_value = ''
+		WHERE status = ? AND grace_until <= ?
+	`, TokenRotationCompleted, TokenRotationRotated, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire token rotations: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return int(rowsAffected), nil
+}
+
+// Forget discards the previous tokens kept for rollback of a deleted token
+func (r *TokenRotator) Forget(tokenID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err := r.db.Exec(`
+		UPDATE token_rotations SET status = ?, previous_token_value = '', new_token_value = ''
+		WHERE token_id = ? AND status = ?
+	`, TokenRotationCompleted, tokenID, TokenRotationRotated)
+	if err != nil {
+		return fmt.Errorf("failed to discard previous tokens: %w", err)
+	}
+	return nil
+}
+
+// GetRotations returns the most recent rotations, newest first
+func (r *TokenRotator) GetRotations(limit int, now time.Time) ([]models.TokenRotation, error) {
+	now = now.UTC()
+	rows, err := r.db.Query(`
+		SELECT `+tokenRotationSelectColumns+`
+		FROM token_rotations
+		ORDER BY rotated_at DESC, id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query token rotations: %w", err)
+	}
+	defer rows.Close()
+
+	rotations := make([]models.TokenRotation, 0)
+	for rows.Next() {
+		rotation, err := scanTokenRotation(rows)
+		if err != nil {
+			return nil, err
+		}
+		rotation.CanRollback = canRollback(rotation, now)
+		rotations = append(rotations, *rotation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating token rotations: %w", err)
+	}
+	return rotations, nil
+}
+
+// getRotation returns a rotation by ID, or nil if it does not exist
+func (r *TokenRotator) getRotation(id int) (*models.TokenRotation, error) {
+	row := r.db.QueryRow("SELECT "+tokenRotationSelectColumns+" FROM token_rotations WHERE id = ?", id)
+	rotation, err := scanTokenRotation(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rotation, err
+}
+
+// scanTokenRotation scans a token_rotations row
+func scanTokenRotation(scanner interface{ Scan(...interface{}) error }) (*models.TokenRotation, error) {
+	var rotation models.TokenRotation
+	err := scanner.Scan(&rotation.ID, &rotation.TokenID, &rotation.TokenName, &rotation.PreviousTokenValue,
+		&rotation.PreviousTokenHint, &rotation.PreviousExpiresAt, &rotation.NewTokenHint, &rotation.NewTokenValue, &rotation.CustomerID,
+		&rotation.AccountCheck, &rotation.Status, &rotation.Message, &rotation.GraceUntil, &rotation.RotatedAt,
+		&rotation.RolledBackAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan token rotation: %w", err)
+	}
+	return &rotation, nil
+}
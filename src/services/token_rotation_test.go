@@ -0,0 +1,317 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"glm-usage-monitor/models"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Token values of the rotation tests; the new and the replacing token share their masked hint
+const (
+	rotationPreviousToken  = "previous0000000000000000.token-aaaa"
+	rotationNewToken       = "abcd1111111111111111111.token-zzzz"
+	rotationReplacingToken = "abcd2222222222222222222.token-zzzz"
+)
+
+// newRotationTestVault opens a key file vault over a database holding token 1, which was
+// rotated from rotationPreviousToken to rotationNewToken within the grace period
+func newRotationTestVault(t *testing.T, now time.Time) (*sql.DB, *TokenVault, *TokenRotator, *models.TokenRotation) {
+	t.Helper()
+
+	t.Setenv(TokenKeyFileEnv, filepath.Join(t.TempDir(), "token.key"))
+	db := newTokenVaultTestDB(t)
+	vault := NewTokenVault(db, NewDatabaseService(db))
+	if err := vault.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	c, _ := vault.Cipher()
+
+	previousValue, _ := c.Encrypt(rotationPreviousToken)
+	newValue, _ := c.Encrypt(rotationNewToken)
+	_, err := db.Exec("INSERT INTO api_tokens (id, token_name, token_value, token_hint) VALUES (1, 'main', ?, ?)",
+		newValue, models.MaskSecret(rotationNewToken))
+	if err != nil {
+		t.Fatalf("failed to insert token: %v", err)
+	}
+
+	graceUntil := now.Add(time.Hour)
+	rotation := &models.TokenRotation{
+		TokenID:            1,
+		TokenName:          "main",
+		PreviousTokenValue: previousValue,
+		PreviousTokenHint:  models.MaskSecret(rotationPreviousToken),
+		NewTokenHint:       models.MaskSecret(rotationNewToken),
+		NewTokenValue:      newValue,
+		Status:             TokenRotationRotated,
+		GraceUntil:         &graceUntil,
+		RotatedAt:          now.Add(-time.Hour),
+	}
+	rotator := NewTokenRotator(db, vault)
+	if err := rotator.insertRotation(db, rotation); err != nil {
+		t.Fatalf("insertRotation failed: %v", err)
+	}
+
+	return db, vault, rotator, rotation
+}
+
+// storedTokenValue returns the decrypted value of token 1
+func storedTokenValue(t *testing.T, db *sql.DB, vault *TokenVault) string {
+	t.Helper()
+
+	var value string
+	if err := db.QueryRow("SELECT token_value FROM api_tokens WHERE id = 1").Scan(&value); err != nil {
+		t.Fatalf("failed to query token: %v", err)
+	}
+	c, _ := vault.Cipher()
+	plaintext, err := c.Decrypt(value)
+	if err != nil {
+		t.Fatalf("failed to decrypt token: %v", err)
+	}
+	return plaintext
+}
+
+func TestTokenRotationRollback(t *testing.T) {
+	now := time.Date(2025, 11, 1, 8, 0, 0, 0, time.UTC)
+	db, vault, rotator, rotation := newRotationTestVault(t, now)
+
+	rolledBack, err := rotator.Rollback(rotation.ID, now)
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if rolledBack.Status != TokenRotationRolledBack || rolledBack.CanRollback {
+		t.Errorf("unexpected rolled back rotation: %+v", rolledBack)
+	}
+	if value := storedTokenValue(t, db, vault); value != rotationPreviousToken {
+		t.Errorf("expected the previous token to be restored, got %s", value)
+	}
+
+	var previousValue, newValue string
+	db.QueryRow("SELECT previous_token_value, new_token_value FROM token_rotations WHERE id = ?", rotation.ID).
+		Scan(&previousValue, &newValue)
+	if previousValue != "" || newValue != "" {
+		t.Errorf("expected the rotation token values to be cleared, got %q %q", previousValue, newValue)
+	}
+}
+
+func TestTokenRotationRollbackRefusesReplacedTokenWithSameHint(t *testing.T) {
+	now := time.Date(2025, 11, 1, 8, 0, 0, 0, time.UTC)
+	db, vault, rotator, rotation := newRotationTestVault(t, now)
+
+	// 轮换后令牌被替换为脱敏值相同的另一个令牌
+	if models.MaskSecret(rotationReplacingToken) != rotation.NewTokenHint {
+		t.Fatalf("test tokens must share their hint")
+	}
+	c, _ := vault.Cipher()
+	replacingValue, _ := c.Encrypt(rotationReplacingToken)
+	if _, err := db.Exec("UPDATE api_tokens SET token_value = ? WHERE id = 1", replacingValue); err != nil {
+		t.Fatalf("failed to replace token: %v", err)
+	}
+
+	if _, err := rotator.Rollback(rotation.ID, now); err == nil {
+		t.Fatalf("expected rollback of a replaced token to fail")
+	}
+	if value := storedTokenValue(t, db, vault); value != rotationReplacingToken {
+		t.Errorf("expected the replacing token to be kept, got %s", value)
+	}
+}
+
+func TestTokenRotationRollbackAfterPassphraseChange(t *testing.T) {
+	now := time.Date(2025, 11, 1, 8, 0, 0, 0, time.UTC)
+	db, vault, rotator, rotation := newRotationTestVault(t, now)
+
+	// 重新加密后两处新令牌密文仍须一致
+	if err := vault.SetPassphrase("correct horse battery staple"); err != nil {
+		t.Fatalf("SetPassphrase failed: %v", err)
+	}
+
+	if _, err := rotator.Rollback(rotation.ID, now); err != nil {
+		t.Fatalf("Rollback after passphrase change failed: %v", err)
+	}
+	if value := storedTokenValue(t, db, vault); value != rotationPreviousToken {
+		t.Errorf("expected the previous token to be restored, got %s", value)
+	}
+}
+
+// rotationBillingAccount is how the fake billing API answers one token: its HTTP status, the
+// status of probe syncs and the account of the returned bills ("" for no bills)
+type rotationBillingAccount struct {
+	status      int
+	probeStatus int
+	customerID  string
+}
+
+// newRotationBillingServer serves the billing API for the given tokens
+func newRotationBillingServer(t *testing.T, accounts map[string]rotationBillingAccount) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		account, ok := accounts[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		status := account.status
+		// 探测同步按页获取，验证请求只取一条
+		if r.URL.Query().Get("pageSize") != "1" && account.probeStatus != 0 {
+			status = account.probeStatus
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		resp := BillingResponse{Code: 200}
+		if account.customerID != "" {
+			resp.Data.BillList = []BillItem{{BillingNo: account.customerID + "1730419200000"}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTokenRotationRotate(t *testing.T) {
+	// 验证失败不重试，避免测试等待退避
+	retryConfig := DefaultRetryConfig
+	DefaultRetryConfig = RetryConfig{MaxRetries: 0, Backoff: 1}
+	t.Cleanup(func() { DefaultRetryConfig = retryConfig })
+
+	now := time.Date(2025, 11, 1, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		newAccount    rotationBillingAccount
+		storedAccount string // 已保存账单的账号，空表示没有账单
+		force         bool
+		replaced      bool // 探测期间令牌被其他操作修改
+		wantStatus    string
+		wantCheck     string
+		wantErr       string
+	}{
+		{
+			name:          "matched",
+			newAccount:    rotationBillingAccount{status: http.StatusOK, customerID: "cust1"},
+			storedAccount: "cust1",
+			wantStatus:    TokenRotationRotated,
+			wantCheck:     AccountCheckMatched,
+		},
+		{
+			name:       "validation failure",
+			newAccount: rotationBillingAccount{status: http.StatusUnauthorized},
+			wantStatus: TokenRotationFailed,
+			wantErr:    "validation failed",
+		},
+		{
+			name:       "probe error",
+			newAccount: rotationBillingAccount{status: http.StatusOK, probeStatus: http.StatusInternalServerError},
+			wantStatus: TokenRotationFailed,
+			wantErr:    "probe sync",
+		},
+		{
+			name:          "account mismatch",
+			newAccount:    rotationBillingAccount{status: http.StatusOK, customerID: "cust2"},
+			storedAccount: "cust1",
+			wantStatus:    TokenRotationFailed,
+			wantErr:       "different account",
+		},
+		{
+			name:       "unverified without force",
+			newAccount: rotationBillingAccount{status: http.StatusOK},
+			wantStatus: TokenRotationFailed,
+			wantCheck:  AccountCheckUnverified,
+			wantErr:    "could not be verified",
+		},
+		{
+			name:       "unverified with force",
+			newAccount: rotationBillingAccount{status: http.StatusOK},
+			force:      true,
+			wantStatus: TokenRotationRotated,
+			wantCheck:  AccountCheckUnverified,
+		},
+		{
+			name:          "token changed during rotation",
+			newAccount:    rotationBillingAccount{status: http.StatusOK, customerID: "cust1"},
+			storedAccount: "cust1",
+			replaced:      true,
+			wantErr:       "changed during rotation",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(TokenKeyFileEnv, filepath.Join(t.TempDir(), "token.key"))
+			db := newTokenVaultTestDB(t)
+			vault := NewTokenVault(db, NewDatabaseService(db))
+			if err := vault.Open(); err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			c, _ := vault.Cipher()
+
+			_, err := db.Exec(`CREATE TABLE expense_bills (
+				id INTEGER PRIMARY KEY AUTOINCREMENT, account_id INTEGER, billing_no TEXT, transaction_time DATETIME)`)
+			if err != nil {
+				t.Fatalf("failed to create expense_bills table: %v", err)
+			}
+			if tt.storedAccount != "" {
+				_, err := db.Exec("INSERT INTO expense_bills (account_id, billing_no, transaction_time) VALUES (1, ?, ?)",
+					tt.storedAccount+"1727740800000", now.AddDate(0, -1, 0))
+				if err != nil {
+					t.Fatalf("failed to insert bill: %v", err)
+				}
+			}
+
+			previousValue, _ := c.Encrypt(rotationPreviousToken)
+			if _, err := db.Exec("INSERT INTO api_tokens (id, token_name, token_value) VALUES (1, 'main', ?)", previousValue); err != nil {
+				t.Fatalf("failed to insert token: %v", err)
+			}
+			if tt.replaced {
+				replacingValue, _ := c.Encrypt(rotationReplacingToken)
+				if _, err := db.Exec("UPDATE api_tokens SET token_value = ? WHERE id = 1", replacingValue); err != nil {
+					t.Fatalf("failed to replace token: %v", err)
+				}
+			}
+
+			server := newRotationBillingServer(t, map[string]rotationBillingAccount{
+				rotationPreviousToken: {status: http.StatusOK},
+				rotationNewToken:      tt.newAccount,
+			})
+			rotator := NewTokenRotator(db, vault)
+			rotator.baseURL = server.URL
+
+			token := &models.APIToken{ID: 1, TokenName: "main", TokenValue: previousValue}
+			rotation, err := rotator.Rotate(token, rotationNewToken, tt.force, now)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Rotate failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+
+			if tt.wantStatus != "" && (rotation == nil || rotation.Status != tt.wantStatus || rotation.AccountCheck != tt.wantCheck) {
+				t.Fatalf("expected a %s rotation with check %q, got %+v", tt.wantStatus, tt.wantCheck, rotation)
+			}
+
+			var recorded int
+			db.QueryRow("SELECT COUNT(*) FROM token_rotations WHERE status = ?", tt.wantStatus).Scan(&recorded)
+			if tt.wantStatus != "" && recorded != 1 {
+				t.Errorf("expected the %s rotation to be recorded, got %d", tt.wantStatus, recorded)
+			}
+
+			wantToken := rotationPreviousToken
+			switch {
+			case tt.replaced:
+				wantToken = rotationReplacingToken
+			case tt.wantStatus == TokenRotationRotated:
+				wantToken = rotationNewToken
+			}
+			if value := storedTokenValue(t, db, vault); value != wantToken {
+				t.Errorf("expected stored token %s, got %s", wantToken, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"fmt"
+	"glm-usage-monitor/models"
+	"sort"
+	"strings"
+)
+
+// usageKeySeparator joins dimension values into a single grouping key
+const usageKeySeparator = "\x1f"
+
+// usageDimensionExpr returns the SQL expression of a usage query dimension
+func usageDimensionExpr(dimension string) (string, error) {
+	switch dimension {
+	case models.UsageDimensionModel:
+		return "COALESCE(model_name, '')", nil
+	case models.UsageDimensionChargeType:
+		return "COALESCE(charge_type, '')", nil
+	case models.UsageDimensionAPIKey:
+		return "COALESCE(api_key, '')", nil
+	case models.UsageDimensionGroup:
+		return "COALESCE(NULLIF(group_id, ''), NULLIF(group_name, ''), '')", nil
+	case models.UsageDimensionUseGroup:
+		return "COALESCE(NULLIF(use_group_id, ''), NULLIF(use_group_name, ''), '')", nil
+	case models.UsageDimensionProduct:
+		return "COALESCE(NULLIF(model_product_name, ''), NULLIF(model_product_code, ''), '')", nil
+	case models.UsageDimensionHour:
+		return reportingTimeExpr("%Y-%m-%d %H:00", "transaction_time"), nil
+	case models.UsageDimensionDay:
+		return reportingDateExpr("transaction_time"), nil
+	case models.UsageDimensionWeek:
+		// 以周一为一周的开始
+		return fmt.Sprintf("DATE(transaction_time, %s, '-6 days', 'weekday 1')", models.ReportingOffsetExpr("transaction_time")), nil
+	case models.UsageDimensionMonth:
+		return reportingTimeExpr("%Y-%m", "transaction_time"), nil
+	case models.UsageDimensionWeekday:
+		return reportingTimeExpr("%w", "transaction_time"), nil
+	case models.UsageDimensionHourOfDay:
+		return reportingTimeExpr("%H", "transaction_time"), nil
+	case models.UsageDimensionAccount:
+		return "COALESCE((SELECT token_name FROM api_tokens WHERE api_tokens.id = expense_bills.account_id), '')", nil
+	default:
+		return "", fmt.Errorf("invalid dimension: %s", dimension)
+	}
+}
+
+// usageQueryWhere builds the WHERE clause of a usage query filter
+func (s *StatisticsService) usageQueryWhere(filter models.UsageQueryFilter) (string, []interface{}, error) {
+	whereClause := "1=1"
+	args := []interface{}{}
+
+	if filter.StartTime != nil {
+		whereClause += " AND datetime(transaction_time) >= ?"
+		args = append(args, filter.StartTime.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if filter.EndTime != nil {
+		whereClause += " AND datetime(transaction_time) < ?"
+		args = append(args, filter.EndTime.UTC().Format("2006-01-02 15:04:05"))
+	}
+
+	addIn := func(expr string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")
+		whereClause += fmt.Sprintf(" AND %s IN (%s)", expr, placeholders)
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+
+	groupExpr, _ := usageDimensionExpr(models.UsageDimensionGroup)
+	addIn("model_name", filter.ModelNames)
+	addIn("charge_type", filter.ChargeTypes)
+	addIn(groupExpr, filter.GroupIDs)
+
+	// API Key过滤支持原始值或key_id
+	if len(filter.APIKeys) > 0 {
+		apiKeys := make([]string, 0, len(filter.APIKeys))
+		for _, key := range filter.APIKeys {
+			apiKey, err := s.resolveAPIKey(key)
+			if err != nil {
+				return "", nil, err
+			}
+			apiKeys = append(apiKeys, apiKey)
+		}
+		addIn("api_key", apiKeys)
+	}
+
+	// 未归属账号的账单 account_id 为 NULL，按 0 过滤
+	if len(filter.AccountIDs) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(filter.AccountIDs)), ",")
+		whereClause += fmt.Sprintf(" AND COALESCE(account_id, 0) IN (%s)", placeholders)
+		for _, accountID := range filter.AccountIDs {
+			args = append(args, accountID)
+		}
+	}
+
+	return whereClause, args, nil
+}
+
+// QueryUsage aggregates expense bills by arbitrary dimensions and metrics.
+// Tokens are normalized (see models.NormalizeUsage); API keys are returned masked.
+func (s *StatisticsService) QueryUsage(query *models.UsageQuery) (*models.UsageQueryResult, error) {
+	if err := query.Normalize(); err != nil {
+		return nil, err
+	}
+
+	whereClause, args, err := s.usageQueryWhere(query.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// 维度拼接为单个分组键，便于与归一化后的token用量对应
+	keyExpr := "''"
+	if len(query.Dimensions) > 0 {
+		exprs := make([]string, 0, len(query.Dimensions))
+		for _, dimension := range query.Dimensions {
+			expr, err := usageDimensionExpr(dimension)
+			if err != nil {
+				return nil, err
+			}
+			exprs = append(exprs, fmt.Sprintf("COALESCE(CAST(%s AS TEXT), '')", expr))
+		}
+		keyExpr = strings.Join(exprs, " || char(31) || ")
+	}
+
+	sqlQuery := fmt.Sprintf(`
+		SELECT
+			%s as usage_key,
+			COUNT(*) as call_count,
+			COALESCE(SUM(cash_cost), 0) as cash_cost,
+			COALESCE(SUM(gift_deduct_amount), 0) as gift_deducted
+		FROM expense_bills
+		WHERE %s
+		GROUP BY usage_key
+	`, keyExpr, whereClause)
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	type usageGroup struct {
+		key          string
+		calls        float64
+		cost         float64
+		giftDeducted float64
+	}
+
+	var groups []usageGroup
+	for rows.Next() {
+		var g usageGroup
+		if err := rows.Scan(&g.key, &g.calls, &g.cost, &g.giftDeducted); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate usage: %w", err)
+	}
+
+	var usage map[string]models.NormalizedUsage
+	if usageQueryNeedsTokens(query.Metrics) {
+		usage, err = s.normalizedUsageBy(keyExpr, whereClause, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &models.UsageQueryResult{
+		Columns: make([]models.UsageQueryColumn, 0, len(query.Dimensions)+len(query.Metrics)),
+		Rows:    make([]models.UsageQueryRow, 0, len(groups)),
+	}
+	for _, dimension := range query.Dimensions {
+		result.Columns = append(result.Columns, models.UsageQueryColumn{
+			Key:   dimension,
+			Label: models.UsageDimensionLabels[dimension],
+			Type:  "dimension",
+		})
+	}
+	for _, metric := range query.Metrics {
+		result.Columns = append(result.Columns, models.UsageQueryColumn{
+			Key:   metric,
+			Label: models.UsageMetricLabels[metric],
+			Type:  "metric",
+		})
+	}
+
+	for _, g := range groups {
+		row := models.UsageQueryRow{
+			Dimensions: make(map[string]string, len(query.Dimensions)),
+			Metrics:    make(map[string]float64, len(query.Metrics)),
+		}
+
+		if len(query.Dimensions) > 0 {
+			values := strings.Split(g.key, usageKeySeparator)
+			for i, dimension := range query.Dimensions {
+				value := ""
+				if i < len(values) {
+					value = values[i]
+				}
+				// API Key不直接返回，使用脱敏后的值
+				if dimension == models.UsageDimensionAPIKey {
+					value = models.MaskSecret(value)
+				}
+				row.Dimensions[dimension] = value
+			}
+		}
+
+		for _, metric := range query.Metrics {
+			switch metric {
+			case models.UsageMetricCalls:
+				row.Metrics[metric] = g.calls
+			case models.UsageMetricTokens:
+				row.Metrics[metric] = usage[g.key].TotalTokens
+			case models.UsageMetricInputTokens:
+				row.Metrics[metric] = usage[g.key].InputTokens
+			case models.UsageMetricOutputTokens:
+				row.Metrics[metric] = usage[g.key].OutputTokens
+			case models.UsageMetricCost:
+				row.Metrics[metric] = g.cost
+			case models.UsageMetricGiftDeducted:
+				row.Metrics[metric] = g.giftDeducted
+			}
+		}
+
+		result.Rows = append(result.Rows, row)
+	}
+
+	sortUsageRows(result.Rows, query)
+
+	if query.Limit > 0 && len(result.Rows) > query.Limit {
+		result.Rows = result.Rows[:query.Limit]
+	}
+
+	return result, nil
+}
+
+// usageQueryNeedsTokens reports whether any token metric was requested
+func usageQueryNeedsTokens(metrics []string) bool {
+	for _, metric := range metrics {
+		switch metric {
+		case models.UsageMetricTokens, models.UsageMetricInputTokens, models.UsageMetricOutputTokens:
+			return true
+		}
+	}
+	return false
+}
+
+// sortUsageRows orders rows by the requested column. Without one, rows are ordered by the first
+// time dimension ascending, or else by the first metric descending.
+func sortUsageRows(rows []models.UsageQueryRow, query *models.UsageQuery) {
+	orderBy := query.OrderBy
+	descending := query.Descending
+	if orderBy == "" {
+		for _, dimension := range query.Dimensions {
+			if models.IsTimeDimension(dimension) {
+				orderBy = dimension
+				break
+			}
+		}
+		if orderBy == "" && len(query.Metrics) > 0 {
+			orderBy = query.Metrics[0]
+			descending = true
+		}
+	}
+	if orderBy == "" {
+		return
+	}
+
+	_, isMetric := models.UsageMetricLabels[orderBy]
+	sort.SliceStable(rows, func(i, j int) bool {
+		if isMetric {
+			a, b := rows[i].Metrics[orderBy], rows[j].Metrics[orderBy]
+			if a != b {
+				if descending {
+					return a > b
+				}
+				return a < b
+			}
+		} else {
+			a, b := rows[i].Dimensions[orderBy], rows[j].Dimensions[orderBy]
+			if a != b {
+				if descending {
+					return a > b
+				}
+				return a < b
+			}
+		}
+
+		// 排序值相同时按维度值排序，保证结果稳定
+		for _, dimension := range query.Dimensions {
+			a, b := rows[i].Dimensions[dimension], rows[j].Dimensions[dimension]
+			if a != b {
+				return a < b
+			}
+		}
+		return false
+	})
+}
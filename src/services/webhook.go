@@ -0,0 +1,203 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"glm-usage-monitor/models"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webhookRateLimitCodes are platform error codes meaning "too many requests", which are retried
+var webhookRateLimitCodes = map[string]map[int]bool{
+	ChannelTypeFeishu:   {9499: true, 11232: true},
+	ChannelTypeDingTalk: {130101: true},
+	ChannelTypeWeCom:    {45009: true},
+}
+
+// sendWebhook posts the notification to a webhook channel and validates the response
+func (d *ChannelDispatcher) sendWebhook(channel models.NotificationChannel, notification Notification) (int, string, error) {
+	req, err := buildWebhookRequest(channel, notification, d.now())
+	if err != nil {
+		return 0, "", &deliveryError{err: err}
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", &deliveryError{retryable: true, err: fmt.Errorf("failed to send webhook: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err := checkWebhookResponse(channel.ChannelType, resp.StatusCode, body); err != nil {
+		return resp.StatusCode, string(body), err
+	}
+
+	return resp.StatusCode, string(body), nil
+}
+
+// buildWebhookRequest builds the platform-specific, optionally signed webhook request
+func buildWebhookRequest(channel models.NotificationChannel, notification Notification, now time.Time) (*http.Request, error) {
+	title := notification.Title
+	message := notification.Message
+	targetURL := channel.URL
+	headers := map[string]string{}
+
+	var payload interface{}
+	switch channel.ChannelType {
+	case ChannelTypeFeishu:
+		body := map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": fmt.Sprintf("【%s】\n%s", title, message)},
+		}
+		// 飞书加签：时间戳（秒）与签名放在消息体中
+		if channel.Secret != "" {
+			timestamp := now.Unix()
+			sign, err := signFeishu(channel.Secret, timestamp)
+			if err != nil {
+				return nil, err
+			}
+			body["timestamp"] = strconv.FormatInt(timestamp, 10)
+			body["sign"] = sign
+		}
+		payload = body
+	case ChannelTypeDingTalk:
+		payload = map[string]interface{}{
+			"msgtype": "markdown",
+			"markdown": map[string]string{
+				"title": title,
+				"text":  fmt.Sprintf("### %s\n\n%s", title, message),
+			},
+		}
+		// 钉钉加签：时间戳（毫秒）与签名放在URL参数中
+		if channel.Secret != "" {
+			timestamp := now.UnixMilli()
+			separator := "?"
+			if strings.Contains(targetURL, "?") {
+				separator = "&"
+			}
+			targetURL += fmt.Sprintf("%stimestamp=%d&sign=%s", separator, timestamp,
+				url.QueryEscape(signDingTalk(channel.Secret, timestamp)))
+		}
+	case ChannelTypeWeCom:
+		payload = map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"content": fmt.Sprintf("**%s**\n%s", title, message)},
+		}
+	case ChannelTypeSlack:
+		payload = map[string]string{"text": fmt.Sprintf("*%s*\n%s", title, message)}
+	case ChannelTypeGeneric:
+		payload = map[string]interface{}{
+			"id":         notification.ID,
+			"level":      notification.Type.String(),
+			"category":   notificationCategory(notification),
+			"title":      title,
+			"message":    message,
+			"data":       notification.Data,
+			"created_at": notification.CreatedAt,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported webhook type: %s", channel.ChannelType)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	// 通用Webhook使用HMAC-SHA256签名整个请求体
+	if channel.ChannelType == ChannelTypeGeneric && channel.Secret != "" {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		headers["X-Webhook-Timestamp"] = timestamp
+		headers["X-Webhook-Signature"] = "sha256=" + signGeneric(channel.Secret, timestamp, body)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	return req, nil
+}
+
+// signFeishu computes the Feishu custom bot signature: HMAC-SHA256 keyed by "timestamp\nsecret"
+// over an empty message, base64 encoded
+func signFeishu(secret string, timestamp int64) (string, error) {
+	stringToSign := fmt.Sprintf("%d\n%s", timestamp, secret)
+	h := hmac.New(sha256.New, []byte(stringToSign))
+	if _, err := h.Write([]byte{}); err != nil {
+		return "", fmt.Errorf("failed to sign feishu webhook: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// signDingTalk computes the DingTalk robot signature: HMAC-SHA256 keyed by the secret over
+// "timestamp\nsecret", base64 encoded
+func signDingTalk(secret string, timestamp int64) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(fmt.Sprintf("%d\n%s", timestamp, secret)))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// signGeneric computes the generic webhook signature: hex HMAC-SHA256 over "timestamp.body"
+func signGeneric(secret, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp + "."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checkWebhookResponse validates the HTTP status and the platform error code in the response body
+func checkWebhookResponse(channelType string, statusCode int, body []byte) error {
+	if statusCode < 200 || statusCode >= 300 {
+		return &deliveryError{
+			retryable: statusCode == http.StatusTooManyRequests || statusCode >= 500,
+			err:       fmt.Errorf("webhook returned HTTP %d", statusCode),
+		}
+	}
+
+	var codeField string
+	switch channelType {
+	case ChannelTypeFeishu:
+		codeField = "code"
+	case ChannelTypeDingTalk, ChannelTypeWeCom:
+		codeField = "errcode"
+	default:
+		return nil
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil
+	}
+	// 飞书旧版接口返回StatusCode
+	code, ok := result[codeField].(float64)
+	if !ok {
+		code, ok = result["StatusCode"].(float64)
+	}
+	if !ok || code == 0 {
+		return nil
+	}
+
+	message, _ := result["msg"].(string)
+	if message == "" {
+		message, _ = result["errmsg"].(string)
+	}
+	return &deliveryError{
+		retryable: webhookRateLimitCodes[channelType][int(code)],
+		err:       fmt.Errorf("webhook returned error %d: %s", int(code), message),
+	}
+}
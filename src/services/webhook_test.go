@@ -0,0 +1,329 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"glm-usage-monitor/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookTestTime is the fixed clock of the test dispatcher
+var webhookTestTime = time.Date(2025, 11, 1, 8, 0, 0, 0, time.UTC)
+
+// newTestChannelDispatcher creates a dispatcher over an in-memory delivery log, with a fixed
+// clock and a negligible retry backoff
+func newTestChannelDispatcher(t *testing.T) *ChannelDispatcher {
+	t.Helper()
+
+	db := newTestDB(t, notificationDeliveriesTestSchema)
+	d := NewChannelDispatcher(NewDatabaseService(db))
+	d.baseBackoff = time.Millisecond
+	d.maxBackoff = time.Millisecond
+	d.now = func() time.Time { return webhookTestTime }
+	return d
+}
+
+// webhookRecorder is a fake webhook endpoint replying with the queued responses in order,
+// repeating the last one, and recording every request
+type webhookRecorder struct {
+	mu        sync.Mutex
+	responses []webhookResponse
+	requests  []*http.Request
+	bodies    [][]byte
+}
+
+type webhookResponse struct {
+	status int
+	body   string
+}
+
+func newWebhookServer(t *testing.T, responses ...webhookResponse) (*httptest.Server, *webhookRecorder) {
+	t.Helper()
+
+	recorder := &webhookRecorder{responses: responses}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		recorder.mu.Lock()
+		index := len(recorder.requests)
+		recorder.requests = append(recorder.requests, r)
+		recorder.bodies = append(recorder.bodies, body)
+		recorder.mu.Unlock()
+
+		response := webhookResponse{status: http.StatusOK, body: `{}`}
+		if len(recorder.responses) > 0 {
+			if index >= len(recorder.responses) {
+				index = len(recorder.responses) - 1
+			}
+			response = recorder.responses[index]
+		}
+		w.WriteHeader(response.status)
+		io.WriteString(w, response.body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, recorder
+}
+
+// testWebhookNotification is a budget warning routed to the test channels
+func testWebhookNotification() Notification {
+	return Notification{
+		ID:        7,
+		Type:      NotificationTypeWarning,
+		Title:     "预算提醒",
+		Message:   "本月支出已达到预算的80%",
+		Data:      map[string]interface{}{"type": "budget_threshold", "percent": 80},
+		CreatedAt: webhookTestTime,
+	}
+}
+
+func TestWebhookPayloadPerPlatform(t *testing.T) {
+	cases := []struct {
+		channelType string
+		expected    string
+	}{
+		{ChannelTypeFeishu, `{"content":{"text":"【预算提醒】\n本月支出已达到预算的80%"},"msg_type":"text"}`},
+		{ChannelTypeDingTalk, `{"markdown":{"text":"### 预算提醒\n\n本月支出已达到预算的80%","title":"预算提醒"},"msgtype":"markdown"}`},
+		{ChannelTypeWeCom, `{"markdown":{"content":"**预算提醒**\n本月支出已达到预算的80%"},"msgtype":"markdown"}`},
+		{ChannelTypeSlack, `{"text":"*预算提醒*\n本月支出已达到预算的80%"}`},
+		{ChannelTypeGeneric, `{"category":"budget_threshold","created_at":"2025-11-01T08:00:00Z","data":{"percent":80,"type":"budget_threshold"},"id":7,"level":"warning","message":"本月支出已达到预算的80%","title":"预算提醒"}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.channelType, func(t *testing.T) {
+			server, recorder := newWebhookServer(t)
+			d := newTestChannelDispatcher(t)
+			channel := models.NotificationChannel{ID: 1, Name: tc.channelType, ChannelType: tc.channelType, URL: server.URL}
+
+			delivery := d.Deliver(channel, testWebhookNotification())
+			if delivery.Status != DeliveryStatusSuccess {
+				t.Fatalf("expected success, got %+v", delivery)
+			}
+			if len(recorder.requests) != 1 {
+				t.Fatalf("expected 1 request, got %d", len(recorder.requests))
+			}
+			if contentType := recorder.requests[0].Header.Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+				t.Errorf("unexpected content type: %s", contentType)
+			}
+
+			// 重新编码以忽略字段顺序
+			var payload interface{}
+			if err := json.Unmarshal(recorder.bodies[0], &payload); err != nil {
+				t.Fatalf("invalid JSON payload %q: %v", recorder.bodies[0], err)
+			}
+			normalized, _ := json.Marshal(payload)
+			var expected interface{}
+			json.Unmarshal([]byte(tc.expected), &expected)
+			expectedNormalized, _ := json.Marshal(expected)
+			if string(normalized) != string(expectedNormalized) {
+				t.Errorf("unexpected payload:\n got  %s\n want %s", normalized, expectedNormalized)
+			}
+		})
+	}
+}
+
+func TestWebhookFeishuSignature(t *testing.T) {
+	server, recorder := newWebhookServer(t, webhookResponse{http.StatusOK, `{"code":0,"msg":"success"}`})
+	d := newTestChannelDispatcher(t)
+	channel := models.NotificationChannel{ID: 1, Name: "feishu", ChannelType: ChannelTypeFeishu, URL: server.URL, Secret: testSecretValue}
+
+	if delivery := d.Deliver(channel, testWebhookNotification()); delivery.Status != DeliveryStatusSuccess {
+		t.Fatalf("expected success, got %+v", delivery)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(recorder.bodies[0], &payload); err != nil {
+		t.Fatalf("invalid JSON payload: %v", err)
+	}
+	// 飞书：以"时间戳(秒)\n密钥"为HMAC密钥签名空消息
+	timestamp := strconv.FormatInt(webhookTestTime.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+testSecretValue))
+	expectedSign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	if payload["timestamp"] != timestamp {
+		t.Errorf("expected timestamp %s, got %v", timestamp, payload["timestamp"])
+	}
+	if payload["sign"] != expectedSign {
+		t.Errorf("expected sign %s, got %v", expectedSign, payload["sign"])
+	}
+	if query := recorder.requests[0].URL.RawQuery; query != "" {
+		t.Errorf("expected no query parameters, got %s", query)
+	}
+}
+
+func TestWebhookDingTalkSignature(t *testing.T) {
+	server, recorder := newWebhookServer(t, webhookResponse{http.StatusOK, `{"errcode":0,"errmsg":"ok"}`})
+	d := newTestChannelDispatcher(t)
+	channel := models.NotificationChannel{ID: 1, Name: "dingtalk", ChannelType: ChannelTypeDingTalk,
+		URL: server.URL + "/robot/send?access_token=abc", Secret: testSecretValue}
+
+	if delivery := d.Deliver(channel, testWebhookNotification()); delivery.Status != DeliveryStatusSuccess {
+		t.Fatalf("expected success, got %+v", delivery)
+	}
+
+	// 钉钉：以密钥签名"时间戳(毫秒)\n密钥"，放在URL参数中
+	timestamp := strconv.FormatInt(webhookTestTime.UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(testSecretValue))
+	mac.Write([]byte(timestamp + "\n" + testSecretValue))
+	expectedSign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	query := recorder.requests[0].URL.Query()
+	if query.Get("access_token") != "abc" {
+		t.Errorf("expected access_token to be kept, got %s", query.Encode())
+	}
+	if query.Get("timestamp") != timestamp {
+		t.Errorf("expected timestamp %s, got %s", timestamp, query.Get("timestamp"))
+	}
+	if query.Get("sign") != expectedSign {
+		t.Errorf("expected sign %s, got %s", expectedSign, query.Get("sign"))
+	}
+}
+
+func TestWebhookGenericSignature(t *testing.T) {
+	server, recorder := newWebhookServer(t)
+	d := newTestChannelDispatcher(t)
+	channel := models.NotificationChannel{ID: 1, Name: "generic", ChannelType: ChannelTypeGeneric, URL: server.URL, Secret: testSecretValue}
+
+	if delivery := d.Deliver(channel, testWebhookNotification()); delivery.Status != DeliveryStatusSuccess {
+		t.Fatalf("expected success, got %+v", delivery)
+	}
+
+	timestamp := strconv.FormatInt(webhookTestTime.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testSecretValue))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(recorder.bodies[0])
+	expectedSignature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	header := recorder.requests[0].Header
+	if header.Get("X-Webhook-Timestamp") != timestamp {
+		t.Errorf("expected timestamp header %s, got %s", timestamp, header.Get("X-Webhook-Timestamp"))
+	}
+	if header.Get("X-Webhook-Signature") != expectedSignature {
+		t.Errorf("expected signature %s, got %s", expectedSignature, header.Get("X-Webhook-Signature"))
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	cases := []struct {
+		name        string
+		channelType string
+		responses   []webhookResponse
+		attempts    int
+		status      string
+		statusCode  int
+	}{
+		{
+			name:        "retries 5xx until success",
+			channelType: ChannelTypeSlack,
+			responses:   []webhookResponse{{http.StatusBadGateway, "bad gateway"}, {http.StatusServiceUnavailable, "unavailable"}, {http.StatusOK, "ok"}},
+			attempts:    3,
+			status:      DeliveryStatusSuccess,
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "retries 429 until success",
+			channelType: ChannelTypeGeneric,
+			responses:   []webhookResponse{{http.StatusTooManyRequests, "slow down"}, {http.StatusOK, "ok"}},
+			attempts:    2,
+			status:      DeliveryStatusSuccess,
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "gives up after max retries",
+			channelType: ChannelTypeSlack,
+			responses:   []webhookResponse{{http.StatusInternalServerError, "boom"}},
+			attempts:    4,
+			status:      DeliveryStatusFailed,
+			statusCode:  http.StatusInternalServerError,
+		},
+		{
+			name:        "does not retry 4xx",
+			channelType: ChannelTypeSlack,
+			responses:   []webhookResponse{{http.StatusBadRequest, "invalid_payload"}, {http.StatusOK, "ok"}},
+			attempts:    1,
+			status:      DeliveryStatusFailed,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "does not retry platform error code",
+			channelType: ChannelTypeFeishu,
+			responses:   []webhookResponse{{http.StatusOK, `{"code":19021,"msg":"sign match fail or timestamp is not within one hour from current time"}`}, {http.StatusOK, `{"code":0}`}},
+			attempts:    1,
+			status:      DeliveryStatusFailed,
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "retries platform rate limit code",
+			channelType: ChannelTypeDingTalk,
+			responses:   []webhookResponse{{http.StatusOK, `{"errcode":130101,"errmsg":"send too fast"}`}, {http.StatusOK, `{"errcode":0,"errmsg":"ok"}`}},
+			attempts:    2,
+			status:      DeliveryStatusSuccess,
+			statusCode:  http.StatusOK,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, recorder := newWebhookServer(t, tc.responses...)
+			d := newTestChannelDispatcher(t)
+			channel := models.NotificationChannel{ID: 1, Name: tc.channelType, ChannelType: tc.channelType, URL: server.URL, MaxRetries: 3}
+
+			delivery := d.Deliver(channel, testWebhookNotification())
+			if delivery.Attempts != tc.attempts || len(recorder.requests) != tc.attempts {
+				t.Errorf("expected %d attempts, got %d (%d requests)", tc.attempts, delivery.Attempts, len(recorder.requests))
+			}
+			if delivery.Status != tc.status || delivery.StatusCode != tc.statusCode {
+				t.Errorf("expected %s with HTTP %d, got %s with HTTP %d: %s",
+					tc.status, tc.statusCode, delivery.Status, delivery.StatusCode, delivery.ErrorMessage)
+			}
+			if tc.status == DeliveryStatusFailed && delivery.ErrorMessage == "" {
+				t.Errorf("expected an error message on failure")
+			}
+		})
+	}
+}
+
+func TestWebhookDeliveryLog(t *testing.T) {
+	longBody := fmt.Sprintf(`{"code":19001,"msg":"param invalid: %0600d"}`, 0)
+	server, _ := newWebhookServer(t, webhookResponse{http.StatusOK, longBody})
+	d := newTestChannelDispatcher(t)
+	channel := models.NotificationChannel{ID: 3, Name: "运维群", ChannelType: ChannelTypeFeishu, URL: server.URL, MaxRetries: 2}
+
+	d.Deliver(channel, testWebhookNotification())
+
+	deliveries, err := d.dbService.GetNotificationDeliveries(3, 10)
+	if err != nil {
+		t.Fatalf("GetNotificationDeliveries failed: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("expected 1 delivery row, got %d", len(deliveries))
+	}
+
+	delivery := deliveries[0]
+	if delivery.ChannelID != 3 || delivery.ChannelName != "运维群" || delivery.NotificationType != "warning" || delivery.Title != "预算提醒" {
+		t.Errorf("unexpected delivery identity: %+v", delivery)
+	}
+	if delivery.Status != DeliveryStatusFailed || delivery.Attempts != 1 || delivery.StatusCode != http.StatusOK {
+		t.Errorf("unexpected delivery outcome: %+v", delivery)
+	}
+	if delivery.ErrorMessage == "" || len(delivery.ResponseBody) != maxDeliveryResponseLength {
+		t.Errorf("expected error message and truncated response body, got %q (%d bytes)", delivery.ErrorMessage, len(delivery.ResponseBody))
+	}
+	if !delivery.CreatedAt.Equal(webhookTestTime) || delivery.CompletedAt == nil || !delivery.CompletedAt.Equal(webhookTestTime) {
+		t.Errorf("unexpected delivery times: %v %v", delivery.CreatedAt, delivery.CompletedAt)
+	}
+
+	if other, err := d.dbService.GetNotificationDeliveries(4, 10); err != nil || len(other) != 0 {
+		t.Errorf("expected no deliveries of another channel, got %d (%v)", len(other), err)
+	}
+}
@@ -5,24 +5,29 @@ import (
 	"fmt"
 	"glm-usage-monitor/models"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"sync"
 	"time"
 )
 
+// DefaultZhipuBaseURL is the base URL of the Zhipu billing API
+const DefaultZhipuBaseURL = "https://bigmodel.cn/api/finance/expenseBill"
+
 // ZhipuAPIService provides integration with Zhipu AI API
 type ZhipuAPIService struct {
 	baseURL      string
 	httpClient   *http.Client
 	apiToken     string
+	storedToken  string // 数据库中的加密令牌，用于判断是否为同一令牌
 	errorHandler ErrorHandler
 }
 
 // NewZhipuAPIService creates a new Zhipu API service
 func NewZhipuAPIService(apiToken string) *ZhipuAPIService {
 	return &ZhipuAPIService{
-		baseURL: "https://bigmodel.cn/api/finance/expenseBill",
+		baseURL: DefaultZhipuBaseURL,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -31,6 +36,21 @@ func NewZhipuAPIService(apiToken string) *ZhipuAPIService {
 	}
 }
 
+// NewZhipuAPIServiceForToken creates a Zhipu API service from an encrypted stored token.
+// This is the only place stored tokens are decrypted.
+func NewZhipuAPIServiceForToken(storedToken string, tokenCipher *TokenCipher) (*ZhipuAPIService, error) {
+	apiToken, err := tokenCipher.Decrypt(storedToken)
+	if err != nil {
+		return nil, err
+	}
+	// 令牌明文只在内存中使用，注册后任何日志或错误中出现都会被脱敏
+	DefaultRedactor().AddSecret(apiToken)
+
+	service := NewZhipuAPIService(apiToken)
+	service.storedToken = storedToken
+	return service, nil
+}
+
 // BillingRequest represents request parameters for billing API
 type BillingRequest struct {
 	BillingMonth string `json:"billingMonth"`
@@ -74,6 +94,81 @@ type BillItem struct {
 	ChargeUnitSymbol string  `json:"chargeUnitSymbol"`
 	TrialCashCost    float64 `json:"trialCashCost"`
 	TimeWindow       string  `json:"timeWindow"`
+
+	// 账单明细字段
+	BillingDate       string     `json:"billingDate"`
+	BillingTime       string     `json:"billingTime"`
+	CustomerID        flexString `json:"customerId"`
+	OrderNo           string     `json:"orderNo"`
+	OriginalAmount    float64    `json:"originalAmount"`
+	OriginalCostPrice float64    `json:"originalCostPrice"`
+	DiscountType      string     `json:"discountType"`
+	CreditPayAmount   float64    `json:"creditPayAmount"`
+	ThirdParty        float64    `json:"thirdParty"`
+	CashAmount        float64    `json:"cashAmount"`
+	APIUsage          float64    `json:"apiUsage"`
+
+	// 模型信息
+	APIKey              string `json:"apiKey"` // 产生该笔消费的API Key，入库后仅以脱敏形式返回前端
+	ModelCode           string `json:"modelCode"`
+	ModelProductType    string `json:"modelProductType"`
+	ModelProductSubtype string `json:"modelProductSubtype"`
+	ModelProductCode    string `json:"modelProductCode"`
+	ModelProductName    string `json:"modelProductName"`
+
+	// 支付、成本和用量
+	PaymentType string     `json:"paymentType"`
+	StartTime   string     `json:"startTime"`
+	EndTime     string     `json:"endTime"`
+	BusinessID  flexString `json:"businessId"`
+	CostPrice   float64    `json:"costPrice"`
+	CostUnit    string     `json:"costUnit"`
+	UsageCount  float64    `json:"usageCount"`
+	UsageExempt float64    `json:"usageExempt"`
+	UsageUnit   string     `json:"usageUnit"`
+	Currency    string     `json:"currency"`
+
+	// 金额
+	SettlementAmount float64 `json:"settlementAmount"`
+	GiftDeductAmount float64 `json:"giftDeductAmount"`
+	DueAmount        float64 `json:"dueAmount"`
+	PaidAmount       float64 `json:"paidAmount"`
+	UnpaidAmount     float64 `json:"unpaidAmount"`
+	BillingStatus    string  `json:"billingStatus"`
+	InvoicingAmount  float64 `json:"invoicingAmount"`
+	InvoicedAmount   float64 `json:"invoicedAmount"`
+
+	// 资源包（Token套餐）抵扣
+	TokenAccountID    flexString `json:"tokenAccountId"`
+	TokenResourceNo   string     `json:"tokenResourceNo"`
+	TokenResourceName string     `json:"tokenResourceName"`
+	DeductUsage       float64    `json:"deductUsage"`
+	DeductAfter       flexString `json:"deductAfter"`
+	TokenType         string     `json:"tokenType"`
+}
+
+// flexString decodes identifiers the API returns either as a JSON string or as a number
+type flexString string
+
+// UnmarshalJSON accepts a JSON string, number or null
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*f = ""
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*f = flexString(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("failed to decode %s as string or number: %w", data, err)
+	}
+	*f = flexString(n.String())
+	return nil
 }
 
 // SyncProgress represents sync progress information
@@ -95,6 +190,7 @@ type SyncResult struct {
 	SkippedItems   int                  `json:"skipped_items"`
 	Duration       time.Duration        `json:"duration"`
 	ErrorMessage   string               `json:"error_message,omitempty"`
+	ErrorCode      string               `json:"error_code,omitempty"` // 如 API_UNAUTHORIZED
 	ProcessedBills []models.ExpenseBill `json:"processed_bills,omitempty"`
 }
 
@@ -163,9 +259,15 @@ func (s *ZhipuAPIService) GetBillingData(request *BillingRequest) (*BillingRespo
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
+	// 401/403 表示令牌无效或已被撤销
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, NewAPIError(ErrCodeAPIUnauthorized, "API token rejected").
+			WithDetails(fmt.Sprintf("status %d: %s", resp.StatusCode, Redact(string(body))))
+	}
+
 	// Check HTTP status code
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, Redact(string(body)))
 	}
 
 	// Parse JSON response
@@ -175,6 +277,10 @@ func (s *ZhipuAPIService) GetBillingData(request *BillingRequest) (*BillingRespo
 	}
 
 	// Check API response code
+	if billingResp.Code == http.StatusUnauthorized {
+		return nil, NewAPIError(ErrCodeAPIUnauthorized, "API token rejected").
+			WithDetails(fmt.Sprintf("code %d: %s", billingResp.Code, billingResp.Message))
+	}
 	if billingResp.Code != 200 {
 		return nil, fmt.Errorf("API returned error code %d: %s", billingResp.Code, billingResp.Message)
 	}
@@ -262,6 +368,9 @@ func (s *ZhipuAPIService) SyncFullMonth(year, month int, progressCallback func(*
 	if err != nil {
 		result.Success = false
 		result.ErrorMessage = fmt.Sprintf("Failed to fetch first page: %v", err)
+		if isUnauthorizedError(err) {
+			result.ErrorCode = ErrCodeAPIUnauthorized
+		}
 		return result, nil
 	}
 
@@ -360,7 +469,12 @@ func (s *ZhipuAPIService) processMultiplePagesConcurrently(billingMonth string,
 			pageResults[pageRes.PageNum-1] = pageRes
 		case err := <-errorChan:
 			// Log error but continue processing other pages
-			fmt.Printf("Error processing page: %v\n", err)
+			log.Printf("Error processing page: %v", err)
+			if isUnauthorizedError(err) {
+				result.Success = false
+				result.ErrorCode = ErrCodeAPIUnauthorized
+				result.ErrorMessage = err.Error()
+			}
 		case <-time.After(60 * time.Second):
 			// Timeout handling
 			result.Success = false
@@ -500,19 +614,78 @@ func (s *ZhipuAPIService) SyncRecentMonths(months int, progressCallback func(mon
 	return results, nil
 }
 
-// BillItemToMap converts BillItem to map for transformation
+// BillItemToMap converts BillItem to the snake_case map expected by models.TransformExpenseBill
 func (s *ZhipuAPIService) BillItemToMap(item *BillItem) (map[string]interface{}, error) {
-	data, err := json.Marshal(item)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal bill item: %w", err)
-	}
-
-	var billMap map[string]interface{}
-	if err := json.Unmarshal(data, &billMap); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal to map: %w", err)
+	if item == nil {
+		return nil, fmt.Errorf("bill item is nil")
 	}
 
-	return billMap, nil
+	// API返回camelCase字段，转换函数按数据库列名（snake_case）读取
+	return map[string]interface{}{
+		"charge_name":        item.ChargeName,
+		"charge_type":        item.ChargeType,
+		"model_name":         item.ModelName,
+		"use_group_name":     item.UseGroupName,
+		"group_name":         item.GroupName,
+		"discount_rate":      item.DiscountRate,
+		"cost_rate":          item.CostRate,
+		"cash_cost":          item.CashCost,
+		"billing_no":         item.BillingNo,
+		"order_time":         item.OrderTime,
+		"use_group_id":       item.UseGroupID,
+		"group_id":           item.GroupID,
+		"charge_unit":        item.ChargeUnit,
+		"charge_count":       item.ChargeCount,
+		"charge_unit_symbol": item.ChargeUnitSymbol,
+		"trial_cash_cost":    item.TrialCashCost,
+		"time_window":        item.TimeWindow,
+
+		"billing_date":        item.BillingDate,
+		"billing_time":        item.BillingTime,
+		"customer_id":         string(item.CustomerID),
+		"order_no":            item.OrderNo,
+		"original_amount":     item.OriginalAmount,
+		"original_cost_price": item.OriginalCostPrice,
+		"discount_type":       item.DiscountType,
+		"credit_pay_amount":   item.CreditPayAmount,
+		"third_party":         item.ThirdParty,
+		"cash_amount":         item.CashAmount,
+		"api_usage":           item.APIUsage,
+
+		"api_key":               item.APIKey,
+		"model_code":            item.ModelCode,
+		"model_product_type":    item.ModelProductType,
+		"model_product_subtype": item.ModelProductSubtype,
+		"model_product_code":    item.ModelProductCode,
+		"model_product_name":    item.ModelProductName,
+
+		"payment_type": item.PaymentType,
+		"start_time":   item.StartTime,
+		"end_time":     item.EndTime,
+		"business_id":  string(item.BusinessID),
+		"cost_price":   item.CostPrice,
+		"cost_unit":    item.CostUnit,
+		"usage_count":  item.UsageCount,
+		"usage_exempt": item.UsageExempt,
+		"usage_unit":   item.UsageUnit,
+		"currency":     item.Currency,
+
+		"settlement_amount":  item.SettlementAmount,
+		"gift_deduct_amount": item.GiftDeductAmount,
+		"due_amount":         item.DueAmount,
+		"paid_amount":        item.PaidAmount,
+		"unpaid_amount":      item.UnpaidAmount,
+		"billing_status":     item.BillingStatus,
+		"invoicing_amount":   item.InvoicingAmount,
+		"invoiced_amount":    item.InvoicedAmount,
+
+		"token_account_id":    string(item.TokenAccountID),
+		"token_resource_no":   item.TokenResourceNo,
+		"token_resource_name": item.TokenResourceName,
+		"deduct_usage":        item.DeductUsage,
+		"deduct_after":        string(item.DeductAfter),
+		"token_type":          item.TokenType,
+	}, nil
 }
 
 // GetAPIToken returns current API token
@@ -520,6 +693,11 @@ func (s *ZhipuAPIService) GetAPIToken() string {
 	return s.apiToken
 }
 
+// StoredToken returns the encrypted stored token the service was created from
+func (s *ZhipuAPIService) StoredToken() string {
+	return s.storedToken
+}
+
 // SetAPIToken updates API token
 func (s *ZhipuAPIService) SetAPIToken(token string) {
 	s.apiToken = token
@@ -530,6 +708,11 @@ func (s *ZhipuAPIService) GetBaseURL() string {
 	return s.baseURL
 }
 
+// SetBaseURL updates base URL
+func (s *ZhipuAPIService) SetBaseURL(baseURL string) {
+	s.baseURL = baseURL
+}
+
 // EstimateSyncTime estimates time required for syncing
 func (s *ZhipuAPIService) EstimateSyncTime(months int) time.Duration {
 	// Rough estimation: 30 seconds per month